@@ -0,0 +1,104 @@
+package assert
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// GoldenDir is the directory of the golden files, relative to the
+// directory of the package under test.
+var GoldenDir = "testdata"
+
+// UpdateGolden rewrites the golden files with the obtained values instead
+// of comparing them, it is set by the "-update" flag:
+//
+//     go test ./menus/ -update
+//
+var UpdateGolden = flag.Bool("update", false, "update the golden files")
+
+// GoldenFile returns the path of a golden file.
+func GoldenFile(name string) string {
+	return filepath.Join(GoldenDir, name)
+}
+
+// ReadGolden reads a golden file.
+func ReadGolden(name string) ([]byte, error) {
+	return ioutil.ReadFile(GoldenFile(name))
+}
+
+// WriteGolden writes a golden file, the directory is created if it isn't exists.
+func WriteGolden(name string, data []byte) error {
+	filename := GoldenFile(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Golden verifies that the obtained bytes are equal to the golden file,
+// the golden file is rewritten if the "-update" flag is set.
+func Golden(t *testing.T, name string, obtained []byte) bool {
+	if *UpdateGolden {
+		if err := WriteGolden(name, obtained); err != nil {
+			t.Error(err)
+			return false
+		}
+		return true
+	}
+
+	expected, err := ReadGolden(name)
+	if err != nil {
+		t.Error(err, "- run the test with -update to create it")
+		return false
+	}
+	if !bytes.Equal(obtained, expected) {
+		t.Errorf("%s isn't matched:\nobtained = %s\nexpected = %s", GoldenFile(name), obtained, expected)
+		return false
+	}
+	return true
+}
+
+// GoldenJSON verifies that the obtained value is equal to the JSON in the
+// golden file like JSONEqualsIgnoring, the golden file is rewritten with
+// the indented JSON if the "-update" flag is set.
+func GoldenJSON(t *testing.T, name string, obtained interface{}, ignores ...string) bool {
+	if *UpdateGolden {
+		value, err := toJSONValue(obtained)
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		bs, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+		if err := WriteGolden(name, append(bs, '\n')); err != nil {
+			t.Error(err)
+			return false
+		}
+		return true
+	}
+
+	expected, err := ReadGolden(name)
+	if err != nil {
+		t.Error(err, "- run the test with -update to create it")
+		return false
+	}
+	diff, err := JSONDiff(obtained, json.RawMessage(expected), ignores...)
+	if err != nil {
+		t.Error(GoldenFile(name), err)
+		return false
+	}
+	if len(diff) != 0 {
+		d := &jsonDiffer{lines: diff}
+		t.Errorf("%s isn't matched:\n%s", GoldenFile(name), d.String())
+		return false
+	}
+	return true
+}
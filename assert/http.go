@@ -0,0 +1,185 @@
+package assert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+)
+
+// HTTPResponse is the expected response of the HTTPMatches checker.
+type HTTPResponse struct {
+	// Status is the expected status code, it isn't checked if it is zero.
+	Status int
+
+	// Header is the expected headers, only the headers in it are checked.
+	Header map[string]string
+
+	// Body is the expected JSON body, it isn't checked if it is nil.
+	Body interface{}
+
+	// Golden is the name of the golden file in GoldenDir which contains the
+	// expected JSON body, it is rewritten if the "-update" flag is set.
+	Golden string
+
+	// Ignores is the paths skipped when the body is compared, see JSONEqualsIgnoring.
+	Ignores []string
+}
+
+// -----------------------------------------------------------------------
+// HTTPMatches checker.
+
+type httpMatchesChecker struct {
+	*CheckerInfo
+}
+
+// The HTTPMatches checker verifies that the response recorded by a
+// *httptest.ResponseRecorder (or a *http.Response) has the status, the
+// headers and the JSON body of the expected HTTPResponse.
+//
+// For example:
+//
+//     w := Record(srv, NewJSONRequest("GET", "/menus/", nil))
+//     c.Assert(w, HTTPMatches, HTTPResponse{
+//         Status:  http.StatusOK,
+//         Header:  map[string]string{"Content-Type": "application/json; charset=utf-8"},
+//         Golden:  "menus.json",
+//         Ignores: []string{"**.id"},
+//     })
+//
+var HTTPMatches Checker = &httpMatchesChecker{
+	&CheckerInfo{Name: "HTTPMatches", Params: []string{"response", "expected"}},
+}
+
+func (checker *httpMatchesChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	var expected HTTPResponse
+	switch v := params[1].(type) {
+	case HTTPResponse:
+		expected = v
+	case *HTTPResponse:
+		expected = *v
+	default:
+		return false, "expected value must be a HTTPResponse"
+	}
+
+	var status int
+	var header http.Header
+	var body []byte
+	switch v := params[0].(type) {
+	case *httptest.ResponseRecorder:
+		status, header, body = v.Code, v.Header(), v.Body.Bytes()
+	case *http.Response:
+		bs, err := ioutil.ReadAll(v.Body)
+		v.Body.Close()
+		if err != nil {
+			return false, "read body fail - " + err.Error()
+		}
+		v.Body = ioutil.NopCloser(bytes.NewReader(bs))
+		status, header, body = v.StatusCode, v.Header, bs
+	default:
+		return false, "response must be a *httptest.ResponseRecorder or a *http.Response"
+	}
+	params[0] = formatResponse(status, header, body)
+
+	var errs []string
+	if expected.Status != 0 && status != expected.Status {
+		errs = append(errs, fmt.Sprintf("status is %d, expected %d", status, expected.Status))
+	}
+	for _, key := range sortedKeys(expected.Header) {
+		if actual := header.Get(key); actual != expected.Header[key] {
+			errs = append(errs, fmt.Sprintf("header '%s' is %q, expected %q", key, actual, expected.Header[key]))
+		}
+	}
+
+	if expected.Golden != "" {
+		if *UpdateGolden {
+			if err := writeGoldenJSON(expected.Golden, body); err != nil {
+				errs = append(errs, err.Error())
+			}
+			return len(errs) == 0, strings.Join(errs, "\n")
+		}
+		bs, err := ReadGolden(expected.Golden)
+		if err != nil {
+			errs = append(errs, err.Error()+" - run the test with -update to create it")
+			return false, strings.Join(errs, "\n")
+		}
+		expected.Body = json.RawMessage(bs)
+	}
+	if expected.Body != nil {
+		diff, err := JSONDiff(json.RawMessage(body), expected.Body, expected.Ignores...)
+		if err != nil {
+			errs = append(errs, "body isn't a valid json - "+err.Error())
+		} else if len(diff) != 0 {
+			d := &jsonDiffer{lines: diff}
+			errs = append(errs, "body isn't matched:\n"+d.String())
+		}
+	}
+	return len(errs) == 0, strings.Join(errs, "\n")
+}
+
+func writeGoldenJSON(name string, body []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return fmt.Errorf("body isn't a valid json - %v", err)
+	}
+	buf.WriteByte('\n')
+	return WriteGolden(name, buf.Bytes())
+}
+
+func formatResponse(status int, header http.Header, body []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d %s\n", status, http.StatusText(status))
+	header.Write(&sb)
+	sb.WriteString("\n")
+	sb.Write(body)
+	return sb.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewJSONRequest creates a request for the handler tests, the body is
+// sent as it is if it is a string, a []byte or an io.Reader, otherwise it
+// is marshaled to JSON.
+func NewJSONRequest(method, target string, body interface{}) *http.Request {
+	var r io.Reader
+	switch v := body.(type) {
+	case nil:
+	case string:
+		r = strings.NewReader(v)
+	case []byte:
+		r = bytes.NewReader(v)
+	case io.Reader:
+		r = v
+	default:
+		bs, err := json.Marshal(body)
+		if err != nil {
+			panic(err)
+		}
+		r = bytes.NewReader(bs)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+// Record serves the request with the handler and returns the recorded response.
+func Record(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,288 @@
+package assert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MAX_DIFF_LINES is the maximum number of differences reported by the JSON checkers.
+const MAX_DIFF_LINES = 50
+
+// -----------------------------------------------------------------------
+// JSONEquals checker.
+
+type jsonEqualsChecker struct {
+	*CheckerInfo
+	ignores [][]string
+}
+
+// The JSONEquals checker verifies that the obtained value is equal to the
+// expected value after both are converted to JSON.  A string, []byte or
+// json.RawMessage is taken as a JSON document, any other value is
+// marshaled with encoding/json.  On failure every difference is reported
+// with its path, such as "$.children[2].title".
+//
+// For example:
+//
+//     c.Assert(body, JSONEquals, `{"uid":"nm.home","title":"运维主页"}`)
+//     c.Assert(menuList, JSONEquals, expectedMenuList)
+//
+var JSONEquals Checker = &jsonEqualsChecker{
+	CheckerInfo: &CheckerInfo{Name: "JSONEquals", Params: []string{"obtained", "expected"}},
+}
+
+// JSONEqualsIgnoring returns a JSONEquals checker which skips the fields
+// matched by the given paths.  A path is a list of object keys or array
+// indexes separated by '.', "*" matches any single key or index and "**"
+// matches any number of them.
+//
+// For example:
+//
+//     c.Assert(body, JSONEqualsIgnoring("id", "children.*.updated_at", "**.created_at"), expected)
+//
+func JSONEqualsIgnoring(paths ...string) Checker {
+	ignores := make([][]string, 0, len(paths))
+	for _, p := range paths {
+		ignores = append(ignores, strings.Split(strings.TrimPrefix(p, "$."), "."))
+	}
+	return &jsonEqualsChecker{
+		CheckerInfo: &CheckerInfo{Name: "JSONEqualsIgnoring(" + strings.Join(paths, ", ") + ")", Params: []string{"obtained", "expected"}},
+		ignores:     ignores,
+	}
+}
+
+func (checker *jsonEqualsChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	obtained, err := toJSONValue(params[0])
+	if err != nil {
+		return false, "obtained value isn't a valid json - " + err.Error()
+	}
+	expected, err := toJSONValue(params[1])
+	if err != nil {
+		return false, "expected value isn't a valid json - " + err.Error()
+	}
+
+	d := &jsonDiffer{ignores: checker.ignores}
+	d.diff(nil, obtained, expected)
+	if len(d.lines) == 0 {
+		return true, ""
+	}
+	params[0], params[1] = formatJSON(obtained), formatJSON(expected)
+	return false, d.String()
+}
+
+// JSONDiff returns the differences between two values after both are
+// converted to JSON, the ignores are paths like those of JSONEqualsIgnoring.
+func JSONDiff(obtained, expected interface{}, ignores ...string) ([]string, error) {
+	a, err := toJSONValue(obtained)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toJSONValue(expected)
+	if err != nil {
+		return nil, err
+	}
+	d := &jsonDiffer{}
+	for _, p := range ignores {
+		d.ignores = append(d.ignores, strings.Split(strings.TrimPrefix(p, "$."), "."))
+	}
+	d.diff(nil, a, b)
+	return d.lines, nil
+}
+
+func toJSONValue(value interface{}) (interface{}, error) {
+	var bs []byte
+	switch v := value.(type) {
+	case string:
+		bs = []byte(v)
+	case []byte:
+		bs = v
+	case json.RawMessage:
+		bs = v
+	default:
+		var err error
+		bs, err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func formatJSON(value interface{}) string {
+	bs, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(bs)
+}
+
+func compactJSON(value interface{}) string {
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(bs)
+}
+
+type jsonDiffer struct {
+	ignores [][]string
+	lines   []string
+}
+
+func (d *jsonDiffer) String() string {
+	if len(d.lines) > MAX_DIFF_LINES {
+		return strings.Join(d.lines[:MAX_DIFF_LINES], "\n") +
+			"\n... and " + strconv.Itoa(len(d.lines)-MAX_DIFF_LINES) + " more differences"
+	}
+	return strings.Join(d.lines, "\n")
+}
+
+func (d *jsonDiffer) add(path []string, format string, args ...interface{}) {
+	d.lines = append(d.lines, formatPath(path)+": "+fmt.Sprintf(format, args...))
+}
+
+func formatPath(path []string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, p := range path {
+		if strings.HasPrefix(p, "[") {
+			sb.WriteString(p)
+		} else {
+			sb.WriteString(".")
+			sb.WriteString(p)
+		}
+	}
+	return sb.String()
+}
+
+func (d *jsonDiffer) isIgnored(path []string) bool {
+	for _, pattern := range d.ignores {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if pattern[0] != "*" && pattern[0] != strings.TrimSuffix(strings.TrimPrefix(path[0], "["), "]") {
+		return false
+	}
+	return matchPath(pattern[1:], path[1:])
+}
+
+func (d *jsonDiffer) diff(path []string, obtained, expected interface{}) {
+	if d.isIgnored(path) {
+		return
+	}
+
+	switch b := expected.(type) {
+	case map[string]interface{}:
+		a, ok := obtained.(map[string]interface{})
+		if !ok {
+			d.add(path, "obtained %s, expected an object", compactJSON(obtained))
+			return
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			sub := append(path[:len(path):len(path)], k)
+			av, aok := a[k]
+			bv, bok := b[k]
+			switch {
+			case !aok:
+				if !d.isIgnored(sub) {
+					d.add(sub, "missing, expected %s", compactJSON(bv))
+				}
+			case !bok:
+				if !d.isIgnored(sub) {
+					d.add(sub, "unexpected %s", compactJSON(av))
+				}
+			default:
+				d.diff(sub, av, bv)
+			}
+		}
+	case []interface{}:
+		a, ok := obtained.([]interface{})
+		if !ok {
+			d.add(path, "obtained %s, expected an array", compactJSON(obtained))
+			return
+		}
+		if len(a) != len(b) {
+			d.add(path, "length is %d, expected %d", len(a), len(b))
+		}
+		for i := 0; i < len(a) || i < len(b); i++ {
+			sub := append(path[:len(path):len(path)], "["+strconv.Itoa(i)+"]")
+			switch {
+			case i >= len(a):
+				if !d.isIgnored(sub) {
+					d.add(sub, "missing, expected %s", compactJSON(b[i]))
+				}
+			case i >= len(b):
+				if !d.isIgnored(sub) {
+					d.add(sub, "unexpected %s", compactJSON(a[i]))
+				}
+			default:
+				d.diff(sub, a[i], b[i])
+			}
+		}
+	case json.Number:
+		a, ok := obtained.(json.Number)
+		if !ok || !isSameNumber(a, b) {
+			d.add(path, "obtained %s, expected %s", compactJSON(obtained), b)
+		}
+	default:
+		if !reflect.DeepEqual(obtained, expected) {
+			d.add(path, "obtained %s, expected %s", compactJSON(obtained), compactJSON(expected))
+		}
+	}
+}
+
+func isSameNumber(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+	if ai, err := a.Int64(); err == nil {
+		if bi, err := b.Int64(); err == nil {
+			return ai == bi
+		}
+	}
+	af, err1 := a.Float64()
+	bf, err2 := b.Float64()
+	return err1 == nil && err2 == nil && af == bf
+}
@@ -0,0 +1,159 @@
+package assert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func check(checker Checker, obtained, expected interface{}) (bool, string) {
+	info := checker.Info()
+	return checker.Check([]interface{}{obtained, expected}, append([]string{}, info.Params...))
+}
+
+func TestJSONEquals(t *testing.T) {
+	type menu struct {
+		UID      string `json:"uid"`
+		Title    string `json:"title"`
+		Children []menu `json:"children,omitempty"`
+	}
+	value := []menu{{UID: "nm.home", Title: "运维主页", Children: []menu{{UID: "a", Title: "A"}}}}
+
+	Check(t, value, JSONEquals, `[{"title":"运维主页","uid":"nm.home","children":[{"uid":"a","title":"A"}]}]`)
+	Check(t, `{"a":1, "b":[1.0, 2]}`, JSONEquals, []byte(`{"b":[1,2.0],"a":1.0}`))
+
+	ok, msg := check(JSONEquals, value, `[{"uid":"nm.home","title":"主页","children":[{"uid":"a","title":"A"},{"uid":"b"}],"icon":"fa-home"}]`)
+	if ok {
+		t.Error("excepted fail")
+	}
+	for _, s := range []string{
+		`$[0].children: length is 1, expected 2`,
+		`$[0].children[1]: missing, expected {"uid":"b"}`,
+		`$[0].icon: missing, expected "fa-home"`,
+		`$[0].title: obtained "运维主页", expected "主页"`,
+	} {
+		if !strings.Contains(msg, s) {
+			t.Error("'"+s+"' isn't found in", msg)
+		}
+	}
+
+	if ok, msg := check(JSONEquals, `{"a":`, `{}`); ok || !strings.Contains(msg, "obtained value isn't a valid json") {
+		t.Error(ok, msg)
+	}
+
+	ignoring := JSONEqualsIgnoring("id", "items.*.created_at", "**.updated_at")
+	Check(t, `{"id":1,"items":[{"x":1,"created_at":"a","updated_at":"b"}],"a":{"updated_at":"c"}}`,
+		ignoring, `{"id":2,"items":[{"x":1,"created_at":"c"}],"a":{}}`)
+	if ok, _ := check(ignoring, `{"items":[{"x":1}]}`, `{"items":[{"x":2}]}`); ok {
+		t.Error("excepted fail")
+	}
+
+	diff, err := JSONDiff(map[string]interface{}{"a": 1, "b": "c"}, `{"a":2,"c":null}`, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excepted := []string{`$.a: obtained 1, expected 2`, `$.c: missing, expected null`}; !reflect.DeepEqual(diff, excepted) {
+		t.Error(diff)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	oldDir, oldUpdate := GoldenDir, *UpdateGolden
+	defer func() {
+		GoldenDir, *UpdateGolden = oldDir, oldUpdate
+	}()
+	GoldenDir = tmp
+
+	*UpdateGolden = true
+	value := map[string]interface{}{"id": 1, "name": "abc"}
+	Golden(t, "a.txt", []byte("abc"))
+	GoldenJSON(t, "sub/a.json", value)
+
+	*UpdateGolden = false
+	Golden(t, "a.txt", []byte("abc"))
+	GoldenJSON(t, "sub/a.json", `{"name":"abc","id":1}`)
+
+	bs, _ := ReadGolden("sub/a.json")
+	if s := string(bs); s != "{\n  \"id\": 1,\n  \"name\": \"abc\"\n}\n" {
+		t.Error(s)
+	}
+}
+
+func TestHTTPMatches(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	oldDir, oldUpdate := GoldenDir, *UpdateGolden
+	defer func() {
+		GoldenDir, *UpdateGolden = oldDir, oldUpdate
+	}()
+	GoldenDir = tmp
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var value map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value["method"] = r.Method
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(value)
+	})
+
+	for _, test := range []struct {
+		name     string
+		req      *http.Request
+		expected HTTPResponse
+		fail     string
+	}{
+		{name: "body",
+			req: NewJSONRequest("POST", "/", map[string]interface{}{"a": 1, "id": 2}),
+			expected: HTTPResponse{Status: http.StatusCreated,
+				Header:  map[string]string{"Content-Type": "application/json; charset=utf-8"},
+				Body:    `{"a":1,"method":"POST"}`,
+				Ignores: []string{"id"}}},
+		{name: "golden",
+			req:      NewJSONRequest("PUT", "/", `{"b":"c"}`),
+			expected: HTTPResponse{Status: http.StatusCreated, Golden: "put.json"}},
+		{name: "status",
+			req:      NewJSONRequest("PUT", "/", `{`),
+			expected: HTTPResponse{Status: http.StatusCreated},
+			fail:     "status is 400, expected 201"},
+		{name: "body fail",
+			req:      NewJSONRequest("PUT", "/", `{"b":"c"}`),
+			expected: HTTPResponse{Body: `{"b":"d","method":"PUT"}`},
+			fail:     `$.b: obtained "c", expected "d"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.expected.Golden != "" {
+				*UpdateGolden = true
+				Check(t, Record(handler, test.req), HTTPMatches, test.expected)
+				*UpdateGolden = false
+				test.req = NewJSONRequest(test.req.Method, "/", `{"b":"c"}`)
+			}
+
+			ok, msg := check(HTTPMatches, Record(handler, test.req), test.expected)
+			if test.fail == "" {
+				if !ok {
+					t.Error(msg)
+				}
+			} else if ok || !strings.Contains(msg, test.fail) {
+				t.Error(ok, msg)
+			}
+		})
+	}
+}
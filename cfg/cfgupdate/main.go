@@ -1,15 +1,53 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/three-plus-three/modules/cfg"
 )
 
+const usage = `usage:
+  cfgupdate -variables=updated.properties file...      用 updated.properties 中的值更新文件
+  cfgupdate set   [-section=name] file key=value...    修改或添加配置项，指定 section 时将它们移到该段中
+  cfgupdate unset file key...                          删除配置项
+  cfgupdate get   file key                             输出配置项的值，不存在时退出码为 2
+  cfgupdate diff  old_file new_file                    比较两个文件，有差异时退出码为 2
+  cfgupdate merge [-overwrite] [-dry-run] src dst      将 src 中的配置项添加到 dst 中，-overwrite 时覆盖已有的值
+  cfgupdate genkey  [-key=secret.key]                  生成密钥文件
+  cfgupdate encrypt [-key=secret.key] value            加密一个值，输出 ENC(...)
+  cfgupdate decrypt [-key=secret.key] ENC(...)         解密一个值
+  cfgupdate rotate  [-key=secret.key] file...          生成新的密钥，并用它重新加密文件中所有 ENC(...) 值`
+
+// errDifferent 表示命令执行成功，但结果为否，如 get 时配置项不存在，diff 时有差异
+var errDifferent = errors.New("different")
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			flagSet := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+			flagSet.Usage = func() {
+				fmt.Fprintln(os.Stderr, usage)
+			}
+			if err := cmd(flagSet, os.Args[2:]); err != nil {
+				if err == errDifferent {
+					os.Exit(2)
+				}
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var updated string
 	flag.StringVar(&updated, "variables", "", "")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+	}
 	flag.Parse()
 
 	args := flag.Args()
@@ -37,3 +75,263 @@ func main() {
 		}
 	}
 }
+
+var commands = map[string]func(flagSet *flag.FlagSet, args []string) error{
+	"set":     set,
+	"unset":   unset,
+	"get":     get,
+	"diff":    diff,
+	"merge":   merge,
+	"genkey":  withKey(genkey),
+	"encrypt": withKey(encrypt),
+	"decrypt": withKey(decrypt),
+	"rotate":  withKey(rotate),
+}
+
+func withKey(cb func(keyFile string, args []string) error) func(flagSet *flag.FlagSet, args []string) error {
+	return func(flagSet *flag.FlagSet, args []string) error {
+		keyFile := flagSet.String("key", "secret.key", "the secret key file")
+		flagSet.Parse(args) // nolint
+		return cb(*keyFile, flagSet.Args())
+	}
+}
+
+func set(flagSet *flag.FlagSet, args []string) error {
+	section := flagSet.String("section", "", "move keys to the section")
+	flagSet.Parse(args) // nolint
+	args = flagSet.Args()
+	if len(args) < 2 {
+		return fmt.Errorf("file or values is missing\r\n%s", usage)
+	}
+
+	doc, err := cfg.ReadDocument(args[0])
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("read file '%s' failed, %s", args[0], err)
+		}
+		doc, _ = cfg.ParseDocument(strings.NewReader(""))
+	}
+	for _, kv := range args[1:] {
+		ss := strings.SplitN(kv, "=", 2)
+		if len(ss) != 2 || ss[0] == "" {
+			return fmt.Errorf("'%s' is invalid, it must is key=value", kv)
+		}
+		doc.Set(ss[0], ss[1])
+		if *section != "" {
+			if err := doc.MoveToSection(ss[0], *section); err != nil {
+				return err
+			}
+		}
+	}
+	return doc.Save(args[0])
+}
+
+func unset(flagSet *flag.FlagSet, args []string) error {
+	flagSet.Parse(args) // nolint
+	args = flagSet.Args()
+	if len(args) < 2 {
+		return fmt.Errorf("file or keys is missing\r\n%s", usage)
+	}
+
+	doc, err := cfg.ReadDocument(args[0])
+	if err != nil {
+		return fmt.Errorf("read file '%s' failed, %s", args[0], err)
+	}
+	for _, key := range args[1:] {
+		doc.Delete(key)
+	}
+	return doc.Save(args[0])
+}
+
+func get(flagSet *flag.FlagSet, args []string) error {
+	flagSet.Parse(args) // nolint
+	args = flagSet.Args()
+	if len(args) != 2 {
+		return fmt.Errorf("file or key is missing\r\n%s", usage)
+	}
+
+	doc, err := cfg.ReadDocument(args[0])
+	if err != nil {
+		return fmt.Errorf("read file '%s' failed, %s", args[0], err)
+	}
+	value, ok := doc.Get(args[1])
+	if !ok {
+		return errDifferent
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func diff(flagSet *flag.FlagSet, args []string) error {
+	flagSet.Parse(args) // nolint
+	args = flagSet.Args()
+	if len(args) != 2 {
+		return fmt.Errorf("files is missing\r\n%s", usage)
+	}
+
+	var values []map[string]string
+	for _, nm := range args {
+		doc, err := cfg.ReadDocument(nm)
+		if err != nil {
+			return fmt.Errorf("read file '%s' failed, %s", nm, err)
+		}
+		values = append(values, doc.Values())
+	}
+
+	changes := cfg.Diff(values[0], values[1])
+	for _, change := range changes {
+		switch {
+		case change.Added:
+			fmt.Printf("+ %s=%s\n", change.Key, change.New)
+		case change.Deleted:
+			fmt.Printf("- %s=%s\n", change.Key, change.Old)
+		default:
+			fmt.Printf("~ %s=%s -> %s\n", change.Key, change.Old, change.New)
+		}
+	}
+	if len(changes) > 0 {
+		return errDifferent
+	}
+	return nil
+}
+
+func merge(flagSet *flag.FlagSet, args []string) error {
+	overwrite := flagSet.Bool("overwrite", false, "overwrite the existing values")
+	dryRun := flagSet.Bool("dry-run", false, "print changes only")
+	flagSet.Parse(args) // nolint
+	args = flagSet.Args()
+	if len(args) != 2 {
+		return fmt.Errorf("files is missing\r\n%s", usage)
+	}
+
+	src, err := cfg.ReadDocument(args[0])
+	if err != nil {
+		return fmt.Errorf("read file '%s' failed, %s", args[0], err)
+	}
+	dst, err := cfg.ReadDocument(args[1])
+	if err != nil {
+		return fmt.Errorf("read file '%s' failed, %s", args[1], err)
+	}
+
+	for _, key := range dst.Merge(src.Values(), *overwrite) {
+		value, _ := dst.Get(key)
+		fmt.Printf("%s=%s\n", key, value)
+	}
+	if *dryRun {
+		return nil
+	}
+	return dst.Save(args[1])
+}
+
+func genkey(keyFile string, args []string) error {
+	if _, err := os.Stat(keyFile); err == nil {
+		return fmt.Errorf("secret key file '%s' is already exists.", keyFile)
+	}
+	key, err := cfg.GenerateSecretKey()
+	if err != nil {
+		return err
+	}
+	return cfg.WriteSecretKey(keyFile, key)
+}
+
+func encrypt(keyFile string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("value is missing\r\n%s", usage)
+	}
+	key, err := cfg.ReadSecretKey(keyFile)
+	if err != nil {
+		return err
+	}
+	value, err := cfg.Encrypt(key, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func decrypt(keyFile string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("value is missing\r\n%s", usage)
+	}
+	key, err := cfg.ReadSecretKey(keyFile)
+	if err != nil {
+		return err
+	}
+	value, err := cfg.Decrypt(key, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
+
+// rotate 先检查所有的文件都能用旧密钥解密，并将新密钥写到 keyFile + ".new" 中，再重新加密
+// 文件，最后用它替换密钥文件，旧密钥被保存在 keyFile + ".old" 中
+func rotate(keyFile string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("files is missing\r\n%s", usage)
+	}
+	newKeyFile := keyFile + ".new"
+	if _, err := os.Stat(newKeyFile); err == nil {
+		return fmt.Errorf("'%s' is already exists, a previous rotation may be unfinished, "+
+			"the files re-encrypted by it use the key in it, please recover them and remove it first", newKeyFile)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	oldKey, err := cfg.ReadSecretKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	var errList []string
+	for _, nm := range args {
+		props, err := cfg.ReadProperties(nm)
+		if err != nil {
+			errList = append(errList, fmt.Sprintf("read file '%s' failed, %s", nm, err))
+			continue
+		}
+		for k, v := range props {
+			if _, err := cfg.Decrypt(oldKey, v); err != nil {
+				errList = append(errList, fmt.Sprintf("'%s' in the '%s' is invalid, %s", k, nm, err))
+			}
+		}
+	}
+	if len(errList) > 0 {
+		return fmt.Errorf("%s", strings.Join(errList, "\r\n"))
+	}
+
+	newKey, err := cfg.GenerateSecretKey()
+	if err != nil {
+		return err
+	}
+	if err := cfg.WriteSecretKey(newKeyFile, newKey); err != nil {
+		os.Remove(newKeyFile)
+		return err
+	}
+	if err := cfg.WriteSecretKey(keyFile+".old", oldKey); err != nil {
+		os.Remove(newKeyFile)
+		return err
+	}
+
+	var done []string
+	for _, nm := range args {
+		keys, err := cfg.ReencryptProperties(nm, oldKey, newKey)
+		if err != nil {
+			return fmt.Errorf("%s\r\nrotation is unfinished, the new key is kept in '%s' and the old key in '%s', "+
+				"the files %v are re-encrypted with the new key, the others still use the old key; "+
+				"to recover, fix the error and re-encrypt the remaining files with the new key, then rename '%s' to '%s'",
+				err, newKeyFile, keyFile, done, newKeyFile, keyFile)
+		}
+		done = append(done, nm)
+		for _, k := range keys {
+			fmt.Println(nm+":", k, "is re-encrypted")
+		}
+	}
+	if err := os.Rename(newKeyFile, keyFile); err != nil {
+		return fmt.Errorf("replace the secret key file failed, %s\r\nall files are re-encrypted with the new key in '%s', "+
+			"to recover, rename it to '%s'", err, newKeyFile, keyFile)
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package cfg
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Document 属性文件的文档模型，它保留注释、空行、顺序和转义，没有修改的行会原样写回。
+//
+// 形如 [name] 的行是一个段的开始，Read 会忽略它，段只用来组织配置项，
+// 第一个段之前的配置项属于名称为空的段
+type Document struct {
+	lines   []docLine
+	newline string
+	hasEOL  bool
+}
+
+type docLine struct {
+	text    string // 原始的文本
+	key     string // 不为空时是一个配置项
+	value   string
+	section string // 不为空时是一个段的开始
+}
+
+func (line *docLine) isComment() bool {
+	return strings.HasPrefix(strings.TrimSpace(line.text), "#")
+}
+
+func (line *docLine) isBlank() bool {
+	return strings.TrimSpace(line.text) == ""
+}
+
+func parseDocLine(txt string) docLine {
+	if key, value, ok := parseLine(txt); ok {
+		return docLine{text: txt, key: key, value: value}
+	}
+	if s := strings.TrimSpace(txt); len(s) > 2 && strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return docLine{text: txt, section: strings.TrimSpace(s[1 : len(s)-1])}
+	}
+	return docLine{text: txt}
+}
+
+// ParseDocument 解析属性文件
+func ParseDocument(r io.Reader) (*Document, error) {
+	var buf strings.Builder
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	txt := buf.String()
+
+	doc := &Document{newline: "\r\n"}
+	if idx := strings.Index(txt, "\n"); idx >= 0 && (idx == 0 || txt[idx-1] != '\r') {
+		doc.newline = "\n"
+	}
+	if txt == "" {
+		doc.hasEOL = true
+		return doc, nil
+	}
+	doc.hasEOL = strings.HasSuffix(txt, "\n")
+
+	scanner := bufio.NewScanner(strings.NewReader(txt))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(txt)+1)
+	for scanner.Scan() {
+		doc.lines = append(doc.lines, parseDocLine(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ReadDocument 读属性文件
+func ReadDocument(nm string) (*Document, error) {
+	f, err := os.Open(nm)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseDocument(f)
+}
+
+// WriteTo 输出文档
+func (doc *Document) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for idx, line := range doc.lines {
+		txt := line.text
+		if idx != len(doc.lines)-1 || doc.hasEOL {
+			txt += doc.newline
+		}
+		n, err := io.WriteString(w, txt)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// String 返回文档的内容
+func (doc *Document) String() string {
+	var buf strings.Builder
+	doc.WriteTo(&buf) // nolint
+	return buf.String()
+}
+
+// Save 保存文档，先写到一个临时文件再改名，这样文件不会只被写了一半
+func (doc *Document) Save(nm string) error {
+	mode := os.FileMode(0644)
+	if st, err := os.Stat(nm); err == nil {
+		mode = st.Mode()
+	}
+
+	out, err := os.OpenFile(nm+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := doc.WriteTo(out); err != nil {
+		out.Close()
+		os.Remove(nm + ".tmp")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(nm + ".tmp")
+		return err
+	}
+	return os.Rename(nm+".tmp", nm)
+}
+
+func (doc *Document) lastIndex(key string) int {
+	for idx := len(doc.lines) - 1; idx >= 0; idx-- {
+		if doc.lines[idx].key == key {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Keys 按出现的顺序返回所有的配置项
+func (doc *Document) Keys() []string {
+	var keys []string
+	exists := map[string]bool{}
+	for _, line := range doc.lines {
+		if line.key != "" && !exists[line.key] {
+			exists[line.key] = true
+			keys = append(keys, line.key)
+		}
+	}
+	return keys
+}
+
+// Values 返回所有的配置项，和 Read 不同的是值中的 ${var} 不会被替换
+func (doc *Document) Values() map[string]string {
+	values := map[string]string{}
+	for _, line := range doc.lines {
+		if line.key != "" {
+			values[line.key] = line.value
+		}
+	}
+	return values
+}
+
+// Get 读配置项，有多个同名的配置项时和 Read 一样返回最后一个
+func (doc *Document) Get(key string) (string, bool) {
+	if idx := doc.lastIndex(key); idx >= 0 {
+		return doc.lines[idx].value, true
+	}
+	return "", false
+}
+
+// Section 返回配置项所在的段
+func (doc *Document) Section(key string) (string, bool) {
+	section := ""
+	found := false
+	for _, line := range doc.lines {
+		if line.section != "" {
+			section = line.section
+		} else if line.key == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+	return section, true
+}
+
+// Sections 按出现的顺序返回所有的段，不包括名称为空的段
+func (doc *Document) Sections() []string {
+	var sections []string
+	for _, line := range doc.lines {
+		if line.section != "" {
+			sections = append(sections, line.section)
+		}
+	}
+	return sections
+}
+
+// Set 写配置项，它已存在时修改它，否则如果有被注释掉的同名配置项（如 # key=value）则替换它，
+// 否则将它添加到名称为空的段的最后
+func (doc *Document) Set(key, value string) {
+	if idx := doc.lastIndex(key); idx >= 0 {
+		doc.lines[idx] = newDocLine(indentOf(doc.lines[idx].text), key, value)
+		return
+	}
+
+	for idx := len(doc.lines) - 1; idx >= 0; idx-- {
+		if !doc.lines[idx].isComment() {
+			continue
+		}
+		txt := strings.TrimLeft(strings.TrimSpace(doc.lines[idx].text), "#")
+		if k, _, ok := parseLine(txt); ok && k == key {
+			doc.lines[idx] = newDocLine(indentOf(doc.lines[idx].text), key, value)
+			return
+		}
+	}
+
+	at, _ := doc.sectionEnd("")
+	doc.insert(at, newDocLine("", key, value))
+}
+
+// Delete 删除配置项，包括所有同名的配置项，配置项不存在时返回 false
+func (doc *Document) Delete(key string) bool {
+	found := false
+	lines := doc.lines[:0]
+	for _, line := range doc.lines {
+		if line.key == key {
+			found = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	doc.lines = lines
+	return found
+}
+
+// Rename 修改配置项的名称，位置和值不变
+func (doc *Document) Rename(oldKey, newKey string) error {
+	if doc.lastIndex(oldKey) < 0 {
+		return errors.New("'" + oldKey + "' is not found.")
+	}
+	if doc.lastIndex(newKey) >= 0 {
+		return errors.New("'" + newKey + "' is already exists.")
+	}
+	for idx := range doc.lines {
+		if doc.lines[idx].key == oldKey {
+			doc.lines[idx] = newDocLine(indentOf(doc.lines[idx].text), newKey, doc.lines[idx].value)
+		}
+	}
+	return nil
+}
+
+// MoveToSection 将配置项和它上面紧挨着的注释移到段 section 的最后，段不存在时在文件最后创建它，
+// section 为空时移到第一个段之前
+func (doc *Document) MoveToSection(key, section string) error {
+	idx := doc.lastIndex(key)
+	if idx < 0 {
+		return errors.New("'" + key + "' is not found.")
+	}
+	start := idx
+	for start > 0 && doc.lines[start-1].isComment() {
+		start--
+	}
+	moved := append([]docLine(nil), doc.lines[start:idx+1]...)
+	doc.lines = append(doc.lines[:start], doc.lines[idx+1:]...)
+
+	at, ok := doc.sectionEnd(section)
+	if !ok {
+		if n := len(doc.lines); n > 0 && !doc.lines[n-1].isBlank() {
+			doc.lines = append(doc.lines, docLine{})
+		}
+		doc.lines = append(doc.lines, docLine{text: "[" + section + "]", section: section})
+		at = len(doc.lines)
+	}
+	doc.insert(at, moved...)
+	return nil
+}
+
+// Merge 将 values 中的配置项添加到文档中，overwrite 为 false 时已存在的配置项不会被修改，返回被修改的配置项
+func (doc *Document) Merge(values map[string]string, overwrite bool) []string {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changed []string
+	for _, k := range keys {
+		if old, ok := doc.Get(k); ok && (!overwrite || old == values[k]) {
+			continue
+		}
+		doc.Set(k, values[k])
+		changed = append(changed, k)
+	}
+	return changed
+}
+
+// sectionEnd 返回在段 section 的最后插入的位置，它在段最后的空行之前
+func (doc *Document) sectionEnd(section string) (int, bool) {
+	start := 0
+	if section != "" {
+		start = -1
+		for idx, line := range doc.lines {
+			if line.section == section {
+				start = idx + 1
+				break
+			}
+		}
+		if start < 0 {
+			return 0, false
+		}
+	}
+
+	end := len(doc.lines)
+	for idx := start; idx < len(doc.lines); idx++ {
+		if doc.lines[idx].section != "" {
+			end = idx
+			break
+		}
+	}
+	for end > start && doc.lines[end-1].isBlank() {
+		end--
+	}
+	return end, true
+}
+
+func (doc *Document) insert(at int, lines ...docLine) {
+	doc.lines = append(doc.lines[:at], append(lines, doc.lines[at:]...)...)
+}
+
+func indentOf(txt string) string {
+	return txt[:len(txt)-len(strings.TrimLeftFunc(txt, unicode.IsSpace))]
+}
+
+func newDocLine(indent, key, value string) docLine {
+	return docLine{text: indent + quoteString(key, true) + "=" + quoteString(value, false), key: key, value: value}
+}
+
+// quoteString 在需要时用双引号括起字符串，以便 Read 能正确地读出它
+func quoteString(s string, isKey bool) string {
+	needQuote := strings.HasPrefix(s, "\"") || strings.HasPrefix(s, "#") ||
+		strings.IndexFunc(s, unicode.IsSpace) >= 0 ||
+		(isKey && strings.Contains(s, "="))
+	if !needQuote {
+		return s
+	}
+
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '\\':
+			buf.WriteString("\\\\")
+		case '"':
+			buf.WriteString("\\\"")
+		case '\t':
+			buf.WriteString("\\t")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\n':
+			buf.WriteString("\\n")
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// PropertyChange 两个配置之间的一个差异
+type PropertyChange struct {
+	Key      string
+	Old, New string
+	// Added 为 true 表示新增的配置项，Deleted 为 true 表示被删除的配置项，都为 false 时表示值被修改
+	Added, Deleted bool
+}
+
+// Diff 比较两个配置，返回按 key 排序的差异
+func Diff(old, new map[string]string) []PropertyChange {
+	var changes []PropertyChange
+	for k, v := range old {
+		if nv, ok := new[k]; !ok {
+			changes = append(changes, PropertyChange{Key: k, Old: v, Deleted: true})
+		} else if nv != v {
+			changes = append(changes, PropertyChange{Key: k, Old: v, New: nv})
+		}
+	}
+	for k, v := range new {
+		if _, ok := old[k]; !ok {
+			changes = append(changes, PropertyChange{Key: k, New: v, Added: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
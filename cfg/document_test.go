@@ -0,0 +1,153 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDocument = "# header\r\n" +
+	"\r\n" +
+	"# the address\r\n" +
+	"a=1\r\n" +
+	"  b = \"x\\ty\"\r\n" +
+	"# c=3\r\n" +
+	"pa=c:\\a.txt\r\n" +
+	"\r\n" +
+	"[db]\r\n" +
+	"db.port=5432\r\n" +
+	"\r\n"
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, txt := range []string{testDocument, "", "a=1", "a=1\nb=2\n", strings.Replace(testDocument, "\r\n", "\n", -1)} {
+		doc, err := ParseDocument(strings.NewReader(txt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := doc.String(); s != txt {
+			t.Errorf("excepted %q", txt)
+			t.Errorf("actual   %q", s)
+		}
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(doc.Keys(), []string{"a", "b", "pa", "db.port"}) {
+		t.Error("keys is", doc.Keys())
+	}
+	if v, ok := doc.Get("b"); !ok || v != "x\ty" {
+		t.Errorf("b is %q", v)
+	}
+	if section, ok := doc.Section("db.port"); !ok || section != "db" {
+		t.Error("section of db.port is", section)
+	}
+
+	doc.Set("a", "hello world")
+	doc.Set("c", "3")
+	doc.Set("d", "#4")
+	doc.Set("db.host", "127.0.0.1")
+	if !doc.Delete("pa") || doc.Delete("not_exists") {
+		t.Error("delete is failed")
+	}
+	if err := doc.Rename("b", "b2"); err != nil {
+		t.Error(err)
+	}
+	if err := doc.Rename("b2", "a"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if err := doc.MoveToSection("db.host", "db"); err != nil {
+		t.Error(err)
+	}
+	if err := doc.MoveToSection("a", "web"); err != nil {
+		t.Error(err)
+	}
+
+	excepted := "# header\r\n" +
+		"\r\n" +
+		"  b2=\"x\\ty\"\r\n" +
+		"c=3\r\n" +
+		"d=\"#4\"\r\n" +
+		"\r\n" +
+		"[db]\r\n" +
+		"db.port=5432\r\n" +
+		"db.host=127.0.0.1\r\n" +
+		"\r\n" +
+		"[web]\r\n" +
+		"# the address\r\n" +
+		"a=\"hello world\"\r\n"
+	if s := doc.String(); s != excepted {
+		t.Errorf("excepted %q", excepted)
+		t.Errorf("actual   %q", s)
+	}
+
+	values, err := Read(strings.NewReader(doc.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exceptedValues := map[string]string{"a": "hello world", "b2": "x\ty", "c": "3", "d": "#4", "db.port": "5432", "db.host": "127.0.0.1"}
+	if !reflect.DeepEqual(values, exceptedValues) {
+		t.Errorf("excepted %#v", exceptedValues)
+		t.Errorf("actual   %#v", values)
+	}
+}
+
+func TestDocumentMergeAndDiff(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm := filepath.Join(tmp, "app.properties")
+	if err := ioutil.WriteFile(nm, []byte("a=1\nb=2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ReadDocument(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := doc.Values()
+
+	changed := doc.Merge(map[string]string{"a": "10", "c": "3"}, false)
+	if !reflect.DeepEqual(changed, []string{"c"}) {
+		t.Error("changed is", changed)
+	}
+	changed = doc.Merge(map[string]string{"a": "10", "c": "3"}, true)
+	if !reflect.DeepEqual(changed, []string{"a"}) {
+		t.Error("changed is", changed)
+	}
+	doc.Delete("b")
+	if err := doc.Save(nm); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "a=10\nc=3\n" {
+		t.Errorf("file is %q", bs)
+	}
+	if st, err := os.Stat(nm); err != nil || st.Mode().Perm() != 0600 {
+		t.Error("mode of file is changed")
+	}
+
+	changes := Diff(old, doc.Values())
+	excepted := []PropertyChange{
+		{Key: "a", Old: "1", New: "10"},
+		{Key: "b", Old: "2", Deleted: true},
+		{Key: "c", New: "3", Added: true},
+	}
+	if !reflect.DeepEqual(changes, excepted) {
+		t.Errorf("excepted %#v", excepted)
+		t.Errorf("actual   %#v", changes)
+	}
+}
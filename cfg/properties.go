@@ -126,38 +126,54 @@ func Read(r io.Reader) (map[string]string, error) {
 	cfg := map[string]string{}
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		txt := scanner.Text()
-		key, retain := readString(txt, true)
-		if len(key) == 0 {
-			continue
+		if key, value, ok := parseLine(scanner.Text()); ok {
+			cfg[key] = value
 		}
+	}
 
-		hasEqualChar, retain := readEqualChar(retain)
-		if !hasEqualChar {
-			continue
-		}
+	return ExpandAll(cfg), nil
+}
 
-		value, retain := readString(retain, false)
-		if len(value) == 0 {
-			continue
-		}
-		if skipWhitespace(retain) != "" {
-			continue
-		}
-		cfg[key] = value
+// parseLine 解析一行 key=value，它不是一个有效的配置项时返回 false
+func parseLine(txt string) (string, string, bool) {
+	key, retain := readString(txt, true)
+	if len(key) == 0 {
+		return "", "", false
 	}
 
-	return ExpandAll(cfg), nil
+	hasEqualChar, retain := readEqualChar(retain)
+	if !hasEqualChar {
+		return "", "", false
+	}
+
+	value, retain := readString(retain, false)
+	if len(value) == 0 {
+		return "", "", false
+	}
+	if skipWhitespace(retain) != "" {
+		return "", "", false
+	}
+	return key, value, true
 }
 
+// ExpandAll 替换值中的 ${var} 和 ${var:-default}，var 先从 cfg 中查找，再从环境变量中查找，
+// ${var:-default} 在 var 不存在或为空时使用 default
 func ExpandAll(cfg map[string]string) map[string]string {
 	remain := 0
 	expend := func(key string) string {
 		remain++
-		if value, ok := cfg[key]; ok {
+		var defaultValue string
+		var hasDefault bool
+		if idx := strings.Index(key, ":-"); idx >= 0 {
+			key, defaultValue, hasDefault = key[:idx], key[idx+2:], true
+		}
+		if value, ok := cfg[key]; ok && (!hasDefault || value != "") {
+			return value
+		}
+		if value, ok := os.LookupEnv(key); ok && (!hasDefault || value != "") {
 			return value
 		}
-		return os.Getenv(key)
+		return defaultValue
 	}
 
 	for i := 0; i < 100; i++ {
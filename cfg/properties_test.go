@@ -3,6 +3,7 @@ package cfg
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 )
@@ -108,3 +109,23 @@ d#5= d#5
 		}
 	}
 }
+
+func TestExpandDefault(t *testing.T) {
+	os.Setenv("CFG_TEST_EXPAND", "env")
+	defer os.Unsetenv("CFG_TEST_EXPAND")
+
+	actual := ExpandAll(map[string]string{
+		"a":     "1",
+		"empty": "",
+		"b":     "${a:-2}",
+		"c":     "${not_exists:-2}",
+		"d":     "${empty:-3}",
+		"e":     "${CFG_TEST_EXPAND:-4}",
+		"f":     "x${not_exists}y",
+	})
+	for k, v := range map[string]string{"b": "1", "c": "2", "d": "3", "e": "env", "f": "xy"} {
+		if actual[k] != v {
+			t.Error(k, "excepted is", v, "actual is", actual[k])
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package cfg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SECRET_KEY_SIZE 密钥的长度，使用 AES-256-GCM 加密
+const SECRET_KEY_SIZE = 32
+
+const (
+	encryptedPrefix = "ENC("
+	encryptedSuffix = ")"
+)
+
+// IsEncrypted 判断值是不是一个形如 ENC(...) 的加密值
+func IsEncrypted(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+// GenerateSecretKey 生成一个随机密钥
+func GenerateSecretKey() ([]byte, error) {
+	key := make([]byte, SECRET_KEY_SIZE)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.New("generate secret key failed, " + err.Error())
+	}
+	return key, nil
+}
+
+// ReadSecretKey 读密钥文件，文件中是十六进制编码的密钥
+func ReadSecretKey(nm string) ([]byte, error) {
+	bs, err := ioutil.ReadFile(nm)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("secret key file '" + nm + "' is not found.")
+		}
+		return nil, errors.New("read secret key file '" + nm + "' failed, " + err.Error())
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(bs)))
+	if err != nil {
+		return nil, errors.New("secret key file '" + nm + "' is invalid, " + err.Error())
+	}
+	if len(key) != SECRET_KEY_SIZE {
+		return nil, errors.New("secret key file '" + nm + "' is invalid, key length must is 32 bytes")
+	}
+	return key, nil
+}
+
+// WriteSecretKey 写密钥文件，文件只有当前用户可以读写
+func WriteSecretKey(nm string, key []byte) error {
+	if len(key) != SECRET_KEY_SIZE {
+		return errors.New("secret key is invalid, key length must is 32 bytes")
+	}
+	if err := writeFileSync(nm, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return errors.New("write secret key file '" + nm + "' failed, " + err.Error())
+	}
+	return nil
+}
+
+// writeFileSync 同 ioutil.WriteFile, 但在关闭前将内容刷到磁盘上
+func writeFileSync(nm string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(nm, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt 加密一个值，返回形如 ENC(...) 的字符串
+func Encrypt(key []byte, plain string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", errors.New("encrypt value failed, " + err.Error())
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.New("encrypt value failed, " + err.Error())
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+// Decrypt 解密一个形如 ENC(...) 的值，不是加密值时原样返回
+func Decrypt(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix)
+
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", errors.New("decrypt value failed, " + err.Error())
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", errors.New("decrypt value failed, " + err.Error())
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("decrypt value failed, value is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("decrypt value failed, " + err.Error())
+	}
+	return string(plain), nil
+}
+
+// ReencryptProperties 用 newKey 重新加密属性文件中所有用 oldKey 加密的值，
+// 返回被修改的键，其中有一个值不能解密时不会修改文件
+func ReencryptProperties(nm string, oldKey, newKey []byte) ([]string, error) {
+	doc, err := ReadDocument(nm)
+	if err != nil {
+		return nil, errors.New("read file '" + nm + "' failed, " + err.Error())
+	}
+
+	var keys []string
+	updated := map[string]string{}
+	for k, v := range doc.Values() {
+		if !IsEncrypted(v) {
+			continue
+		}
+		plain, err := Decrypt(oldKey, v)
+		if err != nil {
+			return nil, errors.New("'" + k + "' in the '" + nm + "' is invalid, " + err.Error())
+		}
+		updated[k], err = Encrypt(newKey, plain)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(updated) == 0 {
+		return nil, nil
+	}
+	for k, v := range updated {
+		doc.Set(k, v)
+	}
+	if err := doc.Save(nm); err != nil {
+		return nil, errors.New("update file '" + nm + "' failed, " + err.Error())
+	}
+	return keys, nil
+}
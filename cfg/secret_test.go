@@ -0,0 +1,100 @@
+package cfg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := Encrypt(key, "pass=word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(value) {
+		t.Error("value isn't encrypted,", value)
+	}
+	plain, err := Decrypt(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != "pass=word" {
+		t.Error("plain is", plain)
+	}
+
+	if plain, err := Decrypt(key, "abc"); err != nil || plain != "abc" {
+		t.Error("plain is", plain, err)
+	}
+
+	otherKey, _ := GenerateSecretKey()
+	if _, err := Decrypt(otherKey, value); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if _, err := Decrypt(key, "ENC(abc)"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+}
+
+func TestReencryptProperties(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	oldKey, _ := GenerateSecretKey()
+	newKey, _ := GenerateSecretKey()
+
+	keyFile := filepath.Join(tmp, "secret.key")
+	if err := WriteSecretKey(keyFile, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ReadSecretKey(keyFile); err != nil || !reflect.DeepEqual(key, oldKey) {
+		t.Error("key is", key, err)
+	}
+
+	a, _ := Encrypt(oldKey, "123")
+	b, _ := Encrypt(oldKey, "456")
+	nm := filepath.Join(tmp, "app.properties")
+	txt := "# comment\r\na.password=" + a + "\r\n# db\r\nb.password=" + b + "\r\nc=abc\r\n"
+	if err := ioutil.WriteFile(nm, []byte(txt), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ReencryptProperties(nm, oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a.password", "b.password"}) {
+		t.Error("keys is", keys)
+	}
+
+	props, err := ReadProperties(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, excepted := range map[string]string{"a.password": "123", "b.password": "456"} {
+		if plain, err := Decrypt(newKey, props[k]); err != nil || plain != excepted {
+			t.Error(k, "is", plain, err)
+		}
+	}
+	if props["c"] != "abc" {
+		t.Error("c is", props["c"])
+	}
+	bs, _ := ioutil.ReadFile(nm)
+	if !strings.Contains(string(bs), "# comment") || !strings.Contains(string(bs), "# db") {
+		t.Error("comments is lost,", string(bs))
+	}
+
+	if _, err := ReencryptProperties(nm, oldKey, newKey); err == nil {
+		t.Error("excepted error is not nil")
+	}
+}
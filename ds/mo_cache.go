@@ -1,9 +1,9 @@
 package ds
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"net"
 	"strconv"
 	"strings"
@@ -11,9 +11,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/runner-mei/log"
 	"github.com/runner-mei/orm"
 	"github.com/three-plus-three/modules/ds/models"
 	merrors "github.com/three-plus-three/modules/errors"
+	"github.com/three-plus-three/modules/logext"
 	"github.com/three-plus-three/modules/types"
 	"xorm.io/xorm"
 )
@@ -190,6 +192,8 @@ type MoCache struct {
 	all_devices    []*NetworkDevice
 	all_links      []*NetworkLink
 	Engine         *xorm.Engine
+	// Logger 为 nil 时使用 context 中的 logger，见 logext.For
+	Logger log.Logger
 }
 
 func (cache *MoCache) Init(engine *xorm.Engine, definitions *types.TableDefinitions) error {
@@ -240,15 +244,22 @@ func (db *MoCache) NetworkLinks() *orm.Collection {
 
 // Refresh 刷新绶存，确保内存与数据库中的数据一致。
 func (cache *MoCache) Refresh() error {
+	return cache.RefreshContext(context.Background())
+}
+
+// RefreshContext 同 Refresh，日志中会带有 ctx 中请求相关的字段
+func (cache *MoCache) RefreshContext(ctx context.Context) error {
+	logger := logext.For(ctx, cache.Logger).Named("mo_cache")
+
 	cache.lock.RLock()
 	isEmpty := len(cache.values) == 0
 	cache.lock.RUnlock()
 	if isEmpty {
-		log.Println("[mo_cache] cache is empty, skip refresh.")
+		logger.Info("cache is empty, skip refresh.")
 		return nil
 	}
 
-	rows, err := cache.Engine.DB().Query("select id, updated_at from " + models.Objects.TableName())
+	rows, err := cache.Engine.DB().QueryContext(ctx, "select id, updated_at from "+models.Objects.TableName())
 	if err != nil {
 		if err == sql.ErrNoRows {
 			cache.lock.Lock()
@@ -257,7 +268,7 @@ func (cache *MoCache) Refresh() error {
 			cache.all_links = nil
 			cache.lock.Unlock()
 
-			log.Println("[mo_cache] database is empty, clear cache.")
+			logger.Info("database is empty, clear cache.")
 			return nil
 		}
 		return errors.New("GetSnapshots:" + err.Error())
@@ -302,7 +313,7 @@ func (cache *MoCache) Refresh() error {
 	cache.all_links = nil
 	cache.lock.Unlock()
 
-	log.Println("[mo_cache] update", len(updated), ", delete", len(moCopies))
+	logger.Info("cache is refreshed.", log.Int("updated", len(updated)), log.Int("deleted", len(moCopies)))
 	return nil
 }
 
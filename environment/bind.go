@@ -0,0 +1,291 @@
+package environment
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/three-plus-three/modules/as"
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Bind 用 prefix 开头的配置项填充结构 value，value 必须是一个结构的指针，字段用下列 tag 描述：
+//
+//	config:"name"      配置项的名称（不含 prefix），缺省为字段名转成小写加下划线，"-" 表示忽略它
+//	default:"value"    配置项不存在时的缺省值
+//	required:"true"    配置项必须存在
+//	min:"1" max:"10"   数字（包括时间和字节数）的取值范围，字符串为长度的范围
+//	unit:"bytes"       值为字节数，可以带 KB, MB, GB, TB 等单位
+//	description:"..."  配置项的说明，见 RegisterStruct
+//
+// 支持的类型有 string, bool, 整数, 浮点数, time.Duration, []string（逗号分隔）和嵌套的结构，
+// 嵌套结构中的配置项名称为 prefix + name + "."，匿名嵌入的结构使用相同的 prefix，
+// 字符串中形如 ENC(...) 的值会被解密，所有字段的错误会被一起返回
+func (self *Config) Bind(prefix string, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind config '" + prefix + "' failed, value must is a pointer to struct")
+	}
+
+	var errList []string
+	walkFields(prefix, rv.Elem(), func(key string, field reflect.StructField, fv reflect.Value) {
+		if err := self.bindField(key, field, fv); err != nil {
+			errList = append(errList, err.Error())
+		}
+	})
+	if len(errList) == 0 {
+		return nil
+	}
+	return errors.New("bind config '" + prefix + "' failed:\r\n" + strings.Join(errList, "\r\n"))
+}
+
+func walkFields(prefix string, rv reflect.Value, cb func(key string, field reflect.StructField, fv reflect.Value)) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := field.Tag.Get("config")
+		if name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if field.Anonymous && name == "" {
+				walkFields(prefix, fv, cb)
+			} else {
+				walkFields(prefix+fieldKey(field)+".", fv, cb)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		cb(prefix+fieldKey(field), field, fv)
+	}
+}
+
+// fieldKey 返回字段的配置项名称，如 MaxIdleConns 为 max_idle_conns
+func fieldKey(field reflect.StructField) string {
+	if name := field.Tag.Get("config"); name != "" {
+		return name
+	}
+
+	var buf strings.Builder
+	runes := []rune(field.Name)
+	for idx, c := range runes {
+		if unicode.IsUpper(c) {
+			if idx > 0 && (unicode.IsLower(runes[idx-1]) ||
+				(idx+1 < len(runes) && unicode.IsLower(runes[idx+1]))) {
+				buf.WriteRune('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+func (self *Config) bindField(key string, field reflect.StructField, fv reflect.Value) error {
+	o, ok := self.get(key)
+	if !ok || o == nil || o == "" {
+		if field.Tag.Get("required") == "true" {
+			return errors.New("'" + key + "' is required.")
+		}
+		defValue, ok := field.Tag.Lookup("default")
+		if !ok {
+			return nil
+		}
+		o = defValue
+	}
+
+	if s, ok := o.(string); ok && commons_cfg.IsEncrypted(s) {
+		plain, err := self.Decrypt(s)
+		if err != nil {
+			return errors.New("'" + key + "' is invalid, " + err.Error())
+		}
+		o = plain
+	}
+
+	if err := setField(fv, field, o); err != nil {
+		return errors.New("'" + key + "' is invalid, " + err.Error())
+	}
+	if err := checkRange(fv, field); err != nil {
+		return errors.New("'" + key + "' " + err.Error())
+	}
+	return nil
+}
+
+func setField(fv reflect.Value, field reflect.StructField, o interface{}) error {
+	if field.Tag.Get("unit") == "bytes" {
+		if s, ok := o.(string); ok {
+			i, err := ParseBytes(s)
+			if err != nil {
+				return err
+			}
+			o = i
+		}
+	}
+
+	if fv.Type() == durationType {
+		d, err := as.Duration(o)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		s, err := as.String(o)
+		if err != nil {
+			return err
+		}
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := as.Bool(o)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := as.Int64(o)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(i) {
+			return errors.New("value '" + fmt.Sprint(o) + "' is overflow")
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := as.Uint64(o)
+		if err != nil {
+			return err
+		}
+		if fv.OverflowUint(u) {
+			return errors.New("value '" + fmt.Sprint(o) + "' is overflow")
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := as.Float64(o)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return errors.New("type '" + fv.Type().String() + "' is unsupported")
+		}
+		var ss []string
+		if s, ok := o.(string); ok {
+			for _, v := range strings.Split(s, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					ss = append(ss, v)
+				}
+			}
+		} else {
+			var err error
+			if ss, err = as.Strings(o); err != nil {
+				return err
+			}
+		}
+		fv.Set(reflect.ValueOf(ss).Convert(fv.Type()))
+	default:
+		return errors.New("type '" + fv.Type().String() + "' is unsupported")
+	}
+	return nil
+}
+
+func checkRange(fv reflect.Value, field reflect.StructField) error {
+	for _, tag := range []string{"min", "max"} {
+		limit, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+
+		var actual, excepted float64
+		switch {
+		case fv.Type() == durationType:
+			d, err := time.ParseDuration(limit)
+			if err != nil {
+				return errors.New(tag + " '" + limit + "' is invalid, " + err.Error())
+			}
+			actual, excepted = float64(fv.Int()), float64(d)
+		case field.Tag.Get("unit") == "bytes":
+			i, err := ParseBytes(limit)
+			if err != nil {
+				return errors.New(tag + " '" + limit + "' is invalid, " + err.Error())
+			}
+			actual, excepted = float64(fv.Int()), float64(i)
+			if fv.Kind() >= reflect.Uint && fv.Kind() <= reflect.Uint64 {
+				actual = float64(fv.Uint())
+			}
+		default:
+			f, err := strconv.ParseFloat(limit, 64)
+			if err != nil {
+				return errors.New(tag + " '" + limit + "' is invalid, " + err.Error())
+			}
+			excepted = f
+			switch fv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				actual = float64(fv.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				actual = float64(fv.Uint())
+			case reflect.Float32, reflect.Float64:
+				actual = fv.Float()
+			case reflect.String, reflect.Slice:
+				actual = float64(fv.Len())
+			default:
+				continue
+			}
+		}
+
+		if tag == "min" && actual < excepted {
+			return errors.New("must is greater than or equal to " + limit)
+		}
+		if tag == "max" && actual > excepted {
+			return errors.New("must is less than or equal to " + limit)
+		}
+	}
+	return nil
+}
+
+// ParseBytes 解析字节数，如 512, 10KB, 1.5MB, 2GiB，单位按 1024 进位
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexFunc(s, func(c rune) bool {
+		return !unicode.IsDigit(c) && c != '.'
+	})
+	number, unit := s, ""
+	if idx >= 0 {
+		number, unit = s[:idx], strings.ToUpper(strings.TrimSpace(s[idx:]))
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, errors.New("'" + s + "' isn't a bytes")
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I") {
+	case "":
+	case "K":
+		f *= 1024
+	case "M":
+		f *= 1024 * 1024
+	case "G":
+		f *= 1024 * 1024 * 1024
+	case "T":
+		f *= 1024 * 1024 * 1024 * 1024
+	default:
+		return 0, errors.New("unit '" + unit + "' of '" + s + "' is unsupported")
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,175 @@
+package environment
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDbOptions struct {
+	Address  string `required:"true"`
+	Password string
+}
+
+type testBindOptions struct {
+	Host         string        `default:"127.0.0.1"`
+	Port         int           `default:"80" min:"1" max:"65535"`
+	Enabled      bool          `config:"is_enabled"`
+	Timeout      time.Duration `default:"10s" max:"1m"`
+	MaxBodySize  int64         `unit:"bytes" default:"1MB"`
+	Ratio        float64
+	Tags         []string
+	Ignored      string `config:"-"`
+	Db           testDbOptions
+	ignoredField string
+}
+
+func TestBind(t *testing.T) {
+	cfg := newConfig(nil, map[string]string{
+		"web.port":          "8080",
+		"web.is_enabled":    "true",
+		"web.max_body_size": "2KB",
+		"web.ratio":         "0.5",
+		"web.tags":          "a, b,c",
+		"web.ignored":       "abc",
+		"web.db.address":    "192.168.1.2",
+	})
+	cfg.Set("web.timeout", 2*time.Second)
+
+	var opts testBindOptions
+	if err := cfg.Bind("web.", &opts); err != nil {
+		t.Fatal(err)
+	}
+	excepted := testBindOptions{
+		Host:        "127.0.0.1",
+		Port:        8080,
+		Enabled:     true,
+		Timeout:     2 * time.Second,
+		MaxBodySize: 2048,
+		Ratio:       0.5,
+		Tags:        []string{"a", "b", "c"},
+		Db:          testDbOptions{Address: "192.168.1.2"},
+	}
+	if !reflect.DeepEqual(opts, excepted) {
+		t.Errorf("excepted %#v", excepted)
+		t.Errorf("actual   %#v", opts)
+	}
+
+	cfg = newConfig(nil, map[string]string{
+		"web.port":    "80000",
+		"web.timeout": "2m",
+		"web.ratio":   "abc",
+	})
+	err := cfg.Bind("web.", &opts)
+	if err == nil {
+		t.Fatal("excepted error is not nil")
+	}
+	for _, s := range []string{
+		"'web.port' must is less than or equal to 65535",
+		"'web.timeout' must is less than or equal to 1m",
+		"'web.ratio' is invalid",
+		"'web.db.address' is required.",
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Error("excepted error contains", s)
+			t.Error("actual is", err)
+		}
+	}
+
+	if err := cfg.Bind("web.", opts); err == nil {
+		t.Error("excepted error is not nil")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for s, excepted := range map[string]int64{
+		"512":    512,
+		"1b":     1,
+		"10KB":   10 * 1024,
+		"1.5M":   1024 * 1024 * 3 / 2,
+		"2GiB":   2 * 1024 * 1024 * 1024,
+		" 1 TB ": 1024 * 1024 * 1024 * 1024,
+	} {
+		if actual, err := ParseBytes(s); err != nil || actual != excepted {
+			t.Error(s, "excepted", excepted, "actual is", actual, err)
+		}
+	}
+	for _, s := range []string{"", "KB", "10PB"} {
+		if _, err := ParseBytes(s); err == nil {
+			t.Error(s, "excepted error is not nil")
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	keyLock.Lock()
+	old := knownKeys
+	knownKeys = map[string]KeyInfo{}
+	keyLock.Unlock()
+	defer func() {
+		keyLock.Lock()
+		knownKeys = old
+		keyLock.Unlock()
+	}()
+
+	RegisterStruct("web", "web.", &testBindOptions{})
+	RegisterKeys("users", KeyInfo{Key: "users.ldap_address", Description: "LDAP 服务器地址"})
+
+	keys := KnownKeys("web")
+	if len(keys) != 9 || keys[0].Key != "web.db.address" || keys[3].Key != "web.is_enabled" {
+		t.Error("keys is", keys)
+	}
+
+	warnings := CheckKeys(map[string]string{
+		"web.port":          "80",
+		"web.prot":          "80",
+		"web.unknown_field": "1",
+		"users.ldap_adress": "a",
+		"other.key":         "1",
+	})
+	excepted := []string{
+		"config 'users.ldap_adress' is unknown, did you mean 'users.ldap_address'?",
+		"config 'web.prot' is unknown, did you mean 'web.port'?",
+		"config 'web.unknown_field' is unknown.",
+	}
+	if !reflect.DeepEqual(warnings, excepted) {
+		t.Errorf("excepted %#v", excepted)
+		t.Errorf("actual   %#v", warnings)
+	}
+
+	cfg := newConfig(nil, map[string]string{"web.port": "80", "web.db.password": "123"})
+	cfg.setSources(map[string]string{"web.port": SOURCE_FILE + ":app.properties"})
+	cfg.Set("web.ratio", 0.5)
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("web.host", "", "")
+	flagSet.String("not_set", "", "")
+	if err := flagSet.Parse([]string{"-web.host=192.168.1.2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteConfigEntries(&buf, cfg.Entries(flagSet), false); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"web.port=80 #file:app.properties\r\n",
+		"web.db.password=****** #file\r\n",
+		"web.ratio=0.5 #runtime\r\n",
+		"web.host=192.168.1.2 #flag:-web.host\r\n",
+		"web.timeout=10s #default\r\n",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Error("excepted contains", s)
+		}
+	}
+	if strings.Contains(buf.String(), "not_set") {
+		t.Error("flag 'not_set' is dumped")
+	}
+	if t.Failed() {
+		t.Log(buf.String())
+	}
+}
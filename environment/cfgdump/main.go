@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/three-plus-three/modules/environment"
+)
+
+func main() {
+	var name, confDir, files string
+	var showSecrets bool
+	flag.StringVar(&name, "name", "", "the name of service, it will read '<name>.properties'")
+	flag.StringVar(&confDir, "conf_dir", "", "the directory of config")
+	flag.StringVar(&files, "files", "", "the extra config files, separated by ','")
+	flag.BoolVar(&showSecrets, "show_secrets", false, "show the value of passwords")
+	flag.Parse()
+
+	var configFiles []string
+	if files != "" {
+		configFiles = strings.Split(files, ",")
+	}
+
+	fs := environment.NewFileSystem(environment.Options{ConfDir: confDir})
+	cfg, err := environment.LoadConfig(fs, configFiles, name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := environment.WriteConfigEntries(os.Stdout, cfg.Entries(nil), showSecrets); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
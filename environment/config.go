@@ -3,36 +3,134 @@ package environment
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/three-plus-three/modules/as"
 	commons_cfg "github.com/three-plus-three/modules/cfg"
 )
 
-// Config 配置
+// Config 配置，它可以被并发地读写，配置文件重新加载时修改会被原子地应用
 type Config struct {
+	// state 保存 *configState, 零值的 Config 没有它，第一次修改时才创建，读写都要通过 loadState 或 initState
+	state atomic.Value
+}
+
+type configState struct {
+	lock       sync.RWMutex
+	reloadLock sync.Mutex
+
 	settings map[string]interface{}
+
+	// loaded 从配置文件中读取的配置，重新加载时只比较和修改它们
+	loaded     map[string]string
+	nextID     int
+	handlers   []changeHandler
+	validators []validateHandler
+
+	// secretKeyFile 解密 ENC(...) 值的密钥文件，为空时使用 SecretKeyFile()
+	secretKeyFile string
+	// sources 配置项的来源，见 Source()
+	sources map[string]string
+}
+
+type changeHandler struct {
+	id     int
+	prefix string
+	cb     func(changes []ConfigChange)
+}
+
+type validateHandler struct {
+	id int
+	cb func(next *Config, changes []ConfigChange) error
+}
+
+// ConfigChange 一个配置项的修改，Old 为 nil 表示新增，New 为 nil 表示删除
+type ConfigChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+func newConfig(settings map[string]interface{}, loaded map[string]string) Config {
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	for k, v := range loaded {
+		settings[k] = v
+	}
+	var cfg Config
+	cfg.state.Store(&configState{settings: settings, loaded: loaded, sources: map[string]string{}})
+	return cfg
+}
+
+// loadState 返回 state, 零值的 Config (如不是用 NewEnvironment 创建的 Environment 中的)
+// 在修改之前没有 state, 这时返回 nil, 读操作应把它当作没有任何配置
+func (self *Config) loadState() *configState {
+	state, _ := self.state.Load().(*configState)
+	return state
 }
 
-// PasswordWithDefault 读配置
+var initStateLock sync.Mutex
+
+// initState 返回 state, 没有时创建它
+func (self *Config) initState() *configState {
+	if state := self.loadState(); state != nil {
+		return state
+	}
+	initStateLock.Lock()
+	defer initStateLock.Unlock()
+	if state := self.loadState(); state != nil {
+		return state
+	}
+	state := &configState{settings: map[string]interface{}{}, sources: map[string]string{}}
+	self.state.Store(state)
+	return state
+}
+
+func (self *Config) get(key string) (interface{}, bool) {
+	state := self.loadState()
+	if state == nil {
+		return nil, false
+	}
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	o, ok := state.settings[key]
+	return o, ok
+}
+
+// PasswordWithDefault 读配置，形如 ENC(...) 的值会被解密，解密失败时返回缺省值
 func (self *Config) PasswordWithDefault(key, defValue string) string {
-	if s, ok := self.settings[key]; ok {
-		return as.StringWithDefault(s, defValue)
+	if s, ok := self.get(key); ok {
+		value := as.StringWithDefault(s, defValue)
+		if !commons_cfg.IsEncrypted(value) {
+			return value
+		}
+		plain, err := self.Decrypt(value)
+		if err != nil {
+			log.Println("decrypt '"+key+"' failed,", err)
+			return defValue
+		}
+		return plain
 	}
 	return defValue
 }
 
 // StringWithDefault 读配置
 func (self *Config) StringWithDefault(key, defValue string) string {
-	if s, ok := self.settings[key]; ok {
+	if s, ok := self.get(key); ok {
 		return as.StringWithDefault(s, defValue)
 	}
 	return defValue
@@ -40,7 +138,7 @@ func (self *Config) StringWithDefault(key, defValue string) string {
 
 // StringsWithDefault 读配置
 func (self *Config) StringsWithDefault(key string, defValue []string) []string {
-	if o, ok := self.settings[key]; ok {
+	if o, ok := self.get(key); ok {
 		if s, ok := o.(string); ok {
 			return strings.Split(s, ",")
 		}
@@ -51,7 +149,7 @@ func (self *Config) StringsWithDefault(key string, defValue []string) []string {
 
 // UintWithDefault 读配置
 func (self *Config) UintWithDefault(key string, defValue uint) uint {
-	if s, ok := self.settings[key]; ok {
+	if s, ok := self.get(key); ok {
 		return as.UintWithDefault(s, defValue)
 	}
 	return defValue
@@ -59,7 +157,7 @@ func (self *Config) UintWithDefault(key string, defValue uint) uint {
 
 // IntWithDefault 读配置
 func (self *Config) IntWithDefault(key string, defValue int) int {
-	if s, ok := self.settings[key]; ok {
+	if s, ok := self.get(key); ok {
 		return as.IntWithDefault(s, defValue)
 	}
 	return defValue
@@ -67,7 +165,7 @@ func (self *Config) IntWithDefault(key string, defValue int) int {
 
 // BoolWithDefault 读配置
 func (self *Config) BoolWithDefault(key string, defValue bool) bool {
-	if s, ok := self.settings[key]; ok {
+	if s, ok := self.get(key); ok {
 		return as.BoolWithDefault(s, defValue)
 	}
 	return defValue
@@ -75,20 +173,29 @@ func (self *Config) BoolWithDefault(key string, defValue bool) bool {
 
 // DurationWithDefault 读配置
 func (self *Config) DurationWithDefault(key string, defValue time.Duration) time.Duration {
-	if s, ok := self.settings[key]; ok {
+	if s, ok := self.get(key); ok {
 		return as.DurationWithDefault(s, defValue)
 	}
 	return defValue
 }
 
-// Set 写配置
+// Set 写配置，值有变化时通知订阅者
 func (self *Config) Set(key string, value interface{}) {
-	self.settings[key] = value
+	state := self.initState()
+	state.lock.Lock()
+	old, ok := state.settings[key]
+	state.settings[key] = value
+	state.sources[key] = SOURCE_RUNTIME
+	state.lock.Unlock()
+
+	if !ok || !reflect.DeepEqual(old, value) {
+		self.notify([]ConfigChange{{Key: key, Old: old, New: value}})
+	}
 }
 
 // Get 读配置
 func (self *Config) Get(key string, subKeys ...string) interface{} {
-	o := self.settings[key]
+	o, _ := self.get(key)
 	if len(subKeys) == 0 {
 		return o
 	}
@@ -140,22 +247,166 @@ func (self *Config) GetAsTime(keys []string, defaultValue time.Time) time.Time {
 	return as.TimeWithDefault(o, defaultValue)
 }
 
+func (self *Config) snapshot() map[string]interface{} {
+	state := self.loadState()
+	if state == nil {
+		return map[string]interface{}{}
+	}
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	copyed := make(map[string]interface{}, len(state.settings))
+	for k, v := range state.settings {
+		copyed[k] = v
+	}
+	return copyed
+}
+
 // ForEach 读配置
 func (self *Config) ForEach(cb func(key string, value interface{})) {
-	for k, v := range self.settings {
+	for k, v := range self.snapshot() {
 		cb(k, v)
 	}
 }
 
 // ForEach 读配置
 func (self *Config) ForEachWithPrefix(prefix string, cb func(key string, value interface{})) {
-	for k, v := range self.settings {
+	for k, v := range self.snapshot() {
 		if strings.HasPrefix(k, prefix) {
 			cb(k, v)
 		}
 	}
 }
 
+// OnChange 订阅 key 以 prefix 开头的配置项的修改，prefix 为空时订阅全部的修改，
+// 同一次重新加载中的修改在一次回调中给出，返回的函数用于取消订阅
+func (self *Config) OnChange(prefix string, cb func(changes []ConfigChange)) func() {
+	state := self.initState()
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.nextID++
+	id := state.nextID
+	state.handlers = append(state.handlers, changeHandler{id: id, prefix: prefix, cb: cb})
+
+	return func() {
+		state.lock.Lock()
+		defer state.lock.Unlock()
+		for idx, h := range state.handlers {
+			if h.id == id {
+				state.handlers = append(state.handlers[:idx:idx], state.handlers[idx+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// OnValidate 注册一个验证函数，它在重新加载的配置被应用前调用，next 为新的配置，
+// 它返回错误时放弃这次重新加载，返回的函数用于取消注册
+func (self *Config) OnValidate(cb func(next *Config, changes []ConfigChange) error) func() {
+	state := self.initState()
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.nextID++
+	id := state.nextID
+	state.validators = append(state.validators, validateHandler{id: id, cb: cb})
+
+	return func() {
+		state.lock.Lock()
+		defer state.lock.Unlock()
+		for idx, h := range state.validators {
+			if h.id == id {
+				state.validators = append(state.validators[:idx:idx], state.validators[idx+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (self *Config) notify(changes []ConfigChange) {
+	state := self.loadState()
+	if state == nil {
+		return
+	}
+	state.lock.RLock()
+	handlers := state.handlers
+	state.lock.RUnlock()
+
+	for _, h := range handlers {
+		var matched []ConfigChange
+		for _, change := range changes {
+			if strings.HasPrefix(change.Key, h.prefix) {
+				matched = append(matched, change)
+			}
+		}
+		if len(matched) > 0 {
+			h.cb(matched)
+		}
+	}
+}
+
+// Reload 用从配置文件中重新读取的配置更新，只比较和修改来自配置文件的配置项，
+// 验证函数都通过后，所有的修改被原子地应用，然后通知订阅者
+func (self *Config) Reload(props map[string]string) ([]ConfigChange, error) {
+	state := self.initState()
+	state.reloadLock.Lock()
+	defer state.reloadLock.Unlock()
+
+	next := self.snapshot()
+	state.lock.RLock()
+	loaded := state.loaded
+	validators := state.validators
+	secretKeyFile := state.secretKeyFile
+	state.lock.RUnlock()
+
+	var changes []ConfigChange
+	for k, v := range props {
+		if old, ok := loaded[k]; ok && old == v {
+			continue
+		}
+		changes = append(changes, ConfigChange{Key: k, Old: next[k], New: v})
+		next[k] = v
+	}
+	for k := range loaded {
+		if _, ok := props[k]; !ok {
+			changes = append(changes, ConfigChange{Key: k, Old: next[k]})
+			delete(next, k)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	nextConfig := newConfig(next, nil)
+	nextConfig.loadState().secretKeyFile = secretKeyFile
+	for _, v := range validators {
+		if err := v.cb(&nextConfig, changes); err != nil {
+			return nil, errors.New("reload config failed, " + err.Error())
+		}
+	}
+
+	copyed := make(map[string]string, len(props))
+	for k, v := range props {
+		copyed[k] = v
+	}
+
+	state.lock.Lock()
+	for _, change := range changes {
+		delete(state.sources, change.Key)
+		if change.New == nil {
+			delete(state.settings, change.Key)
+		} else {
+			state.settings[change.Key] = change.New
+		}
+	}
+	state.loaded = copyed
+	state.lock.Unlock()
+
+	self.notify(changes)
+	return changes, nil
+}
+
 func boolWith(cfg map[string]string, key string, defaultValue bool) bool {
 	if v, ok := cfg[key]; ok && v != "" {
 		switch strings.ToLower(v) {
@@ -417,13 +668,23 @@ func stringWith(props map[string]string, nm, defaultValue string) string {
 	return defaultValue
 }
 
+// ReadDbConfig 读数据库配置，形如 ENC(...) 的密码会用 SecretKeyFile() 解密
 func ReadDbConfig(prefix string, props, defaultValues map[string]string) DbConfig {
+	return readDbConfig(prefix, props, defaultValues, SecretKeyFile())
+}
+
+func readDbConfig(prefix string, props, defaultValues map[string]string, keyFile string) DbConfig {
 	db_type := stringWith(props, prefix+"db.type", stringWith(defaultValues, prefix+"db.type", stringWith(defaultValues, "db.type", "")))
 	db_address := stringWith(props, prefix+"db.address", stringWith(defaultValues, prefix+"db.address", stringWith(defaultValues, "db.address", "")))
 	db_port := stringWith(props, prefix+"db.port", stringWith(defaultValues, prefix+"db.port", stringWith(defaultValues, "db.port", "")))
 	db_schema := stringWith(props, prefix+"db.schema", stringWith(defaultValues, prefix+"db.schema", stringWith(defaultValues, "db.schema", "")))
 	db_username := stringWith(props, prefix+"db.username", stringWith(defaultValues, prefix+"db.username", stringWith(defaultValues, "db.username", "")))
 	db_password := stringWith(props, prefix+"db.password", stringWith(defaultValues, prefix+"db.password", stringWith(defaultValues, "db.password", "")))
+	if plain, err := decryptWith(keyFile, db_password); err != nil {
+		log.Println("decrypt '"+prefix+"db.password' failed,", err)
+	} else {
+		db_password = plain
+	}
 
 	return DbConfig{
 		DbType:   db_type,
@@ -0,0 +1,484 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/three-plus-three/modules/urlutil"
+)
+
+// 服务实例的状态
+const (
+	STATUS_UP   = "up"
+	STATUS_DOWN = "down"
+)
+
+// 从多个服务实例中选择一个的策略，用 <name>.balance 配置，缺省为 BALANCE_ROUND_ROBIN
+const (
+	BALANCE_ROUND_ROBIN = "round_robin" // 轮流使用每个健康的实例
+	BALANCE_FAILOVER    = "failover"    // 总是使用第一个健康的实例，它不可用时才使用下一个
+)
+
+// ServiceInstance 一个注册的服务实例
+type ServiceInstance struct {
+	ID        string            `json:"id"`
+	Service   string            `json:"service"`
+	IsSSL     bool              `json:"is_ssl,omitempty"`
+	Host      string            `json:"host"`
+	Port      string            `json:"port"`
+	UrlPath   string            `json:"url_path,omitempty"`
+	Status    string            `json:"status"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// IsHealthy 实例是否可用
+func (inst *ServiceInstance) IsHealthy() bool {
+	return inst.Status == "" || inst.Status == STATUS_UP
+}
+
+// Discovery 查找服务的实例
+type Discovery interface {
+	// Instances 返回服务的所有实例，包括不健康的实例，它们按 ID 排序
+	Instances(service string) ([]ServiceInstance, error)
+}
+
+// SetDiscovery 指定服务发现，ServiceConfig 会优先使用它找到的健康实例，没有时再使用配置中的地址
+func (env *Environment) SetDiscovery(discovery Discovery) {
+	env.discovery = discovery
+}
+
+// GetDiscovery 返回服务发现，没有指定时返回 nil
+func (env *Environment) GetDiscovery() Discovery {
+	return env.discovery
+}
+
+type dynamicServices struct {
+	lock     sync.Mutex
+	services map[string]*ServiceConfig
+}
+
+// GetServiceConfigByName 按名称查找服务的配置，名称不在 ServiceOptions 中时创建一个动态的服务配置，
+// 它的地址从 <name>.host 和 <name>.port 读取，或者从服务发现中查找，这样新的服务不用添加 ENV_*_PROXY_ID 常量
+func (env *Environment) GetServiceConfigByName(name string) *ServiceConfig {
+	for idx := range env.serviceOptions {
+		if env.serviceOptions[idx].Name == name {
+			return &env.serviceOptions[idx]
+		}
+	}
+
+	if env.dynamicServices == nil {
+		panic(errors.New("environment is not initialized"))
+	}
+	env.dynamicServices.lock.Lock()
+	defer env.dynamicServices.lock.Unlock()
+	if sc, ok := env.dynamicServices.services[name]; ok {
+		return sc
+	}
+
+	sc := &ServiceConfig{env: env, ID: ENV_MAX_PROXY_ID, Name: name}
+	sc.loadDynamicConfig(&env.Config)
+	if env.dynamicServices.services == nil {
+		env.dynamicServices.services = map[string]*ServiceConfig{}
+	}
+	env.dynamicServices.services[name] = sc
+	return sc
+}
+
+func (sc *ServiceConfig) loadDynamicConfig(cfg *Config) {
+	sc.Type = cfg.StringWithDefault(sc.Name+".type", "tcp")
+	sc.IsSSL = cfg.BoolWithDefault(sc.Name+".is_ssl", false)
+	sc.Host = cfg.StringWithDefault(sc.Name+".host", "127.0.0.1")
+	sc.Port = cfg.StringWithDefault(sc.Name+".port", "")
+	sc.UrlPath = cfg.StringWithDefault(sc.Name+".url_path", "")
+	sc.Balance = cfg.StringWithDefault(sc.Name+".balance", BALANCE_ROUND_ROBIN)
+}
+
+// isUnknown 是不是 UnknownServiceConfig
+func (cfg *ServiceConfig) isUnknown() bool {
+	return cfg.ID >= ENV_MAX_PROXY_ID && cfg.Name == ""
+}
+
+// pickInstance 按 Balance 从服务发现中选择一个健康的实例
+func (cfg *ServiceConfig) pickInstance() (ServiceInstance, bool) {
+	if cfg.env == nil || cfg.env.discovery == nil {
+		return ServiceInstance{}, false
+	}
+	instances, err := cfg.env.discovery.Instances(cfg.Name)
+	if err != nil {
+		return ServiceInstance{}, false
+	}
+	healthy := instances[:0:0]
+	for _, inst := range instances {
+		if inst.IsHealthy() {
+			healthy = append(healthy, inst)
+		}
+	}
+	if len(healthy) == 0 {
+		return ServiceInstance{}, false
+	}
+	if cfg.Balance == BALANCE_FAILOVER {
+		return healthy[0], true
+	}
+	idx := atomic.AddUint32(&cfg.next, 1) - 1
+	return healthy[int(idx%uint32(len(healthy)))], true
+}
+
+// ServiceRegistry 一个内存中的服务注册中心，实例需要在 ttl 内再次注册（心跳），否则被删除。
+//
+// 它实现了 Discovery 和 http.Handler，HTTP 接口如下（路径相对于挂载点）：
+//
+//	GET    /                 所有的服务名
+//	GET    /<service>        服务的所有实例
+//	PUT    /<service>/<id>   注册实例或发送心跳，body 为 ServiceInstance 的 JSON
+//	DELETE /<service>/<id>   注销实例
+type ServiceRegistry struct {
+	ttl      time.Duration
+	now      func() time.Time
+	lock     sync.Mutex
+	services map[string]map[string]*ServiceInstance
+}
+
+// NewServiceRegistry 创建一个服务注册中心
+func NewServiceRegistry(ttl time.Duration) *ServiceRegistry {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &ServiceRegistry{
+		ttl:      ttl,
+		now:      time.Now,
+		services: map[string]map[string]*ServiceInstance{},
+	}
+}
+
+// Register 注册实例，已存在时更新它，同时也是心跳
+func (r *ServiceRegistry) Register(inst ServiceInstance) error {
+	if inst.Service == "" {
+		return errors.New("service name is missing")
+	}
+	if inst.ID == "" {
+		return errors.New("instance id is missing")
+	}
+	if inst.Host == "" || inst.Port == "" {
+		return errors.New("address of instance '" + inst.Service + "/" + inst.ID + "' is missing")
+	}
+	if inst.Status == "" {
+		inst.Status = STATUS_UP
+	}
+	inst.UpdatedAt = r.now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	instances := r.services[inst.Service]
+	if instances == nil {
+		instances = map[string]*ServiceInstance{}
+		r.services[inst.Service] = instances
+	}
+	instances[inst.ID] = &inst
+	return nil
+}
+
+// Deregister 注销实例，它不存在时返回 false
+func (r *ServiceRegistry) Deregister(service, id string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	instances := r.services[service]
+	if _, ok := instances[id]; !ok {
+		return false
+	}
+	delete(instances, id)
+	if len(instances) == 0 {
+		delete(r.services, service)
+	}
+	return true
+}
+
+// expire 删除超时的实例，调用者必须持有锁
+func (r *ServiceRegistry) expire() {
+	deadline := r.now().Add(-r.ttl)
+	for service, instances := range r.services {
+		for id, inst := range instances {
+			if inst.UpdatedAt.Before(deadline) {
+				delete(instances, id)
+			}
+		}
+		if len(instances) == 0 {
+			delete(r.services, service)
+		}
+	}
+}
+
+// Instances 返回服务的所有实例，实现 Discovery
+func (r *ServiceRegistry) Instances(service string) ([]ServiceInstance, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire()
+
+	results := make([]ServiceInstance, 0, len(r.services[service]))
+	for _, inst := range r.services[service] {
+		results = append(results, *inst)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+// Services 返回所有已注册的服务名
+func (r *ServiceRegistry) Services() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire()
+
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *ServiceRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	urlPath := strings.Trim(req.URL.Path, "/")
+	var ss []string
+	if urlPath != "" {
+		ss = strings.Split(urlPath, "/")
+	}
+
+	switch {
+	case len(ss) == 0 && req.Method == "GET":
+		renderJSON(w, http.StatusOK, r.Services())
+	case len(ss) == 1 && req.Method == "GET":
+		instances, _ := r.Instances(ss[0])
+		renderJSON(w, http.StatusOK, instances)
+	case len(ss) == 2 && (req.Method == "PUT" || req.Method == "POST"):
+		var inst ServiceInstance
+		if err := json.NewDecoder(req.Body).Decode(&inst); err != nil {
+			renderText(w, http.StatusBadRequest, "read instance failed, "+err.Error())
+			return
+		}
+		inst.Service, inst.ID = ss[0], ss[1]
+		if err := r.Register(inst); err != nil {
+			renderText(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		renderText(w, http.StatusOK, "OK")
+	case len(ss) == 2 && req.Method == "DELETE":
+		if !r.Deregister(ss[0], ss[1]) {
+			renderText(w, http.StatusNotFound, "instance '"+urlPath+"' is not found.")
+			return
+		}
+		renderText(w, http.StatusOK, "OK")
+	case len(ss) <= 2:
+		renderText(w, http.StatusMethodNotAllowed, "Method '"+req.Method+"' is not allowed.")
+	default:
+		renderText(w, http.StatusNotFound, "'"+req.URL.Path+"' is not found.")
+	}
+}
+
+func renderJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value) // nolint
+}
+
+func renderText(w http.ResponseWriter, code int, txt string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	io.WriteString(w, txt) // nolint
+}
+
+type cachedInstances struct {
+	instances  []ServiceInstance
+	err        error
+	expiredAt  time.Time
+	refreshing bool
+}
+
+// httpDiscovery 从远程的 ServiceRegistry 查找实例，结果（包括失败）会被缓存 cacheTTL，
+// 缓存过期后在后台刷新，刷新完成前仍然返回过期的缓存，这样注册中心不可用时不会阻塞查找，
+// ServiceConfig 可以马上使用配置中的地址
+type httpDiscovery struct {
+	registryURL string
+	cacheTTL    time.Duration
+	client      *http.Client
+
+	lock  sync.Mutex
+	cache map[string]*cachedInstances
+}
+
+// NewHTTPDiscovery 创建一个访问远程 ServiceRegistry 的 Discovery，registryURL 是注册中心的挂载点，
+// 如 http://127.0.0.1:59876/services
+func NewHTTPDiscovery(registryURL string, cacheTTL time.Duration) Discovery {
+	if cacheTTL <= 0 {
+		cacheTTL = 5 * time.Second
+	}
+	return &httpDiscovery{
+		registryURL: registryURL,
+		cacheTTL:    cacheTTL,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		cache:       map[string]*cachedInstances{},
+	}
+}
+
+func (d *httpDiscovery) Instances(service string) ([]ServiceInstance, error) {
+	d.lock.Lock()
+	cached, ok := d.cache[service]
+	if ok {
+		instances, err := cached.instances, cached.err
+		if !cached.refreshing && !time.Now().Before(cached.expiredAt) {
+			cached.refreshing = true
+			go d.refresh(service)
+		}
+		d.lock.Unlock()
+		return instances, err
+	}
+	d.lock.Unlock()
+
+	// 第一次查找时还没有缓存，只能等待结果
+	return d.refresh(service)
+}
+
+func (d *httpDiscovery) refresh(service string) ([]ServiceInstance, error) {
+	instances, err := d.fetch(service)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	cached := d.cache[service]
+	if cached == nil {
+		cached = &cachedInstances{}
+		d.cache[service] = cached
+	}
+	if err == nil || cached.err != nil || cached.expiredAt.IsZero() {
+		// 失败时保留以前成功的结果
+		cached.instances, cached.err = instances, err
+	}
+	cached.expiredAt = time.Now().Add(d.cacheTTL)
+	cached.refreshing = false
+	return cached.instances, cached.err
+}
+
+func (d *httpDiscovery) fetch(service string) ([]ServiceInstance, error) {
+	resp, err := d.client.Get(urlutil.Join(d.registryURL, url.PathEscape(service)))
+	if err != nil {
+		return nil, errors.New("query instances of '" + service + "' failed, " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.New("query instances of '" + service + "' failed, " + resp.Status + ": " + string(bs))
+	}
+
+	var instances []ServiceInstance
+	if err := json.NewDecoder(resp.Body).Decode(&instances); err != nil {
+		return nil, errors.New("query instances of '" + service + "' failed, " + err.Error())
+	}
+	return instances, nil
+}
+
+// Registrar 周期性地将实例注册到远程的 ServiceRegistry 中（心跳），并发布它的健康状态
+type Registrar struct {
+	// URL 注册中心的挂载点，如 http://127.0.0.1:59876/services
+	URL      string
+	Instance ServiceInstance
+	// Interval 心跳的间隔，它应该小于注册中心的 ttl，缺省为 10s
+	Interval time.Duration
+	// Health 检查实例的健康状态，返回错误时实例的状态为 STATUS_DOWN，为 nil 时总是 STATUS_UP
+	Health func() error
+	Client *http.Client
+}
+
+func (r *Registrar) instanceURL() string {
+	return urlutil.Join(r.URL, url.PathEscape(r.Instance.Service), url.PathEscape(r.Instance.ID))
+}
+
+func (r *Registrar) do(ctx context.Context, method string, body []byte) error {
+	req, err := http.NewRequest(method, r.instanceURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(resp.Status + ": " + string(bs))
+	}
+	io.Copy(ioutil.Discard, resp.Body) // nolint
+	return nil
+}
+
+// Heartbeat 检查健康状态并注册一次实例
+func (r *Registrar) Heartbeat(ctx context.Context) error {
+	inst := r.Instance
+	inst.Status = STATUS_UP
+	if r.Health != nil {
+		if err := r.Health(); err != nil {
+			inst.Status = STATUS_DOWN
+		}
+	}
+	bs, err := json.Marshal(&inst)
+	if err != nil {
+		return err
+	}
+	if err := r.do(ctx, "PUT", bs); err != nil {
+		return errors.New("register '" + inst.Service + "/" + inst.ID + "' failed, " + err.Error())
+	}
+	return nil
+}
+
+// Deregister 注销实例
+func (r *Registrar) Deregister(ctx context.Context) error {
+	if err := r.do(ctx, "DELETE", nil); err != nil {
+		return errors.New("deregister '" + r.Instance.Service + "/" + r.Instance.ID + "' failed, " + err.Error())
+	}
+	return nil
+}
+
+// Run 周期性地发送心跳，直到 ctx 结束，结束时注销实例
+func (r *Registrar) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Heartbeat(ctx); err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			deregisterCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := r.Deregister(deregisterCtx); err != nil {
+				log.Println(err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
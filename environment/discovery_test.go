@@ -0,0 +1,236 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServiceRegistry(t *testing.T) {
+	now := time.Now()
+	registry := NewServiceRegistry(10 * time.Second)
+	registry.now = func() time.Time { return now }
+
+	for _, inst := range []ServiceInstance{
+		{Service: "a", ID: "2", Host: "192.168.1.2", Port: "80"},
+		{Service: "a", ID: "1", Host: "192.168.1.1", Port: "80", Status: STATUS_DOWN},
+		{Service: "b", ID: "1", Host: "192.168.1.3", Port: "80"},
+	} {
+		if err := registry.Register(inst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.Register(ServiceInstance{Service: "a", ID: "3"}); err == nil {
+		t.Error("excepted error is not nil")
+	}
+
+	instances, _ := registry.Instances("a")
+	if len(instances) != 2 || instances[0].ID != "1" || instances[1].ID != "2" ||
+		instances[0].IsHealthy() || !instances[1].IsHealthy() {
+		t.Error("instances is", instances)
+	}
+
+	now = now.Add(8 * time.Second)
+	registry.Register(ServiceInstance{Service: "a", ID: "2", Host: "192.168.1.2", Port: "80"})
+	now = now.Add(8 * time.Second)
+	instances, _ = registry.Instances("a")
+	if len(instances) != 1 || instances[0].ID != "2" {
+		t.Error("instances is", instances)
+	}
+	if services := registry.Services(); !reflect.DeepEqual(services, []string{"a"}) {
+		t.Error("services is", services)
+	}
+
+	if !registry.Deregister("a", "2") || registry.Deregister("a", "2") {
+		t.Error("deregister failed")
+	}
+	if services := registry.Services(); len(services) != 0 {
+		t.Error("services is", services)
+	}
+}
+
+func TestRegistrarAndHTTPDiscovery(t *testing.T) {
+	registry := NewServiceRegistry(time.Minute)
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	var healthErr error
+	registrar := &Registrar{
+		URL:      srv.URL + "/",
+		Instance: ServiceInstance{Service: "new_service", ID: "node1", Host: "192.168.1.1", Port: "8080"},
+		Health:   func() error { return healthErr },
+	}
+	ctx := context.Background()
+	if err := registrar.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := NewHTTPDiscovery(srv.URL, time.Nanosecond)
+	instances, err := discovery.Instances("new_service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Host != "192.168.1.1" || !instances[0].IsHealthy() {
+		t.Error("instances is", instances)
+	}
+
+	healthErr = errors.New("db is down")
+	if err := registrar.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	instances = waitInstances(discovery, "new_service", func(instances []ServiceInstance) bool {
+		return len(instances) == 1 && instances[0].Status == STATUS_DOWN
+	})
+	if len(instances) != 1 || instances[0].Status != STATUS_DOWN {
+		t.Error("instances is", instances)
+	}
+
+	if err := registrar.Deregister(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := registrar.Deregister(ctx); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	instances = waitInstances(discovery, "new_service", func(instances []ServiceInstance) bool {
+		return len(instances) == 0
+	})
+	if len(instances) != 0 {
+		t.Error("instances is", instances)
+	}
+
+	// 注册中心不可用时使用缓存
+	srv.Close()
+	if _, err := discovery.Instances("new_service"); err != nil {
+		t.Error(err)
+	}
+	if _, err := discovery.Instances("other"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+}
+
+// waitInstances 等待后台刷新缓存，直到 cond 为 true 或超时
+func waitInstances(discovery Discovery, service string, cond func([]ServiceInstance) bool) []ServiceInstance {
+	for i := 0; ; i++ {
+		instances, _ := discovery.Instances(service)
+		if cond(instances) || i >= 100 {
+			return instances
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHTTPDiscoveryCache(t *testing.T) {
+	var count int32
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&count, 1) {
+		case 1:
+			renderJSON(w, http.StatusOK, []ServiceInstance{{Service: "a", ID: "1", Host: "192.168.1.1"}})
+		case 2:
+			<-block
+			renderText(w, http.StatusInternalServerError, "registry is down")
+		default:
+			renderText(w, http.StatusInternalServerError, "registry is down")
+		}
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	discovery := NewHTTPDiscovery(srv.URL, 50*time.Millisecond)
+	if instances, err := discovery.Instances("a"); err != nil || len(instances) != 1 {
+		t.Fatal(instances, err)
+	}
+
+	// 缓存过期后不等待注册中心，马上返回过期的缓存
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		started := time.Now()
+		instances, err := discovery.Instances("a")
+		if err != nil || len(instances) != 1 {
+			t.Error(instances, err)
+		}
+		if elapsed := time.Since(started); elapsed > 20*time.Millisecond {
+			t.Error("Instances is blocked", elapsed)
+		}
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&count) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c := atomic.LoadInt32(&count); c != 2 {
+		t.Error("count is", c)
+	}
+
+	// 失败也会被缓存
+	if _, err := discovery.Instances("b"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if _, err := discovery.Instances("b"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if c := atomic.LoadInt32(&count); c != 3 {
+		t.Error("count is", c)
+	}
+}
+
+func TestServiceConfigDiscovery(t *testing.T) {
+	env := &Environment{
+		Config: newConfig(nil, map[string]string{
+			"new_service.port":    "9000",
+			"failover.balance":    BALANCE_FAILOVER,
+			"failover.port":       "9001",
+			"failover.is_ssl":     "true",
+			"failover.url_path":   "api",
+			"round_robin.balance": BALANCE_ROUND_ROBIN,
+		}),
+		dynamicServices: &dynamicServices{},
+	}
+
+	sc := env.GetServiceConfigByName("new_service")
+	if sc != env.GetServiceConfigByName("new_service") {
+		t.Error("service config is not cached")
+	}
+	if s := sc.URLFor("a"); s != "http://127.0.0.1:9000/a" {
+		t.Error("url is", s)
+	}
+
+	registry := NewServiceRegistry(time.Minute)
+	env.SetDiscovery(registry)
+	for _, inst := range []ServiceInstance{
+		{Service: "failover", ID: "1", Host: "192.168.1.1", Port: "80", Status: STATUS_DOWN},
+		{Service: "failover", ID: "2", Host: "192.168.1.2", Port: "80", IsSSL: true},
+		{Service: "failover", ID: "3", Host: "192.168.1.3", Port: "80"},
+		{Service: "round_robin", ID: "1", Host: "192.168.1.1", Port: "80"},
+		{Service: "round_robin", ID: "2", Host: "192.168.1.2", Port: "80"},
+	} {
+		if err := registry.Register(inst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failover := env.GetServiceConfigByName("failover")
+	for i := 0; i < 3; i++ {
+		if s := failover.URLFor("a"); s != "https://192.168.1.2:80/api/a" {
+			t.Error("url is", s)
+		}
+	}
+
+	roundRobin := env.GetServiceConfigByName("round_robin")
+	var urls []string
+	for i := 0; i < 4; i++ {
+		urls = append(urls, roundRobin.URLFor())
+	}
+	excepted := []string{"http://192.168.1.1:80", "http://192.168.1.2:80", "http://192.168.1.1:80", "http://192.168.1.2:80"}
+	if !reflect.DeepEqual(urls, excepted) {
+		t.Error("urls is", urls)
+	}
+
+	// 没有注册的实例时使用配置中的地址
+	if s := sc.URLFor("a"); s != "http://127.0.0.1:9000/a" {
+		t.Error("url is", s)
+	}
+}
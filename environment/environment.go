@@ -14,6 +14,7 @@ import (
 	"github.com/kardianos/osext"
 	"github.com/runner-mei/log"
 	commons_cfg "github.com/three-plus-three/modules/cfg"
+	"github.com/three-plus-three/modules/tid"
 	"github.com/three-plus-three/modules/util"
 	"go.uber.org/zap"
 )
@@ -53,6 +54,8 @@ type Environment struct {
 	RawDaemonUrlPath   string
 	DaemonUrlPath      string
 	serviceOptions     []ServiceConfig
+	dynamicServices    *dynamicServices
+	discovery          Discovery
 
 	LogConfig          zap.Config
 	Logger             log.Logger
@@ -60,6 +63,9 @@ type Environment struct {
 	notRedirectStdLog  bool
 
 	Engine EngineConfig
+
+	configFiles []string
+	flagSet     *flag.FlagSet
 }
 
 func (env *Environment) EnabledPipe() bool {
@@ -96,6 +102,7 @@ func (self *Environment) Clone() *Environment {
 	for idx := range self.serviceOptions {
 		copyed.serviceOptions[idx].env = copyed
 	}
+	copyed.dynamicServices = &dynamicServices{}
 	return copyed
 }
 
@@ -132,6 +139,11 @@ func (self *Environment) GetEngineConfig() *EngineConfig {
 }
 
 func NewEnvironment(opt Options) (*Environment, error) {
+	return NewEnvironmentWithFS(NewFileSystem(opt), opt)
+}
+
+// NewFileSystem 按 NewEnvironment 的规则查找安装目录，并创建文件系统
+func NewFileSystem(opt Options) FileSystem {
 	var fs *linuxFs
 	if runtime.GOOS == "windows" {
 		var rootDir = opt.ConfDir
@@ -212,7 +224,7 @@ func NewEnvironment(opt Options) (*Environment, error) {
 	if dataDir := os.Getenv("hw_data_dir"); dataDir != "" {
 		fs.dataDir = dataDir
 	}
-	return NewEnvironmentWithFS(fs, opt)
+	return fs
 }
 
 func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
@@ -225,7 +237,9 @@ func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
 		}
 	}
 
-	cfg := ReadConfigs(fs, opt.ConfigFiles, projectName, !opt.NotPrintIfFilesFound, opt.PrintIfFilesNotFound)
+	fileCfg := ReadConfigs(fs, opt.ConfigFiles, projectName, !opt.NotPrintIfFilesFound, opt.PrintIfFilesNotFound)
+	_, fileSources, _ := readConfigFilesWithSources(fs, opt.ConfigFiles, projectName)
+	cfg, sources := mergeLayers(dbDefaults, fileCfg, fileSources, os.Environ(), opt.FlagSet)
 	if e := InitConfig(opt.FlagSet, cfg); nil != e {
 		return nil, e
 	}
@@ -236,11 +250,12 @@ func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
 		//rootDir: opt.rootDir,
 		Fs:     fs,
 		Name:   projectName,
-		Config: Config{settings: map[string]interface{}{}},
-	}
-	for k, v := range cfg {
-		env.Config.Set(k, v)
+		Config: newConfig(nil, cfg),
+
+		configFiles: opt.ConfigFiles,
+		flagSet:     opt.FlagSet,
 	}
+	env.Config.setSources(sources)
 
 	env.RawDaemonUrlPath = stringWith(cfg, "daemon.urlpath", "hengwei")
 	env.DaemonUrlPath = env.RawDaemonUrlPath
@@ -251,8 +266,12 @@ func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
 		env.DaemonUrlPath = env.DaemonUrlPath + "/"
 	}
 
-	env.Db.Models = ReadDbConfig("models.", cfg, dbDefaults)
-	env.Db.Data = ReadDbConfig("data.", cfg, dbDefaults)
+	keyFile := fs.FromDataConfig(SECRET_KEY_FILE)
+	env.Config.loadState().secretKeyFile = keyFile
+	SetSecretKeyFile(keyFile)
+
+	env.Db.Models = readDbConfig("models.", cfg, dbDefaults, keyFile)
+	env.Db.Data = readDbConfig("data.", cfg, dbDefaults, keyFile)
 	env.Engine = loadEngineConfig(&env.Config)
 	env.serviceOptions = make([]ServiceConfig, len(ServiceOptions))
 	for idx, so := range ServiceOptions {
@@ -262,6 +281,16 @@ func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
 		env.serviceOptions[idx].env = env
 		// env.serviceOptions[idx].listeners.Init()
 	}
+	env.dynamicServices = &dynamicServices{}
+	if err := tid.Configure(tid.Options{
+		Node:     int64(env.Config.IntWithDefault("tid.node", 0)),
+		NodeBits: env.Config.UintWithDefault("tid.node_bits", 0),
+	}); err != nil {
+		return nil, errors.New("tid.node or tid.node_bits is invalid, " + err.Error())
+	}
+	if registryURL := stringWith(cfg, "discovery.url", ""); registryURL != "" {
+		env.discovery = NewHTTPDiscovery(registryURL, env.Config.DurationWithDefault("discovery.cache_ttl", 0))
+	}
 
 	if env.CurrentApplication != ENV_MIN_PROXY_ID {
 		so := env.GetServiceConfig(env.CurrentApplication)
@@ -273,6 +302,10 @@ func NewEnvironmentWithFS(fs FileSystem, opt Options) (*Environment, error) {
 			return nil, err
 		}
 	}
+	for _, warning := range CheckKeys(fileCfg) {
+		env.Logger.Warn(warning)
+	}
+
 	if err := env.initTSDB(opt.PrintIfFilesNotFound); err != nil {
 		return nil, err
 	}
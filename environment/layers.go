@@ -0,0 +1,113 @@
+package environment
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+// ENV_PREFIX 覆盖配置的环境变量的前缀
+//
+// 配置按下列的顺序合并，后面的覆盖前面的：
+//
+//  1. SetDefaults 设置的缺省值
+//  2. app.properties
+//  3. Options.ConfigFiles 指定的文件，<name>.properties 和 engine.properties
+//  4. HW_ 开头的环境变量，如 HW_MODELS_DB_PASSWORD 覆盖 models.db.password
+//  5. 命令行中明确指定的参数，它只覆盖同名的配置项
+//
+// 环境变量名去掉前缀后，先和已有的配置项比较（忽略大小写，'.' 看作 '_'），相同时覆盖它，
+// 否则转成小写，"__" 转成 '_'，'_' 转成 '.'，如 HW_USERS_LDAP__ADDRESS 为 users.ldap_address，
+// 这样在容器中可以完全不用配置文件。
+// 合并后值中的 ${var} 和 ${var:-default} 会被替换，var 先从配置中查找，再从环境变量中查找
+const ENV_PREFIX = "HW_"
+
+// envOverrides 从环境变量中读取覆盖配置的值，返回配置项的值和它对应的环境变量名
+func envOverrides(environ []string, props map[string]string) (map[string]string, map[string]string) {
+	known := map[string]string{}
+	addKnown := func(key string) {
+		known[strings.ToUpper(strings.Replace(key, ".", "_", -1))] = key
+	}
+	for k := range props {
+		addKnown(k)
+	}
+	for _, key := range KnownKeys("") {
+		addKnown(key.Key)
+	}
+
+	values := map[string]string{}
+	names := map[string]string{}
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, ENV_PREFIX) {
+			continue
+		}
+		idx := strings.Index(kv, "=")
+		if idx <= len(ENV_PREFIX) {
+			continue
+		}
+		name, value := kv[:idx], kv[idx+1:]
+
+		key, ok := known[strings.ToUpper(name[len(ENV_PREFIX):])]
+		if !ok {
+			key = strings.ToLower(name[len(ENV_PREFIX):])
+			key = strings.Replace(key, "__", "\x00", -1)
+			key = strings.Replace(key, "_", ".", -1)
+			key = strings.Replace(key, "\x00", "_", -1)
+		}
+		values[key] = value
+		names[key] = name
+	}
+	return values, names
+}
+
+// mergeLayers 按 ENV_PREFIX 中说明的顺序合并配置，返回合并后的配置和每个配置项的来源
+func mergeLayers(defaults, files, fileSources map[string]string, environ []string, flagSet *flag.FlagSet) (map[string]string, map[string]string) {
+	props := map[string]string{}
+	sources := map[string]string{}
+	for k, v := range defaults {
+		props[k] = v
+		sources[k] = SOURCE_DEFAULT
+	}
+	for k, v := range files {
+		props[k] = v
+		if source, ok := fileSources[k]; ok {
+			sources[k] = source
+		} else {
+			sources[k] = SOURCE_FILE
+		}
+	}
+
+	values, names := envOverrides(environ, props)
+	for k, v := range values {
+		props[k] = v
+		sources[k] = SOURCE_ENV + ":" + names[k]
+	}
+
+	if flagSet == nil {
+		flagSet = flag.CommandLine
+	}
+	known := map[string]bool{}
+	for _, key := range KnownKeys("") {
+		known[key.Key] = true
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		if _, ok := props[f.Name]; ok || known[f.Name] {
+			props[f.Name] = f.Value.String()
+			sources[f.Name] = SOURCE_FLAG + ":-" + f.Name
+		}
+	})
+	return commons_cfg.ExpandAll(props), sources
+}
+
+// ReadLayeredConfigs 按 ENV_PREFIX 中说明的顺序读取服务 nm 的配置，返回合并后的配置和每个配置项的来源，
+// 它和 ReadConfigs 不同的是配置文件读取失败时返回错误
+func ReadLayeredConfigs(fs FileSystem, files []string, nm string, flagSet *flag.FlagSet) (map[string]string, map[string]string, error) {
+	props, fileSources, err := readConfigFilesWithSources(fs, files, nm)
+	if err != nil {
+		return nil, nil, err
+	}
+	props, sources := mergeLayers(dbDefaults, props, fileSources, os.Environ(), flagSet)
+	return props, sources, nil
+}
@@ -0,0 +1,69 @@
+package environment
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestMergeLayers(t *testing.T) {
+	defaults := map[string]string{"redis.port": "36379", "models.db.type": "postgresql", "models.db.port": "5432"}
+	files := map[string]string{
+		"models.db.port":     "35432",
+		"models.db.password": "abc",
+		"users.ldap_address": "192.168.1.2",
+		"web.url":            "http://${web.host:-127.0.0.1}:${web.port}",
+		"web.port":           "80",
+	}
+	fileSources := map[string]string{"models.db.port": SOURCE_FILE + ":app.properties"}
+	environ := []string{
+		"PATH=/bin",
+		"HW_MODELS_DB_PASSWORD=123",
+		"HW_USERS_LDAP_ADDRESS=192.168.1.3",
+		"HW_NEW_SECTION__KEY=new",
+		"HW_WEB_PORT=8080",
+		"HW_=abc",
+	}
+
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("redis.port", "", "")
+	flagSet.String("not_config", "", "")
+	if err := flagSet.Parse([]string{"-redis.port=6379", "-not_config=a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	props, sources := mergeLayers(defaults, files, fileSources, environ, flagSet)
+	excepted := map[string]string{
+		"redis.port":         "6379",
+		"models.db.type":     "postgresql",
+		"models.db.port":     "35432",
+		"models.db.password": "123",
+		"users.ldap_address": "192.168.1.3",
+		"new.section_key":    "new",
+		"web.url":            "http://127.0.0.1:8080",
+		"web.port":           "8080",
+	}
+	if !reflect.DeepEqual(props, excepted) {
+		t.Errorf("excepted %#v", excepted)
+		t.Errorf("actual   %#v", props)
+	}
+
+	exceptedSources := map[string]string{
+		"redis.port":         "flag:-redis.port",
+		"models.db.type":     "default",
+		"models.db.port":     "file:app.properties",
+		"models.db.password": "env:HW_MODELS_DB_PASSWORD",
+		"users.ldap_address": "env:HW_USERS_LDAP_ADDRESS",
+		"new.section_key":    "env:HW_NEW_SECTION__KEY",
+		"web.url":            "file",
+		"web.port":           "env:HW_WEB_PORT",
+	}
+	if !reflect.DeepEqual(sources, exceptedSources) {
+		t.Errorf("excepted %#v", exceptedSources)
+		t.Errorf("actual   %#v", sources)
+	}
+
+	if db := ReadDbConfig("models.", props, nil); db.Password != "123" || db.Port != "35432" {
+		t.Error("db is", db)
+	}
+}
@@ -0,0 +1,264 @@
+package environment
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+// 配置值的来源
+const (
+	SOURCE_DEFAULT = "default"
+	SOURCE_FILE    = "file"
+	SOURCE_FLAG    = "flag"
+	SOURCE_ENV     = "env"
+	SOURCE_RUNTIME = "runtime"
+)
+
+// KeyInfo 一个已知的配置项
+type KeyInfo struct {
+	Service     string
+	Key         string
+	Default     string
+	Description string
+}
+
+var (
+	keyLock   sync.RWMutex
+	knownKeys = map[string]KeyInfo{}
+)
+
+// RegisterKeys 登记服务 service 使用的配置项，启动时用它们检查配置中未知的或拼写错误的配置项
+func RegisterKeys(service string, keys ...KeyInfo) {
+	keyLock.Lock()
+	defer keyLock.Unlock()
+	for _, key := range keys {
+		key.Service = service
+		knownKeys[key.Key] = key
+	}
+}
+
+// RegisterStruct 登记用 Config.Bind(prefix, value) 读取的配置项，一般在 init 中调用它
+func RegisterStruct(service, prefix string, value interface{}) {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv = reflect.New(rv.Type().Elem())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic("RegisterStruct: value must is a struct")
+	}
+
+	var keys []KeyInfo
+	walkFields(prefix, rv, func(key string, field reflect.StructField, fv reflect.Value) {
+		keys = append(keys, KeyInfo{
+			Key:         key,
+			Default:     field.Tag.Get("default"),
+			Description: field.Tag.Get("description"),
+		})
+	})
+	RegisterKeys(service, keys...)
+}
+
+// KnownKeys 返回服务 service 使用的配置项，service 为空时返回全部，按 key 排序
+func KnownKeys(service string) []KeyInfo {
+	keyLock.RLock()
+	defer keyLock.RUnlock()
+
+	var keys []KeyInfo
+	for _, key := range knownKeys {
+		if service == "" || key.Service == service {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// CheckKeys 检查配置中未登记的配置项，它和一个已登记的配置项很相似时认为是拼写错误，
+// 它和已登记的配置项有相同的第一级名称（第一个 '.' 之前的部分）时认为是未知的，返回告警信息
+func CheckKeys(props map[string]string) []string {
+	known := KnownKeys("")
+	if len(known) == 0 {
+		return nil
+	}
+	namespaces := map[string]bool{}
+	exists := map[string]bool{}
+	for _, key := range known {
+		exists[key.Key] = true
+		if idx := strings.Index(key.Key, "."); idx > 0 {
+			namespaces[key.Key[:idx]] = true
+		}
+	}
+
+	names := make([]string, 0, len(props))
+	for k := range props {
+		if !exists[k] {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, k := range names {
+		similar, distance := "", len(k)
+		for _, key := range known {
+			if d := editDistance(k, key.Key); d < distance {
+				similar, distance = key.Key, d
+			}
+		}
+		if similar != "" && distance <= 2 && distance*4 <= len(k) {
+			warnings = append(warnings, "config '"+k+"' is unknown, did you mean '"+similar+"'?")
+			continue
+		}
+		if idx := strings.Index(k, "."); idx > 0 && namespaces[k[:idx]] {
+			warnings = append(warnings, "config '"+k+"' is unknown.")
+		}
+	}
+	return warnings
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(prev[j]+1, current[j-1]+1), prev[j-1]+cost)
+		}
+		prev, current = current, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Source 返回配置项的来源，如 "file:/etc/tpt/app.properties", "runtime"，配置项不存在时返回空
+func (self *Config) Source(key string) string {
+	state := self.loadState()
+	if state == nil {
+		return ""
+	}
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	if _, ok := state.settings[key]; !ok {
+		return ""
+	}
+	if source, ok := state.sources[key]; ok {
+		return source
+	}
+	if _, ok := state.loaded[key]; ok {
+		return SOURCE_FILE
+	}
+	return SOURCE_RUNTIME
+}
+
+func (self *Config) setSources(sources map[string]string) {
+	state := self.initState()
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	for k, v := range sources {
+		state.sources[k] = v
+	}
+}
+
+// ConfigEntry 一个生效的配置项
+type ConfigEntry struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// Entries 返回生效的配置项及它们的来源，包括在 flagSet 中被设置的参数和已登记但没有配置的缺省值，按 key 排序
+func (self *Config) Entries(flagSet *flag.FlagSet) []ConfigEntry {
+	entries := map[string]ConfigEntry{}
+	for _, key := range KnownKeys("") {
+		entries[key.Key] = ConfigEntry{Key: key.Key, Value: key.Default, Source: SOURCE_DEFAULT}
+	}
+	if flagSet != nil {
+		flagSet.Visit(func(f *flag.Flag) {
+			entries[f.Name] = ConfigEntry{Key: f.Name, Value: f.Value.String(), Source: SOURCE_FLAG + ":-" + f.Name}
+		})
+	}
+	for k, v := range self.snapshot() {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		entries[k] = ConfigEntry{Key: k, Value: s, Source: self.Source(k)}
+	}
+
+	results := make([]ConfigEntry, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, entry)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+	return results
+}
+
+// isSecretKey 判断配置项是不是密码之类的敏感信息
+func isSecretKey(key, value string) bool {
+	key = strings.ToLower(key)
+	return strings.Contains(key, "password") ||
+		strings.Contains(key, "secret") ||
+		commons_cfg.IsEncrypted(value)
+}
+
+// WriteConfigEntries 输出配置项，每一行为 key=value #source，showSecrets 为 false 时密码之类的值被隐藏
+func WriteConfigEntries(w io.Writer, entries []ConfigEntry, showSecrets bool) error {
+	for _, entry := range entries {
+		value := entry.Value
+		if !showSecrets && value != "" && isSecretKey(entry.Key, value) {
+			value = "******"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s #%s\r\n", entry.Key, value, entry.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpConfig 输出当前生效的配置及它们的来源
+func (env *Environment) DumpConfig(w io.Writer, showSecrets bool) error {
+	flagSet := env.flagSet
+	if flagSet == nil {
+		flagSet = flag.CommandLine
+	}
+	return WriteConfigEntries(w, env.Config.Entries(flagSet), showSecrets)
+}
+
+// LoadConfig 和 NewEnvironment 一样读取服务 nm 的配置文件和环境变量（见 ENV_PREFIX），并记录每个配置项的来源
+func LoadConfig(fs FileSystem, files []string, nm string) (*Config, error) {
+	props, sources, err := ReadLayeredConfigs(fs, files, nm, flag.NewFlagSet(nm, flag.ContinueOnError))
+	if err != nil {
+		return nil, err
+	}
+	cfg := newConfig(nil, props)
+	cfg.loadState().secretKeyFile = fs.FromDataConfig(SECRET_KEY_FILE)
+	cfg.setSources(sources)
+	return &cfg, nil
+}
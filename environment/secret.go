@@ -0,0 +1,63 @@
+package environment
+
+import (
+	"errors"
+	"sync"
+
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+// SECRET_KEY_FILE 加密配置值使用的密钥文件，它在 Fs.FromDataConfig() 目录下
+const SECRET_KEY_FILE = "secret.key"
+
+var (
+	secretLock    sync.RWMutex
+	secretKeyFile string
+
+	errSecretKeyFileNotSet = errors.New("secret key file is not set.")
+)
+
+// SetSecretKeyFile 设置没有 Environment 时（如 ReadDbConfig）解密配置使用的密钥文件，
+// 创建 Environment 时会自动设为它的 Fs.FromDataConfig(SECRET_KEY_FILE)
+func SetSecretKeyFile(filename string) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secretKeyFile = filename
+}
+
+// SecretKeyFile 返回缺省的密钥文件
+func SecretKeyFile() string {
+	secretLock.RLock()
+	defer secretLock.RUnlock()
+	return secretKeyFile
+}
+
+// decryptWith 解密形如 ENC(...) 的值，不是加密值时原样返回，
+// 密钥文件每次都重新读取，这样密钥轮换后不用重启
+func decryptWith(keyFile, value string) (string, error) {
+	if !commons_cfg.IsEncrypted(value) {
+		return value, nil
+	}
+	if keyFile == "" {
+		return "", errSecretKeyFileNotSet
+	}
+	key, err := commons_cfg.ReadSecretKey(keyFile)
+	if err != nil {
+		return "", err
+	}
+	return commons_cfg.Decrypt(key, value)
+}
+
+// Decrypt 解密形如 ENC(...) 的配置值，不是加密值时原样返回
+func (self *Config) Decrypt(value string) (string, error) {
+	keyFile := ""
+	if state := self.loadState(); state != nil {
+		state.lock.RLock()
+		keyFile = state.secretKeyFile
+		state.lock.RUnlock()
+	}
+	if keyFile == "" {
+		keyFile = SecretKeyFile()
+	}
+	return decryptWith(keyFile, value)
+}
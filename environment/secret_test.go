@@ -0,0 +1,54 @@
+package environment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+func TestPasswordDecrypt(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	key, err := commons_cfg.GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(tmp, SECRET_KEY_FILE)
+	if err := commons_cfg.WriteSecretKey(keyFile, key); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := commons_cfg.Encrypt(key, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props := map[string]string{"a.password": encrypted, "b.password": "def", "models.db.password": encrypted}
+	cfg := newConfig(nil, props)
+	cfg.loadState().secretKeyFile = keyFile
+
+	if s := cfg.PasswordWithDefault("a.password", "x"); s != "abc" {
+		t.Error("a.password is", s)
+	}
+	if s := cfg.PasswordWithDefault("b.password", "x"); s != "def" {
+		t.Error("b.password is", s)
+	}
+	if s := cfg.StringWithDefault("a.password", "x"); s != encrypted {
+		t.Error("a.password is", s)
+	}
+
+	if db := readDbConfig("models.", props, nil, keyFile); db.Password != "abc" {
+		t.Error("password of db is", db.Password)
+	}
+
+	cfg.loadState().secretKeyFile = filepath.Join(tmp, "not_exists.key")
+	if s := cfg.PasswordWithDefault("a.password", "x"); s != "x" {
+		t.Error("a.password is", s)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/runner-mei/resty"
 	"github.com/three-plus-three/modules/netutil"
+	"github.com/three-plus-three/modules/tracing"
 	"github.com/three-plus-three/modules/urlutil"
 )
 
@@ -22,6 +23,9 @@ type ServiceConfig struct {
 	Host    string
 	Port    string
 	UrlPath string
+	// Balance 有多个注册的实例时选择实例的策略，见 BALANCE_ROUND_ROBIN
+	Balance string
+	next    uint32
 	proxy   *resty.Proxy
 
 	// surl atomic.Value
@@ -36,6 +40,7 @@ func (cfg *ServiceConfig) copyFrom(src *ServiceConfig) {
 	cfg.Host = src.Host
 	cfg.Port = src.Port
 	cfg.UrlPath = src.UrlPath
+	cfg.Balance = src.Balance
 }
 
 func (sc *ServiceConfig) loadConfig(cfg map[string]string, so ServiceOption) {
@@ -44,6 +49,7 @@ func (sc *ServiceConfig) loadConfig(cfg map[string]string, so ServiceOption) {
 
 	sc.Type = stringWith(cfg, so.Name+".type", so.Type)
 	sc.IsSSL = boolWith(cfg, so.Name+".is_ssl", so.IsSSL)
+	sc.Balance = stringWith(cfg, so.Name+".balance", BALANCE_ROUND_ROBIN)
 
 	switch so.ID {
 	case ENV_HOME_PROXY_ID:
@@ -64,7 +70,7 @@ func (sc *ServiceConfig) loadConfig(cfg map[string]string, so ServiceOption) {
 
 // ListenAddr 服务的监听地址
 func (cfg *ServiceConfig) ListenAddr(typ, pa string) (string, string) {
-	if cfg.ID >= ENV_MAX_PROXY_ID {
+	if cfg.isUnknown() {
 		panic("unknow service")
 	}
 	if typ == "" {
@@ -100,7 +106,7 @@ func (cfg *ServiceConfig) ListenAddr(typ, pa string) (string, string) {
 
 // ListenAddr 服务的连接地址
 func (cfg *ServiceConfig) RemoteAddr(typ, pa string) (string, string) {
-	if cfg.ID >= ENV_MAX_PROXY_ID {
+	if cfg.isUnknown() {
 		panic("unknow service")
 	}
 	if pa != "" {
@@ -121,6 +127,10 @@ func (cfg *ServiceConfig) RemoteAddr(typ, pa string) (string, string) {
 		}
 	}
 
+	if inst, ok := cfg.pickInstance(); ok {
+		return "tcp", net.JoinHostPort(inst.Host, inst.Port)
+	}
+
 	//	if engine := cfg.env.GetEngineConfig(); engine.IsEnabled && !engine.IsMasterHost {
 	//		host := engine.RemoteHost
 	//		port := cfg.Port
@@ -163,6 +173,10 @@ func (cfg *ServiceConfig) getHostAndPort() (bool, string, string) {
 	// 	}
 	// }
 
+	if inst, ok := cfg.pickInstance(); ok {
+		return inst.IsSSL, inst.Host, inst.Port
+	}
+
 	isSSL := cfg.IsSSL
 	host := cfg.Host
 	port := cfg.Port
@@ -191,7 +205,7 @@ func (cfg *ServiceConfig) getHostAndPort() (bool, string, string) {
 }
 
 func (cfg *ServiceConfig) URLFor(s ...string) string {
-	if cfg.ID >= ENV_MAX_PROXY_ID {
+	if cfg.isUnknown() {
 		panic("unknow service")
 	}
 
@@ -228,13 +242,14 @@ func (cfg *ServiceConfig) URIFor(s ...string) *url.URL {
 //	}
 //}
 
-// Resty 服务的访问
+// Resty 服务的访问，请求的 context 中有 span 时跟踪的上下文会被注入到请求头中
 func (cfg *ServiceConfig) Resty() resty.ImmutableProxy {
 	if cfg.proxy == nil {
 		pxy, err := resty.New(cfg.URLFor())
 		if err != nil {
 			panic(err)
 		}
+		pxy.Client = tracing.WrapClient(pxy.Client)
 		cfg.proxy = pxy
 	}
 	cfg.proxy.SetURLFor(func(u *url.URL) error {
@@ -0,0 +1,144 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/runner-mei/log"
+	commons_cfg "github.com/three-plus-three/modules/cfg"
+)
+
+// configFileNames 和 ReadConfigs 中的顺序一样，后面的文件覆盖前面的，其中的文件可以不存在
+func configFileNames(fs FileSystem, files []string, nm string) []string {
+	names := []string{fs.FromConfig("app.properties"), fs.FromDataConfig("app.properties")}
+	for _, file := range files {
+		if !filepath.IsAbs(file) {
+			file = fs.FromDataConfig(file)
+		}
+		names = append(names, file)
+	}
+	for _, s := range []string{nm + ".properties", "engine.properties"} {
+		names = append(names, fs.FromConfig(s), fs.FromDataConfig(s))
+	}
+	return names
+}
+
+// readConfigFiles 和 ReadConfigs 一样读取配置，但是文件读取失败时返回错误而不是跳过它
+func readConfigFiles(fs FileSystem, files []string, nm string) (map[string]string, error) {
+	cfg, _, err := readConfigFilesWithSources(fs, files, nm)
+	return cfg, err
+}
+
+// readConfigFilesWithSources 和 readConfigFiles 一样，同时返回每个配置项来自哪个文件
+func readConfigFilesWithSources(fs FileSystem, files []string, nm string) (map[string]string, map[string]string, error) {
+	cfg := map[string]string{}
+	sources := map[string]string{}
+	for _, file := range configFileNames(fs, files, nm) {
+		props, e := commons_cfg.ReadProperties(file)
+		if e != nil {
+			if os.IsNotExist(e) {
+				continue
+			}
+			return nil, nil, errors.New("read properties '" + file + "' failed, " + e.Error())
+		}
+		for k, v := range props {
+			cfg[k] = v
+			sources[k] = SOURCE_FILE + ":" + file
+		}
+	}
+	return cfg, sources, nil
+}
+
+// ReloadConfig 重新读取配置文件（包括环境变量等，见 ENV_PREFIX），并将修改应用到 env.Config 中，
+// 注意 Db, Engine 和服务的配置等是在启动时从配置中计算出来的，它们不会被更新
+func (env *Environment) ReloadConfig() ([]ConfigChange, error) {
+	props, sources, err := ReadLayeredConfigs(env.Fs, env.configFiles, env.Name, env.flagSet)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := env.Config.Reload(props)
+	if err != nil {
+		return nil, err
+	}
+	env.Config.setSources(sources)
+	return changes, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statConfigFiles(names []string) map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	for _, nm := range names {
+		if st, err := os.Stat(nm); err == nil {
+			stamps[nm] = fileStamp{modTime: st.ModTime(), size: st.Size()}
+		}
+	}
+	return stamps
+}
+
+func isStampsChanged(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || !bv.modTime.Equal(v.modTime) || bv.size != v.size {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchConfig 每隔 interval 检查一次配置文件，文件有修改或收到 SIGHUP 信号时重新加载配置,
+// 加载失败时保留原来的配置，ctx 取消时停止
+func (env *Environment) WatchConfig(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	names := configFileNames(env.Fs, env.configFiles, env.Name)
+	stamps := statConfigFiles(names)
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sighup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sighup:
+				stamps = statConfigFiles(names)
+			case <-ticker.C:
+				current := statConfigFiles(names)
+				if !isStampsChanged(stamps, current) {
+					continue
+				}
+				stamps = current
+			}
+
+			changes, err := env.ReloadConfig()
+			if err != nil {
+				env.Logger.Warn("重新加载配置失败", log.Error(err))
+			} else if len(changes) > 0 {
+				keys := make([]string, 0, len(changes))
+				for _, change := range changes {
+					keys = append(keys, change.Key)
+				}
+				env.Logger.Info("重新加载配置成功", log.String("keys", strings.Join(keys, ",")))
+			}
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/log"
+)
+
+func TestConfigReload(t *testing.T) {
+	cfg := newConfig(nil, map[string]string{"a.x": "1", "a.y": "2", "b": "3"})
+	cfg.Set("runtime", 4)
+
+	var all, onlyA [][]ConfigChange
+	cfg.OnChange("", func(changes []ConfigChange) {
+		all = append(all, changes)
+	})
+	unsubscribe := cfg.OnChange("a.", func(changes []ConfigChange) {
+		onlyA = append(onlyA, changes)
+	})
+
+	changes, err := cfg.Reload(map[string]string{"a.x": "10", "b": "3", "c": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excepted := []ConfigChange{
+		{Key: "a.x", Old: "1", New: "10"},
+		{Key: "a.y", Old: "2"},
+		{Key: "c", New: "5"},
+	}
+	if !reflect.DeepEqual(changes, excepted) {
+		t.Errorf("excepted %#v, actual is %#v", excepted, changes)
+	}
+	if len(all) != 1 || !reflect.DeepEqual(all[0], excepted) {
+		t.Error("all is", all)
+	}
+	if len(onlyA) != 1 || !reflect.DeepEqual(onlyA[0], excepted[:2]) {
+		t.Error("onlyA is", onlyA)
+	}
+
+	if s := cfg.StringWithDefault("a.x", ""); s != "10" {
+		t.Error("a.x is", s)
+	}
+	if o := cfg.Get("a.y"); o != nil {
+		t.Error("a.y is", o)
+	}
+	if i := cfg.IntWithDefault("runtime", 0); i != 4 {
+		t.Error("runtime is", i)
+	}
+
+	changes, err = cfg.Reload(map[string]string{"a.x": "10", "b": "3", "c": "5"})
+	if err != nil || len(changes) != 0 {
+		t.Error("excepted no changes, actual is", changes, err)
+	}
+
+	unsubscribe()
+	cfg.Set("a.x", "11")
+	if len(onlyA) != 1 {
+		t.Error("unsubscribe isn't work")
+	}
+	if len(all) != 2 {
+		t.Error("Set isn't notified")
+	}
+}
+
+func TestConfigZeroValue(t *testing.T) {
+	var env Environment
+	if s := env.Config.StringWithDefault("a", "def"); s != "def" {
+		t.Error("a is", s)
+	}
+	if s := env.Config.Source("a"); s != "" {
+		t.Error("source of a is", s)
+	}
+	env.Config.ForEach(func(key string, value interface{}) {
+		t.Error("unexpected", key, value)
+	})
+
+	var cfg Config
+	var all []ConfigChange
+	cfg.OnChange("", func(changes []ConfigChange) {
+		all = append(all, changes...)
+	})
+	cfg.Set("a", "1")
+	if s := cfg.StringWithDefault("a", ""); s != "1" {
+		t.Error("a is", s)
+	}
+	if s := cfg.Source("a"); s != SOURCE_RUNTIME {
+		t.Error("source of a is", s)
+	}
+
+	changes, err := cfg.Reload(map[string]string{"b": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excepted := []ConfigChange{{Key: "b", New: "2"}}; !reflect.DeepEqual(changes, excepted) {
+		t.Errorf("excepted %#v, actual is %#v", excepted, changes)
+	}
+	if len(all) != 2 {
+		t.Error("all is", all)
+	}
+}
+
+func TestConfigZeroValueConcurrent(t *testing.T) {
+	var cfg Config
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			cfg.Set("a"+strconv.Itoa(i), i)
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			cfg.IntWithDefault("a"+strconv.Itoa(i), 0)
+			cfg.Source("a" + strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		if v := cfg.IntWithDefault("a"+strconv.Itoa(i), -1); v != i {
+			t.Error("a"+strconv.Itoa(i), "is", v)
+		}
+	}
+}
+
+func TestConfigReloadValidate(t *testing.T) {
+	cfg := newConfig(nil, map[string]string{"port": "80"})
+	called := false
+	cfg.OnChange("", func(changes []ConfigChange) {
+		called = true
+	})
+	cfg.OnValidate(func(next *Config, changes []ConfigChange) error {
+		if port := next.IntWithDefault("port", 0); port <= 0 || port > 65535 {
+			return errors.New("port is invalid")
+		}
+		return nil
+	})
+
+	_, err := cfg.Reload(map[string]string{"port": "80000"})
+	if err == nil {
+		t.Fatal("excepted error is not nil")
+	}
+	if s := cfg.StringWithDefault("port", ""); s != "80" || called {
+		t.Error("bad reload is applied")
+	}
+
+	if _, err := cfg.Reload(map[string]string{"port": "8080"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := cfg.StringWithDefault("port", ""); s != "8080" || !called {
+		t.Error("reload isn't applied")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fs := &linuxFs{installDir: tmp, confDir: filepath.Join(tmp, "data", "conf")}
+	if err := os.MkdirAll(fs.FromConfig(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fs.FromConfig("app.properties"), []byte("a=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	props, err := readConfigFiles(fs, nil, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &Environment{Fs: fs, Name: "test", Config: newConfig(nil, props), Logger: log.Empty()}
+
+	changed := make(chan []ConfigChange, 1)
+	env.Config.OnChange("a", func(changes []ConfigChange) {
+		changed <- changes
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env.WatchConfig(ctx, 10*time.Millisecond)
+
+	if err := ioutil.WriteFile(fs.FromConfig("app.properties"), []byte("a=22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changes := <-changed:
+		excepted := []ConfigChange{{Key: "a", Old: "1", New: "22"}}
+		if !reflect.DeepEqual(changes, excepted) {
+			t.Errorf("excepted %#v, actual is %#v", excepted, changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change isn't notified")
+	}
+	if s := env.Config.StringWithDefault("a", ""); s != "22" {
+		t.Error("a is", s)
+	}
+}
@@ -0,0 +1,82 @@
+package errors
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PROBLEM_TYPE_BASE 是错误码目录中默认的 type URI 前缀，错误码的 type URI 为前缀加上错误码
+var PROBLEM_TYPE_BASE = "urn:three-plus-three:error:"
+
+// CatalogEntry 错误码目录中的一项
+type CatalogEntry struct {
+	Code int
+	// Type 为空时使用 PROBLEM_TYPE_BASE 加上错误码
+	Type string
+	// Title 是没有对应语言的消息时使用的标题
+	Title string
+	// Messages 本地化的消息，键为语言，如 zh-CN 和 en
+	Messages map[string]string
+}
+
+var catalog = struct {
+	lock    sync.RWMutex
+	entries map[int]CatalogEntry
+}{entries: map[int]CatalogEntry{}}
+
+// Register 在错误码目录中注册一个错误码，同一个错误码注册多次时后面的会覆盖前面的
+func Register(code int, title string, messages map[string]string) {
+	RegisterEntry(CatalogEntry{Code: code, Title: title, Messages: messages})
+}
+
+// RegisterEntry 在错误码目录中注册一项
+func RegisterEntry(entry CatalogEntry) {
+	if entry.Type == "" {
+		entry.Type = PROBLEM_TYPE_BASE + strconv.Itoa(entry.Code)
+	}
+
+	catalog.lock.Lock()
+	defer catalog.lock.Unlock()
+	catalog.entries[entry.Code] = entry
+}
+
+// Lookup 在错误码目录中查找错误码
+func Lookup(code int) (CatalogEntry, bool) {
+	catalog.lock.RLock()
+	defer catalog.lock.RUnlock()
+	entry, ok := catalog.entries[code]
+	return entry, ok
+}
+
+// LocalizedMessage 返回错误码在指定语言下的消息，先精确匹配语言，如 zh-CN，再匹配主语言，如 zh，
+// 都没有时返回 Title，错误码没有注册时返回 false
+func LocalizedMessage(code int, locale string) (string, bool) {
+	entry, ok := Lookup(code)
+	if !ok {
+		return "", false
+	}
+	return entry.Message(locale), true
+}
+
+// Message 返回指定语言下的消息
+func (entry CatalogEntry) Message(locale string) string {
+	if locale != "" && len(entry.Messages) > 0 {
+		locale = strings.Replace(locale, "_", "-", -1)
+		for key, msg := range entry.Messages {
+			if strings.EqualFold(key, locale) {
+				return msg
+			}
+		}
+
+		if pos := strings.Index(locale, "-"); pos > 0 {
+			locale = locale[:pos]
+		}
+		for key, msg := range entry.Messages {
+			if strings.EqualFold(key, locale) {
+				return msg
+			}
+		}
+	}
+	return entry.Title
+}
@@ -0,0 +1,250 @@
+package errors
+
+import (
+	"database/sql/driver"
+	native "errors"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// 数据库错误的种类
+const (
+	DB_ERROR_UNKNOWN = iota
+	DB_ERROR_UNIQUE_VIOLATION
+	DB_ERROR_FOREIGN_KEY_VIOLATION
+	DB_ERROR_NOT_NULL_VIOLATION
+	DB_ERROR_SERIALIZATION_FAILURE
+	DB_ERROR_CONNECTION_LOST
+)
+
+// 数据库错误对应的错误码
+const (
+	ERR_CODE_UNIQUE_VIOLATION      = http.StatusConflict*1000 + 101
+	ERR_CODE_FOREIGN_KEY_VIOLATION = http.StatusConflict*1000 + 102
+	ERR_CODE_SERIALIZATION_FAILURE = http.StatusConflict*1000 + 103
+	ERR_CODE_NOT_NULL_VIOLATION    = http.StatusBadRequest*1000 + 902
+	ERR_CODE_CONNECTION_LOST       = http.StatusServiceUnavailable*1000 + 101
+)
+
+func init() {
+	Register(ERR_CODE_UNIQUE_VIOLATION, "value already exists", map[string]string{"zh-CN": "值已存在"})
+	Register(ERR_CODE_FOREIGN_KEY_VIOLATION, "referenced record is not found or still in use",
+		map[string]string{"zh-CN": "关联的记录不存在或仍被引用"})
+	Register(ERR_CODE_SERIALIZATION_FAILURE, "concurrent update conflict, please retry",
+		map[string]string{"zh-CN": "并发更新冲突，请重试"})
+	Register(ERR_CODE_NOT_NULL_VIOLATION, "value is required", map[string]string{"zh-CN": "值不能为空"})
+	Register(ERR_CODE_CONNECTION_LOST, "database connection is lost", map[string]string{"zh-CN": "数据库连接已断开"})
+}
+
+// DBError 是分类后的数据库错误，它由 ClassifyDBError 从 PostgreSQL 或 SQLite 驱动的错误中创建
+type DBError struct {
+	Kind int
+	// SQLState 是 PostgreSQL 的 SQLSTATE，SQLite 的错误中它为空
+	SQLState   string
+	Table      string
+	Constraint string
+	Columns    []string
+	Cause      error
+}
+
+func (e *DBError) Error() string {
+	return e.Cause.Error()
+}
+
+// Unwrap 返回驱动的原始错误
+func (e *DBError) Unwrap() error {
+	return e.Cause
+}
+
+// ErrorCode 返回错误种类对应的错误码
+func (e *DBError) ErrorCode() int {
+	switch e.Kind {
+	case DB_ERROR_UNIQUE_VIOLATION:
+		return ERR_CODE_UNIQUE_VIOLATION
+	case DB_ERROR_FOREIGN_KEY_VIOLATION:
+		return ERR_CODE_FOREIGN_KEY_VIOLATION
+	case DB_ERROR_NOT_NULL_VIOLATION:
+		return ERR_CODE_NOT_NULL_VIOLATION
+	case DB_ERROR_SERIALIZATION_FAILURE:
+		return ERR_CODE_SERIALIZATION_FAILURE
+	case DB_ERROR_CONNECTION_LOST:
+		return ERR_CODE_CONNECTION_LOST
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (e *DBError) HTTPCode() int {
+	return ToHttpStatus(e.ErrorCode())
+}
+
+var dbFieldMessages = map[int]string{
+	DB_ERROR_UNIQUE_VIOLATION:      "already exists",
+	DB_ERROR_FOREIGN_KEY_VIOLATION: "is not found or still in use",
+	DB_ERROR_NOT_NULL_VIOLATION:    "is required",
+}
+
+// ToApplicationError 转换成 ApplicationError，出错的列会作为字段错误，fieldName 将列名转换成字段名，
+// 如 types.ClassDefinition 中的属性名，它为 nil 时使用列名，返回空字符串时忽略这个列
+func (e *DBError) ToApplicationError(fieldName func(column string) string) *ApplicationError {
+	builder := Build(e.ErrorCode(), e.Error())
+	if msg, ok := dbFieldMessages[e.Kind]; ok {
+		for _, column := range e.Columns {
+			name := column
+			if fieldName != nil {
+				name = fieldName(column)
+			}
+			if name != "" {
+				builder.WithField(name, msg)
+			}
+		}
+	}
+	ae := builder.Build()
+	ae.Cause = e
+	return ae
+}
+
+// ClassifyDBError 对 PostgreSQL 和 SQLite 的错误分类，err 不是可识别的数据库错误时返回 nil，
+// err 可以是被 Wrap 或 fmt.Errorf("%w") 包装过的错误。
+// 本包不依赖数据库的驱动，PostgreSQL 的错误通过 PGError 接口读取，SQLite 的错误通过消息识别
+func ClassifyDBError(err error) *DBError {
+	for e := err; e != nil; e = unwrapCause(e) {
+		if de, ok := e.(*DBError); ok {
+			return de
+		}
+		if pe, ok := e.(PGError); ok {
+			if de := classifyPGError(e, pe.Get('C'), pe.Get('t'), pe.Get('n'), pe.Get('c'), pe.Get('D')); de != nil {
+				return de
+			}
+			continue
+		}
+		if se, ok := e.(interface {
+			SQLState() string
+		}); ok {
+			if de := classifyPGError(e, se.SQLState(), "", "", "", ""); de != nil {
+				return de
+			}
+			continue
+		}
+		if de := classifySQLiteError(e); de != nil {
+			return de
+		}
+		if e == driver.ErrBadConn || e == io.EOF || e == io.ErrUnexpectedEOF {
+			return &DBError{Kind: DB_ERROR_CONNECTION_LOST, Cause: e}
+		}
+		if _, ok := e.(*net.OpError); ok {
+			return &DBError{Kind: DB_ERROR_CONNECTION_LOST, Cause: e}
+		}
+	}
+	return nil
+}
+
+func unwrapCause(e error) error {
+	if ae, ok := e.(*ApplicationError); ok {
+		return ae.Cause
+	}
+	return native.Unwrap(e)
+}
+
+var pgDetailKeys = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+func classifyPGError(e error, code, table, constraint, column, detail string) *DBError {
+	de := &DBError{SQLState: code, Table: table, Constraint: constraint, Cause: e}
+	switch {
+	case code == "23505":
+		de.Kind = DB_ERROR_UNIQUE_VIOLATION
+	case code == "23503":
+		de.Kind = DB_ERROR_FOREIGN_KEY_VIOLATION
+	case code == "23502":
+		de.Kind = DB_ERROR_NOT_NULL_VIOLATION
+	case code == "40001" || code == "40P01":
+		de.Kind = DB_ERROR_SERIALIZATION_FAILURE
+	case strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03":
+		de.Kind = DB_ERROR_CONNECTION_LOST
+	default:
+		return nil
+	}
+
+	if column != "" {
+		de.Columns = []string{column}
+	} else if matches := pgDetailKeys.FindStringSubmatch(detail); len(matches) == 2 {
+		// 唯一约束和外键的 detail 形如 Key (name, email)=(a, b) already exists.
+		for _, s := range strings.Split(matches[1], ",") {
+			de.Columns = append(de.Columns, strings.Trim(strings.TrimSpace(s), `"`))
+		}
+	}
+	return de
+}
+
+var sqliteErrors = []struct {
+	prefix string
+	kind   int
+}{
+	{"UNIQUE constraint failed", DB_ERROR_UNIQUE_VIOLATION},
+	{"FOREIGN KEY constraint failed", DB_ERROR_FOREIGN_KEY_VIOLATION},
+	{"NOT NULL constraint failed", DB_ERROR_NOT_NULL_VIOLATION},
+	{"database is locked", DB_ERROR_SERIALIZATION_FAILURE},
+	{"database table is locked", DB_ERROR_SERIALIZATION_FAILURE},
+}
+
+func classifySQLiteError(e error) *DBError {
+	msg := e.Error()
+	for _, se := range sqliteErrors {
+		if !strings.HasPrefix(msg, se.prefix) {
+			continue
+		}
+
+		de := &DBError{Kind: se.kind, Cause: e}
+		// 约束的消息形如 UNIQUE constraint failed: users.name, users.email
+		// 或 UNIQUE constraint failed: index 'users_name_idx'
+		rest := strings.TrimPrefix(strings.TrimPrefix(msg, se.prefix), ":")
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "index ") {
+			de.Constraint = strings.Trim(strings.TrimPrefix(rest, "index "), "'")
+		} else if rest != "" {
+			for _, s := range strings.Split(rest, ",") {
+				s = strings.TrimSpace(s)
+				if pos := strings.LastIndex(s, "."); pos >= 0 {
+					de.Table = s[:pos]
+					s = s[pos+1:]
+				}
+				de.Columns = append(de.Columns, s)
+			}
+		}
+		return de
+	}
+	return nil
+}
+
+// IsUniqueViolation 是不是违反了唯一约束
+func IsUniqueViolation(err error) bool {
+	return isDBError(err, DB_ERROR_UNIQUE_VIOLATION)
+}
+
+// IsForeignKeyViolation 是不是违反了外键约束
+func IsForeignKeyViolation(err error) bool {
+	return isDBError(err, DB_ERROR_FOREIGN_KEY_VIOLATION)
+}
+
+// IsNotNullViolation 是不是违反了非空约束
+func IsNotNullViolation(err error) bool {
+	return isDBError(err, DB_ERROR_NOT_NULL_VIOLATION)
+}
+
+// IsSerializationFailure 是不是事务的序列化失败或死锁，这类错误通常可以重试
+func IsSerializationFailure(err error) bool {
+	return isDBError(err, DB_ERROR_SERIALIZATION_FAILURE)
+}
+
+// IsConnectionLost 是不是数据库的连接断开了
+func IsConnectionLost(err error) bool {
+	return isDBError(err, DB_ERROR_CONNECTION_LOST)
+}
+
+func isDBError(err error, kind int) bool {
+	de := ClassifyDBError(err)
+	return de != nil && de.Kind == kind
+}
@@ -0,0 +1,108 @@
+package errors
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type testPGError map[byte]string
+
+func (e testPGError) Error() string         { return "pq: " + e['M'] }
+func (e testPGError) Fatal() bool           { return false }
+func (e testPGError) Get(k byte) (v string) { return e[k] }
+
+type testSQLStateError string
+
+func (e testSQLStateError) Error() string    { return "ERROR: " + string(e) }
+func (e testSQLStateError) SQLState() string { return string(e) }
+
+func TestClassifyDBError(t *testing.T) {
+	for idx, test := range []struct {
+		err        error
+		kind       int
+		table      string
+		constraint string
+		columns    []string
+	}{
+		{err: testPGError{'C': "23505", 't': "users", 'n': "users_name_key", 'M': "duplicate key",
+			'D': `Key (name, "email")=(a, b) already exists.`},
+			kind: DB_ERROR_UNIQUE_VIOLATION, table: "users", constraint: "users_name_key", columns: []string{"name", "email"}},
+		{err: testPGError{'C': "23503", 't': "users", 'n': "users_group_id_fkey",
+			'D': `Key (group_id)=(12) is not present in table "groups".`},
+			kind: DB_ERROR_FOREIGN_KEY_VIOLATION, table: "users", constraint: "users_group_id_fkey", columns: []string{"group_id"}},
+		{err: testPGError{'C': "23502", 't': "users", 'c': "name"},
+			kind: DB_ERROR_NOT_NULL_VIOLATION, table: "users", columns: []string{"name"}},
+		{err: testPGError{'C': "40001"}, kind: DB_ERROR_SERIALIZATION_FAILURE},
+		{err: testPGError{'C': "40P01"}, kind: DB_ERROR_SERIALIZATION_FAILURE},
+		{err: testPGError{'C': "08006"}, kind: DB_ERROR_CONNECTION_LOST},
+		{err: testSQLStateError("57P01"), kind: DB_ERROR_CONNECTION_LOST},
+		{err: driver.ErrBadConn, kind: DB_ERROR_CONNECTION_LOST},
+
+		{err: New("UNIQUE constraint failed: users.name, users.email"),
+			kind: DB_ERROR_UNIQUE_VIOLATION, table: "users", columns: []string{"name", "email"}},
+		{err: New("UNIQUE constraint failed: index 'users_name_idx'"),
+			kind: DB_ERROR_UNIQUE_VIOLATION, constraint: "users_name_idx"},
+		{err: New("NOT NULL constraint failed: users.name"),
+			kind: DB_ERROR_NOT_NULL_VIOLATION, table: "users", columns: []string{"name"}},
+		{err: New("FOREIGN KEY constraint failed"), kind: DB_ERROR_FOREIGN_KEY_VIOLATION},
+		{err: New("database is locked"), kind: DB_ERROR_SERIALIZATION_FAILURE},
+
+		// 被包装过的错误
+		{err: Wrap(testPGError{'C': "23505", 'c': "name"}, "insert user"),
+			kind: DB_ERROR_UNIQUE_VIOLATION, columns: []string{"name"}},
+		{err: fmt.Errorf("insert user: %w", New("NOT NULL constraint failed: users.name")),
+			kind: DB_ERROR_NOT_NULL_VIOLATION, table: "users", columns: []string{"name"}},
+	} {
+		de := ClassifyDBError(test.err)
+		if de == nil {
+			t.Error(idx, ": error isn't classified -", test.err)
+			continue
+		}
+		if de.Kind != test.kind || de.Table != test.table || de.Constraint != test.constraint ||
+			!reflect.DeepEqual(de.Columns, test.columns) {
+			t.Error(idx, ": error is", de.Kind, de.Table, de.Constraint, de.Columns)
+		}
+	}
+
+	for _, err := range []error{nil, New("abc"), testPGError{'C': "42P01"}} {
+		if de := ClassifyDBError(err); de != nil {
+			t.Error(err, "is classified as", de.Kind)
+		}
+	}
+
+	if !IsUniqueViolation(testPGError{'C': "23505"}) || IsUniqueViolation(testPGError{'C': "23503"}) ||
+		!IsForeignKeyViolation(testPGError{'C': "23503"}) || !IsNotNullViolation(testPGError{'C': "23502"}) ||
+		!IsSerializationFailure(testPGError{'C': "40001"}) || !IsConnectionLost(driver.ErrBadConn) {
+		t.Error("Is... is failed")
+	}
+}
+
+func TestDBErrorToApplicationError(t *testing.T) {
+	de := ClassifyDBError(New("UNIQUE constraint failed: users.name, users.email"))
+	ae := de.ToApplicationError(func(column string) string {
+		if column == "email" {
+			return ""
+		}
+		return "Name"
+	})
+	if ae.ErrorCode() != ERR_CODE_UNIQUE_VIOLATION || ae.HTTPCode() != http.StatusConflict {
+		t.Error("code is", ae.ErrorCode(), ae.HTTPCode())
+	}
+	if !reflect.DeepEqual(ae.Fields, map[string][]string{"Name": {"already exists"}}) {
+		t.Error("fields is", ae.Fields)
+	}
+	if ae.Cause != de {
+		t.Error("cause is", ae.Cause)
+	}
+
+	ae = ToApplicationError(de)
+	if !reflect.DeepEqual(ae.Fields, map[string][]string{"name": {"already exists"}, "email": {"already exists"}}) {
+		t.Error("fields is", ae.Fields)
+	}
+	if msg, ok := LocalizedMessage(ae.ErrorCode(), "zh-CN"); !ok || msg != "值已存在" {
+		t.Error("message is", msg)
+	}
+}
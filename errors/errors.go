@@ -154,7 +154,20 @@ func ToApplicationError(e error, code ...int) *ApplicationError {
 	return toApplicationError(e, code...)
 }
 
+// ApplicationErrorConverter 可以转换成 ApplicationError 的错误，如 types.RecordError,
+// 它们的字段错误会被转换到 ApplicationError.Fields 中
+type ApplicationErrorConverter interface {
+	ToApplicationError() *ApplicationError
+}
+
 func toApplicationError(e error, code ...int) *ApplicationError {
+	if de, ok := e.(*DBError); ok {
+		return de.ToApplicationError(nil)
+	}
+	if ce, ok := e.(ApplicationErrorConverter); ok {
+		return ce.ToApplicationError()
+	}
+
 	if he, ok := e.(interface {
 		ErrorCode() int
 	}); ok {
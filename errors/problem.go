@@ -0,0 +1,150 @@
+package errors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// PROBLEM_CONTENT_TYPE 是 RFC 7807 中 problem details 的 Content-Type
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+// Problem 是 RFC 7807 中的 problem details，Code、Fields 和 Internals 是扩展的成员，
+// 分别对应 ApplicationError 的错误码、字段错误和内部错误
+type Problem struct {
+	Type      string              `json:"type,omitempty"`
+	Title     string              `json:"title,omitempty"`
+	Status    int                 `json:"status,omitempty"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      int                 `json:"code,omitempty"`
+	Fields    map[string][]string `json:"fields,omitempty"`
+	Internals []Problem           `json:"internals,omitempty"`
+}
+
+// ToProblem 将 error 转换成 Problem，错误码在目录中注册过时用它的 type URI 和 locale 对应的消息作为
+// type 和 title，否则 type 为 about:blank，title 为 HTTP 状态的描述
+func ToProblem(e error, locale string) *Problem {
+	return toProblem(ToApplicationError(e), locale)
+}
+
+func toProblem(ae *ApplicationError, locale string) *Problem {
+	problem := &Problem{
+		Status: ae.HTTPCode(),
+		Code:   ae.ErrorCode(),
+		Detail: ae.Message,
+		Fields: ae.Fields,
+	}
+	if problem.Detail == "" {
+		problem.Detail = ae.Error()
+	}
+
+	if entry, ok := Lookup(problem.Code); ok {
+		problem.Type = entry.Type
+		problem.Title = entry.Message(locale)
+	} else {
+		problem.Type = "about:blank"
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	for idx := range ae.Internals {
+		problem.Internals = append(problem.Internals, *toProblem(&ae.Internals[idx], locale))
+	}
+	return problem
+}
+
+// ToApplicationError 将 Problem 转换回 ApplicationError
+func (problem *Problem) ToApplicationError() *ApplicationError {
+	ae := &ApplicationError{
+		Code:    problem.Code,
+		Message: problem.Detail,
+		Fields:  problem.Fields,
+	}
+	if ae.Code == 0 {
+		ae.Code = problem.Status
+	}
+	if ae.Code == 0 {
+		ae.Code = http.StatusInternalServerError
+	}
+	if ae.Message == "" {
+		ae.Message = problem.Title
+	}
+
+	for idx := range problem.Internals {
+		ae.Internals = append(ae.Internals, *problem.Internals[idx].ToApplicationError())
+	}
+	return ae
+}
+
+// WriteProblem 将 error 以 application/problem+json 的格式写到响应中，
+// 它用 Accept-Language 中的第一个语言来本地化 title，并以请求的路径作为 instance
+func WriteProblem(w http.ResponseWriter, r *http.Request, e error) {
+	var locale string
+	if r != nil {
+		locale = acceptLanguage(r)
+	}
+	problem := ToProblem(e, locale)
+	if r != nil && r.URL != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	bs, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	w.Write(bs)
+}
+
+func acceptLanguage(r *http.Request) string {
+	s := r.Header.Get("Accept-Language")
+	if pos := strings.IndexAny(s, ",;"); pos >= 0 {
+		s = s[:pos]
+	}
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return ""
+	}
+	return s
+}
+
+// ParseProblem 解析 application/problem+json 格式的内容，并转换成 ApplicationError
+func ParseProblem(bs []byte) (*ApplicationError, error) {
+	var problem Problem
+	if err := json.Unmarshal(bs, &problem); err != nil {
+		return nil, err
+	}
+	return problem.ToApplicationError(), nil
+}
+
+// ReadProblem 从响应中读取错误，响应是 application/problem+json 格式时解析它，
+// 否则以响应的状态码和内容创建一个 ApplicationError，它不会关闭 resp.Body
+func ReadProblem(resp *http.Response) *ApplicationError {
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &ApplicationError{Cause: err, Code: ErrReadResponseFail.ErrorCode(),
+			Message: "read response fail, " + err.Error()}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == PROBLEM_CONTENT_TYPE {
+		var problem Problem
+		if err := json.Unmarshal(bs, &problem); err == nil {
+			if problem.Status == 0 {
+				problem.Status = resp.StatusCode
+			}
+			return problem.ToApplicationError()
+		}
+	}
+
+	msg := strings.TrimSpace(string(bs))
+	if msg == "" {
+		msg = resp.Status
+	}
+	return &ApplicationError{Code: resp.StatusCode, Message: msg}
+}
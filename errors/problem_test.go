@@ -0,0 +1,110 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	Register(400123, "name is invalid", map[string]string{
+		"zh-CN": "名称无效",
+		"en":    "the name is invalid",
+	})
+
+	for _, test := range []struct {
+		locale   string
+		excepted string
+	}{
+		{"zh-CN", "名称无效"},
+		{"zh_cn", "名称无效"},
+		{"en-US", "the name is invalid"},
+		{"fr", "name is invalid"},
+		{"", "name is invalid"},
+	} {
+		msg, ok := LocalizedMessage(400123, test.locale)
+		if !ok || msg != test.excepted {
+			t.Error(test.locale, ": excepted is", test.excepted, "actual is", msg)
+		}
+	}
+
+	if _, ok := LocalizedMessage(400124, "zh-CN"); ok {
+		t.Error("400124 is registered")
+	}
+	if entry, _ := Lookup(400123); entry.Type != PROBLEM_TYPE_BASE+"400123" {
+		t.Error("type is", entry.Type)
+	}
+}
+
+func TestProblem(t *testing.T) {
+	Register(400123, "name is invalid", map[string]string{"zh-CN": "名称无效"})
+
+	e := Build(400123, "name 'a' is invalid").
+		WithField("name", "must not be empty").
+		WithInternalError(New("abc")).
+		Build()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/users/1", nil)
+	r.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+	WriteProblem(w, r, e)
+
+	if w.Code != http.StatusBadRequest {
+		t.Error("status is", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != PROBLEM_CONTENT_TYPE {
+		t.Error("content type is", ct)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Type != PROBLEM_TYPE_BASE+"400123" || problem.Title != "名称无效" ||
+		problem.Status != http.StatusBadRequest || problem.Detail != "name 'a' is invalid" ||
+		problem.Instance != "/users/1" || problem.Code != 400123 {
+		t.Error("problem is", problem)
+	}
+	if len(problem.Internals) != 1 || problem.Internals[0].Detail != "abc" ||
+		problem.Internals[0].Type != "about:blank" || problem.Internals[0].Title != "Internal Server Error" {
+		t.Error("internals is", problem.Internals)
+	}
+
+	resp := w.Result()
+	ae := ReadProblem(resp)
+	if ae.Code != 400123 || ae.Message != "name 'a' is invalid" {
+		t.Error("error is", ae.Code, ae.Message)
+	}
+	if !reflect.DeepEqual(ae.Fields, map[string][]string{"name": {"must not be empty"}}) {
+		t.Error("fields is", ae.Fields)
+	}
+	if len(ae.Internals) != 1 || ae.Internals[0].Message != "abc" || ae.Internals[0].Code != http.StatusInternalServerError {
+		t.Error("internals is", ae.Internals)
+	}
+}
+
+func TestReadProblemNotProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	http.Error(w, "abc", http.StatusNotFound)
+	ae := ReadProblem(w.Result())
+	if ae.Code != http.StatusNotFound || ae.Message != "abc" {
+		t.Error("error is", ae.Code, ae.Message)
+	}
+
+	// 没有 code 和 status 时使用响应的状态码
+	w = httptest.NewRecorder()
+	w.Header().Set("Content-Type", PROBLEM_CONTENT_TYPE+"; charset=utf-8")
+	w.WriteHeader(http.StatusConflict)
+	w.Write([]byte(`{"title":"conflict"}`))
+	ae = ReadProblem(w.Result())
+	if ae.Code != http.StatusConflict || ae.Message != "conflict" {
+		t.Error("error is", ae.Code, ae.Message)
+	}
+
+	if _, err := ParseProblem([]byte(strings.Repeat("{", 2))); err == nil {
+		t.Error("excepted error")
+	}
+}
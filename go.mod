@@ -1,6 +1,6 @@
 module github.com/three-plus-three/modules
 
-go 1.13
+go 1.16
 
 require (
 	github.com/AreaHQ/go-fixtures v0.0.0-20160603063519-9384cea840d9
@@ -15,7 +15,9 @@ require (
 	github.com/hjson/hjson-go v3.0.0+incompatible
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
 	github.com/labstack/echo v3.3.10+incompatible
+	github.com/lib/pq v1.2.0
 	github.com/mattn/go-colorable v0.1.4 // indirect
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/mitchellh/go-ps v0.0.0-20190716172923-621e5597135b
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/opentracing/opentracing-go v1.1.0
@@ -36,10 +38,13 @@ require (
 	github.com/three-plus-three/sso v0.0.0-20191027121323-ef45d081defa
 	github.com/valyala/fasttemplate v1.1.0 // indirect
 	github.com/yeka/zip v0.0.0-20180914125537-d046722c6feb
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
 	go.uber.org/zap v1.12.0
 	golang.org/x/net v0.0.0-20191101175033-0deb6923b6d9
 	golang.org/x/tools v0.0.0-20191101200257-8dbcdeb83d3f
 	gopkg.in/ldap.v3 v3.1.0
+	gopkg.in/yaml.v3 v3.0.1
 	xorm.io/xorm v0.8.0
 )
 
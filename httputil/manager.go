@@ -0,0 +1,240 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/three-plus-three/modules/netutil"
+)
+
+// TLSOptions https 的选项
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile 不为空时要求客户端提供证书，并用它校验（mTLS）
+	ClientCAFile string
+	// ReloadInterval 检查证书文件是否修改的间隔，缺省为 10s，小于 0 时不检查
+	ReloadInterval time.Duration
+}
+
+type managedListener struct {
+	net.Listener
+	isTLS bool
+}
+
+// ServerManager 管理一个 http.Server，它可以同时在多个 TCP、unix socket 和 systemd 传入的 socket 上服务，
+// 收到 SIGINT 或 SIGTERM 时优雅地关闭，等待已有的请求完成，超过 ShutdownTimeout 后强制关闭
+type ServerManager struct {
+	Server *http.Server
+	// ShutdownTimeout 优雅关闭时等待的最长时间，缺省为 30s
+	ShutdownTimeout time.Duration
+	// Signals 收到这些信号时关闭，为 nil 时为 SIGINT 和 SIGTERM
+	Signals []os.Signal
+
+	listeners []managedListener
+	certs     *CertReloader
+	tlsOpts   TLSOptions
+	tlsConfig *tls.Config
+}
+
+// NewServerManager 创建一个 ServerManager
+func NewServerManager(srv *http.Server) *ServerManager {
+	return &ServerManager{Server: srv, ShutdownTimeout: 30 * time.Second}
+}
+
+// SetTLS 设置证书，它必须在 ListenTLS 之前调用
+func (m *ServerManager) SetTLS(opts TLSOptions) error {
+	certs, err := NewCertReloader(opts.CertFile, opts.KeyFile, opts.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	m.certs = certs
+	m.tlsOpts = opts
+	base := m.Server.TLSConfig
+	if base == nil && m.Server.TLSNextProto != nil {
+		if _, ok := m.Server.TLSNextProto["h2"]; !ok {
+			// 禁用了 h2
+			base = &tls.Config{NextProtos: []string{"http/1.1"}}
+		}
+	}
+	m.tlsConfig = certs.TLSConfig(base)
+	return nil
+}
+
+func listen(network, addr string) (net.Listener, error) {
+	if network == "" {
+		network = "tcp"
+	}
+	if netutil.IsUnixsocket(network) {
+		return netutil.NewUnixListener(network, addr)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if tcp, ok := ln.(*net.TCPListener); ok {
+		return TcpKeepAliveListener{tcp}, nil
+	}
+	return ln, nil
+}
+
+// Listen 在 network 和 addr 上监听 http，network 为 unix 时 addr 是 socket 文件
+func (m *ServerManager) Listen(network, addr string) error {
+	ln, err := listen(network, addr)
+	if err != nil {
+		return err
+	}
+	m.AddListener(ln, false)
+	return nil
+}
+
+// ListenTLS 在 network 和 addr 上监听 https
+func (m *ServerManager) ListenTLS(network, addr string) error {
+	if m.certs == nil {
+		return errors.New("certificate is missing, SetTLS must is called before ListenTLS")
+	}
+	ln, err := listen(network, addr)
+	if err != nil {
+		return err
+	}
+	m.AddListener(ln, true)
+	return nil
+}
+
+// AddListener 添加一个监听，isTLS 为 true 时必须先调用 SetTLS
+func (m *ServerManager) AddListener(ln net.Listener, isTLS bool) {
+	m.listeners = append(m.listeners, managedListener{Listener: ln, isTLS: isTLS})
+}
+
+// Addrs 返回所有监听的地址
+func (m *ServerManager) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(m.listeners))
+	for _, ln := range m.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	return addrs
+}
+
+// SYSTEMD_LISTEN_FDS_START systemd 传入的第一个 socket 的文件描述符
+const SYSTEMD_LISTEN_FDS_START = 3
+
+// SystemdListeners 返回 systemd socket activation 传入的 socket，没有时返回空，
+// 见 sd_listen_fds(3)，读取后会清除 LISTEN_PID、LISTEN_FDS 和 LISTEN_FDNAMES 环境变量
+func SystemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, count)
+	for fd := SYSTEMD_LISTEN_FDS_START; fd < SYSTEMD_LISTEN_FDS_START+count; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.New("systemd socket " + strconv.Itoa(fd) + " is invalid, " + err.Error())
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// ListenSystemd 添加 systemd socket activation 传入的 socket，返回添加的个数
+func (m *ServerManager) ListenSystemd(isTLS bool) (int, error) {
+	if isTLS && m.certs == nil {
+		return 0, errors.New("certificate is missing, SetTLS must is called before ListenSystemd")
+	}
+	listeners, err := SystemdListeners()
+	if err != nil {
+		return 0, err
+	}
+	for _, ln := range listeners {
+		m.AddListener(ln, isTLS)
+	}
+	return len(listeners), nil
+}
+
+// Serve 在所有的监听上服务，直到 ctx 取消、收到信号或者其中一个监听出错，然后优雅地关闭
+func (m *ServerManager) Serve(ctx context.Context) error {
+	if len(m.listeners) == 0 {
+		return errors.New("listener is missing")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	signals := m.Signals
+	if signals == nil {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sig := make(chan os.Signal, 1)
+	if len(signals) > 0 {
+		signal.Notify(sig, signals...)
+		defer signal.Stop(sig)
+	}
+
+	if m.certs != nil && m.tlsOpts.ReloadInterval >= 0 {
+		go m.certs.Watch(ctx, m.tlsOpts.ReloadInterval)
+	}
+
+	errc := make(chan error, len(m.listeners))
+	var wg sync.WaitGroup
+	for _, ln := range m.listeners {
+		var l net.Listener = ln.Listener
+		if ln.isTLS {
+			l = tls.NewListener(l, m.tlsConfig)
+		}
+
+		wg.Add(1)
+		go func(l net.Listener) {
+			defer wg.Done()
+			if err := m.Server.Serve(l); err != nil && err != http.ErrServerClosed {
+				errc <- err
+			}
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case <-sig:
+	case err = <-errc:
+	}
+
+	timeout := m.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+	defer shutdownCancel()
+	if e := m.Server.Shutdown(shutdownCtx); e != nil {
+		m.Server.Close()
+		if err == nil {
+			err = errors.New("shutdown server failed, " + e.Error())
+		}
+	}
+	wg.Wait()
+	return err
+}
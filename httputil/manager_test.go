@@ -0,0 +1,197 @@
+package httputil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func createTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestServerManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httputil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, "ca", nil, true)
+	server := createTestCert(t, "server1", ca, false)
+	client := createTestCert(t, "client", ca, false)
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+	ca.write(t, caFile, "")
+	server.write(t, certFile, keyFile)
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("slow"))
+		close(finished)
+	})
+
+	mgr := NewServerManager(&http.Server{Handler: mux})
+	mgr.Signals = []os.Signal{}
+	if err := mgr.ListenTLS("tcp", "127.0.0.1:0"); err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if err := mgr.SetTLS(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ReloadInterval: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.ListenTLS("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	addrs := mgr.Addrs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- mgr.Serve(ctx)
+	}()
+
+	httpURL := "http://" + addrs[0].String()
+	httpsURL := "https://" + addrs[1].String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+	get := func(c *http.Client, u string) (string, error) {
+		resp, err := c.Get(u)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		bs, err := ioutil.ReadAll(resp.Body)
+		return string(bs), err
+	}
+
+	if s, err := get(http.DefaultClient, httpURL); err != nil || s != "ok" {
+		t.Error(s, err)
+	}
+	if _, err := get(newClient(), httpsURL); err == nil {
+		t.Error("excepted client certificate is required")
+	}
+	if s, err := get(newClient(client.tlsCertificate()), httpsURL); err != nil || s != "ok" {
+		t.Error(s, err)
+	}
+
+	// 修改证书后重新加载
+	server2 := createTestCert(t, "server2", ca, false)
+	server2.write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if reloaded, err := mgr.certs.Reload(); err != nil || !reloaded {
+		t.Error("reload failed,", reloaded, err)
+	}
+	if reloaded, _ := mgr.certs.Reload(); reloaded {
+		t.Error("certificate is reloaded without changed")
+	}
+	conn, err := tls.Dial("tcp", addrs[1].String(), &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.tlsCertificate()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "server2" {
+		t.Error("certificate is", cn)
+	}
+	conn.Close()
+
+	// 关闭时等待已有的请求完成
+	slow := make(chan string, 1)
+	go func() {
+		s, _ := get(http.DefaultClient, httpURL+"/slow")
+		slow <- s
+	}()
+	<-started
+	cancel()
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("server is closed before request is finished")
+	}
+	if s := <-slow; s != "slow" {
+		t.Error("response is", s)
+	}
+}
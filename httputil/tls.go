@@ -0,0 +1,157 @@
+package httputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader 在证书文件被修改后重新加载证书和客户端的 CA 证书，加载失败时继续使用原来的证书
+type CertReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    []time.Time
+}
+
+// NewCertReloader 加载证书，clientCAFile 不为空时用它校验客户端的证书
+func NewCertReloader(certFile, keyFile, clientCAFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) files() []string {
+	if r.clientCAFile == "" {
+		return []string{r.certFile, r.keyFile}
+	}
+	return []string{r.certFile, r.keyFile, r.clientCAFile}
+}
+
+func statFiles(files []string) []time.Time {
+	stamps := make([]time.Time, len(files))
+	for idx, nm := range files {
+		if st, err := os.Stat(nm); err == nil {
+			stamps[idx] = st.ModTime()
+		}
+	}
+	return stamps
+}
+
+// Reload 文件有修改时重新加载证书，返回是否重新加载了
+func (r *CertReloader) Reload() (bool, error) {
+	stamps := statFiles(r.files())
+
+	r.lock.RLock()
+	changed := r.cert == nil
+	for idx := range r.stamps {
+		if !r.stamps[idx].Equal(stamps[idx]) {
+			changed = true
+		}
+	}
+	r.lock.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, errors.New("load certificate '" + r.certFile + "' failed, " + err.Error())
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		bs, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return false, errors.New("read file '" + r.clientCAFile + "' failed, " + err.Error())
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bs) {
+			return false, errors.New("client ca file '" + r.clientCAFile + "' is invalid.")
+		}
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamps = stamps
+	r.lock.Unlock()
+	return true, nil
+}
+
+// GetCertificate 返回当前的证书，用于 tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// ClientCAs 返回当前的客户端 CA 证书，没有指定 clientCAFile 时返回 nil
+func (r *CertReloader) ClientCAs() *x509.CertPool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.clientCAs
+}
+
+// TLSConfig 创建使用当前证书的 tls.Config，指定了 clientCAFile 时要求并校验客户端的证书，
+// base 为 nil 时和 http.Server 一样支持 h2
+func (r *CertReloader) TLSConfig(base *tls.Config) *tls.Config {
+	var config *tls.Config
+	if base == nil {
+		config = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	} else {
+		config = base.Clone()
+		if len(config.NextProtos) == 0 {
+			config.NextProtos = []string{"http/1.1"}
+		}
+	}
+	config.Certificates = nil
+	config.GetCertificate = r.GetCertificate
+	if r.clientCAFile == "" {
+		return config
+	}
+
+	if config.ClientAuth == tls.NoClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	template := config.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := template.Clone()
+		c.ClientCAs = r.ClientCAs()
+		return c, nil
+	}
+	return config
+}
+
+// Watch 每隔 interval 检查一次证书文件，直到 ctx 取消
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if reloaded, err := r.Reload(); err != nil {
+				log.Println("reload certificate failed,", err)
+			} else if reloaded {
+				log.Println("certificate '" + r.certFile + "' is reloaded.")
+			}
+		}
+	}
+}
@@ -13,6 +13,9 @@ import (
 const (
 	QUEUE = "queue"
 	TOPIC = "topic"
+
+	DEFAULT_PING_INTERVAL = 30 * time.Second
+	DEFAULT_PONG_TIMEOUT  = 10 * time.Second
 )
 
 type ClientBuilder struct {
@@ -20,6 +23,10 @@ type ClientBuilder struct {
 	//capacity int
 	//bufSize  int
 	id string
+
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	noHeader     bool
 }
 
 func (builder *ClientBuilder) Clone() *ClientBuilder {
@@ -28,6 +35,9 @@ func (builder *ClientBuilder) Clone() *ClientBuilder {
 		//capacity: builder.capacity,
 		//bufSize:  builder.bufSize,
 		//id:       builder.id,
+		pingInterval: builder.pingInterval,
+		pongTimeout:  builder.pongTimeout,
+		noHeader:     builder.noHeader,
 	}
 }
 
@@ -36,6 +46,30 @@ func (builder *ClientBuilder) ID(name string) *ClientBuilder {
 	return builder
 }
 
+// SetKeepalive 设置发送 ping 的间隔和等待 pong 的超时时间，超时后连接会被关闭，
+// 为 0 时使用缺省值，pingInterval 为负数时不发送 ping
+func (builder *ClientBuilder) SetKeepalive(pingInterval, pongTimeout time.Duration) *ClientBuilder {
+	builder.pingInterval = pingInterval
+	builder.pongTimeout = pongTimeout
+	return builder
+}
+
+// DisableHeader 订阅和发布时不指定 MESSAGE_HEADER_PARAM，连接上只传递数据，
+// 连接到不支持消息头的旧服务时使用它
+func (builder *ClientBuilder) DisableHeader() *ClientBuilder {
+	builder.noHeader = true
+	return builder
+}
+
+func (builder *ClientBuilder) url(action, name string) string {
+	u := joinURL(builder.baseURL, "/"+action+"?name="+url.QueryEscape(name)+
+		"&client="+url.QueryEscape(builder.id))
+	if !builder.noHeader {
+		u += "&" + MESSAGE_HEADER_PARAM + "=1"
+	}
+	return u
+}
+
 /*
 func (builder *ClientBuilder) SetBufSize(size int) *ClientBuilder {
 	builder.bufSize = size
@@ -49,15 +83,11 @@ func (builder *ClientBuilder) SetQueueCapacity(capacity int) *ClientBuilder {
 */
 
 func (builder *ClientBuilder) ToQueue(name string) (*Publisher, error) {
-	u := joinURL(builder.baseURL, "/sendQueue?name="+url.QueryEscape(name)+
-		"&client="+url.QueryEscape(builder.id))
-	return builder.to(u)
+	return builder.to(builder.url("sendQueue", name))
 }
 
 func (builder *ClientBuilder) ToTopic(name string) (*Publisher, error) {
-	u := joinURL(builder.baseURL, "/sendTopic?name="+url.QueryEscape(name)+
-		"&client="+url.QueryEscape(builder.id))
-	return builder.to(u)
+	return builder.to(builder.url("sendTopic", name))
 }
 
 func (builder *ClientBuilder) to(uri string) (*Publisher, error) {
@@ -65,9 +95,21 @@ func (builder *ClientBuilder) to(uri string) (*Publisher, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// 服务端不会向发布者发送消息，但是必须读连接才能收到 pong
+	go discard(conn)
 	return (*Publisher)(conn), nil
 }
 
+func discard(conn *websocket2.Conn) {
+	for {
+		var bs []byte
+		if err := websocket2.Message.Receive(conn, &bs); err != nil {
+			return
+		}
+	}
+}
+
 func (builder *ClientBuilder) connect(uri string) (*websocket2.Conn, error) {
 	origin := uri
 	if strings.HasPrefix(uri, "http://") {
@@ -85,19 +127,24 @@ func (builder *ClientBuilder) connect(uri string) (*websocket2.Conn, error) {
 	var dialer net.Dialer
 	dialer.KeepAlive = 30 * time.Second
 	config.Dialer = (&netutil.HttpDialer{DialWithContext: dialer.DialContext}).Dial
+
+	config.PingInterval = builder.pingInterval
+	if config.PingInterval == 0 {
+		config.PingInterval = DEFAULT_PING_INTERVAL
+	}
+	config.PongTimeout = builder.pongTimeout
+	if config.PongTimeout <= 0 {
+		config.PongTimeout = DEFAULT_PONG_TIMEOUT
+	}
 	return websocket2.DialConfig(config)
 }
 
 func (builder *ClientBuilder) SubscribeQueue(name string) (*Subscription, error) {
-	u := joinURL(builder.baseURL, "/subscribeQueue?name="+url.QueryEscape(name)+
-		"&client="+url.QueryEscape(builder.id))
-	return builder.subscribe(u)
+	return builder.subscribe(builder.url("subscribeQueue", name))
 }
 
 func (builder *ClientBuilder) SubscribeTopic(name string) (*Subscription, error) {
-	u := joinURL(builder.baseURL, "/subscribeTopic?name="+url.QueryEscape(name)+
-		"&client="+url.QueryEscape(builder.id))
-	return builder.subscribe(u)
+	return builder.subscribe(builder.url("subscribeTopic", name))
 }
 
 func (builder *ClientBuilder) subscribe(uri string) (*Subscription, error) {
@@ -115,13 +162,37 @@ func Connect(uri string) *ClientBuilder {
 type Publisher websocket2.Conn
 
 func (pub *Publisher) Send(bs Message) error {
-	return websocket2.Message.Send((*websocket2.Conn)(pub), bs.Bytes())
+	conn := (*websocket2.Conn)(pub)
+	return websocket2.Message.Send(conn, encodeMessage(conn, bs))
 }
 
 func (pub *Publisher) Close() error {
 	return closeConn((*websocket2.Conn)(pub))
 }
 
+// hasHeader 判断连接是不是在订阅或发布时指定了 MESSAGE_HEADER_PARAM
+func hasHeader(conn *websocket2.Conn) bool {
+	config := conn.Config()
+	return config != nil && config.Location != nil &&
+		config.Location.Query().Get(MESSAGE_HEADER_PARAM) == "1"
+}
+
+// encodeMessage 返回消息在连接上传递的数据
+func encodeMessage(conn *websocket2.Conn, msg Message) []byte {
+	if hasHeader(conn) {
+		return msg.Frame()
+	}
+	return msg.Data()
+}
+
+// decodeMessage 将连接上收到的数据转换为消息
+func decodeMessage(conn *websocket2.Conn, bs []byte) (Message, error) {
+	if hasHeader(conn) {
+		return ParseFrame(bs)
+	}
+	return CreateDataMessage(bs), nil
+}
+
 func closeConn(conn *websocket2.Conn) error {
 	return conn.Close()
 }
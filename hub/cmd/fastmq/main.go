@@ -11,8 +11,10 @@ import (
 	"time"
 
 	"github.com/runner-mei/command"
+	"github.com/three-plus-three/modules/environment"
 	"github.com/three-plus-three/modules/hub"
 	"github.com/three-plus-three/modules/hub/engine"
+	"github.com/three-plus-three/modules/logext"
 )
 
 func main() {
@@ -20,11 +22,13 @@ func main() {
 }
 
 type runCmd struct {
-	listenAt string
+	listenAt    string
+	registryTTL time.Duration
 }
 
 func (cmd *runCmd) Flags(fs *flag.FlagSet) *flag.FlagSet {
 	fs.StringVar(&cmd.listenAt, "listen_at", ":59876", "")
+	fs.DurationVar(&cmd.registryTTL, "registry_ttl", 30*time.Second, "the ttl of service instances, the registry is disabled if it is 0.")
 	return fs
 }
 
@@ -35,9 +39,12 @@ func (cmd *runCmd) Run(args []string) error {
 	if err != nil {
 		return err
 	}
+	if cmd.registryTTL > 0 {
+		srv.Services = environment.NewServiceRegistry(cmd.registryTTL)
+	}
 
 	fmt.Println("listen at -", cmd.listenAt)
-	return http.ListenAndServe(cmd.listenAt, srv)
+	return http.ListenAndServe(cmd.listenAt, logext.Handler("fastmq", srv.Logger, srv))
 }
 
 type sendCmd struct {
@@ -15,6 +15,7 @@ import (
 
 	"github.com/runner-mei/log"
 	"github.com/three-plus-three/modules/hub"
+	"github.com/three-plus-three/modules/logext"
 	"golang.org/x/net/websocket"
 )
 
@@ -40,6 +41,9 @@ type StandardEngine struct {
 	*Core
 	NoRoute http.Handler
 	Logger  log.Logger
+
+	// Services 服务注册中心，不为 nil 时它被挂载在 /services 下
+	Services http.Handler
 }
 
 func (se *StandardEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -136,6 +140,8 @@ func (se *StandardEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusMethodNotAllowed)
 				w.Write([]byte("Method must is PUT or GET."))
 			}
+		} else if se.Services != nil && (r.URL.Path == "/services" || strings.HasPrefix(r.URL.Path, "/services/")) {
+			http.StripPrefix("/services", se.Services).ServeHTTP(w, r)
 		} else {
 			se.NoRoute.ServeHTTP(w, r)
 		}
@@ -180,9 +186,9 @@ func (se *StandardEngine) doGet(w http.ResponseWriter, r *http.Request,
 			w.Header().Add("Content-Type", "text/plain")
 			w.WriteHeader(http.StatusOK)
 
-			bs := msg.Bytes()
+			bs := msg.Data()
 			if len(bs) > 0 {
-				w.Write(msg.Bytes())
+				w.Write(bs)
 			}
 		} else {
 			msgList := readMore(consumer.C, msg)
@@ -192,7 +198,7 @@ func (se *StandardEngine) doGet(w http.ResponseWriter, r *http.Request,
 			w.Write([]byte("["))
 			is_frist := true
 			for _, m := range msgList {
-				bs := m.Bytes()
+				bs := m.Data()
 				if len(bs) > 0 {
 					if is_frist {
 						is_frist = false
@@ -303,10 +309,11 @@ func (se *StandardEngine) subscribe(w http.ResponseWriter, r *http.Request, mode
 		role:       "subscriber",
 		client:     params.Get("client"),
 		name:       params.Get("name"),
+		header:     params.Get(hub.MESSAGE_HEADER_PARAM) == "1",
 		c:          make(chan struct{}),
 	}
 
-	stub.logger = se.Logger.With(log.String("client", stub.client),
+	stub.logger = logext.For(r.Context(), se.Logger).With(log.String("client", stub.client),
 		log.String("hub_subscriber.name", stub.name),
 		log.String("hub_subscriber.peer", stub.remoteAddr))
 	// var consumer *Consumer
@@ -375,8 +382,9 @@ func (se *StandardEngine) send(w http.ResponseWriter, r *http.Request, mode stri
 		role:       "pushlisher",
 		client:     params.Get("client"),
 		name:       params.Get("name"),
+		header:     params.Get(hub.MESSAGE_HEADER_PARAM) == "1",
 		c:          make(chan struct{}),
-		logger:     se.Logger}
+		logger:     logext.For(r.Context(), se.Logger)}
 	var o interface{}
 
 	stub.srv.Handshake = func(config *websocket.Config, req *http.Request) (err error) {
@@ -399,11 +407,11 @@ func (se *StandardEngine) send(w http.ResponseWriter, r *http.Request, mode stri
 		defer stub.Close()
 		stub.disconnect = se.Core.Connect(stub)
 
-		se.Logger.Info("publisher is connected.",
+		stub.logger.Info("publisher is connected.",
 			log.String("client", stub.client),
 			log.String("hub_publisher.name", stub.name),
 			log.String("hub_publisher.peer", stub.remoteAddr))
-		defer se.Logger.Info("publisheris disconnected.",
+		defer stub.logger.Info("publisheris disconnected.",
 			log.String("client", stub.client),
 			log.String("hub_publisher.name", stub.name),
 			log.String("hub_publisher.peer", stub.remoteAddr))
@@ -25,6 +25,9 @@ type engineStub struct {
 	conn       *websocket.Conn
 	logger     log.Logger
 
+	// header 连接上的消息是不是帧，见 hub.MESSAGE_HEADER_PARAM
+	header bool
+
 	c      chan struct{}
 	closed int32
 }
@@ -53,6 +56,20 @@ func (stub *engineStub) Info() map[string]interface{} {
 	}
 }
 
+func (stub *engineStub) encode(msg hub.Message) []byte {
+	if stub.header {
+		return msg.Frame()
+	}
+	return msg.Data()
+}
+
+func (stub *engineStub) decode(data []byte) (hub.Message, error) {
+	if stub.header {
+		return hub.ParseFrame(data)
+	}
+	return hub.CreateDataMessage(data), nil
+}
+
 func (stub *engineStub) subscribe(consumer *Consumer) {
 	is_running := true
 	for is_running {
@@ -64,7 +81,7 @@ func (stub *engineStub) subscribe(consumer *Consumer) {
 				break
 			}
 
-			if e := websocket.Message.Send(stub.conn, msg.Bytes()); nil != e {
+			if e := websocket.Message.Send(stub.conn, stub.encode(msg)); nil != e {
 				is_running = false
 
 				if !consumer.Unread(msg) {
@@ -105,7 +122,12 @@ func (stub *engineStub) publish(producer chan<- hub.Message) {
 			continue
 		}
 
-		msg := hub.CreateDataMessage(data)
+		msg, err := stub.decode(data)
+		if err != nil {
+			stub.logger.Info("connection(read) is closed.", log.Error(err))
+			isRunning = false
+			continue
+		}
 
 		continueTick := 0
 		for continueTick < trySendCount {
@@ -144,7 +166,11 @@ func (stub *engineStub) sendToTopic(producer Producer) {
 			break
 		}
 
-		msg := hub.CreateDataMessage(data)
+		msg, err := stub.decode(data)
+		if err != nil {
+			stub.logger.Info("connection(read) is closed.", log.Error(err))
+			break
+		}
 		rs, err := producer.SendWithContext(msg, ticker.C)
 		if err != hub.ErrPartialSend {
 			stub.logger.Info("connection(read) is fail", log.Error(err))
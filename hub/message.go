@@ -1,6 +1,11 @@
 package hub
 
-import "errors"
+import (
+	"encoding/binary"
+	"errors"
+	"net/url"
+	"strings"
+)
 
 var (
 	ErrTimeout           = errors.New("timeout")
@@ -15,19 +20,113 @@ var (
 	ErrQueueFull         = errors.New("queue is full.")
 	ErrPartialSend       = errors.New("send is partial consumer.")
 	ErrHandlerType       = errors.New("handler isn't http.Handler.")
+	ErrInvalidFrame      = errors.New("message frame is invalid.")
 )
 
+// MESSAGE_HEADER_PARAM 是订阅和发布时的查询参数，为 1 时连接上的每个消息都是一个帧，帧由两个
+// 字节的消息头长度、url 编码的消息头和数据组成，没有消息头时长度为 0，见 Message.Frame 和 ParseFrame。
+// 没有这个参数的连接上只传递数据，消息头被丢弃
+const MESSAGE_HEADER_PARAM = "header"
+
+// messageHeaderMagic 带消息头的消息在内存中以它开头，最后一个字节是版本，之后是两个字节的消息头长度
+// 和 url 编码的消息头。CreateDataMessage 将以它开头的数据包装成消息头为空的消息，所以数据不会被当作消息头
+const messageHeaderMagic = "\xffHDR\x01"
+
 // Message - 一个消息的数据
 type Message []byte
 
+// Bytes 返回消息在内存中的表示，包括消息头，它可以被保存后再用 Message(bs) 转换回来，
+// 在连接上传递时用 Data 或 Frame
 func (msg Message) Bytes() []byte {
 	return msg
 }
 
+func (msg Message) split() (header, data []byte) {
+	n := len(messageHeaderMagic)
+	if len(msg) < n+2 || string(msg[:n]) != messageHeaderMagic {
+		return nil, msg
+	}
+	length := int(binary.BigEndian.Uint16(msg[n:]))
+	if len(msg) < n+2+length {
+		return nil, msg
+	}
+	return msg[n+2 : n+2+length], msg[n+2+length:]
+}
+
+// Data 返回消息的数据，不包括消息头
 func (msg Message) Data() []byte {
-	return msg
+	_, data := msg.split()
+	return data
+}
+
+// Header 返回消息头，没有消息头时返回 nil
+func (msg Message) Header() map[string]string {
+	header, _ := msg.split()
+	if len(header) == 0 {
+		return nil
+	}
+	values, err := url.ParseQuery(string(header))
+	if err != nil {
+		return nil
+	}
+	results := make(map[string]string, len(values))
+	for k, v := range values {
+		results[k] = v[0]
+	}
+	return results
+}
+
+// Frame 返回消息在指定了 MESSAGE_HEADER_PARAM 的连接上传递的帧
+func (msg Message) Frame() []byte {
+	header, data := msg.split()
+	frame := make([]byte, 0, 2+len(header)+len(data))
+	frame = append(frame, byte(len(header)>>8), byte(len(header)))
+	frame = append(frame, header...)
+	return append(frame, data...)
+}
+
+// ParseFrame 解析在指定了 MESSAGE_HEADER_PARAM 的连接上收到的帧
+func ParseFrame(frame []byte) (Message, error) {
+	if len(frame) < 2 {
+		return nil, ErrInvalidFrame
+	}
+	length := int(binary.BigEndian.Uint16(frame))
+	if len(frame) < 2+length {
+		return nil, ErrInvalidFrame
+	}
+	if length == 0 {
+		return CreateDataMessage(frame[2:]), nil
+	}
+	return joinMessage(frame[2:2+length], frame[2+length:]), nil
 }
 
 func CreateDataMessage(bs []byte) Message {
+	if strings.HasPrefix(string(bs), messageHeaderMagic) {
+		return joinMessage(nil, bs)
+	}
 	return Message(bs)
 }
+
+// CreateMessageWithHeader 创建一个带消息头的消息，header 为空时和 CreateDataMessage 相同
+func CreateMessageWithHeader(header map[string]string, bs []byte) Message {
+	if len(header) == 0 {
+		return CreateDataMessage(bs)
+	}
+	values := url.Values{}
+	for k, v := range header {
+		values.Set(k, v)
+	}
+	encoded := values.Encode()
+	if len(encoded) > 0xffff {
+		panic(ErrLengthExceed)
+	}
+	return joinMessage([]byte(encoded), bs)
+}
+
+func joinMessage(header, bs []byte) Message {
+	msg := make([]byte, 0, len(messageHeaderMagic)+2+len(header)+len(bs))
+	msg = append(msg, messageHeaderMagic...)
+	msg = append(msg, byte(len(header)>>8), byte(len(header)))
+	msg = append(msg, header...)
+	return append(msg, bs...)
+}
@@ -0,0 +1,19 @@
+package hub
+
+import (
+	"encoding/json"
+
+	"github.com/three-plus-three/modules/util"
+)
+
+// SendOutput 返回一个将命令输出的每一行以 json 格式发送到 pub 的回调，
+// 它可以作为 util.Command 的 OnOutput，发送失败时丢弃该行
+func SendOutput(pub *Publisher) func(util.OutputLine) {
+	return func(line util.OutputLine) {
+		bs, err := json.Marshal(line)
+		if err != nil {
+			return
+		}
+		pub.Send(CreateDataMessage(bs))
+	}
+}
@@ -64,7 +64,7 @@ func (fr *FileRelay) subscribe(basePath string, consumer *engine.Consumer) error
 	}
 
 	for msg := range consumer.C {
-		err := ioutil.WriteFile(filepath.Join(basePath, tid.GenerateID()), msg.Data(), 0666)
+		err := ioutil.WriteFile(filepath.Join(basePath, tid.GenerateID()), msg.Bytes(), 0666)
 		if err != nil {
 			return err
 		}
@@ -108,7 +108,7 @@ func (fr *FileRelay) to(basePath string, producer engine.Producer) error {
 				return err
 			}
 
-			err = producer.Send(hub.CreateDataMessage(bs))
+			err = producer.Send(hub.Message(bs))
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,434 @@
+package hub
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/three-plus-three/modules/websocket2"
+)
+
+const (
+	DEFAULT_MIN_BACKOFF = 100 * time.Millisecond
+	DEFAULT_MAX_BACKOFF = 30 * time.Second
+	DEFAULT_BUFFER_SIZE = 1000
+)
+
+// ConnState 连接的状态
+type ConnState int32
+
+const (
+	STATE_CONNECTING ConnState = iota
+	STATE_CONNECTED
+	STATE_DISCONNECTED
+	STATE_CLOSED
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case STATE_CONNECTING:
+		return "connecting"
+	case STATE_CONNECTED:
+		return "connected"
+	case STATE_DISCONNECTED:
+		return "disconnected"
+	case STATE_CLOSED:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// StateEvent 连接状态变化的事件
+type StateEvent struct {
+	// Mode 为 QUEUE 或 TOPIC
+	Mode        string
+	Name        string
+	IsPublisher bool
+	State       ConnState
+	// Err 断开连接或连接失败的原因
+	Err error
+}
+
+// ResilientOptions 自动重连的客户端的选项
+type ResilientOptions struct {
+	// MinBackoff 和 MaxBackoff 是重连的最小和最大间隔，每次失败后间隔加倍，
+	// 实际等待的时间在间隔的一半到间隔之间随机选取
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// BufferSize 发布者在断线期间最多缓存的消息数，缓存满了 Send 返回 ErrQueueFull
+	BufferSize int
+
+	// OnStateChange 连接状态变化时被调用，它不能阻塞
+	OnStateChange func(StateEvent)
+}
+
+// ResilientClient 自动重连的客户端，连接断开后按随机化的指数退避重新连接，
+// 订阅者在重连后重新订阅，发布者在断线期间将消息缓存在本地
+type ResilientClient struct {
+	builder *ClientBuilder
+	options ResilientOptions
+
+	closed  int32
+	lock    sync.Mutex
+	closers map[interface{ Close() error }]struct{}
+}
+
+// NewResilientClient 创建一个自动重连的客户端
+func NewResilientClient(builder *ClientBuilder, options ResilientOptions) *ResilientClient {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = DEFAULT_MIN_BACKOFF
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = options.MinBackoff
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = DEFAULT_BUFFER_SIZE
+	}
+	return &ResilientClient{
+		builder: builder,
+		options: options,
+		closers: map[interface{ Close() error }]struct{}{},
+	}
+}
+
+func (client *ResilientClient) add(c interface{ Close() error }) bool {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if atomic.LoadInt32(&client.closed) != 0 {
+		return false
+	}
+	client.closers[c] = struct{}{}
+	return true
+}
+
+func (client *ResilientClient) remove(c interface{ Close() error }) {
+	client.lock.Lock()
+	delete(client.closers, c)
+	client.lock.Unlock()
+}
+
+// Close 关闭所有的订阅者和发布者
+func (client *ResilientClient) Close() error {
+	if !atomic.CompareAndSwapInt32(&client.closed, 0, 1) {
+		return nil
+	}
+	client.lock.Lock()
+	closers := client.closers
+	client.closers = map[interface{ Close() error }]struct{}{}
+	client.lock.Unlock()
+
+	for c := range closers {
+		c.Close()
+	}
+	return nil
+}
+
+func (client *ResilientClient) url(action, name string) string {
+	return client.builder.url(action, name)
+}
+
+// backoff 返回第 retries 次重连前等待的时间
+func (client *ResilientClient) backoff(retries int) time.Duration {
+	d := client.options.MinBackoff
+	for i := 0; i < retries && d < client.options.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > client.options.MaxBackoff {
+		d = client.options.MaxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// resilientConn 是订阅者和发布者共用的状态
+type resilientConn struct {
+	client      *ResilientClient
+	mode        string
+	name        string
+	isPublisher bool
+
+	state  int32
+	closed chan struct{}
+	once   sync.Once
+
+	lock sync.Mutex
+	conn *websocket2.Conn
+}
+
+func (rc *resilientConn) init(client *ResilientClient, mode, name string, isPublisher bool) {
+	rc.client = client
+	rc.mode = mode
+	rc.name = name
+	rc.isPublisher = isPublisher
+	rc.state = int32(STATE_DISCONNECTED)
+	rc.closed = make(chan struct{})
+}
+
+// State 返回当前连接的状态
+func (rc *resilientConn) State() ConnState {
+	return ConnState(atomic.LoadInt32(&rc.state))
+}
+
+func (rc *resilientConn) setState(state ConnState, err error) {
+	if ConnState(atomic.SwapInt32(&rc.state, int32(state))) == state {
+		return
+	}
+	if cb := rc.client.options.OnStateChange; cb != nil {
+		cb(StateEvent{Mode: rc.mode, Name: rc.name, IsPublisher: rc.isPublisher, State: state, Err: err})
+	}
+}
+
+func (rc *resilientConn) isClosed() bool {
+	select {
+	case <-rc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait 等待重连的间隔，返回 false 表示已经关闭了
+func (rc *resilientConn) wait(retries int) bool {
+	timer := time.NewTimer(rc.client.backoff(retries))
+	defer timer.Stop()
+	select {
+	case <-rc.closed:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// nextRetries 连接保持的时间超过了 MaxBackoff 时重新开始退避
+func (rc *resilientConn) nextRetries(retries int, connectedAt time.Time) int {
+	if time.Since(connectedAt) > rc.client.options.MaxBackoff {
+		return 0
+	}
+	return retries + 1
+}
+
+// connect 一直重试直到连接成功，返回 nil 表示已经关闭了，retries 是已经重试的次数
+func (rc *resilientConn) connect(action string, retries int) *websocket2.Conn {
+	for ; ; retries++ {
+		if rc.isClosed() {
+			return nil
+		}
+		rc.setState(STATE_CONNECTING, nil)
+		conn, err := rc.client.builder.connect(rc.client.url(action, rc.name))
+		if err == nil {
+			rc.lock.Lock()
+			if rc.isClosed() {
+				rc.lock.Unlock()
+				conn.Close()
+				return nil
+			}
+			rc.conn = conn
+			rc.lock.Unlock()
+			rc.setState(STATE_CONNECTED, nil)
+			return conn
+		}
+		rc.setState(STATE_DISCONNECTED, err)
+		if !rc.wait(retries) {
+			return nil
+		}
+	}
+}
+
+func (rc *resilientConn) disconnect(conn *websocket2.Conn) {
+	rc.lock.Lock()
+	if rc.conn == conn {
+		rc.conn = nil
+	}
+	rc.lock.Unlock()
+	conn.Close()
+}
+
+// Close 关闭连接并停止重连
+func (rc *resilientConn) Close() error {
+	rc.once.Do(func() {
+		rc.lock.Lock()
+		close(rc.closed)
+		conn := rc.conn
+		rc.conn = nil
+		rc.lock.Unlock()
+		if conn != nil {
+			conn.Close()
+		}
+	})
+	return nil
+}
+
+// ResilientSubscription 自动重连的订阅者
+type ResilientSubscription struct {
+	resilientConn
+	cb   func(*Subscription, Message)
+	done chan struct{}
+}
+
+// SubscribeQueue 订阅一个队列，cb 在一个单独的 goroutine 中被调用
+func (client *ResilientClient) SubscribeQueue(name string, cb func(*Subscription, Message)) (*ResilientSubscription, error) {
+	return client.subscribe(QUEUE, "subscribeQueue", name, cb)
+}
+
+// SubscribeTopic 订阅一个主题，cb 在一个单独的 goroutine 中被调用
+func (client *ResilientClient) SubscribeTopic(name string, cb func(*Subscription, Message)) (*ResilientSubscription, error) {
+	return client.subscribe(TOPIC, "subscribeTopic", name, cb)
+}
+
+func (client *ResilientClient) subscribe(mode, action, name string, cb func(*Subscription, Message)) (*ResilientSubscription, error) {
+	sub := &ResilientSubscription{cb: cb, done: make(chan struct{})}
+	sub.init(client, mode, name, false)
+	if !client.add(sub) {
+		return nil, ErrAlreadyClosed
+	}
+	go sub.run(action)
+	return sub, nil
+}
+
+func (sub *ResilientSubscription) run(action string) {
+	defer close(sub.done)
+	defer sub.client.remove(sub)
+
+	retries := 0
+	for {
+		conn := sub.connect(action, retries)
+		if conn == nil {
+			break
+		}
+
+		connectedAt := time.Now()
+		err := (&Subscription{Conn: conn}).Run(sub.cb)
+		sub.disconnect(conn)
+		if sub.isClosed() {
+			break
+		}
+		sub.setState(STATE_DISCONNECTED, err)
+		retries = sub.nextRetries(retries, connectedAt)
+		if !sub.wait(retries) {
+			break
+		}
+	}
+	sub.setState(STATE_CLOSED, nil)
+}
+
+// Close 取消订阅，并等待回调函数返回，所以不能在回调函数中调用它
+func (sub *ResilientSubscription) Close() error {
+	sub.resilientConn.Close()
+	<-sub.done
+	return nil
+}
+
+// ResilientPublisher 自动重连的发布者，断线期间的消息缓存在本地，重连后按顺序发送
+type ResilientPublisher struct {
+	resilientConn
+	buffer chan Message
+	done   chan struct{}
+}
+
+// ToQueue 创建一个发送到队列的发布者
+func (client *ResilientClient) ToQueue(name string) (*ResilientPublisher, error) {
+	return client.to(QUEUE, "sendQueue", name)
+}
+
+// ToTopic 创建一个发送到主题的发布者
+func (client *ResilientClient) ToTopic(name string) (*ResilientPublisher, error) {
+	return client.to(TOPIC, "sendTopic", name)
+}
+
+func (client *ResilientClient) to(mode, action, name string) (*ResilientPublisher, error) {
+	pub := &ResilientPublisher{
+		buffer: make(chan Message, client.options.BufferSize),
+		done:   make(chan struct{}),
+	}
+	pub.init(client, mode, name, true)
+	if !client.add(pub) {
+		return nil, ErrAlreadyClosed
+	}
+	go pub.run(action)
+	return pub, nil
+}
+
+// Send 将消息放入缓存中，缓存满了时返回 ErrQueueFull
+func (pub *ResilientPublisher) Send(msg Message) error {
+	if pub.isClosed() {
+		return ErrAlreadyClosed
+	}
+	select {
+	case pub.buffer <- Message(append([]byte(nil), msg...)):
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Pending 返回缓存中还没有发送的消息数
+func (pub *ResilientPublisher) Pending() int {
+	return len(pub.buffer)
+}
+
+func (pub *ResilientPublisher) run(action string) {
+	defer close(pub.done)
+	defer pub.client.remove(pub)
+
+	var pending Message
+	retries := 0
+	for {
+		conn := pub.connect(action, retries)
+		if conn == nil {
+			break
+		}
+		connectedAt := time.Now()
+
+		// 服务端不会向发布者发送消息，读连接是为了收到 pong 和发现连接断开
+		disconnected := make(chan error, 1)
+		go func() {
+			for {
+				var bs []byte
+				if err := websocket2.Message.Receive(conn, &bs); err != nil {
+					disconnected <- err
+					return
+				}
+			}
+		}()
+
+		err := func() error {
+			for {
+				if pending != nil {
+					if err := websocket2.Message.Send(conn, encodeMessage(conn, pending)); err != nil {
+						return err
+					}
+					pending = nil
+				}
+				select {
+				case <-pub.closed:
+					return nil
+				case err := <-disconnected:
+					return err
+				case pending = <-pub.buffer:
+				}
+			}
+		}()
+		pub.disconnect(conn)
+		if pub.isClosed() {
+			break
+		}
+		pub.setState(STATE_DISCONNECTED, err)
+		retries = pub.nextRetries(retries, connectedAt)
+		if !pub.wait(retries) {
+			break
+		}
+	}
+	pub.setState(STATE_CLOSED, nil)
+}
+
+// Close 停止发送，缓存中还没有发送的消息被丢弃
+func (pub *ResilientPublisher) Close() error {
+	pub.resilientConn.Close()
+	<-pub.done
+	return nil
+}
@@ -0,0 +1,254 @@
+package hub
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/three-plus-three/modules/websocket2"
+)
+
+// testEngine 是一个只支持主题的简单消息服务，可以停止后在同一个地址上重新启动
+type testEngine struct {
+	t    *testing.T
+	addr string
+	srv  *httptest.Server
+
+	lock        sync.Mutex
+	conns       map[*websocket2.Conn]struct{}
+	subscribers map[string]map[*websocket2.Conn]struct{}
+}
+
+func (e *testEngine) start() {
+	var l net.Listener
+	var err error
+	addr := e.addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	for i := 0; i < 50; i++ {
+		l, err = net.Listen("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	e.addr = l.Addr().String()
+
+	e.lock.Lock()
+	e.conns = map[*websocket2.Conn]struct{}{}
+	e.subscribers = map[string]map[*websocket2.Conn]struct{}{}
+	e.lock.Unlock()
+	e.srv = httptest.NewUnstartedServer(http.HandlerFunc(e.serveHTTP))
+	e.srv.Listener.Close()
+	e.srv.Listener = l
+	e.srv.Start()
+}
+
+func (e *testEngine) kill() {
+	e.lock.Lock()
+	for conn := range e.conns {
+		conn.Close()
+	}
+	e.lock.Unlock()
+	e.srv.Close()
+}
+
+func (e *testEngine) subscriberCount(name string) int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.subscribers[name])
+}
+
+func (e *testEngine) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	switch r.URL.Path {
+	case "/subscribeTopic":
+		websocket2.Server{Handler: func(conn *websocket2.Conn) {
+			e.lock.Lock()
+			e.conns[conn] = struct{}{}
+			if e.subscribers[name] == nil {
+				e.subscribers[name] = map[*websocket2.Conn]struct{}{}
+			}
+			e.subscribers[name][conn] = struct{}{}
+			e.lock.Unlock()
+
+			var bs []byte
+			for websocket2.Message.Receive(conn, &bs) == nil {
+			}
+
+			e.lock.Lock()
+			delete(e.conns, conn)
+			delete(e.subscribers[name], conn)
+			e.lock.Unlock()
+		}}.ServeHTTP(w, r)
+	case "/sendTopic":
+		// 等到有订阅者时才接受发布者，以免重启后消息在重新订阅之前被丢弃
+		for i := 0; i < 100 && e.subscriberCount(name) == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		websocket2.Server{Handler: func(conn *websocket2.Conn) {
+			e.lock.Lock()
+			e.conns[conn] = struct{}{}
+			e.lock.Unlock()
+
+			for {
+				var bs []byte
+				if err := websocket2.Message.Receive(conn, &bs); err != nil {
+					break
+				}
+				e.lock.Lock()
+				for sub := range e.subscribers[name] {
+					websocket2.Message.Send(sub, bs)
+				}
+				e.lock.Unlock()
+			}
+
+			e.lock.Lock()
+			delete(e.conns, conn)
+			e.lock.Unlock()
+		}}.ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	for i := 0; i < 500; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("wait timeout -", msg)
+}
+
+func TestResilientBackoff(t *testing.T) {
+	client := NewResilientClient(Connect("http://127.0.0.1"), ResilientOptions{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	for retries, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for i := 0; i < 10; i++ {
+			d := client.backoff(retries)
+			if d < max/2 || d > max {
+				t.Errorf("retries=%d, backoff is %v, excepted is [%v, %v]", retries, d, max/2, max)
+			}
+		}
+	}
+	if d := client.backoff(1000); d > time.Second {
+		t.Error("backoff is", d)
+	}
+}
+
+func TestResilientClient(t *testing.T) {
+	engine := &testEngine{t: t}
+	engine.start()
+
+	var eventLock sync.Mutex
+	var events []StateEvent
+	client := NewResilientClient(Connect(engine.srv.URL), ResilientOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		BufferSize: 10,
+		OnStateChange: func(evt StateEvent) {
+			eventLock.Lock()
+			events = append(events, evt)
+			eventLock.Unlock()
+		},
+	})
+	defer client.Close()
+
+	received := make(chan string, 100)
+	sub, err := client.SubscribeTopic("t1", func(_ *Subscription, msg Message) {
+		received <- string(msg.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := client.ToTopic("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "connected", func() bool {
+		return pub.State() == STATE_CONNECTED && engine.subscriberCount("t1") == 1
+	})
+
+	expected := []string{"a"}
+	if err := pub.Send(Message("a")); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-received; s != "a" {
+		t.Error("excepted is a, actual is", s)
+	}
+
+	// 停止服务后的消息缓存在本地
+	engine.kill()
+	waitFor(t, "disconnected", func() bool {
+		return pub.State() != STATE_CONNECTED && sub.State() != STATE_CONNECTED
+	})
+	for i := 0; ; i++ {
+		msg := string(rune('b' + i))
+		if err := pub.Send(Message(msg)); err != nil {
+			if err != ErrQueueFull {
+				t.Error(err)
+			}
+			break
+		}
+		expected = append(expected, msg)
+	}
+	if len(expected) != 11 {
+		t.Error("excepted 10 buffered messages, actual is", len(expected)-1)
+	}
+	if pub.Pending() != 10 {
+		t.Error("pending is", pub.Pending())
+	}
+
+	// 重启服务后重新订阅并发送缓存的消息
+	engine.start()
+	defer engine.kill()
+	for _, s := range expected[1:] {
+		select {
+		case actual := <-received:
+			if actual != s {
+				t.Error("excepted is", s, ", actual is", actual)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait", s, "timeout")
+		}
+	}
+	if pub.Pending() != 0 {
+		t.Error("pending is", pub.Pending())
+	}
+
+	client.Close()
+	if pub.State() != STATE_CLOSED || sub.State() != STATE_CLOSED {
+		t.Error("state is", pub.State(), sub.State())
+	}
+	if err := pub.Send(Message("z")); err != ErrAlreadyClosed {
+		t.Error("excepted is ErrAlreadyClosed, actual is", err)
+	}
+
+	eventLock.Lock()
+	defer eventLock.Unlock()
+	counts := map[bool]map[ConnState]int{true: {}, false: {}}
+	for _, evt := range events {
+		if evt.Mode != TOPIC || evt.Name != "t1" {
+			t.Error("unexcepted event", evt)
+		}
+		counts[evt.IsPublisher][evt.State]++
+		if evt.State == STATE_DISCONNECTED && evt.Err == nil {
+			t.Error("error of disconnected event is nil")
+		}
+	}
+	for _, isPublisher := range []bool{true, false} {
+		if counts[isPublisher][STATE_CONNECTED] != 2 ||
+			counts[isPublisher][STATE_DISCONNECTED] < 1 ||
+			counts[isPublisher][STATE_CLOSED] != 1 {
+			t.Error("publisher:", isPublisher, "events:", counts[isPublisher])
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package hub_test
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/log"
+	"github.com/three-plus-three/modules/hub"
+	"github.com/three-plus-three/modules/hub/engine"
+)
+
+// standardEngine 在固定地址上运行 engine.StandardEngine，停止后可以重新启动
+type standardEngine struct {
+	t      *testing.T
+	addr   string
+	engine *engine.StandardEngine
+	srv    *httptest.Server
+}
+
+func (e *standardEngine) start() {
+	var l net.Listener
+	var err error
+	addr := e.addr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	for i := 0; i < 50; i++ {
+		l, err = net.Listen("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	e.addr = l.Addr().String()
+
+	e.engine, err = engine.NewEngine(&engine.Options{ID: 1, Logger: log.Empty()}, nil)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	e.srv = httptest.NewUnstartedServer(e.engine)
+	e.srv.Listener.Close()
+	e.srv.Listener = l
+	e.srv.Start()
+}
+
+func (e *standardEngine) kill() {
+	e.engine.Close()
+	e.srv.Close()
+}
+
+func TestResilientClientWithStandardEngine(t *testing.T) {
+	srv := &standardEngine{t: t}
+	srv.start()
+
+	client := hub.NewResilientClient(hub.Connect(srv.srv.URL), hub.ResilientOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		BufferSize: 10,
+	})
+	defer client.Close()
+
+	messages := make(chan hub.Message, 100)
+	sub, err := client.SubscribeQueue("q1", func(_ *hub.Subscription, msg hub.Message) {
+		messages <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := client.ToQueue("q1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(excepted string) {
+		select {
+		case msg := <-messages:
+			if actual := string(msg.Data()); actual != excepted {
+				t.Error("excepted is", excepted, ", actual is", actual)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait", excepted, "timeout")
+		}
+	}
+
+	if err := pub.Send(hub.Message("a")); err != nil {
+		t.Fatal(err)
+	}
+	wait("a")
+
+	// 停止服务后的消息缓存在本地，重启后重新订阅并发送它们
+	srv.kill()
+	for i := 0; i < 500 && (pub.State() == hub.STATE_CONNECTED || sub.State() == hub.STATE_CONNECTED); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pub.State() == hub.STATE_CONNECTED || sub.State() == hub.STATE_CONNECTED {
+		t.Fatal("state is", pub.State(), sub.State())
+	}
+	for _, s := range []string{"b", "c"} {
+		if err := pub.Send(hub.Message(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.start()
+	defer srv.kill()
+	wait("b")
+	wait("c")
+
+	if err := pub.Send(hub.Message("d")); err != nil {
+		t.Fatal(err)
+	}
+	wait("d")
+
+	// 消息头经过 engine 传递给订阅者，像消息头的数据仍然是数据
+	for _, msg := range []hub.Message{
+		hub.CreateMessageWithHeader(map[string]string{"traceparent": "00-01"}, []byte("e")),
+		hub.CreateDataMessage([]byte("\xffHDR\x01\x00\x03a=1f")),
+	} {
+		if err := pub.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case actual := <-messages:
+			if !reflect.DeepEqual(actual.Header(), msg.Header()) || !bytes.Equal(actual.Data(), msg.Data()) {
+				t.Errorf("excepted is %q, actual is %q", msg, actual)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait", msg, "timeout")
+		}
+	}
+}
@@ -14,9 +14,13 @@ func (e *ErrDisconnect) Error() string {
 	return e.err.Error()
 }
 
+// IsConnected 判断是不是连接断开的错误，包括 keepalive 发现对方无响应后关闭连接的错误
 func IsConnected(e error) bool {
-	_, ok := e.(*ErrDisconnect)
-	return ok
+	switch e.(type) {
+	case *ErrDisconnect, *websocket2.KeepaliveError:
+		return true
+	}
+	return false
 }
 
 type Subscription struct {
@@ -39,6 +43,10 @@ func (sub *Subscription) Run(cb func(*Subscription, Message)) error {
 			return err
 		}
 
-		cb(sub, CreateDataMessage(bs))
+		msg, err := decodeMessage(sub.Conn, bs)
+		if err != nil {
+			return err
+		}
+		cb(sub, msg)
 	}
 }
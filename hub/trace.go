@@ -0,0 +1,34 @@
+package hub
+
+import (
+	"context"
+
+	"github.com/three-plus-three/modules/tracing"
+)
+
+// CreateMessageWithContext 创建一个消息，ctx 中有 span 时为发布创建一个 producer span，
+// 并将它的上下文放在消息头中，消费者用 StartConsumeSpan 将两端关联起来
+func CreateMessageWithContext(ctx context.Context, operationName string, bs []byte) Message {
+	if tracing.SpanFromContext(ctx) == nil {
+		return CreateDataMessage(bs)
+	}
+	span, ctx := tracing.StartSpanFromContext(ctx, operationName,
+		tracing.WithKind(tracing.SPAN_KIND_PRODUCER))
+	defer span.Finish()
+
+	header := tracing.MapCarrier{}
+	tracing.Inject(ctx, header)
+	return CreateMessageWithHeader(header, bs)
+}
+
+// StartConsumeSpan 为消费消息创建一个 consumer span，消息头中有跟踪的上下文时它跟随发布的 span，
+// 返回的 context 中包含这个 span
+func StartConsumeSpan(ctx context.Context, operationName string, msg Message) (tracing.Span, context.Context) {
+	opts := []tracing.StartOption{tracing.WithKind(tracing.SPAN_KIND_CONSUMER)}
+	if header := msg.Header(); header != nil {
+		if sc, err := tracing.GlobalTracer().Extract(tracing.MapCarrier(header)); err == nil {
+			opts = append(opts, tracing.FollowsFrom(sc))
+		}
+	}
+	return tracing.StartSpanFromContext(ctx, operationName, opts...)
+}
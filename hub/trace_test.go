@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/three-plus-three/modules/tracing"
+)
+
+func TestMessageHeader(t *testing.T) {
+	msg := CreateDataMessage([]byte("abc"))
+	if msg.Header() != nil || string(msg.Data()) != "abc" {
+		t.Error("message is", msg.Header(), string(msg.Data()))
+	}
+	if m := CreateMessageWithHeader(nil, []byte("abc")); !bytes.Equal(m.Bytes(), []byte("abc")) {
+		t.Error("message is", m.Bytes())
+	}
+
+	msg = CreateMessageWithHeader(map[string]string{"a": "1", "b": "x=y&z"}, []byte("abc"))
+	header := msg.Header()
+	if len(header) != 2 || header["a"] != "1" || header["b"] != "x=y&z" {
+		t.Error("header is", header)
+	}
+	if string(msg.Data()) != "abc" {
+		t.Error("data is", string(msg.Data()))
+	}
+
+	// 截断的消息头当作普通的数据
+	broken := Message(msg.Bytes()[:len(messageHeaderMagic)+3])
+	if broken.Header() != nil || !bytes.Equal(broken.Data(), broken.Bytes()) {
+		t.Error("broken message is", broken.Header(), broken.Data())
+	}
+
+	// 以 messageHeaderMagic 开头的数据不会被当作消息头
+	data := []byte(messageHeaderMagic + "\x00\x03a=1abc")
+	if m := CreateDataMessage(data); m.Header() != nil || !bytes.Equal(m.Data(), data) {
+		t.Error("message is", m.Header(), m.Data())
+	}
+}
+
+func TestMessageFrame(t *testing.T) {
+	for _, msg := range []Message{
+		CreateDataMessage([]byte("abc")),
+		CreateDataMessage(nil),
+		CreateDataMessage([]byte(messageHeaderMagic + "\x00\x03a=1abc")),
+		CreateMessageWithHeader(map[string]string{"a": "1"}, []byte("abc")),
+	} {
+		frame := msg.Frame()
+		actual, err := ParseFrame(frame)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(actual.Header(), msg.Header()) || !bytes.Equal(actual.Data(), msg.Data()) {
+			t.Errorf("excepted is %q, actual is %q", msg, actual)
+		}
+	}
+
+	if frame := CreateDataMessage([]byte("abc")).Frame(); !bytes.Equal(frame, []byte("\x00\x00abc")) {
+		t.Errorf("frame is %q", frame)
+	}
+	for _, frame := range []string{"", "\x00", "\x00\x05a=1"} {
+		if _, err := ParseFrame([]byte(frame)); err != ErrInvalidFrame {
+			t.Errorf("%q: excepted is ErrInvalidFrame, actual is %v", frame, err)
+		}
+	}
+}
+
+func TestMessageTracing(t *testing.T) {
+	tracer := tracing.NewMemoryTracer()
+	tracing.SetGlobalTracer(tracer)
+	defer tracing.SetGlobalTracer(nil)
+
+	if msg := CreateMessageWithContext(context.Background(), "publish", []byte("abc")); msg.Header() != nil {
+		t.Error("header is", msg.Header())
+	}
+
+	root, ctx := tracing.StartSpanFromContext(context.Background(), "root")
+	msg := CreateMessageWithContext(ctx, "publish", []byte("abc"))
+	root.Finish()
+	if string(msg.Data()) != "abc" {
+		t.Error("data is", string(msg.Data()))
+	}
+
+	span, ctx := StartConsumeSpan(context.Background(), "consume", msg)
+	if tracing.SpanFromContext(ctx) != span {
+		t.Error("span isn't in the context")
+	}
+	span.Finish()
+
+	rootSpan := tracer.FindSpan("root")
+	publishSpan := tracer.FindSpan("publish")
+	consumeSpan := tracer.FindSpan("consume")
+	if rootSpan == nil || publishSpan == nil || consumeSpan == nil {
+		t.Fatal("spans is", tracer.FinishedSpans())
+	}
+	if publishSpan.ParentID != rootSpan.SpanID || publishSpan.Kind != tracing.SPAN_KIND_PRODUCER {
+		t.Error("publish span is", publishSpan.ParentID, publishSpan.Kind)
+	}
+	if consumeSpan.TraceID != rootSpan.TraceID || consumeSpan.ParentID != publishSpan.SpanID ||
+		consumeSpan.Reference != tracing.REFERENCE_FOLLOWS_FROM || consumeSpan.Kind != tracing.SPAN_KIND_CONSUMER {
+		t.Error("consume span is", consumeSpan.ParentID, consumeSpan.Reference, consumeSpan.Kind)
+	}
+
+	// 没有跟踪上下文的消息创建一个新的调用链
+	span, _ = StartConsumeSpan(context.Background(), "consume2", CreateDataMessage([]byte("abc")))
+	span.Finish()
+	if s := tracer.FindSpan("consume2"); s == nil || s.ParentID != "" {
+		t.Error("consume2 is", s)
+	}
+}
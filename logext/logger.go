@@ -0,0 +1,152 @@
+package logext
+
+import (
+	"context"
+	stdlog "log"
+	"net/http"
+	"strconv"
+
+	"github.com/runner-mei/log"
+	"github.com/three-plus-three/modules/toolbox"
+	"github.com/three-plus-three/modules/tracing"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// REQUEST_ID_HEADER 传递请求 ID 的 HTTP 头
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+type requestIDKey struct{}
+type serviceKey struct{}
+type loggerKey struct{}
+
+// GenerateRequestID 生成一个新的请求 ID
+func GenerateRequestID() string {
+	return toolbox.GenerateId()
+}
+
+// ContextWithRequestID 返回一个包含请求 ID 的 context
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 返回 ctx 中的请求 ID，没有时返回空字符串
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ContextWithService 返回一个包含服务名的 context
+func ContextWithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// ServiceFromContext 返回 ctx 中的服务名，没有时返回空字符串
+func ServiceFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	service, _ := ctx.Value(serviceKey{}).(string)
+	return service
+}
+
+// ContextWithLogger 返回一个包含 logger 的 context
+func ContextWithLogger(ctx context.Context, logger log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext 返回 ctx 中的 logger，没有时返回 nil，
+// 它不带请求相关的字段，打印日志时请用 For
+func LoggerFromContext(ctx context.Context) log.Logger {
+	if ctx == nil {
+		return nil
+	}
+	logger, _ := ctx.Value(loggerKey{}).(log.Logger)
+	return logger
+}
+
+// Fields 返回 ctx 中请求相关的日志字段，有请求 ID、trace ID、服务名和用户，没有值的字段会被忽略，
+// 这些值在调用时才读取，所以认证之后才放入 ctx 的用户也会被包含
+func Fields(ctx context.Context) []log.Field {
+	if ctx == nil {
+		return nil
+	}
+
+	var fields []log.Field
+	if id := RequestIDFromContext(ctx); id != "" {
+		fields = append(fields, log.String("request_id", id))
+	}
+	if traceID := tracing.TraceIDFromContext(ctx); traceID != "" {
+		fields = append(fields, log.String("trace_id", traceID))
+	}
+	if service := ServiceFromContext(ctx); service != "" {
+		fields = append(fields, log.String("service", service))
+	}
+	if u := UserFromContext(ctx); u != nil {
+		fields = append(fields, log.String("user_id", strconv.FormatInt(u.ID(), 10)),
+			log.String("username", u.Name()))
+	}
+	return fields
+}
+
+// stdWriter 将日志写到标准库的 log 中
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	stdlog.Print(string(p))
+	return len(p), nil
+}
+
+// stdLogger 是没有 logger 时使用的 logger，它将 Info 及以上级别的日志写到标准库的 log 中
+var stdLogger = log.NewLogger(zap.New(zapcore.NewCore(
+	zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		LevelKey:       "level",
+		NameKey:        "logger",
+		MessageKey:     "msg",
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeName:     zapcore.FullNameEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}),
+	zapcore.AddSync(stdWriter{}),
+	zapcore.InfoLevel)))
+
+// For 返回一个带有 ctx 中请求相关字段的 logger，logger 为 nil 时使用 ctx 中的 logger，
+// 都没有时使用 stdLogger
+func For(ctx context.Context, logger log.Logger) log.Logger {
+	if logger == nil {
+		logger = LoggerFromContext(ctx)
+		if logger == nil {
+			logger = stdLogger
+		}
+	}
+
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.With(fields...)
+}
+
+// Handler 是 net/http 的中间件，它从请求头中读取请求 ID，没有时生成一个，并将它写回到响应头中，
+// 然后将请求 ID、服务名和 logger 放入请求的 context 中，logger 为 nil 时不放入
+func Handler(service string, logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if id == "" {
+			id = GenerateRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+
+		ctx := ContextWithRequestID(r.Context(), id)
+		if service != "" {
+			ctx = ContextWithService(ctx, service)
+		}
+		if logger != nil {
+			ctx = ContextWithLogger(ctx, logger)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,101 @@
+package logext
+
+import (
+	"bytes"
+	"context"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/log"
+	"github.com/three-plus-three/modules/tracing"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHandler(t *testing.T) {
+	tracer := tracing.NewMemoryTracer()
+	tracing.SetGlobalTracer(tracer)
+	defer tracing.SetGlobalTracer(nil)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := log.NewLogger(zap.New(core))
+
+	var traceID string
+	handler := Handler("test", logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := tracing.StartSpanFromContext(r.Context(), "test")
+		defer span.Finish()
+		traceID = tracing.TraceIDFromContext(ctx)
+
+		For(ctx, nil).Info("abc")
+	}))
+
+	for _, id := range []string{"", "123"} {
+		logs.TakeAll()
+
+		r := httptest.NewRequest("GET", "/", nil)
+		if id != "" {
+			r.Header.Set(REQUEST_ID_HEADER, id)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		respID := w.Header().Get(REQUEST_ID_HEADER)
+		if respID == "" || (id != "" && respID != id) {
+			t.Error("request id is", respID)
+		}
+
+		entries := logs.TakeAll()
+		if len(entries) != 1 {
+			t.Fatal("logs is", entries)
+		}
+		fields := entries[0].ContextMap()
+		if fields["request_id"] != respID || fields["service"] != "test" {
+			t.Error("fields is", fields)
+		}
+		if traceID == "" || fields["trace_id"] != traceID {
+			t.Error("trace id is", traceID, fields)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := log.NewLogger(zap.New(core))
+
+	if fields := Fields(context.Background()); len(fields) != 0 {
+		t.Error("fields is", fields)
+	}
+	For(context.Background(), logger).Info("abc")
+	if entries := logs.TakeAll(); len(entries) != 1 || len(entries[0].Context) != 0 {
+		t.Error("logs is", entries)
+	}
+
+	// 参数中的 logger 优先于 context 中的 logger
+	other, otherLogs := observer.New(zapcore.DebugLevel)
+	ctx := ContextWithLogger(context.Background(), log.NewLogger(zap.New(other)))
+	ctx = ContextWithRequestID(ctx, "abc")
+	For(ctx, logger).Info("abc")
+	if entries := logs.TakeAll(); len(entries) != 1 || entries[0].ContextMap()["request_id"] != "abc" {
+		t.Error("logs is", entries)
+	}
+	For(ctx, nil).Info("abc")
+	if entries := otherLogs.TakeAll(); len(entries) != 1 || entries[0].ContextMap()["request_id"] != "abc" {
+		t.Error("logs is", entries)
+	}
+
+	// 都没有时写到标准库的 log 中
+	var buf bytes.Buffer
+	stdlog.SetOutput(&buf)
+	defer stdlog.SetOutput(os.Stderr)
+	For(ContextWithRequestID(context.Background(), "abc"), nil).Named("cache").Info("cache is refreshed.")
+	For(context.Background(), nil).Debug("debug")
+	if s := buf.String(); !strings.Contains(s, "cache is refreshed.") || !strings.Contains(s, `"request_id": "abc"`) ||
+		!strings.Contains(s, "cache") || strings.Contains(s, "debug") {
+		t.Error("log is", s)
+	}
+}
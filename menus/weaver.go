@@ -1,6 +1,7 @@
 package menus
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -160,6 +161,10 @@ func (weaver *menuWeaver) Init() error {
 }
 
 func (weaver *menuWeaver) Update(app string, menuList []toolbox.Menu) error {
+	return weaver.UpdateWithContext(context.Background(), app, menuList)
+}
+
+func (weaver *menuWeaver) UpdateWithContext(ctx context.Context, app string, menuList []toolbox.Menu) error {
 	weaver.mu.RLock()
 	oldList := weaver.byApplications[app]
 	weaver.mu.RUnlock()
@@ -192,7 +197,7 @@ func (weaver *menuWeaver) Update(app string, menuList []toolbox.Menu) error {
 	weaver.menuList = weaver.deleteByDisabled(weaver.menuList)
 	weaver.menuList = ClearDividerFromList(weaver.menuList)
 
-	weaver.sendEvent(hub.CreateDataMessage([]byte(strconv.Itoa(len(menuList)))))
+	weaver.sendEvent(hub.CreateMessageWithContext(ctx, EventName, []byte(strconv.Itoa(len(menuList)))))
 
 	filename := weaver.env.Fs.FromTMP("app_menus.json")
 	if err = os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
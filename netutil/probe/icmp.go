@@ -0,0 +1,225 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+)
+
+var idSeq = uint32(os.Getpid())
+
+func nextID() int {
+	return int(atomic.AddUint32(&idSeq, 1) & 0xffff)
+}
+
+type icmpConn struct {
+	*icmp.PacketConn
+	isIPv6 bool
+	isRaw  bool
+}
+
+// listenICMP 打开一个 ICMP 连接，不是 privileged 时先尝试 datagram socket (linux 下需要
+// net.ipv4.ping_group_range 包含当前用户组), 失败时再用 raw socket (需要 root 或 CAP_NET_RAW)
+func listenICMP(isIPv6, privileged bool) (*icmpConn, error) {
+	dgram, raw, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if isIPv6 {
+		dgram, raw, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	if !privileged {
+		c, err := icmp.ListenPacket(dgram, address)
+		if err == nil {
+			return &icmpConn{PacketConn: c, isIPv6: isIPv6}, nil
+		}
+	}
+	c, err := icmp.ListenPacket(raw, address)
+	if err != nil {
+		return nil, err
+	}
+	return &icmpConn{PacketConn: c, isIPv6: isIPv6, isRaw: true}, nil
+}
+
+// closeOnDone 在 ctx 取消时关闭连接，以中断阻塞的读操作
+func closeOnDone(ctx context.Context, conn interface{ Close() error }) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (c *icmpConn) proto() int {
+	if c.isIPv6 {
+		return protocolIPv6ICMP
+	}
+	return protocolICMP
+}
+
+func (c *icmpConn) echoType() icmp.Type {
+	if c.isIPv6 {
+		return ipv6.ICMPTypeEchoRequest
+	}
+	return ipv4.ICMPTypeEcho
+}
+
+func (c *icmpConn) echoReplyType() icmp.Type {
+	if c.isIPv6 {
+		return ipv6.ICMPTypeEchoReply
+	}
+	return ipv4.ICMPTypeEchoReply
+}
+
+func (c *icmpConn) setTTL(ttl int) error {
+	if c.isIPv6 {
+		return c.IPv6PacketConn().SetHopLimit(ttl)
+	}
+	return c.IPv4PacketConn().SetTTL(ttl)
+}
+
+func (c *icmpConn) sendEcho(ip net.IP, id, seq, size int) error {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	msg := icmp.Message{
+		Type: c.echoType(),
+		Body: &icmp.Echo{ID: id, Seq: seq & 0xffff, Data: data},
+	}
+	bs, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	// datagram socket 的目标地址必须是 UDPAddr
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	if c.isRaw {
+		dst = &net.IPAddr{IP: ip}
+	}
+	_, err = c.WriteTo(bs, dst)
+	return err
+}
+
+// readMessage 读一个 ICMP 报文，报文无法解析时返回的 msg 为 nil
+func (c *icmpConn) readMessage(buf []byte, deadline time.Time) (*icmp.Message, net.IP, error) {
+	if err := c.SetReadDeadline(deadline); err != nil {
+		return nil, nil, err
+	}
+	n, peer, err := c.ReadFrom(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := icmp.ParseMessage(c.proto(), buf[:n])
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	switch addr := peer.(type) {
+	case *net.IPAddr:
+		return msg, addr.IP, nil
+	case *net.UDPAddr:
+		return msg, addr.IP, nil
+	}
+	return msg, nil, nil
+}
+
+// waitEcho 等待指定序号的应答，超时返回 false
+func (c *icmpConn) waitEcho(buf []byte, ip net.IP, id, seq int, deadline time.Time) (bool, error) {
+	for {
+		msg, peer, err := c.readMessage(buf, deadline)
+		if err != nil {
+			if isTimeout(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if msg == nil || msg.Type != c.echoReplyType() {
+			continue
+		}
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || echo.Seq != seq&0xffff {
+			continue
+		}
+		// raw socket 会收到所有的 ICMP 报文，datagram socket 的 ID 由内核分配并过滤
+		if c.isRaw && (echo.ID != id || !peer.Equal(ip)) {
+			continue
+		}
+		return true, nil
+	}
+}
+
+// Ping 向 host 发送 ICMP echo 请求，并统计应答
+//
+// 只有在地址解析或打开连接失败时才返回错误，收不到应答时返回丢包率为 100 的结果，
+// ctx 取消时返回已有的结果和 ctx 的错误。
+func Ping(ctx context.Context, host string, opts *PingOptions) (*PingResult, error) {
+	o := opts.withDefaults()
+	ip, err := resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := listenICMP(ip.To4() == nil, o.Privileged)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	if o.TTL > 0 {
+		if err := conn.setTTL(o.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &PingResult{Host: host, Addr: ip}
+	id := nextID()
+	buf := make([]byte, 1500)
+	var sendAt time.Time
+	for seq := 0; seq < o.Count; seq++ {
+		if seq > 0 {
+			if err := sleep(ctx, o.Interval-time.Since(sendAt)); err != nil {
+				result.compute()
+				return result, err
+			}
+		}
+
+		sendAt = time.Now()
+		result.Sent++
+		if err := conn.sendEcho(ip, id, seq, o.Size); err != nil {
+			if ctx.Err() != nil {
+				result.compute()
+				return result, ctx.Err()
+			}
+			continue
+		}
+
+		ok, err := conn.waitEcho(buf, ip, id, seq, sendAt.Add(o.Timeout))
+		if err != nil {
+			result.compute()
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			return result, err
+		}
+		if ok {
+			result.add(time.Since(sendAt))
+		}
+	}
+	result.compute()
+	return result, nil
+}
@@ -0,0 +1,134 @@
+// Package probe 用 Go 实现的 ping, traceroute 和 tcp 探测，用于替换 util.Commands 中的
+// ping, tracert, traceroute 和 nping 等外部命令，它们的输出和操作系统及语言有关，很难解析。
+package probe
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"time"
+)
+
+// Statistics 探测的统计结果
+type Statistics struct {
+	Sent     int
+	Received int
+	Loss     float64 // 丢包率，百分比
+	Min      time.Duration
+	Avg      time.Duration
+	Max      time.Duration
+	Mdev     time.Duration   // 平均偏差，和 ping 命令中的 mdev 一样
+	RTTs     []time.Duration // 收到应答的往返时间
+}
+
+func (s *Statistics) add(rtt time.Duration) {
+	s.Received++
+	s.RTTs = append(s.RTTs, rtt)
+}
+
+func (s *Statistics) compute() {
+	if s.Sent > 0 {
+		s.Loss = float64(s.Sent-s.Received) * 100 / float64(s.Sent)
+	}
+	if len(s.RTTs) == 0 {
+		return
+	}
+
+	var sum, sum2 float64
+	s.Min, s.Max = s.RTTs[0], s.RTTs[0]
+	for _, rtt := range s.RTTs {
+		if rtt < s.Min {
+			s.Min = rtt
+		}
+		if rtt > s.Max {
+			s.Max = rtt
+		}
+		sum += float64(rtt)
+		sum2 += float64(rtt) * float64(rtt)
+	}
+	avg := sum / float64(len(s.RTTs))
+	s.Avg = time.Duration(avg)
+	if variance := sum2/float64(len(s.RTTs)) - avg*avg; variance > 0 {
+		s.Mdev = time.Duration(math.Sqrt(variance))
+	}
+}
+
+// PingOptions ping 的选项，为零值的选项使用缺省值
+type PingOptions struct {
+	Count    int           // 发送的次数，缺省为 4
+	Interval time.Duration // 发送的间隔，缺省为 1 秒
+	Timeout  time.Duration // 每次等待应答的时间，缺省为 2 秒
+	Size     int           // ICMP 数据的长度，缺省为 56
+	TTL      int
+
+	// Privileged 为 true 时直接使用 raw socket, 否则先尝试无需特权的 datagram socket,
+	// 失败后再用 raw socket
+	Privileged bool
+}
+
+func (opts *PingOptions) withDefaults() PingOptions {
+	var o PingOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Count <= 0 {
+		o.Count = 4
+	}
+	if o.Interval <= 0 {
+		o.Interval = 1 * time.Second
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+	if o.Size <= 0 {
+		o.Size = 56
+	}
+	return o
+}
+
+// PingResult ping 的结果
+type PingResult struct {
+	Host string
+	Addr net.IP
+	Statistics
+}
+
+func resolve(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, errors.New("resolve '" + host + "' failed, " + err.Error())
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("address of '" + host + "' is not found.")
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP, nil
+		}
+	}
+	return addrs[0].IP, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
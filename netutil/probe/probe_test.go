@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	a "github.com/three-plus-three/modules/assert"
+)
+
+func skipIfPermission(t *testing.T, err error) {
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("icmp socket isn't permitted,", err)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	s := Statistics{Sent: 4}
+	for _, rtt := range []time.Duration{1 * time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond} {
+		s.add(rtt)
+	}
+	s.compute()
+
+	a.Check(t, s.Received, a.Equals, 3)
+	a.Check(t, s.Loss, a.Equals, float64(25))
+	a.Check(t, s.Min, a.Equals, 1*time.Millisecond)
+	a.Check(t, s.Avg, a.Equals, 2*time.Millisecond)
+	a.Check(t, s.Max, a.Equals, 3*time.Millisecond)
+	a.Check(t, s.Mdev, a.Equals, time.Duration(816496))
+
+	s = Statistics{Sent: 2}
+	s.compute()
+	a.Check(t, s.Loss, a.Equals, float64(100))
+	a.Check(t, s.Avg, a.Equals, time.Duration(0))
+}
+
+func TestPing(t *testing.T) {
+	for _, privileged := range []bool{false, true} {
+		result, err := Ping(context.Background(), "127.0.0.1", &PingOptions{
+			Count:      3,
+			Interval:   10 * time.Millisecond,
+			Timeout:    time.Second,
+			Privileged: privileged,
+		})
+		if err != nil {
+			skipIfPermission(t, err)
+			t.Fatal(err)
+		}
+		a.Check(t, result.Addr.String(), a.Equals, "127.0.0.1")
+		a.Check(t, result.Sent, a.Equals, 3)
+		a.Check(t, result.Received, a.Equals, 3)
+		a.Check(t, result.Loss, a.Equals, float64(0))
+		a.Check(t, result.Min <= result.Avg && result.Avg <= result.Max, a.Equals, true)
+	}
+}
+
+func TestPingCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := Ping(ctx, "127.0.0.1", &PingOptions{Count: 100, Interval: 50 * time.Millisecond})
+	if err != nil && result == nil {
+		skipIfPermission(t, err)
+		t.Fatal(err)
+	}
+	a.Check(t, err, a.Equals, context.DeadlineExceeded)
+	a.Check(t, result.Sent < 100, a.Equals, true)
+}
+
+func TestTraceroute(t *testing.T) {
+	for _, protocol := range []string{TRACE_ICMP, TRACE_UDP} {
+		result, err := Traceroute(context.Background(), "127.0.0.1", &TracerouteOptions{
+			Protocol: protocol,
+			MaxHops:  5,
+			Queries:  2,
+			Timeout:  time.Second,
+		})
+		if err != nil {
+			skipIfPermission(t, err)
+			t.Fatal(protocol, err)
+		}
+		a.Check(t, result.Reached, a.Equals, true, a.Commentf("%s", protocol))
+		a.Assert(t, len(result.Hops), a.Equals, 1, a.Commentf("%s", protocol))
+		a.Check(t, result.Hops[0].TTL, a.Equals, 1)
+		a.Check(t, result.Hops[0].Addr.String(), a.Equals, "127.0.0.1")
+		a.Check(t, result.Hops[0].Received, a.Equals, 2)
+	}
+
+	_, err := Traceroute(context.Background(), "127.0.0.1", &TracerouteOptions{Protocol: "tcp"})
+	if err == nil {
+		t.Error("excepted error is not nil")
+	}
+}
+
+func TestTCPPing(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	address := ln.Addr().String()
+
+	opts := &PingOptions{Count: 3, Interval: 10 * time.Millisecond, Timeout: time.Second}
+	result, err := TCPPing(context.Background(), address, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, result.Received, a.Equals, 3)
+	a.Check(t, result.Loss, a.Equals, float64(0))
+
+	ln.Close()
+	result, err = TCPPing(context.Background(), address, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, result.Received, a.Equals, 0)
+	a.Check(t, result.Loss, a.Equals, float64(100))
+}
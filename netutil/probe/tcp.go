@@ -0,0 +1,50 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// TCPPing 用 TCP 连接探测 address (host:port), 连接建立的时间作为往返时间，
+// 连接失败 (包括端口关闭) 的探测计为丢失，opts 中的 Size, TTL 和 Privileged 无效
+func TCPPing(ctx context.Context, address string, opts *PingOptions) (*PingResult, error) {
+	o := opts.withDefaults()
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, errors.New("address '" + address + "' is invalid, " + err.Error())
+	}
+	ip, err := resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	target := net.JoinHostPort(ip.String(), port)
+	dialer := net.Dialer{Timeout: o.Timeout}
+	result := &PingResult{Host: address, Addr: ip}
+	var sendAt time.Time
+	for i := 0; i < o.Count; i++ {
+		if i > 0 {
+			if err := sleep(ctx, o.Interval-time.Since(sendAt)); err != nil {
+				result.compute()
+				return result, err
+			}
+		}
+
+		sendAt = time.Now()
+		result.Sent++
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			if ctx.Err() != nil {
+				result.compute()
+				return result, ctx.Err()
+			}
+			continue
+		}
+		result.add(time.Since(sendAt))
+		conn.Close()
+	}
+	result.compute()
+	return result, nil
+}
@@ -0,0 +1,293 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	TRACE_UDP  = "udp"
+	TRACE_ICMP = "icmp"
+)
+
+// TracerouteOptions traceroute 的选项，为零值的选项使用缺省值
+type TracerouteOptions struct {
+	Protocol string        // 探测报文的协议 TRACE_UDP 或 TRACE_ICMP, 缺省为 TRACE_UDP
+	FirstHop int           // 缺省为 1
+	MaxHops  int           // 缺省为 30
+	Queries  int           // 每一跳探测的次数，缺省为 3
+	Timeout  time.Duration // 每次探测等待应答的时间，缺省为 3 秒
+	Port     int           // UDP 探测的起始端口，缺省为 33434
+}
+
+func (opts *TracerouteOptions) withDefaults() TracerouteOptions {
+	var o TracerouteOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Protocol == "" {
+		o.Protocol = TRACE_UDP
+	}
+	if o.FirstHop <= 0 {
+		o.FirstHop = 1
+	}
+	if o.MaxHops <= 0 {
+		o.MaxHops = 30
+	}
+	if o.Queries <= 0 {
+		o.Queries = 3
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 3 * time.Second
+	}
+	if o.Port <= 0 {
+		o.Port = 33434
+	}
+	return o
+}
+
+// Hop 路径中的一跳，Addr 为第一个应答的地址，全部超时时为 nil
+type Hop struct {
+	TTL  int
+	Addr net.IP
+	Statistics
+}
+
+// TracerouteResult traceroute 的结果
+type TracerouteResult struct {
+	Host    string
+	Addr    net.IP
+	Hops    []Hop
+	Reached bool // 是否到达了目标地址
+}
+
+type tracer interface {
+	send(ttl, seq int) error
+
+	// match 判断报文是不是 seq 的应答，final 表示不用再增加 ttl 了
+	match(msg *icmp.Message, peer net.IP, seq int) (matched, final bool)
+	Close() error
+}
+
+type icmpTracer struct {
+	conn *icmpConn
+	dst  net.IP
+	id   int
+}
+
+func (t *icmpTracer) send(ttl, seq int) error {
+	if err := t.conn.setTTL(ttl); err != nil {
+		return err
+	}
+	return t.conn.sendEcho(t.dst, t.id, seq, 32)
+}
+
+func (t *icmpTracer) match(msg *icmp.Message, peer net.IP, seq int) (bool, bool) {
+	if msg.Type == t.conn.echoReplyType() {
+		echo, ok := msg.Body.(*icmp.Echo)
+		if ok && echo.ID == t.id && echo.Seq == seq&0xffff && peer.Equal(t.dst) {
+			return true, true
+		}
+		return false, false
+	}
+
+	payload, final := errorPayload(msg, t.conn.isIPv6, protocolICMP, protocolIPv6ICMP)
+	if len(payload) < 8 {
+		return false, false
+	}
+	if int(binary.BigEndian.Uint16(payload[4:6])) != t.id ||
+		int(binary.BigEndian.Uint16(payload[6:8])) != seq&0xffff {
+		return false, false
+	}
+	return true, final
+}
+
+func (t *icmpTracer) Close() error {
+	return nil
+}
+
+type udpTracer struct {
+	conn      net.PacketConn
+	isIPv6    bool
+	dst       net.IP
+	port      int
+	localPort int
+}
+
+func (t *udpTracer) send(ttl, seq int) error {
+	var err error
+	if t.isIPv6 {
+		err = ipv6.NewPacketConn(t.conn).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewPacketConn(t.conn).SetTTL(ttl)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(make([]byte, 32), &net.UDPAddr{IP: t.dst, Port: t.dstPort(seq)})
+	return err
+}
+
+// dstPort 每次探测用不同的端口，以便区分应答
+func (t *udpTracer) dstPort(seq int) int {
+	return t.port + (seq-1)%(0x10000-t.port)
+}
+
+func (t *udpTracer) match(msg *icmp.Message, peer net.IP, seq int) (bool, bool) {
+	const protocolUDP = 17
+	payload, final := errorPayload(msg, t.isIPv6, protocolUDP, protocolUDP)
+	if len(payload) < 4 {
+		return false, false
+	}
+	if int(binary.BigEndian.Uint16(payload[0:2])) != t.localPort ||
+		int(binary.BigEndian.Uint16(payload[2:4])) != t.dstPort(seq) {
+		return false, false
+	}
+	return true, final
+}
+
+func (t *udpTracer) Close() error {
+	return t.conn.Close()
+}
+
+// errorPayload 取 ICMP 差错报文中原始报文的载荷 (原始报文的 IP 头之后至少 8 字节),
+// 原始报文的协议不是 proto4 或 proto6 时返回 nil, 目标不可达时 final 为 true
+func errorPayload(msg *icmp.Message, isIPv6 bool, proto4, proto6 int) ([]byte, bool) {
+	var data []byte
+	var final bool
+	switch body := msg.Body.(type) {
+	case *icmp.TimeExceeded:
+		data = body.Data
+	case *icmp.DstUnreach:
+		data, final = body.Data, true
+	default:
+		return nil, false
+	}
+
+	if isIPv6 {
+		// 不处理扩展头
+		if len(data) < ipv6.HeaderLen || int(data[6]) != proto6 {
+			return nil, false
+		}
+		return data[ipv6.HeaderLen:], final
+	}
+	if len(data) < ipv4.HeaderLen || int(data[9]) != proto4 {
+		return nil, false
+	}
+	hl := int(data[0]&0x0f) * 4
+	if len(data) < hl {
+		return nil, false
+	}
+	return data[hl:], final
+}
+
+// Traceroute 探测到 host 的路径
+//
+// 中间路由器返回的 ICMP 超时报文只能用 raw socket 接收，所以它需要 root 或 CAP_NET_RAW 权限。
+// 只有在地址解析或打开连接失败时才返回错误，ctx 取消时返回已有的结果和 ctx 的错误。
+func Traceroute(ctx context.Context, host string, opts *TracerouteOptions) (*TracerouteResult, error) {
+	o := opts.withDefaults()
+	ip, err := resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	isIPv6 := ip.To4() == nil
+
+	conn, err := listenICMP(isIPv6, true)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	var t tracer
+	switch o.Protocol {
+	case TRACE_ICMP:
+		t = &icmpTracer{conn: conn, dst: ip, id: nextID()}
+	case TRACE_UDP:
+		network, address := "udp4", "0.0.0.0:0"
+		if isIPv6 {
+			network, address = "udp6", "[::]:0"
+		}
+		c, err := net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+		t = &udpTracer{conn: c, isIPv6: isIPv6, dst: ip, port: o.Port,
+			localPort: c.LocalAddr().(*net.UDPAddr).Port}
+	default:
+		return nil, errors.New("protocol '" + o.Protocol + "' is unsupported, it must is 'udp' or 'icmp'")
+	}
+	defer t.Close()
+
+	result := &TracerouteResult{Host: host, Addr: ip}
+	buf := make([]byte, 1500)
+	seq := 0
+	for ttl := o.FirstHop; ttl <= o.MaxHops; ttl++ {
+		hop := Hop{TTL: ttl}
+		final := false
+		for q := 0; q < o.Queries; q++ {
+			seq++
+			sendAt := time.Now()
+			hop.Sent++
+			if err := t.send(ttl, seq); err != nil {
+				if ctx.Err() != nil {
+					hop.compute()
+					result.Hops = append(result.Hops, hop)
+					return result, ctx.Err()
+				}
+				continue
+			}
+
+			peer, last, err := waitProbe(conn, buf, t, seq, sendAt.Add(o.Timeout))
+			if err != nil {
+				hop.compute()
+				result.Hops = append(result.Hops, hop)
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				return result, err
+			}
+			if peer != nil {
+				hop.add(time.Since(sendAt))
+				if hop.Addr == nil {
+					hop.Addr = peer
+				}
+				final = final || last
+			}
+		}
+		hop.compute()
+		result.Hops = append(result.Hops, hop)
+		if final {
+			result.Reached = hop.Addr.Equal(ip)
+			break
+		}
+	}
+	return result, nil
+}
+
+// waitProbe 等待 seq 的应答，超时返回的 peer 为 nil
+func waitProbe(conn *icmpConn, buf []byte, t tracer, seq int, deadline time.Time) (net.IP, bool, error) {
+	for {
+		msg, peer, err := conn.readMessage(buf, deadline)
+		if err != nil {
+			if isTimeout(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		if msg == nil || peer == nil {
+			continue
+		}
+		if matched, final := t.match(msg, peer, seq); matched {
+			return peer, final, nil
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/labstack/echo"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	"github.com/three-plus-three/modules/tracing"
+	"github.com/three-plus-three/modules/tracing/otbridge"
 	//jaegercfg "github.com/uber/jaeger-client-go/config"
 	//"github.com/uber/jaeger-lib/metrics"
 )
@@ -77,10 +79,9 @@ func Tracing(comp string) echo.MiddlewareFunc {
 			}
 			defer span.Finish()
 
-			//if ctx := c.Request().Context(); ctx != nil {
-			//	ctx = opentracing.ContextWithSpan(ctx, span)
-			//	c.Request().WithContext(ctx)
-			//}
+			// 将 span 放在请求的 context 中，以便向外的调用注入跟踪的上下文
+			ctx := tracing.ContextWithSpan(c.Request().Context(), otbridge.WrapSpan(span))
+			c.SetRequest(c.Request().WithContext(ctx))
 			c.Set(DefaultKey, span)
 
 			ext.Component.Set(span, comp)
@@ -1,10 +1,13 @@
 package permissions
 
 import (
+	"context"
 	"errors"
 	"sync/atomic"
 
+	"github.com/runner-mei/log"
 	"github.com/three-plus-three/modules/concurrency"
+	"github.com/three-plus-three/modules/logext"
 )
 
 type Permissions struct {
@@ -16,6 +19,8 @@ type Permissions struct {
 type GroupCache struct {
 	concurrency.Tickable
 	permissions atomic.Value
+	// Logger 为 nil 时使用 context 中的 logger，见 logext.For
+	Logger log.Logger
 }
 
 //从缓存中获取权限对象
@@ -58,7 +63,9 @@ func (cache *GroupCache) getPermissions() map[int64]*Permissions {
 	return values
 }
 
-func (cache *GroupCache) refresh(db *DB) error {
+func (cache *GroupCache) refresh(ctx context.Context, db *DB) error {
+	logger := logext.For(ctx, cache.Logger).Named("permission_groups")
+
 	var valueArray []*Permissions
 	err := db.PermissionGroups().Where().All(&valueArray)
 	if err != nil {
@@ -86,5 +93,6 @@ func (cache *GroupCache) refresh(db *DB) error {
 	}
 
 	cache.setPermissions(values)
+	logger.Debug("permission groups is refreshed.", log.Int("count", len(values)))
 	return nil
 }
@@ -1,6 +1,7 @@
 package permissions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -127,7 +128,7 @@ type userManager struct {
 
 func (um *userManager) refresh() {
 	refresh := func() {
-		um.lastErr.Set(um.permissionGroupCache.refresh(um.db))
+		um.lastErr.Set(um.permissionGroupCache.refresh(context.Background(), um.db))
 	}
 	um.permissionGroupCache.Init(5*time.Minute, refresh)
 }
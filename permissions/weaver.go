@@ -1,6 +1,7 @@
 package permissions
 
 import (
+	"context"
 	"strconv"
 	"sync"
 
@@ -40,6 +41,10 @@ func (weaver *memWeaver) Stats() interface{} {
 }
 
 func (weaver *memWeaver) Update(app string, data *PermissionData) error {
+	return weaver.UpdateWithContext(context.Background(), app, data)
+}
+
+func (weaver *memWeaver) UpdateWithContext(ctx context.Context, app string, data *PermissionData) error {
 	weaver.mu.Lock()
 	defer weaver.mu.Unlock()
 	if data == nil || (len(data.Groups) == 0 &&
@@ -73,7 +78,7 @@ func (weaver *memWeaver) Update(app string, data *PermissionData) error {
 		appendPermissionData(&weaver.all, group)
 	}
 
-	event := hub.CreateDataMessage([]byte(strconv.Itoa(len(weaver.all.Permissions))))
+	event := hub.CreateMessageWithContext(ctx, PermissionEventName, []byte(strconv.Itoa(len(weaver.all.Permissions))))
 	weaver.sendEvent(event)
 	return nil
 }
@@ -0,0 +1,183 @@
+package tid
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options is the options of a generator.
+type Options struct {
+	// Node is the id of the current node, it must be unique in the cluster.
+	// A node id is derived from the hostname and the pid if it is zero.
+	Node int64
+
+	// NodeBits is the bit count of the node id, DEFAULT_NODE_BITS is used if it is zero.
+	NodeBits uint
+}
+
+// Generator creates monotonic IDs for a node.
+type Generator struct {
+	node     int64
+	nodeBits uint
+	seqBits  uint
+	maxSeq   int64
+
+	mu   sync.Mutex
+	last int64 // milliseconds since EPOCH of the last id
+	seq  int64
+}
+
+// NewGenerator creates a generator.
+func NewGenerator(opts Options) (*Generator, error) {
+	nodeBits := opts.NodeBits
+	if nodeBits == 0 {
+		nodeBits = DEFAULT_NODE_BITS
+	}
+	if nodeBits > MAX_NODE_BITS {
+		return nil, fmt.Errorf("node bits '%d' is greater than %d", nodeBits, MAX_NODE_BITS)
+	}
+	maxNode := int64(1)<<nodeBits - 1
+
+	node := opts.Node
+	if node == 0 {
+		node = int64(defaultNode() & uint32(maxNode))
+	} else if node < 0 || node > maxNode {
+		return nil, fmt.Errorf("node '%d' is out of range [0, %d]", node, maxNode)
+	}
+
+	seqBits := NODE_AND_SEQUENCE_BITS - nodeBits
+	return &Generator{
+		node:     node,
+		nodeBits: nodeBits,
+		seqBits:  seqBits,
+		maxSeq:   int64(1)<<seqBits - 1,
+	}, nil
+}
+
+// Node returns the node id of the generator.
+func (g *Generator) Node() int64 {
+	return g.node
+}
+
+// Next returns a new ID, it never goes backwards even if the clock does,
+// and it borrows the next millisecond when the sequence is exhausted.
+func (g *Generator) Next() ID {
+	now := int64(time.Since(EPOCH) / time.Millisecond)
+
+	g.mu.Lock()
+	if now > g.last {
+		g.last = now
+		g.seq = 0
+	} else if g.seq < g.maxSeq {
+		g.seq++
+	} else {
+		g.last++
+		g.seq = 0
+	}
+	id := g.last<<NODE_AND_SEQUENCE_BITS | g.node<<g.seqBits | g.seq
+	g.mu.Unlock()
+	return ID(id)
+}
+
+// Decompose returns the time, the node id and the sequence number of an id,
+// the id must be created by a generator with the same NodeBits.
+func (g *Generator) Decompose(id ID) (t time.Time, node, seq int64) {
+	return id.Time(), (int64(id) >> g.seqBits) & (int64(1)<<g.nodeBits - 1), int64(id) & g.maxSeq
+}
+
+var defaultGenerator atomic.Value
+
+func init() {
+	g, err := NewGenerator(Options{})
+	if err != nil {
+		panic(err)
+	}
+	defaultGenerator.Store(g)
+}
+
+// Default returns the default generator.
+func Default() *Generator {
+	return defaultGenerator.Load().(*Generator)
+}
+
+// SetDefault replaces the default generator.
+func SetDefault(g *Generator) {
+	if g == nil {
+		panic(errors.New("generator is nil"))
+	}
+	defaultGenerator.Store(g)
+}
+
+// Configure replaces the default generator with a new one created with opts.
+func Configure(opts Options) error {
+	g, err := NewGenerator(opts)
+	if err != nil {
+		return err
+	}
+	SetDefault(g)
+	return nil
+}
+
+// defaultNode derives a node id from the machine id and the pid.
+func defaultNode() uint32 {
+	var b [5]byte
+	copy(b[:], machineID[:])
+	binary.BigEndian.PutUint16(b[3:], uint16(currentPid))
+	hw := md5.New()
+	hw.Write(b[:])
+	return binary.BigEndian.Uint32(hw.Sum(nil))
+}
+
+var (
+	// machineID stores machine id generated once and used in subsequent calls
+	// to ObjectID and defaultNode function.
+	machineID  = readMachineID()
+	currentPid = os.Getpid()
+)
+
+// readMachineID generates machine id from the hostname, a random id is used
+// if it fails to get the hostname.
+func readMachineID() [3]byte {
+	var id [3]byte
+	hostname, err1 := os.Hostname()
+	if err1 != nil {
+		_, err2 := io.ReadFull(rand.Reader, id[:])
+		if err2 != nil {
+			panic(fmt.Errorf("cannot get hostname: %v; %v", err1, err2))
+		}
+		return id
+	}
+	hw := md5.New()
+	hw.Write([]byte(hostname))
+	copy(id[:], hw.Sum(nil))
+	return id
+}
+
+// objectIDCounter is atomically incremented when generating a new ObjectID.
+var objectIDCounter uint32
+
+// ObjectID returns a new unique 12 bytes Mongo-style ObjectId in hex.
+func ObjectID() string {
+	var b [12]byte
+	// Timestamp, 4 bytes, big endian
+	binary.BigEndian.PutUint32(b[:], uint32(time.Now().Unix()))
+	// Machine, first 3 bytes of md5(hostname)
+	copy(b[4:], machineID[:])
+	// Pid, 2 bytes, big endian
+	binary.BigEndian.PutUint16(b[7:], uint16(currentPid))
+	// Increment, 3 bytes, big endian
+	i := atomic.AddUint32(&objectIDCounter, 1)
+	b[9] = byte(i >> 16)
+	b[10] = byte(i >> 8)
+	b[11] = byte(i)
+	return hex.EncodeToString(b[:])
+}
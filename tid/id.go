@@ -1,24 +1,176 @@
 package tid
 
 import (
+	"database/sql/driver"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"strconv"
 	"sync/atomic"
 	"time"
 )
 
 var ErrInvalidID = errors.New("invalid id string")
 
+// Layout of an ID, from the most significant bit:
+//
+//	1 bit  - sign, always 0
+//	41 bit - milliseconds since EPOCH
+//	22 bit - node id (NodeBits) and sequence number (the rest)
+//
+// IDs created by one generator are monotonic, and the hex string form
+// sorts in the same order as the numeric form.
+const (
+	TIMESTAMP_BITS         = 41
+	NODE_AND_SEQUENCE_BITS = 22
+	DEFAULT_NODE_BITS      = 10
+	MAX_NODE_BITS          = 16
+
+	ID_STRING_LENGTH = 16
+)
+
+// EPOCH is the start time of the timestamp part of an ID.
+var EPOCH = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ID is a k-sortable unique id.
+type ID int64
+
+// New returns a new ID from the default generator.
+func New() ID {
+	return Default().Next()
+}
+
+// ParseID parses the string form of an ID.
+func ParseID(s string) (ID, error) {
+	if len(s) != ID_STRING_LENGTH {
+		return 0, ErrInvalidID
+	}
+	u, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || int64(u) < 0 {
+		return 0, ErrInvalidID
+	}
+	return ID(u), nil
+}
+
+// IsValidID reports whether s is the string form of an ID.
+func IsValidID(s string) bool {
+	_, err := ParseID(s)
+	return err == nil
+}
+
+// Time returns the time when the id was created, in milliseconds.
+func (id ID) Time() time.Time {
+	return EPOCH.Add(time.Duration(int64(id)>>NODE_AND_SEQUENCE_BITS) * time.Millisecond)
+}
+
+// IsZero reports whether id is zero.
+func (id ID) IsZero() bool {
+	return id == 0
+}
+
+// String returns a 16 bytes hex string.
+func (id ID) String() string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	return hex.EncodeToString(b[:])
+}
+
+// MarshalText implements encoding.TextMarshaler, ids are encoded as strings
+// in JSON because javascript cannot hold a 64 bit integer.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *ID) UnmarshalText(text []byte) error {
+	v, err := ParseID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it accepts a string, a number or null.
+func (id *ID) UnmarshalJSON(bs []byte) error {
+	s := string(bs)
+	if s == "null" {
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return id.UnmarshalText(bs[1 : len(bs)-1])
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 0 {
+		return ErrInvalidID
+	}
+	*id = ID(i)
+	return nil
+}
+
+// Value implements driver.Valuer, an id is stored as a BIGINT.
+func (id ID) Value() (driver.Value, error) {
+	return int64(id), nil
+}
+
+// Scan implements sql.Scanner.
+func (id *ID) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*id = 0
+		return nil
+	case int64:
+		if v < 0 {
+			return ErrInvalidID
+		}
+		*id = ID(v)
+		return nil
+	case []byte:
+		return id.scanString(string(v))
+	case string:
+		return id.scanString(v)
+	default:
+		return fmt.Errorf("cannot convert %T to tid.ID", src)
+	}
+}
+
+// scanString parses the text of a column, an id is stored as a BIGINT, so
+// the text is a decimal number if it has digits only, otherwise it is the
+// string form of an ID.
+func (id *ID) scanString(s string) error {
+	if !isDigits(s) {
+		return id.UnmarshalText([]byte(s))
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 0 {
+		return ErrInvalidID
+	}
+	*id = ID(i)
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 var (
 	// idCounter is atomically incremented when generating a new ObjectId
 	// using GenerateID() function. It's used as a counter part of an id.
 	idCounter uint32
 )
 
-// GenerateID returns a new unique ObjectId.
+// GenerateID returns the string form of a new ID.
 func GenerateID() string {
-	return CreateID(time.Now(), atomic.AddUint32(&idCounter, 1))
+	return New().String()
 }
 
 // SequenceID returns a new sequence ObjectId.
@@ -26,7 +178,9 @@ func SequenceID() uint32 {
 	return atomic.AddUint32(&idCounter, 1)
 }
 
-// CreateID create a unique ObjectId.
+// CreateID create a legacy id, it packs a second timestamp and a count.
+//
+// Deprecated: ids created in the same second by two processes may collide, use New instead.
 func CreateID(t time.Time, count uint32) string {
 	var b [8]byte
 	// Timestamp, 4 bytes, big endian
@@ -36,17 +190,40 @@ func CreateID(t time.Time, count uint32) string {
 	return hex.EncodeToString(b[:])
 }
 
-// CreateID create a unique ObjectId.
-func TimeFromID(id string) time.Time {
+// ParseLegacyID parses an id created by CreateID.
+func ParseLegacyID(id string) (time.Time, uint32, error) {
+	if len(id) != ID_STRING_LENGTH {
+		return time.Time{}, 0, ErrInvalidID
+	}
 	bs, err := hex.DecodeString(id)
 	if err != nil {
-		panic(err)
-	}
-	if len(bs) != 8 {
-		panic(ErrInvalidID)
+		return time.Time{}, 0, ErrInvalidID
 	}
 
 	// Timestamp, 4 bytes, big endian
 	unix := binary.BigEndian.Uint32(bs[:])
-	return time.Unix(int64(unix), 0)
+	return time.Unix(int64(unix), 0), binary.BigEndian.Uint32(bs[4:]), nil
+}
+
+// maxClockSkew is how far the time of an ID may be later than the local clock.
+const maxClockSkew = 24 * time.Hour
+
+// TimeFromID returns the time of an id created by GenerateID or CreateID,
+// it returns the zero time if the id is invalid.
+//
+// Both forms are 16 hex characters. The high 32 bits of a legacy id are
+// the seconds since 1970, read as an ID its time is decades later than
+// now, so an id is a legacy id if it isn't a valid ID or its time is in
+// the future.
+func TimeFromID(id string) time.Time {
+	if v, err := ParseID(id); err == nil {
+		if t := v.Time(); !t.After(time.Now().Add(maxClockSkew)) {
+			return t
+		}
+	}
+	t, _, err := ParseLegacyID(id)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
 }
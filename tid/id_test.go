@@ -0,0 +1,173 @@
+package tid
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGeneratorMonotonic(t *testing.T) {
+	g, err := NewGenerator(Options{Node: 5, NodeBits: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last ID
+	var strs []string
+	for i := 0; i < 100000; i++ {
+		id := g.Next()
+		if id <= last {
+			t.Fatal("id isn't monotonic -", last, id)
+		}
+		last = id
+		if i%1000 == 0 {
+			strs = append(strs, id.String())
+		}
+	}
+	if !sort.StringsAreSorted(strs) {
+		t.Error("strings aren't sorted")
+	}
+
+	// 时钟回拨时不能生成更小的 id
+	g.last += 10000
+	if id := g.Next(); id <= last {
+		t.Error("id isn't monotonic after clock goes back -", last, id)
+	}
+
+	tm, node, _ := g.Decompose(last)
+	if node != 5 {
+		t.Error("node is", node)
+	}
+	if d := time.Since(tm); d < 0 || d > time.Minute {
+		t.Error("time is", tm)
+	}
+}
+
+func TestGeneratorNodes(t *testing.T) {
+	g1, _ := NewGenerator(Options{Node: 1})
+	g2, _ := NewGenerator(Options{Node: 2})
+
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	seen := map[ID]bool{}
+	for _, g := range []*Generator{g1, g2, g1, g2} {
+		wait.Add(1)
+		go func(g *Generator) {
+			defer wait.Done()
+			ids := make([]ID, 0, 10000)
+			for i := 0; i < 10000; i++ {
+				ids = append(ids, g.Next())
+			}
+			lock.Lock()
+			for _, id := range ids {
+				if seen[id] {
+					t.Error("duplicated id -", id)
+				}
+				seen[id] = true
+			}
+			lock.Unlock()
+		}(g)
+	}
+	wait.Wait()
+
+	for _, opts := range []Options{{Node: -1}, {Node: 1024}, {Node: 16, NodeBits: 4}, {NodeBits: MAX_NODE_BITS + 1}} {
+		if _, err := NewGenerator(opts); err == nil {
+			t.Error("excepted error for", opts)
+		}
+	}
+}
+
+func TestParseID(t *testing.T) {
+	id := New()
+	parsed, err := ParseID(id.String())
+	if err != nil || parsed != id {
+		t.Error("parse", id, "is", parsed, err)
+	}
+	if len(GenerateID()) != ID_STRING_LENGTH {
+		t.Error("GenerateID is", GenerateID())
+	}
+
+	for _, s := range []string{"", "abc", "zzzzzzzzzzzzzzzz", "8000000000000000", "00000000000000001"} {
+		if _, err := ParseID(s); err != ErrInvalidID {
+			t.Error(s, "error is", err)
+		}
+	}
+
+	if !TimeFromID("not_hex").IsZero() {
+		t.Error("TimeFromID isn't zero")
+	}
+	now := time.Unix(time.Now().Unix(), 0)
+	tm, count, err := ParseLegacyID(CreateID(now, 12))
+	if err != nil || !tm.Equal(now) || count != 12 {
+		t.Error(tm, count, err)
+	}
+
+	if tm := TimeFromID(GenerateID()); tm.Before(now) || tm.After(time.Now()) {
+		t.Error("TimeFromID of a new id is", tm)
+	}
+	for _, tm := range []time.Time{now, time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)} {
+		if actual := TimeFromID(CreateID(tm, 12)); !actual.Equal(tm) {
+			t.Error("TimeFromID of a legacy id is", actual, ", excepted is", tm)
+		}
+	}
+}
+
+func TestIDJSONAndSQL(t *testing.T) {
+	var v struct {
+		ID  ID  `json:"id"`
+		Ptr *ID `json:"ptr"`
+	}
+	id := New()
+	v.ID = id
+	bs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(bs); s != `{"id":"`+id.String()+`","ptr":null}` {
+		t.Error(s)
+	}
+
+	v.ID = 0
+	if err := json.Unmarshal(bs, &v); err != nil || v.ID != id {
+		t.Error(v.ID, err)
+	}
+	if err := json.Unmarshal([]byte(`{"id":12}`), &v); err != nil || v.ID != 12 {
+		t.Error(v.ID, err)
+	}
+	if err := json.Unmarshal([]byte(`{"id":"abc"}`), &v); err == nil {
+		t.Error("excepted error")
+	}
+
+	value, err := id.Value()
+	if err != nil || value.(int64) != int64(id) {
+		t.Error(value, err)
+	}
+	for _, src := range []interface{}{int64(id), id.String(), []byte(id.String())} {
+		var scanned ID
+		if err := scanned.Scan(src); err != nil || scanned != id {
+			t.Error(src, scanned, err)
+		}
+	}
+	for _, src := range []interface{}{"1234567890123456", []byte("1234567890123456")} {
+		var scanned ID
+		if err := scanned.Scan(src); err != nil || scanned != 1234567890123456 {
+			t.Error(src, scanned, err)
+		}
+	}
+	var scanned ID = 1
+	if err := scanned.Scan(nil); err != nil || scanned != 0 {
+		t.Error(scanned, err)
+	}
+	if err := scanned.Scan(1.2); err == nil {
+		t.Error("excepted error")
+	}
+}
+
+func TestObjectID(t *testing.T) {
+	a, b := ObjectID(), ObjectID()
+	if len(a) != 24 || a == b {
+		t.Error(a, b)
+	}
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TRACE_PARENT_HEADER 是 W3C Trace Context 的头，MemoryTracer 和 OpenTelemetry 缺省都用它传递上下文
+const TRACE_PARENT_HEADER = "traceparent"
+
+// MemorySpanContext 是 MemoryTracer 的跟踪上下文
+type MemorySpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// MemorySpan 是 MemoryTracer 记录的 span
+type MemorySpan struct {
+	tracer *MemoryTracer
+
+	TraceID       string
+	SpanID        string
+	ParentID      string
+	Reference     int
+	OperationName string
+	Kind          string
+	StartTime     time.Time
+	FinishTime    time.Time
+
+	lock sync.Mutex
+	tags map[string]interface{}
+	err  error
+}
+
+func (span *MemorySpan) Context() SpanContext {
+	return MemorySpanContext{TraceID: span.TraceID, SpanID: span.SpanID}
+}
+
+func (span *MemorySpan) SetTag(key string, value interface{}) {
+	span.lock.Lock()
+	span.tags[key] = value
+	span.lock.Unlock()
+}
+
+func (span *MemorySpan) SetError(err error) {
+	span.lock.Lock()
+	span.err = err
+	span.lock.Unlock()
+}
+
+// Tags 返回 span 的标签
+func (span *MemorySpan) Tags() map[string]interface{} {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	tags := make(map[string]interface{}, len(span.tags))
+	for k, v := range span.tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// Err 返回 SetError 设置的错误
+func (span *MemorySpan) Err() error {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	return span.err
+}
+
+func (span *MemorySpan) Finish() {
+	span.lock.Lock()
+	if !span.FinishTime.IsZero() {
+		span.lock.Unlock()
+		return
+	}
+	span.FinishTime = time.Now()
+	span.lock.Unlock()
+
+	span.tracer.lock.Lock()
+	span.tracer.spans = append(span.tracer.spans, span)
+	span.tracer.lock.Unlock()
+}
+
+// MemoryTracer 将结束了的 span 记录在内存中，用于测试，它用 W3C Trace Context 的格式传递上下文
+type MemoryTracer struct {
+	lock  sync.Mutex
+	spans []*MemorySpan
+}
+
+// NewMemoryTracer 创建一个 MemoryTracer
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+func randomID(n int) string {
+	bs := make([]byte, n)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bs)
+}
+
+func (t *MemoryTracer) StartSpan(operationName string, opts ...StartOption) Span {
+	options := ApplyOptions(opts)
+	span := &MemorySpan{
+		tracer:        t,
+		SpanID:        randomID(8),
+		Reference:     options.Reference,
+		OperationName: operationName,
+		Kind:          options.Kind,
+		StartTime:     time.Now(),
+		tags:          map[string]interface{}{},
+	}
+	if parent, ok := options.Parent.(MemorySpanContext); ok {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = randomID(16)
+	}
+	for k, v := range options.Tags {
+		span.tags[k] = v
+	}
+	return span
+}
+
+func (t *MemoryTracer) Inject(sc SpanContext, carrier Carrier) error {
+	msc, ok := sc.(MemorySpanContext)
+	if !ok {
+		return ErrSpanContextNotFound
+	}
+	carrier.Set(TRACE_PARENT_HEADER, "00-"+msc.TraceID+"-"+msc.SpanID+"-01")
+	return nil
+}
+
+func (t *MemoryTracer) Extract(carrier Carrier) (SpanContext, error) {
+	ss := strings.Split(carrier.Get(TRACE_PARENT_HEADER), "-")
+	if len(ss) != 4 || len(ss[1]) != 32 || len(ss[2]) != 16 {
+		return nil, ErrSpanContextNotFound
+	}
+	return MemorySpanContext{TraceID: ss[1], SpanID: ss[2]}, nil
+}
+
+// FinishedSpans 返回按结束时间排序的所有已结束的 span
+func (t *MemoryTracer) FinishedSpans() []*MemorySpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*MemorySpan(nil), t.spans...)
+}
+
+// FindSpan 返回第一个名为 operationName 的已结束的 span，没有时返回 nil
+func (t *MemoryTracer) FindSpan(operationName string) *MemorySpan {
+	for _, span := range t.FinishedSpans() {
+		if span.OperationName == operationName {
+			return span
+		}
+	}
+	return nil
+}
+
+// Reset 清除所有记录的 span
+func (t *MemoryTracer) Reset() {
+	t.lock.Lock()
+	t.spans = nil
+	t.lock.Unlock()
+}
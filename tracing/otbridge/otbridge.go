@@ -0,0 +1,106 @@
+// Package otbridge 将 opentracing 的 Tracer 桥接为 tracing.Tracer，它和 opentracing/echo
+// 一样用 opentracing.HTTPHeaders 格式传递上下文
+package otbridge
+
+import (
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/three-plus-three/modules/tracing"
+)
+
+// New 创建一个桥接 tracer 的 tracing.Tracer，tracer 为 nil 时使用 opentracing.GlobalTracer()
+func New(tracer opentracing.Tracer) tracing.Tracer {
+	return &otTracer{tracer: tracer}
+}
+
+type otTracer struct {
+	tracer opentracing.Tracer
+}
+
+func (t *otTracer) get() opentracing.Tracer {
+	if t.tracer == nil {
+		return opentracing.GlobalTracer()
+	}
+	return t.tracer
+}
+
+func (t *otTracer) StartSpan(operationName string, opts ...tracing.StartOption) tracing.Span {
+	options := tracing.ApplyOptions(opts)
+
+	var otOpts []opentracing.StartSpanOption
+	if parent, ok := options.Parent.(opentracing.SpanContext); ok {
+		if options.Reference == tracing.REFERENCE_FOLLOWS_FROM {
+			otOpts = append(otOpts, opentracing.FollowsFrom(parent))
+		} else {
+			otOpts = append(otOpts, opentracing.ChildOf(parent))
+		}
+	}
+	if len(options.Tags) > 0 {
+		otOpts = append(otOpts, opentracing.Tags(options.Tags))
+	}
+	span := t.get().StartSpan(operationName, otOpts...)
+	if options.Kind != "" {
+		ext.SpanKind.Set(span, ext.SpanKindEnum(options.Kind))
+	}
+	return &otSpan{span: span}
+}
+
+func (t *otTracer) Inject(sc tracing.SpanContext, carrier tracing.Carrier) error {
+	otsc, ok := sc.(opentracing.SpanContext)
+	if !ok {
+		return tracing.ErrSpanContextNotFound
+	}
+	return t.get().Inject(otsc, opentracing.HTTPHeaders, textMapCarrier{carrier})
+}
+
+func (t *otTracer) Extract(carrier tracing.Carrier) (tracing.SpanContext, error) {
+	sc, err := t.get().Extract(opentracing.HTTPHeaders, textMapCarrier{carrier})
+	if err != nil {
+		if err == opentracing.ErrSpanContextNotFound {
+			return nil, tracing.ErrSpanContextNotFound
+		}
+		return nil, err
+	}
+	return sc, nil
+}
+
+// WrapSpan 将 opentracing 的 span 包装为 tracing.Span，以便将它放在 context 中
+func WrapSpan(span opentracing.Span) tracing.Span {
+	return &otSpan{span: span}
+}
+
+// Unwrap 返回 tracing.Span 中的 opentracing 的 span，span 不是由本包创建时返回 nil
+func Unwrap(span tracing.Span) opentracing.Span {
+	if s, ok := span.(*otSpan); ok {
+		return s.span
+	}
+	return nil
+}
+
+type otSpan struct {
+	span opentracing.Span
+}
+
+func (s *otSpan) Context() tracing.SpanContext         { return s.span.Context() }
+func (s *otSpan) SetTag(key string, value interface{}) { s.span.SetTag(key, value) }
+func (s *otSpan) Finish()                              { s.span.Finish() }
+func (s *otSpan) SetError(err error) {
+	ext.Error.Set(s.span, true)
+	s.span.SetTag("error.message", err.Error())
+}
+
+// textMapCarrier 将 tracing.Carrier 适配为 opentracing.TextMapWriter 和 opentracing.TextMapReader
+type textMapCarrier struct {
+	carrier tracing.Carrier
+}
+
+func (c textMapCarrier) Set(key, val string) { c.carrier.Set(key, val) }
+
+func (c textMapCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, key := range c.carrier.Keys() {
+		if err := handler(key, c.carrier.Get(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package otelbridge 将 OpenTelemetry 的 Tracer 桥接为 tracing.Tracer，
+// 缺省用 otel.GetTextMapPropagator() 在 HTTP 请求和 hub 消息中传递上下文
+package otelbridge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/three-plus-three/modules/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New 创建一个桥接 tracer 的 tracing.Tracer，propagator 为 nil 时使用 otel.GetTextMapPropagator()，
+// 通常它是 W3C Trace Context，和 tracing.MemoryTracer 的格式相同
+func New(tracer trace.Tracer, propagator propagation.TextMapPropagator) tracing.Tracer {
+	return &otelTracer{tracer: tracer, propagator: propagator}
+}
+
+type otelTracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func (t *otelTracer) getPropagator() propagation.TextMapPropagator {
+	if t.propagator == nil {
+		return otel.GetTextMapPropagator()
+	}
+	return t.propagator
+}
+
+var spanKinds = map[string]trace.SpanKind{
+	tracing.SPAN_KIND_SERVER:   trace.SpanKindServer,
+	tracing.SPAN_KIND_CLIENT:   trace.SpanKindClient,
+	tracing.SPAN_KIND_PRODUCER: trace.SpanKindProducer,
+	tracing.SPAN_KIND_CONSUMER: trace.SpanKindConsumer,
+}
+
+func toAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+func (t *otelTracer) StartSpan(operationName string, opts ...tracing.StartOption) tracing.Span {
+	options := tracing.ApplyOptions(opts)
+
+	ctx := context.Background()
+	var otelOpts []trace.SpanStartOption
+	if parent, ok := options.Parent.(trace.SpanContext); ok && parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+		if options.Reference == tracing.REFERENCE_FOLLOWS_FROM {
+			otelOpts = append(otelOpts, trace.WithLinks(trace.Link{SpanContext: parent}))
+		}
+	}
+	if kind, ok := spanKinds[options.Kind]; ok {
+		otelOpts = append(otelOpts, trace.WithSpanKind(kind))
+	}
+	if len(options.Tags) > 0 {
+		attrs := make([]attribute.KeyValue, 0, len(options.Tags))
+		for k, v := range options.Tags {
+			attrs = append(attrs, toAttribute(k, v))
+		}
+		otelOpts = append(otelOpts, trace.WithAttributes(attrs...))
+	}
+	_, span := t.tracer.Start(ctx, operationName, otelOpts...)
+	return &otelSpan{span: span}
+}
+
+func (t *otelTracer) Inject(sc tracing.SpanContext, carrier tracing.Carrier) error {
+	otelsc, ok := sc.(trace.SpanContext)
+	if !ok || !otelsc.IsValid() {
+		return tracing.ErrSpanContextNotFound
+	}
+	t.getPropagator().Inject(trace.ContextWithSpanContext(context.Background(), otelsc), carrier)
+	return nil
+}
+
+func (t *otelTracer) Extract(carrier tracing.Carrier) (tracing.SpanContext, error) {
+	ctx := t.getPropagator().Extract(context.Background(), carrier)
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil, tracing.ErrSpanContextNotFound
+	}
+	return sc, nil
+}
+
+// WrapSpan 将 OpenTelemetry 的 span 包装为 tracing.Span，以便将它放在 context 中
+func WrapSpan(span trace.Span) tracing.Span {
+	return &otelSpan{span: span}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) Context() tracing.SpanContext { return s.span.SpanContext() }
+func (s *otelSpan) Finish()                      { s.span.End() }
+func (s *otelSpan) SetTag(key string, value interface{}) {
+	s.span.SetAttributes(toAttribute(key, value))
+}
+func (s *otelSpan) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
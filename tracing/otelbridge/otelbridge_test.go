@@ -0,0 +1,52 @@
+package otelbridge
+
+import (
+	"testing"
+
+	"github.com/three-plus-three/modules/tracing"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBridge(t *testing.T) {
+	memTracer := tracing.NewMemoryTracer()
+	root := memTracer.StartSpan("root")
+	carrier := tracing.MapCarrier{}
+	if err := memTracer.Inject(root.Context(), carrier); err != nil {
+		t.Fatal(err)
+	}
+
+	// MemoryTracer 和 OpenTelemetry 都用 W3C Trace Context 格式，可以互相传递上下文
+	tracer := New(trace.NewNoopTracerProvider().Tracer("test"), propagation.TraceContext{})
+	sc, err := tracer.Extract(carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := root.Context().(tracing.MemorySpanContext)
+	if actual := sc.(trace.SpanContext); actual.TraceID().String() != parent.TraceID ||
+		actual.SpanID().String() != parent.SpanID {
+		t.Error("excepted is", parent, "actual is", actual)
+	}
+
+	span := tracer.StartSpan("child", tracing.FollowsFrom(sc), tracing.WithKind(tracing.SPAN_KIND_CONSUMER),
+		tracing.WithTag("a", 1))
+	defer span.Finish()
+	if actual := span.Context().(trace.SpanContext); actual.TraceID().String() != parent.TraceID {
+		t.Error("trace id is", actual.TraceID())
+	}
+
+	injected := tracing.MapCarrier{}
+	if err := tracer.Inject(sc, injected); err != nil {
+		t.Fatal(err)
+	}
+	if injected[tracing.TRACE_PARENT_HEADER] != carrier[tracing.TRACE_PARENT_HEADER] {
+		t.Error("excepted is", carrier, "actual is", injected)
+	}
+
+	if _, err := tracer.Extract(tracing.MapCarrier{}); err != tracing.ErrSpanContextNotFound {
+		t.Error("excepted is ErrSpanContextNotFound, actual is", err)
+	}
+	if err := tracer.Inject(parent, injected); err != tracing.ErrSpanContextNotFound {
+		t.Error("excepted is ErrSpanContextNotFound, actual is", err)
+	}
+}
@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Carrier 跟踪上下文的载体，如 HTTP 头和 hub 消息头
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+	Keys() []string
+}
+
+// HeaderCarrier 以 HTTP 头为载体
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string { return http.Header(c).Get(key) }
+func (c HeaderCarrier) Set(key, value string) { http.Header(c).Set(key, value) }
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// MapCarrier 以 map 为载体
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string { return c[key] }
+func (c MapCarrier) Set(key, value string) { c[key] = value }
+func (c MapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Transport 在请求的 context 中有 span 时，为请求创建一个 client span 并将它注入到请求头中
+type Transport struct {
+	// Base 为 nil 时使用 http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// WrapClient 返回一个会注入跟踪上下文的 http.Client，client 为 nil 时以 http.DefaultClient 为模板
+func WrapClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, ok := client.Transport.(*Transport); ok {
+		return client
+	}
+	c := *client
+	c.Transport = &Transport{Base: client.Transport}
+	return &c
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	parent := SpanFromContext(req.Context())
+	if parent == nil {
+		return base.RoundTrip(req)
+	}
+
+	span := GlobalTracer().StartSpan("HTTP "+req.Method,
+		ChildOf(parent.Context()),
+		WithKind(SPAN_KIND_CLIENT),
+		WithTag("http.method", req.Method),
+		WithTag("http.url", req.URL.String()))
+	defer span.Finish()
+
+	// RoundTripper 不能修改原来的请求
+	req = req.Clone(req.Context())
+	GlobalTracer().Inject(span.Context(), HeaderCarrier(req.Header))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetTag("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(&httpError{code: resp.StatusCode})
+	}
+	return resp, nil
+}
+
+type httpError struct {
+	code int
+}
+
+func (e *httpError) Error() string {
+	return strconv.Itoa(e.code) + " " + http.StatusText(e.code)
+}
+
+// StartServerSpan 从请求头中提取跟踪的上下文并创建一个 server span，返回的 context 中包含这个 span
+func StartServerSpan(r *http.Request, operationName string) (Span, context.Context) {
+	opts := []StartOption{
+		WithKind(SPAN_KIND_SERVER),
+		WithTag("http.method", r.Method),
+		WithTag("http.url", r.URL.String()),
+	}
+	if sc, err := GlobalTracer().Extract(HeaderCarrier(r.Header)); err == nil {
+		opts = append(opts, ChildOf(sc))
+	}
+	span := GlobalTracer().StartSpan(operationName, opts...)
+	return span, ContextWithSpan(r.Context(), span)
+}
+
+// Handler 为每个请求创建一个 server span，operationName 为空时使用 "HTTP " + 方法名
+func Handler(operationName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := operationName
+		if name == "" {
+			name = "HTTP " + r.Method
+		}
+		span, ctx := StartServerSpan(r, name)
+		defer span.Finish()
+
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetTag("http.status_code", sw.code)
+		if sw.code >= http.StatusInternalServerError {
+			span.SetError(&httpError{code: sw.code})
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,205 @@
+// Package tracing 是调用链跟踪的抽象，它在 HTTP 请求和 hub 消息中传递跟踪的上下文，
+// 具体的实现有内存中的 MemoryTracer，以及 otbridge 和 otelbridge 中对 opentracing
+// 和 OpenTelemetry 的桥接
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrSpanContextNotFound 载体中没有跟踪的上下文
+var ErrSpanContextNotFound = errors.New("span context is not found.")
+
+const (
+	SPAN_KIND_SERVER   = "server"
+	SPAN_KIND_CLIENT   = "client"
+	SPAN_KIND_PRODUCER = "producer"
+	SPAN_KIND_CONSUMER = "consumer"
+)
+
+const (
+	// REFERENCE_CHILD_OF 父 span 依赖子 span 的结果
+	REFERENCE_CHILD_OF = iota
+	// REFERENCE_FOLLOWS_FROM 子 span 只是由父 span 引起的，例如消息的消费
+	REFERENCE_FOLLOWS_FROM
+)
+
+// SpanContext 跟踪的上下文，它的类型由 Tracer 的实现决定
+type SpanContext interface{}
+
+// Span 调用链中的一个操作
+type Span interface {
+	Context() SpanContext
+	SetTag(key string, value interface{})
+	SetError(err error)
+	Finish()
+}
+
+// Tracer 创建 span，并在载体中注入和提取跟踪的上下文
+type Tracer interface {
+	StartSpan(operationName string, opts ...StartOption) Span
+	Inject(sc SpanContext, carrier Carrier) error
+	Extract(carrier Carrier) (SpanContext, error)
+}
+
+// StartOptions 创建 span 的选项
+type StartOptions struct {
+	Parent    SpanContext
+	Reference int
+	Kind      string
+	Tags      map[string]interface{}
+}
+
+// StartOption 设置创建 span 的选项
+type StartOption func(*StartOptions)
+
+// ChildOf 指定父 span
+func ChildOf(sc SpanContext) StartOption {
+	return func(opts *StartOptions) {
+		opts.Parent = sc
+		opts.Reference = REFERENCE_CHILD_OF
+	}
+}
+
+// FollowsFrom 指定引起本 span 的 span
+func FollowsFrom(sc SpanContext) StartOption {
+	return func(opts *StartOptions) {
+		opts.Parent = sc
+		opts.Reference = REFERENCE_FOLLOWS_FROM
+	}
+}
+
+// WithKind 指定 span 的类型，如 SPAN_KIND_SERVER
+func WithKind(kind string) StartOption {
+	return func(opts *StartOptions) {
+		opts.Kind = kind
+	}
+}
+
+// WithTag 为 span 添加一个标签
+func WithTag(key string, value interface{}) StartOption {
+	return func(opts *StartOptions) {
+		if opts.Tags == nil {
+			opts.Tags = map[string]interface{}{}
+		}
+		opts.Tags[key] = value
+	}
+}
+
+// ApplyOptions 合并选项，供 Tracer 的实现使用
+func ApplyOptions(opts []StartOption) StartOptions {
+	var options StartOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+type tracerHolder struct {
+	tracer Tracer
+}
+
+var globalTracer atomic.Value
+
+func init() {
+	globalTracer.Store(tracerHolder{tracer: noopTracer{}})
+}
+
+// SetGlobalTracer 设置全局的 Tracer，为 nil 时不跟踪
+func SetGlobalTracer(tracer Tracer) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	globalTracer.Store(tracerHolder{tracer: tracer})
+}
+
+// GlobalTracer 返回全局的 Tracer
+func GlobalTracer() Tracer {
+	return globalTracer.Load().(tracerHolder).tracer
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 返回一个包含 span 的 context
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 返回 ctx 中的 span，没有时返回 nil
+func SpanFromContext(ctx context.Context) Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
+
+// StartSpanFromContext 用全局的 Tracer 创建一个 span，没有指定父 span 时以 ctx 中的 span 为父 span，
+// 返回的 context 中包含新的 span
+func StartSpanFromContext(ctx context.Context, operationName string, opts ...StartOption) (Span, context.Context) {
+	if parent := SpanFromContext(ctx); parent != nil {
+		opts = append([]StartOption{ChildOf(parent.Context())}, opts...)
+	}
+	span := GlobalTracer().StartSpan(operationName, opts...)
+	return span, ContextWithSpan(ctx, span)
+}
+
+// Inject 将 ctx 中的 span 的上下文注入到载体中，ctx 中没有 span 时返回 false
+func Inject(ctx context.Context, carrier Carrier) bool {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return false
+	}
+	return GlobalTracer().Inject(span.Context(), carrier) == nil
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(operationName string, opts ...StartOption) Span { return noopSpan{} }
+func (noopTracer) Inject(sc SpanContext, carrier Carrier) error             { return nil }
+func (noopTracer) Extract(carrier Carrier) (SpanContext, error) {
+	return nil, ErrSpanContextNotFound
+}
+
+type noopSpan struct{}
+
+func (noopSpan) Context() SpanContext                 { return nil }
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) SetError(err error)                   {}
+func (noopSpan) Finish()                              {}
+
+// JAEGER_TRACE_HEADER 是 jaeger 传递跟踪上下文的头，格式为 {trace-id}:{span-id}:{parent-span-id}:{flags}
+const JAEGER_TRACE_HEADER = "uber-trace-id"
+
+// TraceIDFromContext 返回 ctx 中的 span 的 trace ID，用于在日志中关联调用链，
+// 它将上下文注入到载体中再读取，所以只支持 W3C Trace Context 和 jaeger 的格式，不支持时返回空字符串
+func TraceIDFromContext(ctx context.Context) string {
+	carrier := MapCarrier{}
+	if !Inject(ctx, carrier) {
+		return ""
+	}
+	for key, value := range carrier {
+		switch strings.ToLower(key) {
+		case TRACE_PARENT_HEADER:
+			if ss := strings.Split(value, "-"); len(ss) == 4 {
+				return ss[1]
+			}
+		case JAEGER_TRACE_HEADER:
+			// jaeger 在 HTTP 头中会对值做 url 编码
+			if unescaped, err := url.QueryUnescape(value); err == nil {
+				value = unescaped
+			}
+			if ss := strings.Split(value, ":"); len(ss) == 4 {
+				return ss[0]
+			}
+		}
+	}
+	return ""
+}
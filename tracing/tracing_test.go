@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMemoryTracer(t *testing.T) {
+	tracer := NewMemoryTracer()
+
+	root := tracer.StartSpan("root", WithTag("a", 1))
+	child := tracer.StartSpan("child", ChildOf(root.Context()), WithKind(SPAN_KIND_CLIENT))
+	child.SetError(errors.New("abc"))
+	child.Finish()
+	child.Finish()
+
+	carrier := MapCarrier{}
+	if err := tracer.Inject(root.Context(), carrier); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := tracer.Extract(carrier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc != root.Context() {
+		t.Error("excepted is", root.Context(), "actual is", sc)
+	}
+	if _, err := tracer.Extract(MapCarrier{TRACE_PARENT_HEADER: "00-abc-01"}); err != ErrSpanContextNotFound {
+		t.Error("excepted is ErrSpanContextNotFound, actual is", err)
+	}
+	root.Finish()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatal("spans is", len(spans))
+	}
+	if spans[0].OperationName != "child" || spans[1].OperationName != "root" {
+		t.Error("spans is", spans[0].OperationName, spans[1].OperationName)
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentID != spans[1].SpanID || spans[1].ParentID != "" {
+		t.Error("child isn't linked to root")
+	}
+	if spans[0].Kind != SPAN_KIND_CLIENT || spans[0].Err() == nil {
+		t.Error("child is", spans[0].Kind, spans[0].Err())
+	}
+	if spans[1].Tags()["a"] != 1 {
+		t.Error("tags is", spans[1].Tags())
+	}
+
+	tracer.Reset()
+	if len(tracer.FinishedSpans()) != 0 {
+		t.Error("spans isn't reset")
+	}
+}
+
+func TestHTTPPropagation(t *testing.T) {
+	tracer := NewMemoryTracer()
+	SetGlobalTracer(tracer)
+	defer SetGlobalTracer(nil)
+
+	var serverParent string
+	srv := httptest.NewServer(Handler("server", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverParent = r.Header.Get(TRACE_PARENT_HEADER)
+		if SpanFromContext(r.Context()) == nil {
+			t.Error("span isn't in the context")
+		}
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Write([]byte("ok"))
+	})))
+	defer srv.Close()
+
+	client := WrapClient(nil)
+	if WrapClient(client) != client {
+		t.Error("client is wrapped twice")
+	}
+	get := func(ctx context.Context, u string) {
+		req, _ := http.NewRequest("GET", u, nil)
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if req.Header.Get(TRACE_PARENT_HEADER) != "" {
+			t.Error("request of caller is modified")
+		}
+	}
+
+	// 没有 span 时不注入
+	get(context.Background(), srv.URL)
+	if serverParent != "" {
+		t.Error("traceparent is", serverParent)
+	}
+	if span := tracer.FindSpan("server"); span == nil || span.ParentID != "" {
+		t.Error("server span is", span)
+	}
+	tracer.Reset()
+
+	root, ctx := StartSpanFromContext(context.Background(), "root")
+	get(ctx, srv.URL+"/error")
+	root.Finish()
+
+	rootSpan := tracer.FindSpan("root")
+	clientSpan := tracer.FindSpan("HTTP GET")
+	serverSpan := tracer.FindSpan("server")
+	if rootSpan == nil || clientSpan == nil || serverSpan == nil {
+		t.Fatal("spans is", tracer.FinishedSpans())
+	}
+	if clientSpan.ParentID != rootSpan.SpanID || serverSpan.ParentID != clientSpan.SpanID ||
+		serverSpan.TraceID != rootSpan.TraceID {
+		t.Error("spans isn't linked")
+	}
+	if serverParent != "00-"+clientSpan.TraceID+"-"+clientSpan.SpanID+"-01" {
+		t.Error("traceparent is", serverParent)
+	}
+	if clientSpan.Tags()["http.status_code"] != 500 || clientSpan.Err() == nil {
+		t.Error("client span is", clientSpan.Tags(), clientSpan.Err())
+	}
+	if serverSpan.Kind != SPAN_KIND_SERVER || serverSpan.Tags()["http.status_code"] != 500 || serverSpan.Err() == nil {
+		t.Error("server span is", serverSpan.Kind, serverSpan.Tags(), serverSpan.Err())
+	}
+}
+
+type jaegerTracer struct{ noopTracer }
+
+func (jaegerTracer) StartSpan(operationName string, opts ...StartOption) Span { return jaegerSpan{} }
+func (jaegerTracer) Inject(sc SpanContext, carrier Carrier) error {
+	carrier.Set("Uber-Trace-Id", "abc%3A123%3A0%3A1")
+	return nil
+}
+
+type jaegerSpan struct{ noopSpan }
+
+func TestTraceIDFromContext(t *testing.T) {
+	if id := TraceIDFromContext(context.Background()); id != "" {
+		t.Error("trace id is", id)
+	}
+
+	tracer := NewMemoryTracer()
+	SetGlobalTracer(tracer)
+	defer SetGlobalTracer(nil)
+
+	span, ctx := StartSpanFromContext(context.Background(), "root")
+	span.Finish()
+	if id := TraceIDFromContext(ctx); id == "" || id != tracer.FindSpan("root").TraceID {
+		t.Error("trace id is", id)
+	}
+
+	SetGlobalTracer(jaegerTracer{})
+	_, ctx = StartSpanFromContext(context.Background(), "root")
+	if id := TraceIDFromContext(ctx); id != "abc" {
+		t.Error("trace id is", id)
+	}
+}
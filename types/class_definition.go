@@ -2,6 +2,8 @@ package types
 
 import (
 	"bytes"
+
+	"github.com/three-plus-three/modules/errors"
 )
 
 type Annotation struct {
@@ -102,6 +104,7 @@ type ClassDefinition struct {
 	CollectionName string
 	IsAbstractly   bool
 	Keys           []KeyDefinition
+	Restrictions   []ClassValidator
 	OwnFields      map[string]*PropertyDefinition
 	Fields         map[string]*PropertyDefinition
 
@@ -160,6 +163,34 @@ func (self *ClassDefinition) GetOwnProperty(nm string) *PropertyDefinition {
 	return column
 }
 
+// GetPropertyByColumn 返回数据库中的列对应的属性，没有时返回 nil
+func (self *ClassDefinition) GetPropertyByColumn(column string) *PropertyDefinition {
+	if p := self.Fields[column]; p != nil {
+		return p
+	}
+	for _, p := range self.Fields {
+		if Underscore(p.Name) == column {
+			return p
+		}
+	}
+	return nil
+}
+
+// ConvertDBError 将违反唯一、外键或非空约束等数据库错误转换成 ApplicationError，出错的列会转换成
+// 对应属性名的字段错误，以便表单标出出错的字段，err 不是可识别的数据库错误时原样返回
+func (self *ClassDefinition) ConvertDBError(err error) error {
+	de := errors.ClassifyDBError(err)
+	if de == nil {
+		return err
+	}
+	return de.ToApplicationError(func(column string) string {
+		if p := self.GetPropertyByColumn(column); p != nil {
+			return p.Name
+		}
+		return ""
+	})
+}
+
 func (self *ClassDefinition) IsInheritanced() bool {
 	return (nil != self.Super) || (nil != self.Sons && 0 != len(self.Sons))
 }
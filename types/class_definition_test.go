@@ -0,0 +1,37 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/three-plus-three/modules/errors"
+)
+
+func TestConvertDBError(t *testing.T) {
+	cls := &ClassDefinition{Name: "User", UnderscoreName: "user",
+		Fields: map[string]*PropertyDefinition{
+			"name":    {Name: "name"},
+			"groupID": {Name: "groupID"},
+		}}
+
+	if p := cls.GetPropertyByColumn("group_id"); p == nil || p.Name != "groupID" {
+		t.Error("property is", p)
+	}
+
+	err := cls.ConvertDBError(errors.New("UNIQUE constraint failed: users.name, users.group_id, users.email"))
+	ae, ok := err.(*errors.ApplicationError)
+	if !ok {
+		t.Fatal("error is", err)
+	}
+	if ae.ErrorCode() != errors.ERR_CODE_UNIQUE_VIOLATION {
+		t.Error("code is", ae.ErrorCode())
+	}
+	if !reflect.DeepEqual(ae.Fields, map[string][]string{"name": {"already exists"}, "groupID": {"already exists"}}) {
+		t.Error("fields is", ae.Fields)
+	}
+
+	e := errors.New("abc")
+	if cls.ConvertDBError(e) != e {
+		t.Error("error is converted")
+	}
+}
@@ -433,6 +433,7 @@ func LoadClassDefinitionsWithOld(fileName, namespace string, self *ClassDefiniti
 		if 0 == len(msgs) {
 			errs = mergeErrors(errs, "load class '"+className+"' failed", msgs)
 		}
+		errs = append(errs, loadClassValidators(cls, className, xmlDefinition.Annotations)...)
 		self.Register(cls)
 	}
 
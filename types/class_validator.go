@@ -0,0 +1,313 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ClassValidatorAnnotation 在模型文件中声明类级别验证器的注解名称
+//
+// 每个注解是一条规则，在 json 或 yaml 中也可以是一个规则的数组:
+//
+//	required(priv_pass, priv_proto) when sec_level == 'authPriv'
+//	check(end_at > start_at, '结束时间必须在开始时间之后')
+//	unique(address, domain_id) when not empty(address)
+const ClassValidatorAnnotation = "validate"
+
+// ClassValidator 类级别的验证器，它可以访问整个记录
+type ClassValidator interface {
+	// Fields 验证器用到的字段，部分更新时缺少这些字段的验证器会被跳过
+	Fields() []string
+	Validate(record map[string]interface{}) ([]*FieldError, error)
+	String() string
+}
+
+// RequiredValidator 条件满足时 Names 中的字段必须有值
+type RequiredValidator struct {
+	Names []string
+	When  *Expression
+	src   string
+}
+
+func (v *RequiredValidator) Fields() []string {
+	return mergeFieldNames(v.Names, v.When)
+}
+
+func (v *RequiredValidator) Validate(record map[string]interface{}) ([]*FieldError, error) {
+	if ok, err := evalWhen(v.When, record); !ok || err != nil {
+		return nil, err
+	}
+
+	var errs []*FieldError
+	for _, name := range v.Names {
+		if isEmptyValue(record[name]) {
+			msg := "it is required"
+			if v.When != nil {
+				msg = "it is required when " + v.When.String()
+			}
+			errs = append(errs, &FieldError{Field: name, Code: FIELD_REQUIRED, Message: msg})
+		}
+	}
+	return errs, nil
+}
+
+func (v *RequiredValidator) String() string {
+	return v.src
+}
+
+// CheckValidator 条件满足时 Expr 的值必须为 true, 和 SQL 中的 CHECK 约束一样，
+// Expr 用到的字段中有空值时不检查
+type CheckValidator struct {
+	Expr    *Expression
+	When    *Expression
+	Message string
+	src     string
+}
+
+func (v *CheckValidator) Fields() []string {
+	return mergeFieldNames(v.Expr.Fields(), v.When)
+}
+
+func (v *CheckValidator) Validate(record map[string]interface{}) ([]*FieldError, error) {
+	if ok, err := evalWhen(v.When, record); !ok || err != nil {
+		return nil, err
+	}
+
+	for _, name := range v.Expr.Fields() {
+		if record[name] == nil {
+			return nil, nil
+		}
+	}
+
+	ok, err := v.Expr.EvalBool(record)
+	if err != nil {
+		return nil, errors.New("eval '" + v.Expr.String() + "' failed, " + err.Error())
+	}
+	if ok {
+		return nil, nil
+	}
+
+	msg := v.Message
+	if msg == "" {
+		msg = "'" + v.Expr.String() + "' isn't satisfied"
+	}
+	var field string
+	if fields := v.Expr.Fields(); len(fields) > 0 {
+		field = fields[0]
+	}
+	return []*FieldError{{Field: field, Code: FIELD_INVALID, Message: msg}}, nil
+}
+
+func (v *CheckValidator) String() string {
+	return v.src
+}
+
+// UniqueValidator 条件满足时 Names 中的字段组合必须唯一，它需要查询数据库，
+// 所以由 ValidateRecord 调用 UniqueChecker 来检查
+type UniqueValidator struct {
+	Names []string
+	When  *Expression
+	src   string
+}
+
+func (v *UniqueValidator) Fields() []string {
+	return mergeFieldNames(v.Names, v.When)
+}
+
+func (v *UniqueValidator) Validate(record map[string]interface{}) ([]*FieldError, error) {
+	return nil, nil
+}
+
+// IsEnabled 条件是否满足
+func (v *UniqueValidator) IsEnabled(record map[string]interface{}) (bool, error) {
+	return evalWhen(v.When, record)
+}
+
+func (v *UniqueValidator) String() string {
+	return v.src
+}
+
+func evalWhen(when *Expression, record map[string]interface{}) (bool, error) {
+	if when == nil {
+		return true, nil
+	}
+	ok, err := when.EvalBool(record)
+	if err != nil {
+		return false, errors.New("eval '" + when.String() + "' failed, " + err.Error())
+	}
+	return ok, nil
+}
+
+func mergeFieldNames(names []string, when *Expression) []string {
+	if when == nil {
+		return names
+	}
+	res := append([]string{}, names...)
+	for _, name := range when.Fields() {
+		found := false
+		for _, s := range res {
+			if s == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// ParseClassValidator 解析一条类级别的验证规则
+func ParseClassValidator(s string) (ClassValidator, error) {
+	p, err := newExprParser(s)
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() || p.peek().kind != tokenIdent {
+		return nil, p.errorf("'required', 'check' or 'unique' is excepted")
+	}
+	kind := p.peek().text
+	p.idx++
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var validator ClassValidator
+	var when **Expression
+	switch kind {
+	case "required", "unique":
+		var names []string
+		for {
+			if p.eof() || p.peek().kind != tokenIdent {
+				return nil, p.errorf("field name is excepted")
+			}
+			names = append(names, p.peek().text)
+			p.idx++
+			if p.isOperator(")") {
+				p.idx++
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if kind == "required" {
+			v := &RequiredValidator{Names: names, src: strings.TrimSpace(s)}
+			validator, when = v, &v.When
+		} else {
+			v := &UniqueValidator{Names: names, src: strings.TrimSpace(s)}
+			validator, when = v, &v.When
+		}
+	case "check":
+		start := p.idx
+		root, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		v := &CheckValidator{Expr: newExpression(tokensText(p, start, p.idx), root), src: strings.TrimSpace(s)}
+		if p.isOperator(",") {
+			p.idx++
+			if p.eof() || p.peek().kind != tokenString {
+				return nil, p.errorf("message is excepted")
+			}
+			v.Message = p.peek().value.(string)
+			p.idx++
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		validator, when = v, &v.When
+	default:
+		p.idx--
+		return nil, p.errorf("'%s' is unsupported, it must is 'required', 'check' or 'unique'", kind)
+	}
+
+	if p.isKeyword("when") {
+		p.idx++
+		start := p.idx
+		root, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		*when = newExpression(tokensText(p, start, p.idx), root)
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected '%s'", p.peek().text)
+	}
+	return validator, nil
+}
+
+// tokensText 取 [start, end) 之间的 token 在原字符串中的文本
+func tokensText(p *exprParser, start, end int) string {
+	if start >= end {
+		return ""
+	}
+	last := p.tokens[end-1]
+	return p.src[p.tokens[start].pos : last.pos+len(last.text)]
+}
+
+// ParseClassValidators 解析注解中的规则，注解的内容可以是一条规则，也可以是一个规则的 json 数组
+func ParseClassValidators(text string) ([]ClassValidator, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	rules := []string{text}
+	if strings.HasPrefix(text, "[") {
+		rules = nil
+		if err := json.Unmarshal([]byte(text), &rules); err != nil {
+			return nil, errors.New("rules '" + text + "' is invalid, " + err.Error())
+		}
+	}
+
+	validators := make([]ClassValidator, 0, len(rules))
+	for _, rule := range rules {
+		validator, err := ParseClassValidator(rule)
+		if err != nil {
+			return nil, err
+		}
+		validators = append(validators, validator)
+	}
+	return validators, nil
+}
+
+// GetClassValidators 取类和它的父类上的所有类级别验证器
+func GetClassValidators(cls *ClassDefinition) []ClassValidator {
+	var validators []ClassValidator
+	for s := cls; s != nil; s = s.Super {
+		validators = append(validators, s.Restrictions...)
+	}
+	return validators
+}
+
+func checkClassValidators(cls *ClassDefinition, errList *[]string) {
+	for _, validator := range cls.Restrictions {
+		for _, name := range validator.Fields() {
+			if _, ok := cls.Fields[name]; !ok {
+				*errList = append(*errList, fmt.Sprintf("property '%s' in validator '%s' of class '%s' is not found.",
+					name, validator.String(), cls.Name))
+			}
+		}
+	}
+}
+
+// loadClassValidators 解析类定义上的 validate 注解，并加到 cls.Restrictions 中，返回错误信息
+func loadClassValidators(cls *ClassDefinition, className string, annotations []XMLAnnotation) []string {
+	var errList []string
+	for _, ann := range annotations {
+		if ann.Name != ClassValidatorAnnotation {
+			continue
+		}
+		validators, err := ParseClassValidators(annotationText(ann))
+		if err != nil {
+			errList = append(errList, "load validator of class '"+className+"' failed, "+err.Error())
+			continue
+		}
+		cls.Restrictions = append(cls.Restrictions, validators...)
+	}
+	return errList
+}
@@ -0,0 +1,260 @@
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	a "github.com/three-plus-three/modules/assert"
+)
+
+const validatorSpec = `classes:
+  - name: Snmp
+    annotations:
+      validate:
+        - required(priv_pass) when sec_level == 'authPriv'
+        - check(end_at > start_at, '结束时间必须在开始时间之后')
+        - unique(address, domain_id) when not empty(address)
+    fields:
+      - name: sec_level
+        type: string
+        restrictions:
+          enumerations: [noAuthNoPriv, authNoPriv, authPriv]
+      - name: priv_pass
+        type: password
+      - name: start_at
+        type: datetime
+      - name: end_at
+        type: datetime
+      - name: address
+        type: ipAddress
+      - name: domain_id
+        type: objectId
+`
+
+const validatorXML = `<?xml version="1.0" encoding="UTF-8"?>
+<classDefinitions xmlns="http://schemas.hengwei.com.cn/tpt/1/metricDefinitions">
+	<class name="Job">
+		<annotation name="validate">check(end_at &gt; start_at)</annotation>
+		<annotation name="validate">required(owner) when priority &gt;= 3</annotation>
+		<property name="start_at" type="datetime" />
+		<property name="end_at" type="datetime" />
+		<property name="priority" type="integer" />
+		<property name="owner" type="string" />
+	</class>
+</classDefinitions>`
+
+func loadValidatorDefinitions(t *testing.T, nm, text string) *TableDefinitions {
+	tmp, err := ioutil.TempDir("", "validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm = filepath.Join(tmp, nm)
+	if err := ioutil.WriteFile(nm, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := LoadTableDefinitions(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return definitions
+}
+
+func TestParseClassValidator(t *testing.T) {
+	v, err := ParseClassValidator(`required(priv_pass, priv_proto) when sec_level == 'authPriv'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	required := v.(*RequiredValidator)
+	a.Check(t, required.Names, a.DeepEquals, []string{"priv_pass", "priv_proto"})
+	a.Check(t, required.When.String(), a.Equals, `sec_level == 'authPriv'`)
+	a.Check(t, v.Fields(), a.DeepEquals, []string{"priv_pass", "priv_proto", "sec_level"})
+
+	v, err = ParseClassValidator(`check(len(name) > 3 && (a > b), "too short")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := v.(*CheckValidator)
+	a.Check(t, check.Expr.String(), a.Equals, `len(name) > 3 && (a > b)`)
+	a.Check(t, check.Message, a.Equals, "too short")
+	a.Check(t, check.When, a.IsNil)
+
+	for _, test := range []struct {
+		rule     string
+		excepted string
+	}{
+		{`optional(a)`, "'optional' is unsupported"},
+		{`required(a`, "',' is excepted"},
+		{`required('a')`, "field name is excepted"},
+		{`check(a > b, 1)`, "message is excepted"},
+		{`unique(a) if b`, "unexpected 'if'"},
+	} {
+		_, err := ParseClassValidator(test.rule)
+		if err == nil {
+			t.Error(test.rule, "excepted error is not nil")
+			continue
+		}
+		if !strings.Contains(err.Error(), test.excepted) {
+			t.Error(test.rule, "excepted error contains", test.excepted)
+			t.Error("actual is", err)
+		}
+	}
+}
+
+func TestClassValidators(t *testing.T) {
+	definitions := loadValidatorDefinitions(t, "snmp.yaml", validatorSpec)
+	cls := definitions.Find("Snmp")
+	a.Assert(t, len(cls.Restrictions), a.Equals, 3)
+
+	_, err := ValidateRecord(cls, map[string]interface{}{
+		"sec_level": "authPriv",
+		"start_at":  "2019-10-02T00:00:00Z",
+		"end_at":    "2019-10-01T00:00:00Z",
+	}, VALIDATE_CREATE)
+	a.Assert(t, err, a.NotNil)
+	a.Check(t, err.(*RecordError).Fields(), a.DeepEquals, map[string][]string{
+		"priv_pass": {"it is required when sec_level == 'authPriv'"},
+		"end_at":    {"结束时间必须在开始时间之后"},
+	})
+
+	_, err = ValidateRecord(cls, map[string]interface{}{
+		"sec_level": "authNoPriv",
+		"start_at":  "2019-10-01T00:00:00Z",
+		"end_at":    "2019-10-02T00:00:00Z",
+	}, VALIDATE_CREATE)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 部分更新时缺少字段的规则不检查
+	_, err = ValidateRecord(cls, map[string]interface{}{
+		"end_at": "2019-10-01T00:00:00Z",
+	}, VALIDATE_PATCH)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var keys [][]string
+	checker := func(cls *ClassDefinition, key KeyDefinition, values map[string]interface{}) (bool, error) {
+		var names []string
+		for _, field := range key {
+			names = append(names, field.Name)
+		}
+		keys = append(keys, names)
+		return true, nil
+	}
+	_, err = ValidateRecord(cls, map[string]interface{}{
+		"address":   "192.168.1.1",
+		"domain_id": 1,
+	}, VALIDATE_CREATE, checker)
+	a.Assert(t, err, a.NotNil)
+	a.Check(t, keys, a.DeepEquals, [][]string{{"address", "domain_id"}})
+	a.Check(t, err.(*RecordError).Errors[0].Code, a.Equals, FIELD_UNIQUE)
+
+	keys = nil
+	_, err = ValidateRecord(cls, map[string]interface{}{
+		"domain_id": 1,
+	}, VALIDATE_CREATE, checker)
+	if err != nil {
+		t.Error(err)
+	}
+	a.Check(t, len(keys), a.Equals, 0, a.Commentf("address is empty"))
+}
+
+func TestClassValidatorsInXML(t *testing.T) {
+	definitions := loadValidatorDefinitions(t, "job.xml", validatorXML)
+	cls := definitions.Find("Job")
+	a.Assert(t, len(cls.Restrictions), a.Equals, 2)
+
+	_, err := ValidateRecord(cls, map[string]interface{}{
+		"start_at": "2019-10-02T00:00:00Z",
+		"end_at":   "2019-10-01T00:00:00Z",
+		"priority": 3,
+	}, VALIDATE_CREATE)
+	a.Assert(t, err, a.NotNil)
+	a.Check(t, err.(*RecordError).Fields(), a.DeepEquals, map[string][]string{
+		"owner":  {"it is required when priority >= 3"},
+		"end_at": {"'end_at > start_at' isn't satisfied"},
+	})
+}
+
+func TestClassValidatorsConvert(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	xmlFile := filepath.Join(tmp, "job.xml")
+	specFile := filepath.Join(tmp, "job.yaml")
+	if err := ioutil.WriteFile(xmlFile, []byte(validatorXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ConvertXMLToSpec(xmlFile, specFile); err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := LoadTableDefinitions(specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cls := definitions.Find("Job")
+	a.Assert(t, len(cls.Restrictions), a.Equals, 2)
+	a.Check(t, cls.Restrictions[0].String(), a.Equals, "check(end_at > start_at)")
+	a.Check(t, cls.Restrictions[1].String(), a.Equals, "required(owner) when priority >= 3")
+}
+
+func TestClassValidatorsFailure(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm := filepath.Join(tmp, "job.xml")
+	text := strings.Replace(validatorXML, "required(owner)", "required(manager)", -1)
+	if err := ioutil.WriteFile(nm, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadTableDefinitions(nm)
+	if err == nil {
+		t.Fatal("excepted error is not nil")
+	}
+	excepted := "property 'manager' in validator 'required(manager) when priority >= 3' of class 'Job' is not found."
+	if !strings.Contains(err.Error(), excepted) {
+		t.Error("excepted error contains", excepted)
+		t.Error("actual is", err)
+	}
+}
+
+func TestLoadClassDefinitionsValidators(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "validator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm := filepath.Join(tmp, "job.xml")
+	if err := ioutil.WriteFile(nm, []byte(validatorXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// class definitions 的加载路径也要解析 validate 注解
+	definitions, _, err := LoadClassDefinitionsFromFile(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := definitions.Find("Job")
+	a.Assert(t, job, a.NotNil)
+	a.Check(t, len(job.Restrictions), a.Equals, 2)
+
+	invalid := strings.Replace(validatorXML, "check(end_at &gt; start_at)", "check(end_at &gt;)", 1)
+	if err := ioutil.WriteFile(nm, []byte(invalid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = LoadClassDefinitionsFromFile(nm)
+	a.Check(t, err, a.ErrorMatches, "(?s).*load validator of class 'Job' failed.*")
+}
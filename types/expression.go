@@ -0,0 +1,1033 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 表达式的限制，防止在模型文件中写出过于复杂的表达式
+const (
+	maxExpressionLength = 4096
+	maxExpressionDepth  = 64
+)
+
+// Expression 一个条件表达式，它只能读取记录中的字段和调用内置的函数，
+// 不能访问其它任何东西，所以可以放心地从模型文件中加载。
+//
+// 支持的语法:
+//
+//	字面量:   123, 1.5, 'abc', "abc", true, false, null, [1, 2, 3]
+//	字段:     sec_level, end_at
+//	比较:     ==, !=, <, <=, >, >=, in, not in
+//	逻辑:     &&, ||, !, and, or, not
+//	算术:     +, -, *, /, %
+//	函数:     len(x), empty(x), lower(s), upper(s), trim(s), contains(s, sub),
+//	          startsWith(s, prefix), endsWith(s, suffix), matches(s, pattern), now()
+type Expression struct {
+	src    string
+	root   exprNode
+	fields []string
+}
+
+// ParseExpression 解析一个表达式
+func ParseExpression(s string) (*Expression, error) {
+	p, err := newExprParser(s)
+	if err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected '%s'", p.peek().text)
+	}
+	return newExpression(s, root), nil
+}
+
+func newExpression(src string, root exprNode) *Expression {
+	e := &Expression{src: strings.TrimSpace(src), root: root}
+	root.fields(func(name string) {
+		for _, field := range e.fields {
+			if field == name {
+				return
+			}
+		}
+		e.fields = append(e.fields, name)
+	})
+	return e
+}
+
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Fields 表达式中引用到的字段
+func (e *Expression) Fields() []string {
+	return e.fields
+}
+
+// Eval 计算表达式的值
+func (e *Expression) Eval(record map[string]interface{}) (interface{}, error) {
+	return e.root.eval(record)
+}
+
+// EvalBool 计算表达式的值，结果必须是一个布尔值，null 被当作 false
+func (e *Expression) EvalBool(record map[string]interface{}) (bool, error) {
+	value, err := e.root.eval(record)
+	if err != nil {
+		return false, err
+	}
+	return toExprBool(value)
+}
+
+type exprNode interface {
+	eval(record map[string]interface{}) (interface{}, error)
+	fields(cb func(string))
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(record map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *literalNode) fields(cb func(string)) {}
+
+type fieldNode struct {
+	name string
+}
+
+func (n *fieldNode) eval(record map[string]interface{}) (interface{}, error) {
+	return normalizeExprValue(record[n.name]), nil
+}
+
+func (n *fieldNode) fields(cb func(string)) {
+	cb(n.name)
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(record map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (n *listNode) fields(cb func(string)) {
+	for _, item := range n.items {
+		item.fields(cb)
+	}
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(record map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(record)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, err := toExprBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return !b, nil
+	default: // "-"
+		switch v := value.(type) {
+		case int64:
+			return -v, nil
+		case float64:
+			return -v, nil
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("'%v' is not a number", value)
+		}
+	}
+}
+
+func (n *unaryNode) fields(cb func(string)) {
+	n.operand.fields(cb)
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(record map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逻辑运算是短路的
+	switch n.op {
+	case "&&", "||":
+		lb, err := toExprBool(left)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "&&") != lb {
+			return lb, nil
+		}
+		right, err := n.right.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		return toExprBool(right)
+	}
+
+	right, err := n.right.eval(record)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEquals(left, right), nil
+	case "!=":
+		return !exprEquals(left, right), nil
+	case "<", "<=", ">", ">=":
+		if left == nil || right == nil {
+			return false, nil
+		}
+		c, err := exprCompare(left, right)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "in", "not in":
+		values, ok := right.([]interface{})
+		if !ok {
+			if right != nil {
+				return nil, fmt.Errorf("'%v' is not a list", right)
+			}
+		}
+		found := false
+		for _, value := range values {
+			if exprEquals(left, value) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in"), nil
+	default:
+		return exprArithmetic(n.op, left, right)
+	}
+}
+
+func (n *binaryNode) fields(cb func(string)) {
+	n.left.fields(cb)
+	n.right.fields(cb)
+}
+
+type callNode struct {
+	name string
+	fn   exprFunc
+	args []exprNode
+}
+
+func (n *callNode) eval(record map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(record)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	value, err := n.fn.call(args)
+	if err != nil {
+		return nil, errors.New(n.name + "() failed, " + err.Error())
+	}
+	return value, nil
+}
+
+func (n *callNode) fields(cb func(string)) {
+	for _, arg := range n.args {
+		arg.fields(cb)
+	}
+}
+
+type exprFunc struct {
+	argc int
+	call func(args []interface{}) (interface{}, error)
+}
+
+func stringFunc(fn func(s string) interface{}) exprFunc {
+	return exprFunc{argc: 1, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		return fn(exprString(args[0])), nil
+	}}
+}
+
+func stringsFunc(fn func(s, sub string) bool) exprFunc {
+	return exprFunc{argc: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		return fn(exprString(args[0]), exprString(args[1])), nil
+	}}
+}
+
+var exprFuncs = map[string]exprFunc{
+	"len": {argc: 1, call: func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return int64(0), nil
+		case string:
+			return int64(len([]rune(v))), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[string]interface{}:
+			return int64(len(v)), nil
+		default:
+			return nil, fmt.Errorf("'%v' has not length", v)
+		}
+	}},
+	"empty": {argc: 1, call: func(args []interface{}) (interface{}, error) {
+		return isEmptyValue(args[0]), nil
+	}},
+	"lower": stringFunc(func(s string) interface{} { return strings.ToLower(s) }),
+	"upper": stringFunc(func(s string) interface{} { return strings.ToUpper(s) }),
+	"trim":  stringFunc(func(s string) interface{} { return strings.TrimSpace(s) }),
+
+	"contains":   stringsFunc(strings.Contains),
+	"startsWith": stringsFunc(strings.HasPrefix),
+	"endsWith":   stringsFunc(strings.HasSuffix),
+	"matches": {argc: 2, call: func(args []interface{}) (interface{}, error) {
+		if args[0] == nil {
+			return false, nil
+		}
+		re, err := compileRegexp(exprString(args[1]), false)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(exprString(args[0])), nil
+	}},
+	"now": {argc: 0, call: func(args []interface{}) (interface{}, error) {
+		return time.Now(), nil
+	}},
+}
+
+// regexpCache 缓存表达式中作为常量出现的正则表达式，它们在解析时被编译一次
+var regexpCache sync.Map
+
+// compileRegexp 编译正则表达式，cache 为 true 时将结果放入缓存，
+// 运行时才知道的正则表达式不放入缓存，以免缓存无限增长
+func compileRegexp(pattern string, cache bool) (*regexp.Regexp, error) {
+	if o, ok := regexpCache.Load(pattern); ok {
+		return o.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if cache {
+		regexpCache.Store(pattern, re)
+	}
+	return re, nil
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := normalizeExprValue(value).(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// normalizeExprValue 将各种整数、浮点数和自定义的字符串类型统一为 int64, float64 和 string
+func normalizeExprValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int64, float64, string, time.Time, []interface{}, map[string]interface{}:
+		return v
+	case json.Number:
+		if i64, err := v.Int64(); err == nil {
+			return i64
+		}
+		if f64, err := v.Float64(); err == nil {
+			return f64
+		}
+		return v.String()
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		if _, ok := value.(time.Duration); !ok {
+			return v.String()
+		}
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, rv.Len())
+		for idx := range values {
+			values[idx] = normalizeExprValue(rv.Index(idx).Interface())
+		}
+		return values
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeExprValue(rv.Elem().Interface())
+	}
+	return value
+}
+
+func toExprBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	default:
+		return false, fmt.Errorf("'%v' is not a boolean", value)
+	}
+}
+
+func exprString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toExprFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f64, err := strconv.ParseFloat(v, 64)
+		return f64, err == nil
+	}
+	return 0, false
+}
+
+func exprEquals(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	c, err := exprCompare(left, right)
+	if err == nil {
+		return c == 0
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func exprCompare(left, right interface{}) (int, error) {
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return compareInt64(l, r), nil
+		}
+	case string:
+		switch r := right.(type) {
+		case string:
+			return strings.Compare(l, r), nil
+		case time.Time:
+			t, err := time.Parse(time.RFC3339, l)
+			if err != nil {
+				return 0, err
+			}
+			return compareTime(t, r), nil
+		}
+	case time.Time:
+		switch r := right.(type) {
+		case time.Time:
+			return compareTime(l, r), nil
+		case string:
+			t, err := time.Parse(time.RFC3339, r)
+			if err != nil {
+				return 0, err
+			}
+			return compareTime(l, t), nil
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			if l == r {
+				return 0, nil
+			}
+			if !l {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	lf, lok := toExprFloat(left)
+	rf, rok := toExprFloat(right)
+	if lok && rok {
+		switch {
+		case lf < rf:
+			return -1, nil
+		case lf > rf:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("'%v' and '%v' isn't comparable", left, right)
+}
+
+func compareInt64(l, r int64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareTime(l, r time.Time) int {
+	switch {
+	case l.Before(r):
+		return -1
+	case l.After(r):
+		return 1
+	default:
+		return 0
+	}
+}
+
+func exprArithmetic(op string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	if op == "+" {
+		if ls, ok := left.(string); ok {
+			return ls + exprString(right), nil
+		}
+	}
+
+	li, lok := left.(int64)
+	ri, rok := right.(int64)
+	if lok && rok {
+		switch op {
+		case "+":
+			return li + ri, nil
+		case "-":
+			return li - ri, nil
+		case "*":
+			return li * ri, nil
+		case "/":
+			if ri == 0 {
+				return nil, errors.New("divide by zero")
+			}
+			return li / ri, nil
+		case "%":
+			if ri == 0 {
+				return nil, errors.New("divide by zero")
+			}
+			return li % ri, nil
+		}
+	}
+
+	lf, lok := toExprFloat(left)
+	rf, rok := toExprFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("'%v' %s '%v' is unsupported", left, op, right)
+	}
+	switch op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, errors.New("divide by zero")
+		}
+		return lf / rf, nil
+	default:
+		if rf == 0 {
+			return nil, errors.New("divide by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+}
+
+type exprTokenKind int
+
+const (
+	tokenIdent exprTokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	idx    int
+	depth  int
+}
+
+func newExprParser(s string) (*exprParser, error) {
+	if len(s) > maxExpressionLength {
+		return nil, fmt.Errorf("expression is too long, it must less than %d", maxExpressionLength)
+	}
+	p := &exprParser{src: s}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ","}
+
+func (p *exprParser) tokenize() error {
+	s := p.src
+	for pos := 0; pos < len(s); {
+		c := s[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			pos++
+		case c == '\'' || c == '"':
+			end := pos + 1
+			var sb strings.Builder
+			for ; end < len(s) && s[end] != c; end++ {
+				if s[end] == '\\' && end+1 < len(s) {
+					end++
+					switch s[end] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(s[end])
+					}
+					continue
+				}
+				sb.WriteByte(s[end])
+			}
+			if end >= len(s) {
+				return fmt.Errorf("syntax error at %d of '%s', string isn't closed", pos, s)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenString, text: s[pos : end+1], value: sb.String(), pos: pos})
+			pos = end + 1
+		case c >= '0' && c <= '9':
+			end := pos
+			isFloat := false
+			for ; end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.'); end++ {
+				if s[end] == '.' {
+					isFloat = true
+				}
+			}
+			text := s[pos:end]
+			var value interface{}
+			var err error
+			if isFloat {
+				value, err = strconv.ParseFloat(text, 64)
+			} else {
+				value, err = strconv.ParseInt(text, 10, 64)
+			}
+			if err != nil {
+				return fmt.Errorf("syntax error at %d of '%s', '%s' is invalid number", pos, s, text)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenNumber, text: text, value: value, pos: pos})
+			pos = end
+		case isIdentStart(c):
+			end := pos
+			for ; end < len(s) && (isIdentStart(s[end]) || s[end] == '.' || (s[end] >= '0' && s[end] <= '9')); end++ {
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokenIdent, text: s[pos:end], pos: pos})
+			pos = end
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[pos:], op) {
+					p.tokens = append(p.tokens, exprToken{kind: tokenOperator, text: op, pos: pos})
+					pos += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				if c == '=' {
+					// 允许用 = 代替 ==
+					p.tokens = append(p.tokens, exprToken{kind: tokenOperator, text: "==", pos: pos})
+					pos++
+					continue
+				}
+				return fmt.Errorf("syntax error at %d of '%s', unexpected '%c'", pos, s, c)
+			}
+		}
+	}
+	return nil
+}
+
+// isIdentStart 字段名可以包含中文等非 ASCII 字符
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	pos := len(p.src)
+	if !p.eof() {
+		pos = p.peek().pos
+	}
+	return fmt.Errorf("syntax error at %d of '%s', %s", pos, p.src, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) eof() bool {
+	return p.idx >= len(p.tokens)
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.idx]
+}
+
+func (p *exprParser) isOperator(ops ...string) bool {
+	if p.eof() || p.peek().kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if p.peek().text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) isKeyword(words ...string) bool {
+	if p.eof() || p.peek().kind != tokenIdent {
+		return false
+	}
+	for _, word := range words {
+		if p.peek().text == word {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOperator(op) {
+		if p.eof() {
+			return p.errorf("'%s' is excepted", op)
+		}
+		return p.errorf("'%s' is excepted, actual is '%s'", op, p.peek().text)
+	}
+	p.idx++
+	return nil
+}
+
+func (p *exprParser) enter() error {
+	p.depth++
+	if p.depth > maxExpressionDepth {
+		return p.errorf("expression is too deep")
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") || p.isKeyword("or") {
+		p.idx++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") || p.isKeyword("and") {
+		p.idx++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOperator("!") || p.isKeyword("not") {
+		p.idx++
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "!", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isOperator("==", "!=", "<", "<=", ">", ">=") {
+		op := p.peek().text
+		p.idx++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+
+	op := "in"
+	if p.isKeyword("not") && p.idx+1 < len(p.tokens) &&
+		p.tokens[p.idx+1].kind == tokenIdent && p.tokens[p.idx+1].text == "in" {
+		op = "not in"
+		p.idx++
+	}
+	if p.isKeyword("in") {
+		p.idx++
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	if op == "not in" {
+		return nil, p.errorf("'in' is excepted")
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.peek().text
+		p.idx++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "%") {
+		op := p.peek().text
+		p.idx++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOperator("-") {
+		p.idx++
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parseList(end string) ([]exprNode, error) {
+	var items []exprNode
+	if p.isOperator(end) {
+		p.idx++
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.isOperator(end) {
+			p.idx++
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end")
+	}
+
+	token := p.peek()
+	switch token.kind {
+	case tokenNumber, tokenString:
+		p.idx++
+		return &literalNode{value: token.value}, nil
+	case tokenIdent:
+		p.idx++
+		switch token.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if !p.isOperator("(") {
+			return &fieldNode{name: token.text}, nil
+		}
+
+		fn, ok := exprFuncs[token.text]
+		if !ok {
+			p.idx--
+			return nil, p.errorf("function '%s' is undefined", token.text)
+		}
+		p.idx++
+		args, err := p.parseList(")")
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != fn.argc {
+			return nil, fmt.Errorf("syntax error at %d of '%s', function '%s' excepted %d arguments, actual is %d",
+				token.pos, p.src, token.text, fn.argc, len(args))
+		}
+		if token.text == "matches" {
+			if lit, ok := args[1].(*literalNode); ok {
+				if _, err := compileRegexp(exprString(lit.value), true); err != nil {
+					return nil, fmt.Errorf("syntax error at %d of '%s', pattern of 'matches' is invalid, %s",
+						token.pos, p.src, err.Error())
+				}
+			}
+		}
+		return &callNode{name: token.text, fn: fn, args: args}, nil
+	default:
+		switch token.text {
+		case "(":
+			p.idx++
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		case "[":
+			p.idx++
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+		return nil, p.errorf("unexpected '%s'", token.text)
+	}
+}
@@ -0,0 +1,130 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	a "github.com/three-plus-three/modules/assert"
+)
+
+func TestExpression(t *testing.T) {
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	record := map[string]interface{}{
+		"sec_level": "authPriv",
+		"port":      161,
+		"ratio":     float32(0.5),
+		"address":   IPAddress("192.168.1.1"),
+		"start_at":  start,
+		"end_at":    start.Add(time.Hour),
+		"tags":      []string{"a", "b"},
+		"empty_str": "",
+	}
+
+	for _, test := range []struct {
+		expr     string
+		excepted interface{}
+	}{
+		{`sec_level == "authPriv"`, true},
+		{`sec_level = 'authPriv'`, true},
+		{`sec_level != 'authPriv'`, false},
+		{`sec_level in ['authNoPriv', 'authPriv']`, true},
+		{`sec_level not in ['authNoPriv', 'authPriv']`, false},
+		{`port > 100 && port <= 161`, true},
+		{`port == 161.0`, true},
+		{`port + 1`, int64(162)},
+		{`port * 2 - 1`, int64(321)},
+		{`-port`, int64(-161)},
+		{`ratio * 2`, float64(1)},
+		{`end_at > start_at`, true},
+		{`start_at < '2019-10-02T00:00:00Z'`, true},
+		{`address == '192.168.1.1'`, true},
+		{`startsWith(address, '192.168.')`, true},
+		{`matches(address, '^192\\.')`, true},
+		{`len(tags) == 2 and not empty(tags)`, true},
+		{`empty(empty_str) or empty(missing)`, true},
+		{`missing == null`, true},
+		{`missing > 1`, false},
+		{`!(port > 100) || upper(sec_level) == 'AUTHPRIV'`, true},
+		{`lower('ABC') + trim(' d ')`, "abcd"},
+	} {
+		expr, err := ParseExpression(test.expr)
+		if err != nil {
+			t.Error(test.expr, err)
+			continue
+		}
+		actual, err := expr.Eval(record)
+		if err != nil {
+			t.Error(test.expr, err)
+			continue
+		}
+		a.Check(t, actual, a.Equals, test.excepted, a.Commentf("eval %s", test.expr))
+	}
+
+	expr, err := ParseExpression(`end_at > start_at && sec_level == 'authPriv' && end_at != null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, expr.Fields(), a.DeepEquals, []string{"end_at", "start_at", "sec_level"})
+
+	// 常量的正则表达式在解析时编译一次
+	if _, err := ParseExpression(`matches(address, '^10\\.')`); err != nil {
+		t.Fatal(err)
+	}
+	_, ok := regexpCache.Load(`^10\.`)
+	a.Check(t, ok, a.Equals, true)
+}
+
+func TestExpressionFailure(t *testing.T) {
+	for _, test := range []struct {
+		expr     string
+		excepted string
+	}{
+		{`a ==`, "unexpected end"},
+		{`(a == 1`, "')' is excepted"},
+		{`a == 'abc`, "string isn't closed"},
+		{`exec('rm')`, "function 'exec' is undefined"},
+		{`len(a, b)`, "excepted 1 arguments"},
+		{`a $ b`, "unexpected '$'"},
+		{`a b`, "unexpected 'b'"},
+		{`matches(a, '(')`, "pattern of 'matches' is invalid"},
+		{strings.Repeat("(", 100) + "a" + strings.Repeat(")", 100), "too deep"},
+		{strings.Repeat("a", maxExpressionLength+1), "too long"},
+	} {
+		_, err := ParseExpression(test.expr)
+		if err == nil {
+			t.Error(test.expr, "excepted error is not nil")
+			continue
+		}
+		if !strings.Contains(err.Error(), test.excepted) {
+			t.Error(test.expr, "excepted error contains", test.excepted)
+			t.Error("actual is", err)
+		}
+	}
+
+	for _, test := range []struct {
+		expr     string
+		excepted string
+	}{
+		{`a + 1`, "is unsupported"},
+		{`a > 1`, "isn't comparable"},
+		{`1 / 0`, "divide by zero"},
+		{`a in 1`, "is not a list"},
+		{`1 && a`, "is not a boolean"},
+	} {
+		expr, err := ParseExpression(test.expr)
+		if err != nil {
+			t.Error(test.expr, err)
+			continue
+		}
+		_, err = expr.Eval(map[string]interface{}{"a": true})
+		if err == nil {
+			t.Error(test.expr, "excepted error is not nil")
+			continue
+		}
+		if !strings.Contains(err.Error(), test.excepted) {
+			t.Error(test.expr, "excepted error contains", test.excepted)
+			t.Error("actual is", err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/three-plus-three/modules/environment"
 	"github.com/three-plus-three/modules/util"
@@ -52,8 +53,8 @@ func Load(env *environment.Environment) (*TableDefinitions, error) {
 		"../../../../../cn/com/hengwei/meta/tpt_models.xml"}
 	found := false
 	for _, file := range files {
-		if util.FileExists(file) {
-			flag.Set("ds.models", file)
+		if nm := lookupModelsPath(file); nm != "" {
+			flag.Set("ds.models", nm)
 			found = true
 			break
 		}
@@ -78,6 +79,24 @@ func Load(env *environment.Environment) (*TableDefinitions, error) {
 	return definitions, nil
 }
 
+// lookupModelsPath 查找模型文件，xml 文件不存在时查找同名的 yaml 或 json 文件，以及同名的目录
+func lookupModelsPath(file string) string {
+	if util.FileExists(file) {
+		return file
+	}
+
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		if util.FileExists(base + ext) {
+			return base + ext
+		}
+	}
+	if util.DirExists(base) {
+		return base
+	}
+	return ""
+}
+
 func LookupModelsFile(config_name, origin_name string, is_dir bool) (string, error) {
 	files := []string{
 		"../meta/" + origin_name,
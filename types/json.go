@@ -18,15 +18,53 @@ var emptyArgs = []interface{}{}
 type ClassSpec struct {
 	Super        string                 `json:"super,omitempty" yaml:"super,omitempty"`
 	Name         string                 `json:"name" yaml:"name"`
+	Label        string                 `json:"label,omitempty" yaml:"label,omitempty"`
 	IsAbstractly bool                   `json:"abstract,omitempty" yaml:"abstract,omitempty"`
+	Includes     []string               `json:"includes,omitempty" yaml:"includes,omitempty"`
 	Keys         [][]string             `json:"keys,omitempty" yaml:"keys,omitempty"`
 	Fields       []FieldSpec            `json:"fields,omitempty" yaml:"fields,omitempty"`
 	Annotations  map[string]interface{} `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	BelongsTo           []BelongsToSpec           `json:"belongs_to,omitempty" yaml:"belongs_to,omitempty"`
+	HasMany             []HasManySpec             `json:"has_many,omitempty" yaml:"has_many,omitempty"`
+	HasOne              []HasOneSpec              `json:"has_one,omitempty" yaml:"has_one,omitempty"`
+	HasAndBelongsToMany []HasAndBelongsToManySpec `json:"has_and_belongs_to_many,omitempty" yaml:"has_and_belongs_to_many,omitempty"`
+}
+
+type BelongsToSpec struct {
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	Target string `json:"target" yaml:"target"`
+}
+
+type HasManySpec struct {
+	Target        string `json:"target" yaml:"target"`
+	AttributeName string `json:"attribute_name,omitempty" yaml:"attribute_name,omitempty"`
+	ForeignKey    string `json:"foreign_key,omitempty" yaml:"foreign_key,omitempty"`
+	Embedded      bool   `json:"embedded,omitempty" yaml:"embedded,omitempty"`
+	Polymorphic   bool   `json:"polymorphic,omitempty" yaml:"polymorphic,omitempty"`
+}
+
+type HasOneSpec struct {
+	Target        string `json:"target" yaml:"target"`
+	AttributeName string `json:"attribute_name,omitempty" yaml:"attribute_name,omitempty"`
+	ForeignKey    string `json:"foreign_key,omitempty" yaml:"foreign_key,omitempty"`
+	Embedded      bool   `json:"embedded,omitempty" yaml:"embedded,omitempty"`
+}
+
+type HasAndBelongsToManySpec struct {
+	Target     string `json:"target" yaml:"target"`
+	ForeignKey string `json:"foreign_key,omitempty" yaml:"foreign_key,omitempty"`
+	Through    string `json:"through,omitempty" yaml:"through,omitempty"`
+}
+
+type MixinSpec struct {
+	Name   string      `json:"name" yaml:"name"`
+	Fields []FieldSpec `json:"fields,omitempty" yaml:"fields,omitempty"`
 }
 
 type FieldSpec struct {
-	Name         string                 `json:"name" ymal:"name"`
-	Label        string                 `json:"label,omitempty" ymal:"label,omitempty"`
+	Name         string                 `json:"name" yaml:"name"`
+	Label        string                 `json:"label,omitempty" yaml:"label,omitempty"`
 	Description  string                 `json:"description,omitempty" yaml:"description,omitempty"`
 	Type         string                 `json:"type" yaml:"type"`
 	Format       string                 `json:"format,omitempty" yaml:"format,omitempty"`
@@ -49,6 +87,9 @@ type RestrictionSpec struct {
 	Length       string   `json:"length,omitempty" yaml:"length,omitempty"`
 	MinLength    string   `json:"minLength,omitempty" yaml:"minLength,omitempty"`
 	MaxLength    string   `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+
+	FractionDigits string `json:"fractionDigits,omitempty" yaml:"fractionDigits,omitempty"`
+	TotalDigits    string `json:"totalDigits,omitempty" yaml:"totalDigits,omitempty"`
 }
 
 func (p *FieldSpec) DefaultValue() interface{} {
@@ -189,6 +230,14 @@ func (p *FieldSpec) ToXML() *XMLPropertyDefinition {
 		Required:     Required,
 		DefaultValue: p.Default}
 
+	if p.Label != "" {
+		xpd.Labels = []XMLabel{{Lang: defaultLang, Content: p.Label}}
+	}
+	if p.Description != "" {
+		xpd.Descriptions = []XMLDescriptionType{{Lang: defaultLang, Content: p.Description}}
+	}
+	xpd.Annotations = toXMLAnnotations(p.Annotations)
+
 	if p.Restrictions != nil {
 		if len(p.Restrictions.Enumerations) != 0 {
 			xpd.Enumerations = make([]XMLEnumerationType, len(p.Restrictions.Enumerations))
@@ -203,6 +252,8 @@ func (p *FieldSpec) ToXML() *XMLPropertyDefinition {
 		xpd.Length = p.Restrictions.Length
 		xpd.MinLength = p.Restrictions.MinLength
 		xpd.MaxLength = p.Restrictions.MaxLength
+		xpd.FractionDigits = p.Restrictions.FractionDigits
+		xpd.TotalDigits = p.Restrictions.TotalDigits
 	}
 
 	return xpd
@@ -0,0 +1,293 @@
+package types
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+const (
+	// JSONSchemaDraft JSON Schema 的版本
+	JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	// OpenAPIVersion OpenAPI 的版本, 3.1 和 JSON Schema draft 2020-12 兼容
+	OpenAPIVersion = "3.1.0"
+)
+
+// JSONSchema 生成一个类的 JSON Schema 文档，它引用到的类(父类和关联的类)都放在 $defs 中
+func JSONSchema(cls *ClassDefinition) map[string]interface{} {
+	ref := func(name string) string {
+		return "#/$defs/" + name
+	}
+
+	defs := map[string]interface{}{}
+	var walk func(cls *ClassDefinition)
+	walk = func(cls *ClassDefinition) {
+		if _, ok := defs[cls.Name]; ok {
+			return
+		}
+		defs[cls.Name] = ClassJSONSchema(cls, ref)
+
+		if cls.Super != nil {
+			walk(cls.Super)
+		}
+		for _, assoc := range GetAssocations(cls) {
+			walk(assoc.Target())
+		}
+	}
+	walk(cls)
+
+	return map[string]interface{}{
+		"$schema": JSONSchemaDraft,
+		"$id":     cls.UnderscoreName + ".schema.json",
+		"title":   cls.Name,
+		"$ref":    ref(cls.Name),
+		"$defs":   defs,
+	}
+}
+
+// OpenAPIComponents 生成包含所有类的 OpenAPI components 文档
+func OpenAPIComponents(definitions *TableDefinitions, title, version string) map[string]interface{} {
+	ref := func(name string) string {
+		return "#/components/schemas/" + name
+	}
+
+	schemas := map[string]interface{}{}
+	for _, cls := range definitions.All() {
+		schemas[cls.Name] = ClassJSONSchema(cls, ref)
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+// ClassJSONSchema 生成一个类的 schema, ref 用于生成引用其它类的路径
+//
+// 有父类时用 allOf 引用父类的 schema，自已只包含本类定义的属性，
+// belongs_to 和 has_one 生成一个引用目标类的属性，has_many 和
+// has_and_belongs_to_many 生成一个引用目标类的数组属性。
+func ClassJSONSchema(cls *ClassDefinition, ref func(name string) string) map[string]interface{} {
+	fields := cls.Fields
+	if cls.Super != nil {
+		fields = cls.OwnFields
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := map[string]interface{}{}
+	var required []string
+	for _, name := range names {
+		field := fields[name]
+		properties[name] = PropertyJSONSchema(field)
+		if field.IsRequired && !field.IsPrimaryKey() {
+			required = append(required, name)
+		}
+	}
+
+	for _, assoc := range GetAssocations(cls) {
+		var name string
+		var schema map[string]interface{}
+		target := map[string]interface{}{"$ref": ref(assoc.Target().Name)}
+		switch assoc.(type) {
+		case *BelongsTo, *HasOne:
+			name = assoc.Target().UnderscoreName
+			schema = target
+		case *HasMany, *HasAndBelongsToMany:
+			name = Tableize(assoc.Target().Name)
+			schema = map[string]interface{}{
+				"type":  "array",
+				"items": target,
+			}
+		default:
+			continue
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		schema["readOnly"] = true
+		properties[name] = schema
+	}
+
+	own := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		own["required"] = required
+	}
+
+	if cls.Super == nil {
+		own["title"] = cls.Name
+		if cls.IsAbstractly {
+			own["x-abstract"] = true
+		}
+		return own
+	}
+
+	schema := map[string]interface{}{
+		"title": cls.Name,
+		"allOf": []interface{}{
+			map[string]interface{}{"$ref": ref(cls.Super.Name)},
+			own,
+		},
+	}
+	if cls.IsAbstractly {
+		schema["x-abstract"] = true
+	}
+	return schema
+}
+
+// PropertyJSONSchema 生成一个属性的 schema, 类型来自 TypeDefinition，约束来自验证器
+func PropertyJSONSchema(field *PropertyDefinition) map[string]interface{} {
+	schema := typeJSONSchema(field.Type)
+	for _, validator := range field.Restrictions {
+		addValidatorJSONSchema(schema, validator)
+	}
+
+	if field.Collection.IsCollection() {
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": schema,
+		}
+		if field.Collection.IsSet() {
+			schema["uniqueItems"] = true
+		}
+	}
+
+	if field.IsReadOnly || field.IsPrimaryKey() {
+		schema["readOnly"] = true
+	}
+	if field.DefaultValue != nil {
+		schema["default"] = defaultJSONValue(field.Type.ToExternal(field.DefaultValue))
+	}
+	return schema
+}
+
+func typeJSONSchema(typ TypeDefinition) map[string]interface{} {
+	switch typ.Name() {
+	case "boolean":
+		return map[string]interface{}{"type": "boolean"}
+	case "integer":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "objectId":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "biginteger":
+		return map[string]interface{}{"type": "integer"}
+	case "decimal":
+		return map[string]interface{}{"type": "number"}
+	case "string":
+		return map[string]interface{}{"type": "string"}
+	case "password":
+		return map[string]interface{}{"type": "string", "format": "password", "writeOnly": true}
+	case "datetime":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "duration":
+		return map[string]interface{}{"type": "string", "pattern": `^(-?\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+$`}
+	case "ipAddress":
+		return map[string]interface{}{"type": "string", "anyOf": []interface{}{
+			map[string]interface{}{"format": "ipv4"},
+			map[string]interface{}{"format": "ipv6"},
+		}}
+	case "physicalAddress":
+		return map[string]interface{}{"type": "string", "pattern": `^([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}$`}
+	case "attributeMap":
+		return map[string]interface{}{"type": "object"}
+	default:
+		// dynamic 可以是任意类型
+		return map[string]interface{}{}
+	}
+}
+
+func addValidatorJSONSchema(schema map[string]interface{}, validator Validator) {
+	switch v := validator.(type) {
+	case *PatternValidator:
+		schema["pattern"] = v.PatternString()
+	case *StringLengthValidator:
+		if v.MinLength >= 0 {
+			schema["minLength"] = v.MinLength
+		}
+		if v.MaxLength >= 0 {
+			schema["maxLength"] = v.MaxLength
+		}
+	case *IntegerValidator:
+		if v.HasMin {
+			schema["minimum"] = v.MinValue
+		}
+		if v.HasMax {
+			schema["maximum"] = v.MaxValue
+		}
+	case *DecimalValidator:
+		if v.HasMin {
+			schema["minimum"] = v.MinValue
+		}
+		if v.HasMax {
+			schema["maximum"] = v.MaxValue
+		}
+	case *DateValidator:
+		// JSON Schema 不支持日期范围，用 formatMinimum 和 formatMaximum 扩展
+		if v.HasMin {
+			schema["formatMinimum"] = v.MinValue.Format(time.RFC3339)
+		}
+		if v.HasMax {
+			schema["formatMaximum"] = v.MaxValue.Format(time.RFC3339)
+		}
+	case *StringEnumerationValidator:
+		values := make([]interface{}, len(v.Values))
+		for idx := range v.Values {
+			values[idx] = v.Values[idx]
+		}
+		schema["enum"] = values
+	case *IntegerEnumerationValidator:
+		values := make([]interface{}, len(v.Values))
+		for idx := range v.Values {
+			values[idx] = v.Values[idx]
+		}
+		schema["enum"] = values
+	case *BigIntegerValidator:
+		values := make([]interface{}, len(v.Values))
+		for idx := range v.Values {
+			values[idx] = jsonBigInt(&v.Values[idx])
+		}
+		schema["enum"] = values
+	case *EnumerationValidator:
+		values := make([]interface{}, len(v.Values))
+		for idx := range v.Values {
+			values[idx] = defaultJSONValue(v.Values[idx])
+		}
+		schema["enum"] = values
+	}
+}
+
+func defaultJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case time.Duration:
+		return v.String()
+	case *big.Int:
+		return jsonBigInt(v)
+	case big.Int:
+		return jsonBigInt(&v)
+	default:
+		return value
+	}
+}
+
+// jsonBigInt 超出 int64 的大整数在 JSON 中无法精确表示，转为字符串
+func jsonBigInt(i *big.Int) interface{} {
+	if i.IsInt64() {
+		return i.Int64()
+	}
+	return i.String()
+}
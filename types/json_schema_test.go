@@ -0,0 +1,87 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	a "github.com/three-plus-three/modules/assert"
+)
+
+func TestJSONSchema(t *testing.T) {
+	definitions, err := LoadTableDefinitions("test/spec")
+	if nil != err {
+		t.Errorf("read dir 'test/spec' failed, %s", err.Error())
+		return
+	}
+
+	schema := JSONSchema(definitions.Find("Employee"))
+	a.Check(t, schema["$schema"], a.Equals, JSONSchemaDraft)
+	a.Check(t, schema["$ref"], a.Equals, "#/$defs/Employee")
+
+	defs := schema["$defs"].(map[string]interface{})
+	a.Assert(t, len(defs), a.Equals, 3, a.Commentf("Employee, Person and Company"))
+
+	employee := defs["Employee"].(map[string]interface{})
+	allOf := employee["allOf"].([]interface{})
+	a.Assert(t, len(allOf), a.Equals, 2)
+	a.Check(t, allOf[0], a.DeepEquals, map[string]interface{}{"$ref": "#/$defs/Person"})
+
+	own := allOf[1].(map[string]interface{})
+	a.Check(t, own["required"], a.DeepEquals, []string{"Job"})
+	properties := own["properties"].(map[string]interface{})
+	a.Check(t, properties["Job"], a.DeepEquals, map[string]interface{}{"type": "string"})
+	a.Check(t, properties["Name"], a.IsNil, a.Commentf("Name is inherited from Person"))
+	a.Check(t, properties["company"], a.DeepEquals, map[string]interface{}{"$ref": "#/$defs/Company", "readOnly": true})
+
+	person := defs["Person"].(map[string]interface{})
+	properties = person["properties"].(map[string]interface{})
+	a.Check(t, properties["id"].(map[string]interface{})["readOnly"], a.Equals, true)
+	a.Check(t, properties["Name"], a.DeepEquals, map[string]interface{}{
+		"type":      "string",
+		"default":   "mfk",
+		"minLength": 3,
+		"maxLength": 13,
+	})
+	a.Check(t, properties["Age"], a.DeepEquals, map[string]interface{}{
+		"type":    "integer",
+		"format":  "int64",
+		"default": int64(123),
+		"minimum": int64(3),
+		"maximum": int64(313),
+	})
+	a.Check(t, properties["Sex"].(map[string]interface{})["enum"], a.DeepEquals, []interface{}{"male", "female"})
+
+	company := defs["Company"].(map[string]interface{})
+	properties = company["properties"].(map[string]interface{})
+	a.Check(t, properties["employees"], a.DeepEquals, map[string]interface{}{
+		"type":     "array",
+		"items":    map[string]interface{}{"$ref": "#/$defs/Employee"},
+		"readOnly": true,
+	})
+
+	if _, err := json.Marshal(schema); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenAPIComponents(t *testing.T) {
+	definitions, err := LoadTableDefinitions("test/spec")
+	if nil != err {
+		t.Errorf("read dir 'test/spec' failed, %s", err.Error())
+		return
+	}
+
+	doc := OpenAPIComponents(definitions, "models", "1.0")
+	a.Check(t, doc["openapi"], a.Equals, OpenAPIVersion)
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	a.Assert(t, len(schemas), a.Equals, 3)
+
+	employee := schemas["Employee"].(map[string]interface{})
+	allOf := employee["allOf"].([]interface{})
+	a.Check(t, allOf[0], a.DeepEquals, map[string]interface{}{"$ref": "#/components/schemas/Person"})
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Error(err)
+	}
+}
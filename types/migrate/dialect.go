@@ -0,0 +1,509 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/three-plus-three/modules/types"
+)
+
+// Dialect 数据库方言，负责类型映射和生成 DDL 语句
+type Dialect interface {
+	Name() string
+
+	// ColumnType 返回属性对应的列类型
+	ColumnType(field *types.PropertyDefinition) (string, error)
+	// Literal 将缺省值转换为 SQL 字面量
+	Literal(value interface{}) (string, error)
+
+	// NormalizeType 将从数据库中读到的类型转换为 ColumnType 的格式，以便比较
+	NormalizeType(typ string) string
+	// NormalizeDefault 将从数据库中读到的缺省值转换为 Literal 的格式，以便比较
+	NormalizeDefault(value string) string
+
+	// Statements 将变更转换为 SQL 语句
+	Statements(changes []Change) ([]string, error)
+}
+
+// GetDialect 按名称取数据库方言, 名称可以是 postgres, postgresql 或 sqlite, sqlite3
+func GetDialect(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "postgres", "postgresql":
+		return Postgres, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	default:
+		return nil, errors.New("dialect '" + name + "' is unsupported")
+	}
+}
+
+var (
+	// Postgres PostgreSQL 方言
+	Postgres Dialect = &postgresDialect{}
+	// SQLite SQLite 方言
+	SQLite Dialect = &sqliteDialect{}
+)
+
+func quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for idx, name := range names {
+		quoted[idx] = quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func literal(value interface{}, trueValue, falseValue string) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return quoteString(v), nil
+	case []byte:
+		return quoteString(string(v)), nil
+	case bool:
+		if v {
+			return trueValue, nil
+		}
+		return falseValue, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case *big.Int:
+		return v.String(), nil
+	case big.Int:
+		return v.String(), nil
+	case time.Duration:
+		return strconv.FormatInt(int64(v), 10), nil
+	case time.Time:
+		return quoteString(v.Format(time.RFC3339)), nil
+	case net.IP:
+		return quoteString(v.String()), nil
+	case net.HardwareAddr:
+		return quoteString(v.String()), nil
+	case fmt.Stringer:
+		return quoteString(v.String()), nil
+	default:
+		return "", fmt.Errorf("default value '%v' is unsupported type - %T", value, value)
+	}
+}
+
+// changesOf 取某一张表的所有变更
+func changesOf(changes []Change, table string) []Change {
+	var res []Change
+	for _, change := range changes {
+		if change.TableName() == table {
+			res = append(res, change)
+		}
+	}
+	return res
+}
+
+// checkAddColumn 已有的行在新增的 NOT NULL 列上没有值，所以这样的列必须有缺省值
+func checkAddColumn(change Change) error {
+	if change.Type == AddColumn && change.Column.NotNull &&
+		change.Column.Default == "" && !change.Column.PrimaryKey {
+		return errors.New("column '" + change.Column.Name + "' of table '" + change.TableName() +
+			"' is NOT NULL and hasn't a default value, the existing rows cannot be copied to it")
+	}
+	return nil
+}
+
+type postgresDialect struct{}
+
+func (d *postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (d *postgresDialect) ColumnType(field *types.PropertyDefinition) (string, error) {
+	if field.IsPrimaryKey() {
+		return "BIGSERIAL", nil
+	}
+	if field.Collection.IsCollection() {
+		return "JSONB", nil
+	}
+
+	switch field.Type.Name() {
+	case "boolean":
+		return "BOOLEAN", nil
+	case "integer":
+		return "INTEGER", nil
+	case "biginteger", "bigInteger", "objectId", "duration":
+		return "BIGINT", nil
+	case "decimal":
+		return "NUMERIC", nil
+	case "string", "password", "dynamic":
+		if length := maxLength(field); length > 0 {
+			return "VARCHAR(" + strconv.Itoa(length) + ")", nil
+		}
+		return "TEXT", nil
+	case "datetime":
+		return "TIMESTAMP WITH TIME ZONE", nil
+	case "ipAddress", "IPAddress", "physicalAddress", "PhysicalAddress":
+		return "VARCHAR(50)", nil
+	case "attributeMap":
+		return "JSONB", nil
+	default:
+		return "", errors.New("type '" + field.Type.Name() + "' is unsupported")
+	}
+}
+
+func (d *postgresDialect) Literal(value interface{}) (string, error) {
+	return literal(value, "true", "false")
+}
+
+var pgTypes = map[string]string{
+	"boolean":                     "BOOLEAN",
+	"integer":                     "INTEGER",
+	"bigint":                      "BIGINT",
+	"numeric":                     "NUMERIC",
+	"text":                        "TEXT",
+	"jsonb":                       "JSONB",
+	"timestamp with time zone":    "TIMESTAMP WITH TIME ZONE",
+	"timestamp without time zone": "TIMESTAMP",
+}
+
+func (d *postgresDialect) NormalizeType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if strings.HasPrefix(typ, "character varying") {
+		return "VARCHAR" + strings.TrimPrefix(typ, "character varying")
+	}
+	if s, ok := pgTypes[typ]; ok {
+		return s
+	}
+	return strings.ToUpper(typ)
+}
+
+var pgCast = regexp.MustCompile(`::[a-z ]+(\(\d+\))?$`)
+
+func (d *postgresDialect) NormalizeDefault(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "nextval(") {
+		return ""
+	}
+	return pgCast.ReplaceAllString(value, "")
+}
+
+func (d *postgresDialect) columnDefinition(column *Column) string {
+	var sb strings.Builder
+	sb.WriteString(quote(column.Name))
+	sb.WriteString(" ")
+	sb.WriteString(column.Type)
+	if column.PrimaryKey {
+		sb.WriteString(" PRIMARY KEY")
+	} else if column.NotNull {
+		sb.WriteString(" NOT NULL")
+	}
+	if column.Default != "" {
+		sb.WriteString(" DEFAULT ")
+		sb.WriteString(column.Default)
+	}
+	return sb.String()
+}
+
+func (d *postgresDialect) createIndex(table string, index *Index) string {
+	if index.Unique {
+		return "CREATE UNIQUE INDEX " + quote(index.Name) + " ON " + quote(table) + " (" + quoteAll(index.Columns) + ")"
+	}
+	return "CREATE INDEX " + quote(index.Name) + " ON " + quote(table) + " (" + quoteAll(index.Columns) + ")"
+}
+
+func (d *postgresDialect) Statements(changes []Change) ([]string, error) {
+	var sqlList []string
+	for _, change := range changes {
+		if err := checkAddColumn(change); err != nil {
+			return nil, err
+		}
+
+		switch change.Type {
+		case CreateTable:
+			columns := make([]string, 0, len(change.Table.Columns))
+			for _, column := range change.Table.Columns {
+				columns = append(columns, "  "+d.columnDefinition(column))
+			}
+			sqlList = append(sqlList, "CREATE TABLE "+quote(change.Table.Name)+" (\n"+strings.Join(columns, ",\n")+"\n)")
+		case DropTable:
+			sqlList = append(sqlList, "DROP TABLE "+quote(change.OldTable.Name))
+		case AddColumn:
+			sqlList = append(sqlList, "ALTER TABLE "+quote(change.Table.Name)+" ADD COLUMN "+d.columnDefinition(change.Column))
+		case DropColumn:
+			sqlList = append(sqlList, "ALTER TABLE "+quote(change.Table.Name)+" DROP COLUMN "+quote(change.OldColumn.Name))
+		case AlterColumn:
+			prefix := "ALTER TABLE " + quote(change.Table.Name) + " ALTER COLUMN " + quote(change.Column.Name)
+			if change.Column.Type != change.OldColumn.Type {
+				sqlList = append(sqlList, prefix+" TYPE "+change.Column.Type+
+					" USING "+quote(change.Column.Name)+"::"+change.Column.Type)
+			}
+			if change.Column.NotNull != change.OldColumn.NotNull {
+				if change.Column.NotNull {
+					sqlList = append(sqlList, prefix+" SET NOT NULL")
+				} else {
+					sqlList = append(sqlList, prefix+" DROP NOT NULL")
+				}
+			}
+			if change.Column.Default != change.OldColumn.Default {
+				if change.Column.Default == "" {
+					sqlList = append(sqlList, prefix+" DROP DEFAULT")
+				} else {
+					sqlList = append(sqlList, prefix+" SET DEFAULT "+change.Column.Default)
+				}
+			}
+		case CreateIndex:
+			sqlList = append(sqlList, d.createIndex(change.Table.Name, change.Index))
+		case DropIndex:
+			sqlList = append(sqlList, "DROP INDEX "+quote(change.Index.Name))
+		case AddForeignKey:
+			fk := change.ForeignKey
+			sqlList = append(sqlList, "ALTER TABLE "+quote(change.Table.Name)+
+				" ADD CONSTRAINT "+quote(fk.Name)+
+				" FOREIGN KEY ("+quoteAll(fk.Columns)+") REFERENCES "+quote(fk.RefTable)+" ("+quoteAll(fk.RefColumns)+")")
+		case DropForeignKey:
+			sqlList = append(sqlList, "ALTER TABLE "+quote(change.OldTable.Name)+
+				" DROP CONSTRAINT "+quote(change.ForeignKey.Name))
+		default:
+			return nil, errors.New("change '" + change.Type.String() + "' is unsupported")
+		}
+	}
+	return sqlList, nil
+}
+
+type sqliteDialect struct{}
+
+func (d *sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (d *sqliteDialect) ColumnType(field *types.PropertyDefinition) (string, error) {
+	if field.IsPrimaryKey() {
+		return "INTEGER", nil
+	}
+	if field.Collection.IsCollection() {
+		return "TEXT", nil
+	}
+
+	switch field.Type.Name() {
+	case "boolean":
+		return "BOOLEAN", nil
+	case "integer":
+		return "INTEGER", nil
+	case "biginteger", "bigInteger", "objectId", "duration":
+		return "BIGINT", nil
+	case "decimal":
+		return "REAL", nil
+	case "string", "password", "dynamic":
+		if length := maxLength(field); length > 0 {
+			return "VARCHAR(" + strconv.Itoa(length) + ")", nil
+		}
+		return "TEXT", nil
+	case "datetime":
+		return "DATETIME", nil
+	case "ipAddress", "IPAddress", "physicalAddress", "PhysicalAddress":
+		return "VARCHAR(50)", nil
+	case "attributeMap":
+		return "TEXT", nil
+	default:
+		return "", errors.New("type '" + field.Type.Name() + "' is unsupported")
+	}
+}
+
+func (d *sqliteDialect) Literal(value interface{}) (string, error) {
+	return literal(value, "1", "0")
+}
+
+func (d *sqliteDialect) NormalizeType(typ string) string {
+	return strings.ToUpper(strings.TrimSpace(typ))
+}
+
+func (d *sqliteDialect) NormalizeDefault(value string) string {
+	return strings.TrimSpace(value)
+}
+
+func (d *sqliteDialect) columnDefinition(column *Column) string {
+	var sb strings.Builder
+	sb.WriteString(quote(column.Name))
+	sb.WriteString(" ")
+	sb.WriteString(column.Type)
+	if column.PrimaryKey {
+		sb.WriteString(" PRIMARY KEY AUTOINCREMENT")
+	} else if column.NotNull {
+		sb.WriteString(" NOT NULL")
+	}
+	if column.Default != "" {
+		sb.WriteString(" DEFAULT ")
+		sb.WriteString(column.Default)
+	}
+	return sb.String()
+}
+
+func (d *sqliteDialect) createTable(name string, table *Table) string {
+	lines := make([]string, 0, len(table.Columns)+len(table.ForeignKeys))
+	for _, column := range table.Columns {
+		lines = append(lines, "  "+d.columnDefinition(column))
+	}
+	for _, fk := range table.ForeignKeys {
+		lines = append(lines, "  CONSTRAINT "+quote(fk.Name)+" FOREIGN KEY ("+quoteAll(fk.Columns)+
+			") REFERENCES "+quote(fk.RefTable)+" ("+quoteAll(fk.RefColumns)+")")
+	}
+	return "CREATE TABLE " + quote(name) + " (\n" + strings.Join(lines, ",\n") + "\n)"
+}
+
+func (d *sqliteDialect) createIndex(table string, index *Index) string {
+	if index.Unique {
+		return "CREATE UNIQUE INDEX " + quote(index.Name) + " ON " + quote(table) + " (" + quoteAll(index.Columns) + ")"
+	}
+	return "CREATE INDEX " + quote(index.Name) + " ON " + quote(table) + " (" + quoteAll(index.Columns) + ")"
+}
+
+// needRebuild SQLite 的 ALTER TABLE 只支持增加列和改名，其它的修改只能重建表
+func (d *sqliteDialect) needRebuild(change Change) bool {
+	switch change.Type {
+	case AlterColumn, DropColumn, DropForeignKey:
+		return true
+	case AddForeignKey:
+		return change.OldTable != nil
+	case AddColumn:
+		return change.Column.PrimaryKey
+	}
+	return false
+}
+
+// rebuild 按 SQLite 推荐的步骤重建表: 建新表，复制数据，删除旧表，改名，重建索引
+func (d *sqliteDialect) rebuild(from, to *Table) []string {
+	var common []string
+	for _, column := range to.Columns {
+		if from.GetColumn(column.Name) != nil {
+			common = append(common, column.Name)
+		}
+	}
+
+	tmpName := "_migrate_" + to.Name
+	sqlList := []string{
+		d.createTable(tmpName, to),
+		"INSERT INTO " + quote(tmpName) + " (" + quoteAll(common) + ") SELECT " + quoteAll(common) + " FROM " + quote(from.Name),
+		"DROP TABLE " + quote(from.Name),
+		"ALTER TABLE " + quote(tmpName) + " RENAME TO " + quote(to.Name),
+	}
+	for _, index := range to.Indexes {
+		sqlList = append(sqlList, d.createIndex(to.Name, index))
+	}
+	return sqlList
+}
+
+// applyChanges 在旧的表结构上应用 changes 中的变更，返回变更后的表结构
+func applyChanges(old *Table, changes []Change) *Table {
+	table := &Table{
+		Name:        old.Name,
+		Columns:     append([]*Column{}, old.Columns...),
+		Indexes:     append([]*Index{}, old.Indexes...),
+		ForeignKeys: append([]*ForeignKey{}, old.ForeignKeys...),
+	}
+	for _, change := range changes {
+		switch change.Type {
+		case AddColumn:
+			table.Columns = append(table.Columns, change.Column)
+		case AlterColumn:
+			for idx, column := range table.Columns {
+				if column.Name == change.OldColumn.Name {
+					table.Columns[idx] = change.Column
+				}
+			}
+		case DropColumn:
+			for idx, column := range table.Columns {
+				if column.Name == change.OldColumn.Name {
+					table.Columns = append(table.Columns[:idx:idx], table.Columns[idx+1:]...)
+					break
+				}
+			}
+		case CreateIndex:
+			table.Indexes = append(table.Indexes, change.Index)
+		case DropIndex:
+			for idx, index := range table.Indexes {
+				if index == change.Index {
+					table.Indexes = append(table.Indexes[:idx:idx], table.Indexes[idx+1:]...)
+					break
+				}
+			}
+		case AddForeignKey:
+			table.ForeignKeys = append(table.ForeignKeys, change.ForeignKey)
+		case DropForeignKey:
+			for idx, fk := range table.ForeignKeys {
+				if fk == change.ForeignKey {
+					table.ForeignKeys = append(table.ForeignKeys[:idx:idx], table.ForeignKeys[idx+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return table
+}
+
+func (d *sqliteDialect) Statements(changes []Change) ([]string, error) {
+	rebuilt := map[string]bool{}
+	for _, change := range changes {
+		if d.needRebuild(change) {
+			rebuilt[change.TableName()] = false
+		}
+	}
+
+	var sqlList []string
+	for _, change := range changes {
+		if err := checkAddColumn(change); err != nil {
+			return nil, err
+		}
+
+		if done, ok := rebuilt[change.TableName()]; ok {
+			if !done && change.Table != nil && change.OldTable != nil {
+				// 只应用 changes 中的变更，被跳过的变更(如 allowDrop 为 false 时删除列)不能在重建时被执行
+				target := applyChanges(change.OldTable, changesOf(changes, change.TableName()))
+				sqlList = append(sqlList, d.rebuild(change.OldTable, target)...)
+				rebuilt[change.TableName()] = true
+			}
+			// 表重建时已包含了它所有的变更
+			if change.Type != DropTable && change.Type != CreateTable {
+				continue
+			}
+		}
+
+		switch change.Type {
+		case CreateTable:
+			sqlList = append(sqlList, d.createTable(change.Table.Name, change.Table))
+		case DropTable:
+			sqlList = append(sqlList, "DROP TABLE "+quote(change.OldTable.Name))
+		case AddColumn:
+			sqlList = append(sqlList, "ALTER TABLE "+quote(change.Table.Name)+" ADD COLUMN "+d.columnDefinition(change.Column))
+		case CreateIndex:
+			sqlList = append(sqlList, d.createIndex(change.Table.Name, change.Index))
+		case DropIndex:
+			sqlList = append(sqlList, "DROP INDEX "+quote(change.Index.Name))
+		case AddForeignKey:
+			// 新建的表在 CREATE TABLE 中已包含了外键
+		default:
+			return nil, errors.New("change '" + change.Type.String() + "' is unsupported")
+		}
+	}
+	return sqlList, nil
+}
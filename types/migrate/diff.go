@@ -0,0 +1,280 @@
+package migrate
+
+import (
+	"sort"
+	"strings"
+)
+
+// ChangeType 变更的类型
+type ChangeType int
+
+const (
+	CreateTable ChangeType = iota
+	DropTable
+	AddColumn
+	DropColumn
+	AlterColumn
+	CreateIndex
+	DropIndex
+	AddForeignKey
+	DropForeignKey
+)
+
+var changeTypeNames = []string{
+	"create table",
+	"drop table",
+	"add column",
+	"drop column",
+	"alter column",
+	"create index",
+	"drop index",
+	"add foreign key",
+	"drop foreign key",
+}
+
+func (t ChangeType) String() string {
+	if int(t) < len(changeTypeNames) {
+		return changeTypeNames[t]
+	}
+	return "unknown"
+}
+
+// Change 表结构的一个变更
+//
+// Table 是变更后的表，OldTable 是变更前的表，新建表时 OldTable 为 nil，
+// 删除表时 Table 为 nil。
+type Change struct {
+	Type       ChangeType
+	Table      *Table
+	OldTable   *Table
+	Column     *Column
+	OldColumn  *Column
+	Index      *Index
+	ForeignKey *ForeignKey
+}
+
+// TableName 变更所在的表名
+func (c Change) TableName() string {
+	if c.Table != nil {
+		return c.Table.Name
+	}
+	return c.OldTable.Name
+}
+
+// IsDestructive 变更是否会丢失数据
+func (c Change) IsDestructive() bool {
+	switch c.Type {
+	case DropTable, DropColumn:
+		return true
+	case DropForeignKey:
+		// 删除表之前先删除它的外键，它和删除表一起执行或跳过
+		return c.Table == nil
+	case AlterColumn:
+		return c.Column.Type != c.OldColumn.Type
+	}
+	return false
+}
+
+func (c Change) String() string {
+	switch c.Type {
+	case CreateTable, DropTable:
+		return c.Type.String() + " " + c.TableName()
+	case AddColumn, AlterColumn:
+		return c.Type.String() + " " + c.TableName() + "." + c.Column.Name
+	case DropColumn:
+		return c.Type.String() + " " + c.TableName() + "." + c.OldColumn.Name
+	case CreateIndex, DropIndex:
+		return c.Type.String() + " " + c.Index.Name + " on " + c.TableName()
+	case AddForeignKey, DropForeignKey:
+		return c.Type.String() + " " + c.ForeignKey.Name + " on " + c.TableName()
+	}
+	return c.Type.String()
+}
+
+// Diff 比较两个表结构，返回从 from 变为 to 所需的变更，变更已按执行顺序排好:
+//
+//	删除外键, 删除索引, 新建表, 增加列, 修改列, 删除列, 新建索引, 增加外键, 删除表
+//
+// 新建表按外键依赖排序，被引用的表在前面，删除表则相反。
+func Diff(from, to *Schema) []Change {
+	if from == nil {
+		from = &Schema{}
+	}
+	if to == nil {
+		to = &Schema{}
+	}
+
+	var dropForeignKeys, dropIndexes, createTables, addColumns, alterColumns,
+		dropColumns, createIndexes, addForeignKeys, dropTables []Change
+
+	for _, newTable := range sortTables(to.Tables) {
+		oldTable := from.GetTable(newTable.Name)
+		if oldTable == nil {
+			createTables = append(createTables, Change{Type: CreateTable, Table: newTable})
+			for _, index := range newTable.Indexes {
+				createIndexes = append(createIndexes, Change{Type: CreateIndex, Table: newTable, Index: index})
+			}
+			for _, fk := range newTable.ForeignKeys {
+				addForeignKeys = append(addForeignKeys, Change{Type: AddForeignKey, Table: newTable, ForeignKey: fk})
+			}
+			continue
+		}
+
+		for _, column := range newTable.Columns {
+			oldColumn := oldTable.GetColumn(column.Name)
+			if oldColumn == nil {
+				addColumns = append(addColumns, Change{Type: AddColumn, Table: newTable, OldTable: oldTable, Column: column})
+			} else if !sameColumn(oldColumn, column) {
+				alterColumns = append(alterColumns, Change{Type: AlterColumn, Table: newTable, OldTable: oldTable,
+					Column: column, OldColumn: oldColumn})
+			}
+		}
+		for _, oldColumn := range oldTable.Columns {
+			if newTable.GetColumn(oldColumn.Name) == nil {
+				dropColumns = append(dropColumns, Change{Type: DropColumn, Table: newTable, OldTable: oldTable, OldColumn: oldColumn})
+			}
+		}
+
+		for _, oldIndex := range oldTable.Indexes {
+			if findIndex(newTable.Indexes, oldIndex) == nil {
+				dropIndexes = append(dropIndexes, Change{Type: DropIndex, Table: newTable, OldTable: oldTable, Index: oldIndex})
+			}
+		}
+		for _, index := range newTable.Indexes {
+			if findIndex(oldTable.Indexes, index) == nil {
+				createIndexes = append(createIndexes, Change{Type: CreateIndex, Table: newTable, OldTable: oldTable, Index: index})
+			}
+		}
+
+		for _, oldFk := range oldTable.ForeignKeys {
+			if findForeignKey(newTable.ForeignKeys, oldFk) == nil {
+				dropForeignKeys = append(dropForeignKeys, Change{Type: DropForeignKey, Table: newTable, OldTable: oldTable, ForeignKey: oldFk})
+			}
+		}
+		for _, fk := range newTable.ForeignKeys {
+			if findForeignKey(oldTable.ForeignKeys, fk) == nil {
+				addForeignKeys = append(addForeignKeys, Change{Type: AddForeignKey, Table: newTable, OldTable: oldTable, ForeignKey: fk})
+			}
+		}
+	}
+
+	oldTables := sortTables(from.Tables)
+	for idx := len(oldTables) - 1; idx >= 0; idx-- {
+		oldTable := oldTables[idx]
+		if to.GetTable(oldTable.Name) != nil {
+			continue
+		}
+		// 先删除外键，以免删除表时因为引用关系而失败
+		for _, fk := range oldTable.ForeignKeys {
+			dropForeignKeys = append(dropForeignKeys, Change{Type: DropForeignKey, OldTable: oldTable, ForeignKey: fk})
+		}
+		dropTables = append(dropTables, Change{Type: DropTable, OldTable: oldTable})
+	}
+
+	var changes []Change
+	for _, list := range [][]Change{dropForeignKeys, dropIndexes, createTables, addColumns,
+		alterColumns, dropColumns, createIndexes, addForeignKeys, dropTables} {
+		changes = append(changes, list...)
+	}
+	return changes
+}
+
+// Generate 生成变更的 SQL 语句，allowDrop 为 false 时会丢失数据的语句将注释掉
+func Generate(dialect Dialect, changes []Change, allowDrop bool) ([]string, error) {
+	var sqlList []string
+	var safe []Change
+	for _, change := range changes {
+		if change.IsDestructive() && !allowDrop {
+			sqlList = append(sqlList, "-- skip: "+change.String())
+			continue
+		}
+		safe = append(safe, change)
+	}
+
+	statements, err := dialect.Statements(safe)
+	if err != nil {
+		return nil, err
+	}
+	return append(sqlList, statements...), nil
+}
+
+func sameColumn(a, b *Column) bool {
+	return a.Type == b.Type &&
+		a.NotNull == b.NotNull &&
+		a.Default == b.Default
+}
+
+// findIndex 索引按列和是否唯一来比较，不比较名称
+func findIndex(indexes []*Index, index *Index) *Index {
+	for _, idx := range indexes {
+		if idx.Unique == index.Unique && sameStrings(idx.Columns, index.Columns) {
+			return idx
+		}
+	}
+	return nil
+}
+
+// findForeignKey 外键按列和引用来比较，不比较名称
+func findForeignKey(foreignKeys []*ForeignKey, fk *ForeignKey) *ForeignKey {
+	for _, f := range foreignKeys {
+		if f.RefTable == fk.RefTable &&
+			sameStrings(f.Columns, fk.Columns) &&
+			sameStrings(f.RefColumns, fk.RefColumns) {
+			return f
+		}
+	}
+	return nil
+}
+
+// sortTables 按外键依赖排序，被引用的表在前面，没有依赖关系的按名称排序
+func sortTables(tables []*Table) []*Table {
+	byNames := map[string]*Table{}
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		byNames[table.Name] = table
+		names = append(names, table.Name)
+	}
+	sort.Strings(names)
+
+	visited := map[string]bool{}
+	results := make([]*Table, 0, len(tables))
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		table := byNames[name]
+		var refs []string
+		for _, fk := range table.ForeignKeys {
+			if _, ok := byNames[fk.RefTable]; ok && fk.RefTable != name {
+				refs = append(refs, fk.RefTable)
+			}
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			visit(ref)
+		}
+		results = append(results, table)
+	}
+
+	for _, name := range names {
+		visit(name)
+	}
+	return results
+}
+
+// FormatSQL 将语句格式化为一个脚本
+func FormatSQL(sqlList []string) string {
+	var sb strings.Builder
+	for _, s := range sqlList {
+		sb.WriteString(s)
+		if !strings.HasPrefix(s, "--") {
+			sb.WriteString(";")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,358 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inspect 从数据库中读取表结构，指定了 tables 时只读取这些表，
+// 以免和模型定义比较时删除不归模型管理的表或它们的外键
+func Inspect(ctx context.Context, db *sql.DB, dialect Dialect, tables ...string) (*Schema, error) {
+	switch dialect.Name() {
+	case "postgres":
+		return inspectPostgres(ctx, db, dialect, tables)
+	case "sqlite":
+		return inspectSQLite(ctx, db, dialect, tables)
+	default:
+		return nil, errors.New("inspect of dialect '" + dialect.Name() + "' is unsupported")
+	}
+}
+
+// filterNames 只保留 tables 中的表名，tables 为 nil 时不过滤
+func filterNames(names, tables []string) []string {
+	if tables == nil {
+		return names
+	}
+	results := names[:0]
+	for _, name := range names {
+		for _, table := range tables {
+			if name == table {
+				results = append(results, name)
+				break
+			}
+		}
+	}
+	return results
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		results = append(results, s)
+	}
+	return results, rows.Err()
+}
+
+func inspectPostgres(ctx context.Context, db *sql.DB, dialect Dialect, tables []string) (*Schema, error) {
+	names, err := queryStrings(ctx, db, `SELECT table_name FROM information_schema.tables
+ WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name`)
+	if err != nil {
+		return nil, errors.New("read tables failed, " + err.Error())
+	}
+	names = filterNames(names, tables)
+
+	schema := &Schema{}
+	for _, name := range names {
+		table := &Table{Name: name}
+		if err := inspectPostgresColumns(ctx, db, dialect, table); err != nil {
+			return nil, errors.New("read columns of '" + name + "' failed, " + err.Error())
+		}
+		if err := inspectPostgresIndexes(ctx, db, table); err != nil {
+			return nil, errors.New("read indexes of '" + name + "' failed, " + err.Error())
+		}
+		if err := inspectPostgresForeignKeys(ctx, db, table); err != nil {
+			return nil, errors.New("read foreign keys of '" + name + "' failed, " + err.Error())
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	return schema, nil
+}
+
+func inspectPostgresColumns(ctx context.Context, db *sql.DB, dialect Dialect, table *Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT c.column_name, c.data_type, c.character_maximum_length,
+  c.is_nullable, c.column_default,
+  EXISTS(SELECT 1 FROM information_schema.table_constraints tc
+    JOIN information_schema.key_column_usage kcu
+      ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+    WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema
+      AND tc.table_name = c.table_name AND kcu.column_name = c.column_name)
+ FROM information_schema.columns c
+ WHERE c.table_schema = current_schema() AND c.table_name = $1
+ ORDER BY c.ordinal_position`, table.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, typ, nullable string
+		var length sql.NullInt64
+		var defaultValue sql.NullString
+		var isPrimaryKey bool
+		if err := rows.Scan(&name, &typ, &length, &nullable, &defaultValue, &isPrimaryKey); err != nil {
+			return err
+		}
+
+		column := &Column{
+			Name:       name,
+			NotNull:    nullable == "NO",
+			PrimaryKey: isPrimaryKey,
+		}
+		if length.Valid {
+			typ = typ + "(" + strconv.FormatInt(length.Int64, 10) + ")"
+		}
+		column.Type = dialect.NormalizeType(typ)
+		if defaultValue.Valid {
+			if isPrimaryKey && strings.HasPrefix(defaultValue.String, "nextval(") {
+				if column.Type == "BIGINT" {
+					column.Type = "BIGSERIAL"
+				} else if column.Type == "INTEGER" {
+					column.Type = "SERIAL"
+				}
+			}
+			column.Default = dialect.NormalizeDefault(defaultValue.String)
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	return rows.Err()
+}
+
+func inspectPostgresIndexes(ctx context.Context, db *sql.DB, table *Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT i.relname, ix.indisunique, a.attname
+ FROM pg_class t
+ JOIN pg_index ix ON t.oid = ix.indrelid
+ JOIN pg_class i ON i.oid = ix.indexrelid
+ JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)
+ WHERE t.relname = $1 AND t.relnamespace = current_schema()::regnamespace AND NOT ix.indisprimary
+ ORDER BY i.relname, array_position(ix.indkey, a.attnum)`, table.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var last *Index
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			return err
+		}
+		if last == nil || last.Name != name {
+			last = &Index{Name: name, Unique: unique}
+			table.Indexes = append(table.Indexes, last)
+		}
+		last.Columns = append(last.Columns, column)
+	}
+	return rows.Err()
+}
+
+func inspectPostgresForeignKeys(ctx context.Context, db *sql.DB, table *Table) error {
+	rows, err := db.QueryContext(ctx, `SELECT tc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name
+ FROM information_schema.table_constraints tc
+ JOIN information_schema.key_column_usage kcu
+   ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+ JOIN information_schema.constraint_column_usage ccu
+   ON tc.constraint_name = ccu.constraint_name AND tc.table_schema = ccu.table_schema
+ WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = $1
+ ORDER BY tc.constraint_name, kcu.ordinal_position`, table.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var last *ForeignKey
+	for rows.Next() {
+		var name, column, refTable, refColumn string
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return err
+		}
+		if last == nil || last.Name != name {
+			last = &ForeignKey{Name: name, RefTable: refTable}
+			table.ForeignKeys = append(table.ForeignKeys, last)
+		}
+		last.Columns = append(last.Columns, column)
+		last.RefColumns = append(last.RefColumns, refColumn)
+	}
+	return rows.Err()
+}
+
+func inspectSQLite(ctx context.Context, db *sql.DB, dialect Dialect, tables []string) (*Schema, error) {
+	names, err := queryStrings(ctx, db, `SELECT name FROM sqlite_master
+ WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, errors.New("read tables failed, " + err.Error())
+	}
+	names = filterNames(names, tables)
+
+	schema := &Schema{}
+	for _, name := range names {
+		table := &Table{Name: name}
+		if err := inspectSQLiteColumns(ctx, db, dialect, table); err != nil {
+			return nil, errors.New("read columns of '" + name + "' failed, " + err.Error())
+		}
+		if err := inspectSQLiteIndexes(ctx, db, table); err != nil {
+			return nil, errors.New("read indexes of '" + name + "' failed, " + err.Error())
+		}
+		if err := inspectSQLiteForeignKeys(ctx, db, table); err != nil {
+			return nil, errors.New("read foreign keys of '" + name + "' failed, " + err.Error())
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	return schema, nil
+}
+
+func inspectSQLiteColumns(ctx context.Context, db *sql.DB, dialect Dialect, table *Table) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+quote(table.Name)+")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		column := &Column{
+			Name:       name,
+			Type:       dialect.NormalizeType(typ),
+			NotNull:    notNull != 0 || pk != 0,
+			PrimaryKey: pk != 0,
+		}
+		if defaultValue.Valid {
+			column.Default = dialect.NormalizeDefault(defaultValue.String)
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	return rows.Err()
+}
+
+func inspectSQLiteIndexes(ctx context.Context, db *sql.DB, table *Table) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA index_list("+quote(table.Name)+")")
+	if err != nil {
+		return err
+	}
+
+	var indexes []*Index
+	for rows.Next() {
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		// 不同版本的 index_list 返回的列数不同: seq, name, unique[, origin, partial]
+		values := make([]interface{}, len(columns))
+		var name string
+		var unique int
+		var origin sql.NullString
+		for idx := range values {
+			switch columns[idx] {
+			case "name":
+				values[idx] = &name
+			case "unique":
+				values[idx] = &unique
+			case "origin":
+				values[idx] = &origin
+			default:
+				values[idx] = new(interface{})
+			}
+		}
+		if err := rows.Scan(values...); err != nil {
+			rows.Close()
+			return err
+		}
+		// 自动生成的主键和唯一约束索引不能单独删除，跳过
+		if strings.HasPrefix(name, "sqlite_autoindex_") || origin.String == "pk" {
+			continue
+		}
+		indexes = append(indexes, &Index{Name: name, Unique: unique != 0})
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if err := inspectSQLiteIndexColumns(ctx, db, index); err != nil {
+			return err
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+	table.Indexes = indexes
+	return nil
+}
+
+func inspectSQLiteIndexColumns(ctx context.Context, db *sql.DB, index *Index) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA index_info("+quote(index.Name)+")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seqno, cid int
+		var name string
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			return err
+		}
+		index.Columns = append(index.Columns, name)
+	}
+	return rows.Err()
+}
+
+func inspectSQLiteForeignKeys(ctx context.Context, db *sql.DB, table *Table) error {
+	rows, err := db.QueryContext(ctx, "PRAGMA foreign_key_list("+quote(table.Name)+")")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := map[int]*ForeignKey{}
+	for rows.Next() {
+		var id, seq int
+		var refTable, from, onUpdate, onDelete, match string
+		var to sql.NullString
+		if err := rows.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return err
+		}
+		fk := byID[id]
+		if fk == nil {
+			// SQLite 不会返回外键的名称，按本包的命名规则生成一个
+			fk = &ForeignKey{RefTable: refTable}
+			byID[id] = fk
+			table.ForeignKeys = append(table.ForeignKeys, fk)
+		}
+		fk.Columns = append(fk.Columns, from)
+		if to.Valid {
+			fk.RefColumns = append(fk.RefColumns, to.String)
+		} else {
+			fk.RefColumns = append(fk.RefColumns, "id")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, fk := range table.ForeignKeys {
+		fk.Name = indexName("fk", table.Name, fk.Columns)
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	a "github.com/three-plus-three/modules/assert"
+	"github.com/three-plus-three/modules/types"
+)
+
+const v1 = `classes:
+  - name: Device
+    fields:
+      - name: name
+        type: string
+        required: true
+        restrictions:
+          maxLength: "100"
+      - name: address
+        type: ipAddress
+      - name: description
+        type: string
+    keys:
+      - [name]
+  - name: Port
+    fields:
+      - name: ifIndex
+        type: integer
+        required: true
+        default: "0"
+    belongs_to:
+      - name: device_id
+        target: Device
+`
+
+const v2 = `classes:
+  - name: Device
+    fields:
+      - name: name
+        type: string
+        required: true
+        restrictions:
+          maxLength: "100"
+      - name: address
+        type: ipAddress
+      - name: enabled
+        type: boolean
+        default: "true"
+    keys:
+      - [name]
+  - name: Port
+    fields:
+      - name: ifIndex
+        type: integer
+        required: true
+        default: "0"
+    belongs_to:
+      - name: device_id
+        target: Device
+  - name: Domain
+    fields:
+      - name: name
+        type: string
+        unique: true
+`
+
+func loadSchema(t *testing.T, text string, dialect Dialect) *Schema {
+	tmp, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm := filepath.Join(tmp, "models.yaml")
+	if err := ioutil.WriteFile(nm, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	definitions, err := types.LoadTableDefinitions(nm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := FromDefinitions(definitions, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestFromDefinitions(t *testing.T) {
+	schema := loadSchema(t, v1, Postgres)
+	a.Assert(t, len(schema.Tables), a.Equals, 2)
+
+	devices := schema.GetTable("tpt_devices")
+	a.Assert(t, devices, a.NotNil)
+	a.Check(t, devices.Columns[0].Name, a.Equals, "id")
+	a.Check(t, devices.Columns[0].Type, a.Equals, "BIGSERIAL")
+	a.Check(t, devices.Columns[0].PrimaryKey, a.Equals, true)
+	a.Check(t, devices.GetColumn("name").Type, a.Equals, "VARCHAR(100)")
+	a.Check(t, devices.GetColumn("name").NotNull, a.Equals, true)
+	a.Check(t, devices.GetColumn("address").Type, a.Equals, "VARCHAR(50)")
+	a.Check(t, devices.GetColumn("description").Type, a.Equals, "TEXT")
+	a.Assert(t, len(devices.Indexes), a.Equals, 1)
+	a.Check(t, devices.Indexes[0].Name, a.Equals, "uq_tpt_devices_name")
+	a.Check(t, devices.Indexes[0].Unique, a.Equals, true)
+
+	ports := schema.GetTable("tpt_ports")
+	a.Assert(t, ports, a.NotNil)
+	a.Check(t, ports.GetColumn("ifIndex").Default, a.Equals, "0")
+	a.Assert(t, len(ports.ForeignKeys), a.Equals, 1)
+	a.Check(t, ports.ForeignKeys[0].Name, a.Equals, "fk_tpt_ports_device_id")
+	a.Check(t, ports.ForeignKeys[0].RefTable, a.Equals, "tpt_devices")
+	a.Check(t, ports.ForeignKeys[0].RefColumns, a.DeepEquals, []string{"id"})
+	a.Assert(t, len(ports.Indexes), a.Equals, 1)
+	a.Check(t, ports.Indexes[0].Name, a.Equals, "ix_tpt_ports_device_id")
+}
+
+func TestDiffCreate(t *testing.T) {
+	schema := loadSchema(t, v2, Postgres)
+	changes := Diff(nil, schema)
+
+	var tables []string
+	for _, change := range changes {
+		if change.Type == CreateTable {
+			tables = append(tables, change.Table.Name)
+		}
+	}
+	// tpt_ports 引用了 tpt_devices，所以 tpt_devices 必须在前面
+	a.Check(t, tables, a.DeepEquals, []string{"tpt_devices", "tpt_domains", "tpt_ports"})
+
+	sqlList, err := Generate(Postgres, changes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Assert(t, len(sqlList), a.Equals, 7)
+	a.Check(t, sqlList[0], a.Equals, `CREATE TABLE "tpt_devices" (
+  "id" BIGSERIAL PRIMARY KEY,
+  "address" VARCHAR(50),
+  "enabled" BOOLEAN DEFAULT true,
+  "name" VARCHAR(100) NOT NULL
+)`)
+	a.Check(t, sqlList[6], a.Equals, `ALTER TABLE "tpt_ports" ADD CONSTRAINT "fk_tpt_ports_device_id" FOREIGN KEY ("device_id") REFERENCES "tpt_devices" ("id")`)
+}
+
+func TestDiffAlter(t *testing.T) {
+	from := loadSchema(t, v1, Postgres)
+	to := loadSchema(t, v2, Postgres)
+
+	changes := Diff(from, to)
+	var actual []string
+	for _, change := range changes {
+		actual = append(actual, change.String())
+	}
+	a.Check(t, actual, a.DeepEquals, []string{
+		"create table tpt_domains",
+		"add column tpt_devices.enabled",
+		"drop column tpt_devices.description",
+		"create index uq_tpt_domains_name on tpt_domains",
+	})
+
+	sqlList, err := Generate(Postgres, changes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, sqlList[0], a.Equals, "-- skip: drop column tpt_devices.description")
+	a.Check(t, sqlList[2], a.Equals, `ALTER TABLE "tpt_devices" ADD COLUMN "enabled" BOOLEAN DEFAULT true`)
+
+	sqlList, err = Generate(Postgres, changes, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, sqlList[2], a.Equals, `ALTER TABLE "tpt_devices" DROP COLUMN "description"`)
+
+	a.Check(t, len(Diff(to, to)), a.Equals, 0)
+}
+
+func TestDiffDrop(t *testing.T) {
+	from := loadSchema(t, v2, Postgres)
+	to := loadSchema(t, v1, Postgres)
+	to.Tables = to.Tables[:1] // 只保留 tpt_devices
+
+	changes := Diff(from, to)
+	var actual []string
+	for _, change := range changes {
+		actual = append(actual, change.String())
+	}
+	a.Check(t, actual, a.DeepEquals, []string{
+		"drop foreign key fk_tpt_ports_device_id on tpt_ports",
+		"add column tpt_devices.description",
+		"drop column tpt_devices.enabled",
+		"drop table tpt_ports",
+		"drop table tpt_domains",
+	})
+
+	// 被删除的表的外键和表一起跳过
+	sqlList, err := Generate(Postgres, changes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, sqlList[:4], a.DeepEquals, []string{
+		"-- skip: drop foreign key fk_tpt_ports_device_id on tpt_ports",
+		"-- skip: drop column tpt_devices.enabled",
+		"-- skip: drop table tpt_ports",
+		"-- skip: drop table tpt_domains",
+	})
+}
+
+func TestFilterNames(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	a.Check(t, filterNames(names, nil), a.DeepEquals, []string{"a", "b", "c"})
+	a.Check(t, filterNames(names, []string{"c", "a", "d"}), a.DeepEquals, []string{"a", "c"})
+	a.Check(t, len(filterNames([]string{"a"}, []string{})), a.Equals, 0)
+}
+
+func TestSQLiteRebuild(t *testing.T) {
+	from := loadSchema(t, v2, SQLite)
+	to := loadSchema(t, v1, SQLite)
+
+	sqlList, err := Generate(SQLite, Diff(from, to), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := FormatSQL(sqlList)
+
+	for _, excepted := range []string{
+		`CREATE TABLE "_migrate_tpt_devices" (`,
+		`INSERT INTO "_migrate_tpt_devices" ("id", "address", "name") SELECT "id", "address", "name" FROM "tpt_devices";`,
+		`DROP TABLE "tpt_devices";`,
+		`ALTER TABLE "_migrate_tpt_devices" RENAME TO "tpt_devices";`,
+		`CREATE UNIQUE INDEX "uq_tpt_devices_name" ON "tpt_devices" ("name");`,
+		`DROP TABLE "tpt_domains";`,
+	} {
+		if !strings.Contains(script, excepted) {
+			t.Error("excepted script contains", excepted)
+		}
+	}
+	if strings.Contains(script, "ADD COLUMN") {
+		t.Error("excepted columns are added by rebuilding")
+	}
+	if t.Failed() {
+		t.Log(script)
+	}
+
+	sqlList, err = Generate(SQLite, Diff(nil, to), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, sqlList[1], a.Equals, `CREATE TABLE "tpt_ports" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "device_id" BIGINT,
+  "ifIndex" INTEGER NOT NULL DEFAULT 0,
+  CONSTRAINT "fk_tpt_ports_device_id" FOREIGN KEY ("device_id") REFERENCES "tpt_devices" ("id")
+)`)
+}
+
+func TestSQLiteRebuildSkipDestructive(t *testing.T) {
+	from := &Schema{Tables: []*Table{{
+		Name: "tpt_devices",
+		Columns: []*Column{
+			{Name: "id", Type: "INTEGER", PrimaryKey: true},
+			{Name: "name", Type: "TEXT"},
+			{Name: "description", Type: "TEXT"},
+			{Name: "port", Type: "TEXT"},
+		},
+	}}}
+	to := &Schema{Tables: []*Table{{
+		Name: "tpt_devices",
+		Columns: []*Column{
+			{Name: "id", Type: "INTEGER", PrimaryKey: true},
+			{Name: "name", Type: "TEXT", NotNull: true, Default: "''"},
+			{Name: "port", Type: "INTEGER"},
+		},
+	}}}
+
+	sqlList, err := Generate(SQLite, Diff(from, to), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := FormatSQL(sqlList)
+
+	// 删除列和修改类型被跳过了，重建表时必须保留它们
+	for _, excepted := range []string{
+		"-- skip: alter column tpt_devices.port",
+		"-- skip: drop column tpt_devices.description",
+		`CREATE TABLE "_migrate_tpt_devices" (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "name" TEXT NOT NULL DEFAULT '',
+  "description" TEXT,
+  "port" TEXT
+);`,
+		`INSERT INTO "_migrate_tpt_devices" ("id", "name", "description", "port") SELECT "id", "name", "description", "port" FROM "tpt_devices";`,
+	} {
+		if !strings.Contains(script, excepted) {
+			t.Error("excepted script contains", excepted)
+		}
+	}
+	if t.Failed() {
+		t.Log(script)
+	}
+}
+
+func TestSQLiteAddNotNullColumn(t *testing.T) {
+	from := &Schema{Tables: []*Table{{
+		Name:    "tpt_devices",
+		Columns: []*Column{{Name: "id", Type: "INTEGER", PrimaryKey: true}},
+	}}}
+	to := &Schema{Tables: []*Table{{
+		Name: "tpt_devices",
+		Columns: []*Column{
+			{Name: "id", Type: "INTEGER", PrimaryKey: true},
+			{Name: "name", Type: "TEXT", NotNull: true},
+		},
+	}}}
+
+	for _, dialect := range []Dialect{SQLite, Postgres} {
+		_, err := Generate(dialect, Diff(from, to), true)
+		a.Check(t, err, a.ErrorMatches, ".*'name' of table 'tpt_devices' is NOT NULL and hasn't a default value.*")
+	}
+
+	to.Tables[0].Columns[1].Default = "''"
+	sqlList, err := Generate(SQLite, Diff(from, to), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, sqlList, a.DeepEquals, []string{`ALTER TABLE "tpt_devices" ADD COLUMN "name" TEXT NOT NULL DEFAULT ''`})
+}
@@ -0,0 +1,270 @@
+// Package migrate 根据 types.TableDefinitions 生成数据库表结构的迁移脚本
+//
+// 它可以比较两个版本的模型定义，也可以比较模型定义和一个已存在的数据库，
+// 然后按依赖顺序生成 PostgreSQL 或 SQLite 的 DDL 语句。
+package migrate
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/three-plus-three/modules/types"
+)
+
+// Column 数据库中的一列
+type Column struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	Default    string
+	PrimaryKey bool
+}
+
+// Index 数据库中的一个索引
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ForeignKey 数据库中的一个外键
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Table 数据库中的一张表
+type Table struct {
+	Name        string
+	Columns     []*Column
+	Indexes     []*Index
+	ForeignKeys []*ForeignKey
+}
+
+// GetColumn 按名称查找列
+func (t *Table) GetColumn(name string) *Column {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+// Schema 数据库表结构
+type Schema struct {
+	Tables []*Table
+}
+
+// GetTable 按名称查找表
+func (s *Schema) GetTable(name string) *Table {
+	for _, table := range s.Tables {
+		if table.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// FromDefinitions 根据模型定义生成表结构，单表继承的类会合并到根类的表中
+func FromDefinitions(definitions *types.TableDefinitions, dialect Dialect) (*Schema, error) {
+	byTables := map[string][]*types.ClassDefinition{}
+	for _, cls := range definitions.All() {
+		byTables[cls.CollectionName] = append(byTables[cls.CollectionName], cls)
+	}
+
+	names := make([]string, 0, len(byTables))
+	for name := range byTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schema := &Schema{}
+	for _, name := range names {
+		classes := byTables[name]
+		root := stiRoot(classes)
+		if root == nil {
+			return nil, errors.New("root class of table '" + name + "' isn't found")
+		}
+		if root.IsAbstractly && !types.IsSingleTableInheritance(root) {
+			continue
+		}
+
+		table, err := tableFromClasses(definitions, root, classes, dialect)
+		if err != nil {
+			return nil, err
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+	return schema, nil
+}
+
+func stiRoot(classes []*types.ClassDefinition) *types.ClassDefinition {
+	for _, cls := range classes {
+		if cls.Super == nil || cls.Super.CollectionName != cls.CollectionName {
+			return cls
+		}
+	}
+	return nil
+}
+
+func tableFromClasses(definitions *types.TableDefinitions, root *types.ClassDefinition,
+	classes []*types.ClassDefinition, dialect Dialect) (*Table, error) {
+	table := &Table{Name: root.CollectionName}
+
+	// 根类的列在前面，其它的列按类名和列名排序，以保证每次生成的结果都一样
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i] == root {
+			return true
+		}
+		if classes[j] == root {
+			return false
+		}
+		return classes[i].Name < classes[j].Name
+	})
+
+	for _, cls := range classes {
+		fields := cls.GetProperties()
+		sort.Slice(fields, func(i, j int) bool {
+			if fields[i].IsPrimaryKey() != fields[j].IsPrimaryKey() {
+				return fields[i].IsPrimaryKey()
+			}
+			return fields[i].Name < fields[j].Name
+		})
+
+		for _, field := range fields {
+			if table.GetColumn(field.Name) != nil {
+				continue
+			}
+
+			column, err := columnFromProperty(field, dialect)
+			if err != nil {
+				return nil, errors.New("column '" + field.Name + "' of table '" + table.Name + "' is invalid, " + err.Error())
+			}
+			// 单表继承时子类的列必须可以为空
+			if cls != root {
+				column.NotNull = false
+			}
+			table.Columns = append(table.Columns, column)
+
+			if field.IsUniquely && !field.IsPrimaryKey() {
+				table.Indexes = append(table.Indexes, &Index{
+					Name:    indexName("uq", table.Name, []string{field.Name}),
+					Columns: []string{field.Name},
+					Unique:  true,
+				})
+			}
+		}
+	}
+
+	for _, key := range root.GetKeys() {
+		columns := make([]string, 0, len(key))
+		for _, field := range key {
+			columns = append(columns, field.Name)
+		}
+		if len(columns) == 1 && (root.Fields[columns[0]].IsUniquely || root.Fields[columns[0]].IsPrimaryKey()) {
+			continue
+		}
+		table.Indexes = append(table.Indexes, &Index{
+			Name:    indexName("uq", table.Name, columns),
+			Columns: columns,
+			Unique:  true,
+		})
+	}
+
+	for _, cls := range classes {
+		for _, assoc := range types.GetAssocationByTypes(cls, types.BELONGS_TO) {
+			belongsTo := assoc.(*types.BelongsTo)
+			target := definitions.FindByTableName(belongsTo.TargetTable.CollectionName)
+			if target == nil {
+				target = belongsTo.TargetTable
+			}
+
+			columns := []string{belongsTo.Name.Name}
+			if hasForeignKey(table, columns) {
+				continue
+			}
+			table.ForeignKeys = append(table.ForeignKeys, &ForeignKey{
+				Name:       indexName("fk", table.Name, columns),
+				Columns:    columns,
+				RefTable:   target.CollectionName,
+				RefColumns: []string{"id"},
+			})
+			if !hasIndex(table, columns) {
+				table.Indexes = append(table.Indexes, &Index{
+					Name:    indexName("ix", table.Name, columns),
+					Columns: columns,
+				})
+			}
+		}
+	}
+	return table, nil
+}
+
+func columnFromProperty(field *types.PropertyDefinition, dialect Dialect) (*Column, error) {
+	column := &Column{
+		Name:       field.Name,
+		NotNull:    field.IsRequired || field.IsPrimaryKey(),
+		PrimaryKey: field.IsPrimaryKey(),
+	}
+
+	var err error
+	column.Type, err = dialect.ColumnType(field)
+	if err != nil {
+		return nil, err
+	}
+	if field.DefaultValue != nil && !field.IsPrimaryKey() {
+		column.Default, err = dialect.Literal(field.Type.ToExternal(field.DefaultValue))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return column, nil
+}
+
+func indexName(prefix, table string, columns []string) string {
+	return prefix + "_" + table + "_" + strings.Join(columns, "_")
+}
+
+func hasIndex(table *Table, columns []string) bool {
+	for _, index := range table.Indexes {
+		if sameStrings(index.Columns, columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasForeignKey(table *Table, columns []string) bool {
+	for _, fk := range table.ForeignKeys {
+		if sameStrings(fk.Columns, columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// maxLength 从验证器中取字符串的最大长度，没有时返回 0
+func maxLength(field *types.PropertyDefinition) int {
+	for _, validator := range field.Restrictions {
+		if lv, ok := validator.(*types.StringLengthValidator); ok && lv.MaxLength > 0 {
+			return lv.MaxLength
+		}
+	}
+	return 0
+}
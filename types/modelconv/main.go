@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/three-plus-three/modules/types"
+)
+
+func main() {
+	var check bool
+	flag.BoolVar(&check, "check", false, "转换后再加载一次目标文件，检查是否正确")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 2 {
+		fmt.Println("用法：  " + os.Args[0] + " [-check] 源文件 目标文件")
+		fmt.Println("    源文件是 xml 时转换为 yaml 或 json(由目标文件的扩展名决定)，否则转换为 xml")
+		os.Exit(1)
+		return
+	}
+
+	var err error
+	if strings.ToLower(filepath.Ext(args[0])) == ".xml" {
+		err = types.ConvertXMLToSpec(args[0], args[1])
+	} else {
+		err = types.ConvertSpecToXML(args[0], args[1])
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	if check {
+		if _, err := types.LoadTableDefinitions(args[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+			return
+		}
+	}
+}
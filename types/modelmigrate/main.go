@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/three-plus-three/modules/types"
+	"github.com/three-plus-three/modules/types/migrate"
+)
+
+func main() {
+	var from, to, dialectName, dbDriver, dbURL, output string
+	var dryRun, allowDrop bool
+	flag.StringVar(&from, "from", "", "旧的模型定义文件或目录，不指定时和数据库比较")
+	flag.StringVar(&to, "to", "", "新的模型定义文件或目录")
+	flag.StringVar(&dialectName, "dialect", "", "数据库类型(postgres 或 sqlite)，不指定时由 db.driver 决定")
+	flag.StringVar(&dbDriver, "db.driver", "postgres", "数据库驱动(postgres 或 sqlite3)")
+	flag.StringVar(&dbURL, "db.url", "", "数据库连接串")
+	flag.StringVar(&output, "o", "", "输出的 sql 文件，不指定时输出到屏幕")
+	flag.BoolVar(&dryRun, "dry-run", false, "只输出 sql 语句，不在数据库上执行")
+	flag.BoolVar(&allowDrop, "allow-drop", false, "允许删除表和列等会丢失数据的变更")
+	flag.Parse()
+
+	if to == "" || (from == "" && dbURL == "") {
+		fmt.Println("用法：  " + os.Args[0] + " [-dry-run] [-allow-drop] [-o 文件] -from 旧的模型定义 -to 新的模型定义")
+		fmt.Println("       " + os.Args[0] + " [-dry-run] [-allow-drop] [-o 文件] -db.driver 驱动 -db.url 连接串 -to 新的模型定义")
+		flag.PrintDefaults()
+		os.Exit(1)
+		return
+	}
+
+	if dialectName == "" {
+		dialectName = dbDriver
+	}
+	dialect, err := migrate.GetDialect(dialectName)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	toSchema, err := loadSchema(to, dialect)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	var db *sql.DB
+	var fromSchema *migrate.Schema
+	if from != "" {
+		fromSchema, err = loadSchema(from, dialect)
+	} else {
+		db, err = sql.Open(dbDriver, dbURL)
+		if err == nil {
+			defer db.Close()
+			// 只和模型中的表比较，数据库中其它的表不归这里管理
+			tables := make([]string, 0, len(toSchema.Tables))
+			for _, table := range toSchema.Tables {
+				tables = append(tables, table.Name)
+			}
+			fromSchema, err = migrate.Inspect(context.Background(), db, dialect, tables...)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	sqlList, err := migrate.Generate(dialect, migrate.Diff(fromSchema, toSchema), allowDrop)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	script := migrate.FormatSQL(sqlList)
+	if output != "" {
+		err = ioutil.WriteFile(output, []byte(script), 0644)
+	} else {
+		fmt.Print(script)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	if dryRun || db == nil {
+		return
+	}
+	if err := execute(db, sqlList); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+}
+
+func loadSchema(file string, dialect migrate.Dialect) (*migrate.Schema, error) {
+	definitions, err := types.LoadTableDefinitions(file)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.FromDefinitions(definitions, dialect)
+}
+
+func execute(db *sql.DB, sqlList []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, s := range sqlList {
+		if len(s) >= 2 && s[:2] == "--" {
+			continue
+		}
+		if _, err := tx.Exec(s); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("execute '%s' failed, %s", s, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/three-plus-three/modules/types"
+)
+
+func main() {
+	var className, output, title, version string
+	var openapi bool
+	flag.StringVar(&className, "class", "", "生成指定类的 JSON Schema")
+	flag.BoolVar(&openapi, "openapi", false, "生成包含所有类的 OpenAPI components 文档")
+	flag.StringVar(&title, "title", "models", "OpenAPI 文档的标题")
+	flag.StringVar(&version, "version", "1.0", "OpenAPI 文档的版本")
+	flag.StringVar(&output, "o", "", "输出文件，不指定时输出到屏幕")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 || (className == "" && !openapi) {
+		fmt.Println("用法：  " + os.Args[0] + " -class 类名 [-o 文件] 模型定义")
+		fmt.Println("       " + os.Args[0] + " -openapi [-title 标题] [-version 版本] [-o 文件] 模型定义")
+		os.Exit(1)
+		return
+	}
+
+	definitions, err := types.LoadTableDefinitions(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	var doc map[string]interface{}
+	if openapi {
+		doc = types.OpenAPIComponents(definitions, title, version)
+	} else {
+		cls := definitions.Find(className)
+		if cls == nil {
+			fmt.Println("class '" + className + "' isn't found")
+			os.Exit(1)
+			return
+		}
+		doc = types.JSONSchema(cls)
+	}
+
+	bs, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+
+	if output == "" {
+		fmt.Println(string(bs))
+		return
+	}
+	if err := ioutil.WriteFile(output, bs, 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+		return
+	}
+}
@@ -0,0 +1,344 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	merrors "github.com/three-plus-three/modules/errors"
+)
+
+// ValidateMode 验证记录的模式
+type ValidateMode int
+
+const (
+	// VALIDATE_CREATE 新建记录，缺少的字段会填上缺省值，必填字段不能缺少
+	VALIDATE_CREATE ValidateMode = 1
+	// VALIDATE_UPDATE 更新整个记录，必填字段不能缺少，不填缺省值
+	VALIDATE_UPDATE ValidateMode = 2
+	// VALIDATE_PATCH 更新部分字段，只检查记录中有的字段
+	VALIDATE_PATCH ValidateMode = 3
+)
+
+func (mode ValidateMode) String() string {
+	switch mode {
+	case VALIDATE_CREATE:
+		return "create"
+	case VALIDATE_UPDATE:
+		return "update"
+	case VALIDATE_PATCH:
+		return "patch"
+	default:
+		return "unknown"
+	}
+}
+
+// 字段错误的代码
+const (
+	FIELD_REQUIRED = "required"
+	FIELD_READONLY = "readonly"
+	FIELD_UNKNOWN  = "unknown"
+	FIELD_INVALID  = "invalid"
+	FIELD_UNIQUE   = "unique"
+)
+
+// ERR_CODE_INVALID_RECORD 验证记录失败的错误码
+const ERR_CODE_INVALID_RECORD = http.StatusBadRequest*1000 + 903
+
+func init() {
+	merrors.Register(ERR_CODE_INVALID_RECORD, "record is invalid", map[string]string{"zh-CN": "记录中有错误的字段"})
+}
+
+// FieldError 一个字段的错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// RecordError 验证记录时的所有字段错误
+type RecordError struct {
+	Class  string        `json:"class"`
+	Errors []*FieldError `json:"errors"`
+}
+
+func (e *RecordError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("validate record of '")
+	buffer.WriteString(e.Class)
+	buffer.WriteString("' failed")
+	for _, fe := range e.Errors {
+		buffer.WriteString("\r\n")
+		buffer.WriteString(fe.Error())
+	}
+	return buffer.String()
+}
+
+// Fields 按字段名分组的错误信息，用于在表单中显示
+func (e *RecordError) Fields() map[string][]string {
+	res := map[string][]string{}
+	for _, fe := range e.Errors {
+		res[fe.Field] = append(res[fe.Field], fe.Message)
+	}
+	return res
+}
+
+// ErrorCode 返回 ERR_CODE_INVALID_RECORD
+func (e *RecordError) ErrorCode() int {
+	return ERR_CODE_INVALID_RECORD
+}
+
+// HTTPCode 返回 400
+func (e *RecordError) HTTPCode() int {
+	return http.StatusBadRequest
+}
+
+// ToApplicationError 转换成 ApplicationError，字段错误放在 Fields 中，以便
+// web_ext.ErrorToFlash 和 errors.ToProblem 能显示它们
+func (e *RecordError) ToApplicationError() *merrors.ApplicationError {
+	ae := merrors.Build(e.ErrorCode(), e.Error()).Build()
+	ae.Cause = e
+	if len(e.Errors) > 0 {
+		ae.Fields = e.Fields()
+	}
+	return ae
+}
+
+// UniqueChecker 检查唯一键的值是否已存在, values 为键中各字段的值
+//
+// 更新时调用者需要自已排除当前记录。
+type UniqueChecker func(cls *ClassDefinition, key KeyDefinition, values map[string]interface{}) (exists bool, err error)
+
+// ValidateRecord 按类定义验证一个记录，返回转换后的记录
+//
+// 字段值用 TypeDefinition.ToInternal 转换为内部类型，然后用字段的验证器检查，
+// 新建时缺少的字段会填上缺省值，只读字段和主键不能写入，然后检查类级别的验证器。
+// 指定了 checker 时会检查唯一字段、GetKeys() 中的组合唯一键和 unique 验证器。
+// 验证失败时返回 *RecordError。
+func ValidateRecord(cls *ClassDefinition, record map[string]interface{}, mode ValidateMode,
+	checker ...UniqueChecker) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(record))
+	recordErr := &RecordError{Class: cls.Name}
+	addError := func(field, code, msg string) {
+		recordErr.Errors = append(recordErr.Errors, &FieldError{Field: field, Code: code, Message: msg})
+	}
+
+	names := make([]string, 0, len(record))
+	for name := range record {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := cls.GetProperty(name)
+		if field == nil {
+			addError(name, FIELD_UNKNOWN, "it isn't a property of '"+cls.Name+"'")
+			continue
+		}
+		if field.IsReadOnly || field.IsPrimaryKey() {
+			addError(name, FIELD_READONLY, "it is readonly")
+			continue
+		}
+
+		value := record[name]
+		if value == nil {
+			if field.IsRequired {
+				addError(name, FIELD_REQUIRED, "it is required")
+			} else {
+				result[name] = nil
+			}
+			continue
+		}
+
+		value, err := coerceValue(field, value, record)
+		if err != nil {
+			addError(name, FIELD_INVALID, err.Error())
+			continue
+		}
+		result[name] = value
+	}
+
+	if mode != VALIDATE_PATCH {
+		fields := cls.GetProperties()
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Name < fields[j].Name
+		})
+
+		for _, field := range fields {
+			if _, ok := record[field.Name]; ok || field.IsPrimaryKey() {
+				continue
+			}
+			if mode == VALIDATE_CREATE && field.DefaultValue != nil {
+				result[field.Name] = field.DefaultValue
+				continue
+			}
+			if field.IsRequired && !field.IsReadOnly {
+				addError(field.Name, FIELD_REQUIRED, "it is required")
+			}
+		}
+	}
+
+	invalidFields := map[string]bool{}
+	for _, fe := range recordErr.Errors {
+		invalidFields[fe.Field] = true
+	}
+
+	var uniqueKeys []KeyDefinition
+	for _, validator := range GetClassValidators(cls) {
+		if !canValidate(validator, result, mode, invalidFields) {
+			continue
+		}
+
+		if unique, ok := validator.(*UniqueValidator); ok {
+			enabled, err := unique.IsEnabled(result)
+			if err != nil {
+				return nil, err
+			}
+			if enabled {
+				key := make(KeyDefinition, 0, len(unique.Names))
+				for _, name := range unique.Names {
+					key = append(key, cls.GetProperty(name))
+				}
+				uniqueKeys = append(uniqueKeys, key)
+			}
+			continue
+		}
+
+		errs, err := validator.Validate(result)
+		if err != nil {
+			return nil, err
+		}
+		recordErr.Errors = append(recordErr.Errors, errs...)
+	}
+
+	if len(recordErr.Errors) == 0 && len(checker) > 0 && checker[0] != nil {
+		if err := checkUniqueKeys(cls, result, uniqueKeys, checker[0], addError); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(recordErr.Errors) > 0 {
+		return nil, recordErr
+	}
+	return result, nil
+}
+
+func coerceValue(field *PropertyDefinition, value interface{}, attributes map[string]interface{}) (interface{}, error) {
+	if !field.Collection.IsCollection() {
+		return coerceOneValue(field, value, attributes)
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		if s, ok := value.([]string); ok {
+			values = make([]interface{}, len(s))
+			for idx := range s {
+				values[idx] = s[idx]
+			}
+		} else {
+			return nil, errors.New("it must is a array")
+		}
+	}
+
+	results := make([]interface{}, 0, len(values))
+	for idx, v := range values {
+		internal, err := coerceOneValue(field, v, attributes)
+		if err != nil {
+			return nil, fmt.Errorf("value[%d] is invalid, %s", idx, err.Error())
+		}
+		if field.Collection.IsSet() {
+			for _, old := range results {
+				if fmt.Sprint(old) == fmt.Sprint(internal) {
+					return nil, fmt.Errorf("value[%d] is duplicated", idx)
+				}
+			}
+		}
+		results = append(results, internal)
+	}
+	return results, nil
+}
+
+func coerceOneValue(field *PropertyDefinition, value interface{}, attributes map[string]interface{}) (interface{}, error) {
+	internal, err := field.Type.ToInternal(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, validator := range field.Restrictions {
+		if ok, err := validator.Validate(internal, attributes); !ok {
+			if err == nil {
+				return nil, fmt.Errorf("'%v' is invalid", value)
+			}
+			return nil, err
+		}
+	}
+	return internal, nil
+}
+
+// canValidate 验证器用到的字段有错误时不再检查，部分更新时记录中没有验证器用到的所有字段也不检查
+func canValidate(validator ClassValidator, record map[string]interface{}, mode ValidateMode, invalidFields map[string]bool) bool {
+	for _, name := range validator.Fields() {
+		if invalidFields[name] {
+			return false
+		}
+		if mode == VALIDATE_PATCH {
+			if _, ok := record[name]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func checkUniqueKeys(cls *ClassDefinition, record map[string]interface{}, uniqueKeys []KeyDefinition,
+	checker UniqueChecker, addError func(field, code, msg string)) error {
+	keys := append(cls.GetKeys(), uniqueKeys...)
+
+	fields := cls.GetProperties()
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	for _, field := range fields {
+		if field.IsUniquely && !field.IsPrimaryKey() {
+			keys = append(keys, KeyDefinition{field})
+		}
+	}
+
+	for _, key := range keys {
+		values := make(map[string]interface{}, len(key))
+		names := make([]string, 0, len(key))
+		for _, field := range key {
+			value, ok := record[field.Name]
+			if !ok {
+				break
+			}
+			values[field.Name] = value
+			names = append(names, field.Name)
+		}
+		// 部分更新时没有键中所有的字段，无法检查
+		if len(names) != len(key) {
+			continue
+		}
+
+		exists, err := checker(cls, key, values)
+		if err != nil {
+			return fmt.Errorf("check unique key '%s' of '%s' failed, %s", strings.Join(names, ","), cls.Name, err.Error())
+		}
+		if exists {
+			for _, name := range names {
+				if len(names) == 1 {
+					addError(name, FIELD_UNIQUE, "it is already exists")
+				} else {
+					addError(name, FIELD_UNIQUE, "combination of '"+strings.Join(names, ",")+"' is already exists")
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"testing"
+
+	a "github.com/three-plus-three/modules/assert"
+	"github.com/three-plus-three/modules/errors"
+)
+
+func TestValidateRecord(t *testing.T) {
+	definitions, err := LoadTableDefinitions("test/spec")
+	if nil != err {
+		t.Errorf("read dir 'test/spec' failed, %s", err.Error())
+		return
+	}
+	employee := definitions.Find("Employee")
+
+	record, err := ValidateRecord(employee, map[string]interface{}{
+		"Job": "coder",
+		"Age": "33",
+	}, VALIDATE_CREATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, record["Job"], a.Equals, "coder")
+	a.Check(t, record["Age"], a.Equals, int64(33))
+	a.Check(t, record["Name"], a.Equals, "mfk", a.Commentf("default value"))
+	a.Check(t, record["Sex"], a.Equals, "male", a.Commentf("default value"))
+	_, ok := record["id"]
+	a.Check(t, ok, a.Equals, false)
+
+	_, err = ValidateRecord(employee, map[string]interface{}{
+		"id":    1,
+		"Age":   "1000",
+		"Sex":   "unknown",
+		"Other": "a",
+	}, VALIDATE_UPDATE)
+	a.Assert(t, err, a.NotNil)
+	recordErr, ok := err.(*RecordError)
+	a.Assert(t, ok, a.Equals, true)
+
+	var codes = map[string]string{}
+	for _, fe := range recordErr.Errors {
+		codes[fe.Field] = fe.Code
+	}
+	a.Check(t, codes, a.DeepEquals, map[string]string{
+		"id":    FIELD_READONLY,
+		"Age":   FIELD_INVALID,
+		"Sex":   FIELD_INVALID,
+		"Other": FIELD_UNKNOWN,
+		"Job":   FIELD_REQUIRED,
+	})
+	a.Check(t, len(recordErr.Fields()["Job"]), a.Equals, 1)
+
+	// 字段错误能被 errors.ToApplicationError 和 errors.ToProblem 识别
+	ae := errors.ToApplicationError(err)
+	a.Check(t, ae.ErrorCode(), a.Equals, ERR_CODE_INVALID_RECORD)
+	a.Check(t, ae.Fields, a.DeepEquals, recordErr.Fields())
+	problem := errors.ToProblem(err, "zh-CN")
+	a.Check(t, problem.Status, a.Equals, 400)
+	a.Check(t, problem.Title, a.Equals, "记录中有错误的字段")
+	a.Check(t, problem.Fields, a.DeepEquals, recordErr.Fields())
+
+	record, err = ValidateRecord(employee, map[string]interface{}{
+		"Age": 34,
+	}, VALIDATE_PATCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, record, a.DeepEquals, map[string]interface{}{"Age": int64(34)})
+
+	_, err = ValidateRecord(employee, map[string]interface{}{
+		"Job": nil,
+	}, VALIDATE_PATCH)
+	a.Assert(t, err, a.NotNil)
+	a.Check(t, err.(*RecordError).Errors[0].Code, a.Equals, FIELD_REQUIRED)
+}
+
+func TestValidateRecordUniqueKeys(t *testing.T) {
+	definitions, err := LoadTableDefinitions("test/spec")
+	if nil != err {
+		t.Errorf("read dir 'test/spec' failed, %s", err.Error())
+		return
+	}
+	person := definitions.Find("Person")
+
+	var checked []map[string]interface{}
+	checker := func(cls *ClassDefinition, key KeyDefinition, values map[string]interface{}) (bool, error) {
+		checked = append(checked, values)
+		return values["Name"] == "exists", nil
+	}
+
+	_, err = ValidateRecord(person, map[string]interface{}{"Name": "newone"}, VALIDATE_CREATE, checker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, checked, a.DeepEquals, []map[string]interface{}{{"Name": "newone"}})
+
+	_, err = ValidateRecord(person, map[string]interface{}{"Name": "exists"}, VALIDATE_CREATE, checker)
+	a.Assert(t, err, a.NotNil)
+	a.Check(t, err.(*RecordError).Errors[0].Field, a.Equals, "Name")
+	a.Check(t, err.(*RecordError).Errors[0].Code, a.Equals, FIELD_UNIQUE)
+
+	checked = nil
+	_, err = ValidateRecord(person, map[string]interface{}{"Age": 12}, VALIDATE_PATCH, checker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Check(t, len(checked), a.Equals, 0, a.Commentf("key isn't in the record"))
+}
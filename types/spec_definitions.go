@@ -0,0 +1,672 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultLang 转换为 xml 时 label 和 description 使用的语言
+const defaultLang = "zh"
+
+// ModelsSpec 是 json 或 yaml 格式的模型文件，它和 XMLClassDefinitions 一一对应
+type ModelsSpec struct {
+	LastModified string      `json:"lastModified,omitempty" yaml:"lastModified,omitempty"`
+	Classes      []ClassSpec `json:"classes,omitempty" yaml:"classes,omitempty"`
+	Mixins       []MixinSpec `json:"mixins,omitempty" yaml:"mixins,omitempty"`
+}
+
+// IsSpecFile 判断文件是不是 json 或 yaml 格式的模型文件
+func IsSpecFile(nm string) bool {
+	switch strings.ToLower(filepath.Ext(nm)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// specFile 是一个已读取的模型文件, 它记录了各个类、mixin 和属性所在的行号
+type specFile struct {
+	name       string
+	spec       ModelsSpec
+	classLines []int
+	fieldLines [][]int
+	mixinLines []int
+}
+
+func (f *specFile) errorf(line int, format string, args ...interface{}) string {
+	if line <= 0 {
+		return f.name + ": " + fmt.Sprintf(format, args...)
+	}
+	return f.name + ":" + strconv.Itoa(line) + ": " + fmt.Sprintf(format, args...)
+}
+
+// ReadSpecFile 读取 json 或 yaml 格式的模型文件
+func ReadSpecFile(nm string) (*ModelsSpec, error) {
+	f, err := readSpecFile(nm)
+	if err != nil {
+		return nil, err
+	}
+	return &f.spec, nil
+}
+
+func readSpecFile(nm string) (*specFile, error) {
+	bs, err := ioutil.ReadFile(nm)
+	if nil != err {
+		return nil, fmt.Errorf("read file '%s' failed, %s", nm, err.Error())
+	}
+
+	if strings.ToLower(filepath.Ext(nm)) == ".json" {
+		// yaml 兼容 json, 但它的语法检查宽松一些，所以先用 json 检查一遍
+		var v interface{}
+		if err := json.Unmarshal(bs, &v); err != nil {
+			var offset int64 = -1
+			switch e := err.(type) {
+			case *json.SyntaxError:
+				offset = e.Offset
+			case *json.UnmarshalTypeError:
+				offset = e.Offset
+			}
+			if offset >= 0 {
+				return nil, fmt.Errorf("%s:%d: unmarshal json failed, %s", nm, lineAt(bs, offset), err.Error())
+			}
+			return nil, fmt.Errorf("%s: unmarshal json failed, %s", nm, err.Error())
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(bs, &doc); err != nil {
+		return nil, fmt.Errorf("%s: unmarshal failed, %s", nm, err.Error())
+	}
+
+	f := &specFile{name: nm}
+	if len(doc.Content) == 0 {
+		return f, nil
+	}
+	if err := doc.Decode(&f.spec); err != nil {
+		return nil, fmt.Errorf("%s: unmarshal failed, %s", nm, err.Error())
+	}
+
+	root := doc.Content[0]
+	if classes := mappingValue(root, "classes"); classes != nil {
+		for _, item := range classes.Content {
+			f.classLines = append(f.classLines, item.Line)
+
+			var lines []int
+			if fields := mappingValue(item, "fields"); fields != nil {
+				for _, field := range fields.Content {
+					lines = append(lines, field.Line)
+				}
+			}
+			f.fieldLines = append(f.fieldLines, lines)
+		}
+	}
+	if mixins := mappingValue(root, "mixins"); mixins != nil {
+		for _, item := range mixins.Content {
+			f.mixinLines = append(f.mixinLines, item.Line)
+		}
+	}
+	return f, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func lineAt(bs []byte, offset int64) int {
+	if offset > int64(len(bs)) {
+		offset = int64(len(bs))
+	}
+	return bytes.Count(bs[:offset], []byte("\n")) + 1
+}
+
+func (f *specFile) classLine(idx int) int {
+	if idx < len(f.classLines) {
+		return f.classLines[idx]
+	}
+	return 0
+}
+
+func (f *specFile) fieldLine(clsIdx, idx int) int {
+	if clsIdx < len(f.fieldLines) && idx < len(f.fieldLines[clsIdx]) {
+		return f.fieldLines[clsIdx][idx]
+	}
+	return f.classLine(clsIdx)
+}
+
+func (f *specFile) mixinLine(idx int) int {
+	if idx < len(f.mixinLines) {
+		return f.mixinLines[idx]
+	}
+	return 0
+}
+
+// LoadSpecDir 从目录中加载所有 json 和 yaml 格式的模型文件
+func LoadSpecDir(dir string) (*TableDefinitions, error) {
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if nil != err {
+			return nil, fmt.Errorf("list dir '%s' failed, %s", dir, err.Error())
+		}
+		files = append(files, matches...)
+	}
+	if 0 == len(files) {
+		return nil, fmt.Errorf("load dir '%s' error, models file is not found", dir)
+	}
+	sort.Strings(files)
+	return LoadSpecFiles(files)
+}
+
+// LoadSpecFiles 加载 json 和 yaml 格式的模型文件，它和 xml 文件有相同的继承，mixin 和关联语义
+func LoadSpecFiles(files []string) (*TableDefinitions, error) {
+	var specFiles []*specFile
+	for _, nm := range files {
+		f, err := readSpecFile(nm)
+		if err != nil {
+			return nil, err
+		}
+		specFiles = append(specFiles, f)
+	}
+
+	errList := checkSpecFiles(specFiles)
+	if 0 != len(errList) {
+		return nil, errors.New(strings.Join(errList, "\r\n"))
+	}
+
+	xmlList := make([]XMLClassDefinitions, 0, len(specFiles))
+	for _, f := range specFiles {
+		xmlList = append(xmlList, *f.spec.ToXML())
+	}
+
+	res, errList := loadDefinitions(xmlList)
+	if 0 != len(errList) {
+		errList = mergeErrors(nil, "load files '"+strings.Join(files, ",")+"' error:", errList)
+		return nil, errors.New(strings.Join(errList, "\r\n"))
+	}
+	return res, nil
+}
+
+// checkSpecFiles 先检查一遍引用关系，以便错误信息中能带上文件名和行号，
+// 同时也防止 loadDefinitions 因为找不到 key 的属性而 panic
+func checkSpecFiles(specFiles []*specFile) []string {
+	var errList []string
+
+	mixins := map[string][]FieldSpec{}
+	for _, f := range specFiles {
+		for idx, mixin := range f.spec.Mixins {
+			if "" == mixin.Name {
+				errList = append(errList, f.errorf(f.mixinLine(idx), "name of mixin is required"))
+				continue
+			}
+			if _, ok := mixins[mixin.Name]; ok {
+				errList = append(errList, f.errorf(f.mixinLine(idx), "mixin '%s' is duplicated.", mixin.Name))
+				continue
+			}
+			mixins[mixin.Name] = mixin.Fields
+
+			for _, field := range mixin.Fields {
+				if _, ok := types[field.Type]; !ok {
+					errList = append(errList, f.errorf(f.mixinLine(idx), "type '%s' of property '%s' in mixin '%s' is unsupported",
+						field.Type, field.Name, mixin.Name))
+					continue
+				}
+				if _, msgs := loadOwnField(field.ToXML()); len(msgs) != 0 {
+					errList = append(errList, f.errorf(f.mixinLine(idx), "load property '%s' of mixin '%s' failed, %s",
+						field.Name, mixin.Name, strings.Join(msgs, ",")))
+				}
+			}
+		}
+	}
+
+	classes := map[string]bool{}
+	for _, f := range specFiles {
+		for idx, cls := range f.spec.Classes {
+			if "" == cls.Name {
+				errList = append(errList, f.errorf(f.classLine(idx), "name of class is required"))
+				continue
+			}
+			if classes[cls.Name] {
+				errList = append(errList, f.errorf(f.classLine(idx), "class '%s' is aleady exists.", cls.Name))
+				continue
+			}
+			classes[cls.Name] = true
+		}
+	}
+
+	for _, f := range specFiles {
+		for idx, cls := range f.spec.Classes {
+			line := f.classLine(idx)
+
+			fields := map[string]bool{}
+			for fieldIdx, field := range cls.Fields {
+				fields[field.Name] = true
+				if _, ok := types[field.Type]; !ok {
+					errList = append(errList, f.errorf(f.fieldLine(idx, fieldIdx), "type '%s' of property '%s' in class '%s' is unsupported",
+						field.Type, field.Name, cls.Name))
+					continue
+				}
+				if _, msgs := loadOwnField(field.ToXML()); len(msgs) != 0 {
+					errList = append(errList, f.errorf(f.fieldLine(idx, fieldIdx), "load property '%s' of class '%s' failed, %s",
+						field.Name, cls.Name, strings.Join(msgs, ",")))
+				}
+			}
+
+			for _, include := range cls.Includes {
+				mixin, ok := mixins[include]
+				if !ok {
+					errList = append(errList, f.errorf(line, "mixin '%s' of class '%s' isn't found.", include, cls.Name))
+					continue
+				}
+				for _, field := range mixin {
+					if fields[field.Name] {
+						errList = append(errList, f.errorf(line, "property '%s' of class '%s' is duplicated.", field.Name, cls.Name))
+					}
+					fields[field.Name] = true
+				}
+			}
+
+			if "" != cls.Super && !classes[cls.Super] {
+				errList = append(errList, f.errorf(line, "Base '%s' of class '%s' is not found.", cls.Super, cls.Name))
+			}
+
+			for _, key := range cls.Keys {
+				for _, nm := range key {
+					if !fields[nm] {
+						errList = append(errList, f.errorf(line, "key '%s' of class '%s' is not found.", nm, cls.Name))
+					}
+				}
+			}
+
+			for _, belongsTo := range cls.BelongsTo {
+				if !classes[belongsTo.Target] {
+					errList = append(errList, f.errorf(line, "belongs_to Target '%s' of class '%s' is not found.", belongsTo.Target, cls.Name))
+				}
+			}
+			for _, hasMany := range cls.HasMany {
+				if !classes[hasMany.Target] {
+					errList = append(errList, f.errorf(line, "has_many Target '%s' of class '%s' is not found.", hasMany.Target, cls.Name))
+				}
+			}
+			for _, hasOne := range cls.HasOne {
+				if !classes[hasOne.Target] {
+					errList = append(errList, f.errorf(line, "has_one Target '%s' of class '%s' is not found.", hasOne.Target, cls.Name))
+				}
+			}
+			for _, habtm := range cls.HasAndBelongsToMany {
+				if !classes[habtm.Target] {
+					errList = append(errList, f.errorf(line, "has_and_belongs_to_many Target '%s' of class '%s' is not found.", habtm.Target, cls.Name))
+				}
+				if !classes[habtm.Through] {
+					errList = append(errList, f.errorf(line, "has_and_belongs_to_many Through '%s' of class '%s' is not found.", habtm.Through, cls.Name))
+				}
+			}
+		}
+	}
+	return errList
+}
+
+// ToXML 转换为 xml 格式的模型定义
+func (spec *ModelsSpec) ToXML() *XMLClassDefinitions {
+	res := &XMLClassDefinitions{LastModified: spec.LastModified}
+	for idx := range spec.Classes {
+		res.Definitions = append(res.Definitions, *spec.Classes[idx].ToXML())
+	}
+	for idx := range spec.Mixins {
+		res.Mixins = append(res.Mixins, *spec.Mixins[idx].ToXML())
+	}
+	return res
+}
+
+// ToXML 转换为 xml 格式的 mixin 定义
+func (spec *MixinSpec) ToXML() *XMLMixinDefinition {
+	res := &XMLMixinDefinition{Name: spec.Name}
+	for idx := range spec.Fields {
+		res.Properties = append(res.Properties, *spec.Fields[idx].ToXML())
+	}
+	return res
+}
+
+// ToXML 转换为 xml 格式的类定义
+func (spec *ClassSpec) ToXML() *XMLClassDefinition {
+	res := &XMLClassDefinition{
+		Name:     spec.Name,
+		Base:     spec.Super,
+		Abstract: spec.IsAbstractly,
+		Includes: spec.Includes,
+	}
+	if spec.Label != "" {
+		res.Labels = []XMLabel{{Lang: defaultLang, Content: spec.Label}}
+	}
+	res.Annotations = toXMLAnnotations(spec.Annotations)
+
+	for _, key := range spec.Keys {
+		res.CombinedKeys = append(res.CombinedKeys, XMLKey{Names: key})
+	}
+	for idx := range spec.Fields {
+		res.Properties = append(res.Properties, *spec.Fields[idx].ToXML())
+	}
+
+	for _, belongsTo := range spec.BelongsTo {
+		res.BelongsTo = append(res.BelongsTo, XMLBelongsTo{Name: belongsTo.Name, Target: belongsTo.Target})
+	}
+	for _, hasMany := range spec.HasMany {
+		res.HasMany = append(res.HasMany, XMLHasMany{
+			AttributeName: hasMany.AttributeName,
+			ForeignKey:    hasMany.ForeignKey,
+			Embedded:      boolToXML(hasMany.Embedded),
+			Polymorphic:   boolToXML(hasMany.Polymorphic),
+			Target:        hasMany.Target,
+		})
+	}
+	for _, hasOne := range spec.HasOne {
+		res.HasOne = append(res.HasOne, XMLHasOne{
+			AttributeName: hasOne.AttributeName,
+			ForeignKey:    hasOne.ForeignKey,
+			Embedded:      boolToXML(hasOne.Embedded),
+			Target:        hasOne.Target,
+		})
+	}
+	for _, habtm := range spec.HasAndBelongsToMany {
+		res.HasAndBelongsToMany = append(res.HasAndBelongsToMany, XMLHasAndBelongsToMany{
+			ForeignKey: habtm.ForeignKey,
+			Through:    habtm.Through,
+			Target:     habtm.Target,
+		})
+	}
+	return res
+}
+
+func boolToXML(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
+
+func toXMLAnnotations(annotations map[string]interface{}) []XMLAnnotation {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(annotations))
+	for name := range annotations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]XMLAnnotation, 0, len(annotations))
+	for _, name := range names {
+		// 值为字符串列表时表示多个同名的注解(如多个 validate)
+		if list, ok := annotationList(annotations[name]); ok {
+			for _, s := range list {
+				res = append(res, toXMLAnnotation(name, s))
+			}
+			continue
+		}
+
+		var s string
+		switch value := annotations[name].(type) {
+		case string:
+			s = value
+		case nil:
+		default:
+			bs, err := json.Marshal(value)
+			if err != nil {
+				s = fmt.Sprint(value)
+			} else {
+				s = string(bs)
+			}
+		}
+		res = append(res, toXMLAnnotation(name, s))
+	}
+	return res
+}
+
+func toXMLAnnotation(name, s string) XMLAnnotation {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return XMLAnnotation{Name: name, Data: buf.String()}
+}
+
+// annotationList 值为字符串列表时返回它，其它的值(如数字的列表)仍然作为一个 json 格式的注解
+func annotationList(value interface{}) ([]string, bool) {
+	switch list := value.(type) {
+	case []string:
+		return list, true
+	case []interface{}:
+		if len(list) == 0 {
+			return nil, false
+		}
+		ss := make([]string, 0, len(list))
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			ss = append(ss, s)
+		}
+		return ss, true
+	}
+	return nil, false
+}
+
+func fromXMLAnnotations(annotations []XMLAnnotation) map[string]interface{} {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(annotations))
+	for _, ann := range annotations {
+		text := annotationText(ann)
+		// 同名的注解(如多个 validate)保存为一个注解的列表，转回 xml 时仍然是多个注解
+		switch old := res[ann.Name].(type) {
+		case nil:
+			res[ann.Name] = text
+		case string:
+			res[ann.Name] = []string{old, text}
+		case []string:
+			res[ann.Name] = append(old, text)
+		}
+	}
+	return res
+}
+
+// annotationText 取注解的文本内容，注解的内容是 innerxml, 需要反转义
+func annotationText(ann XMLAnnotation) string {
+	var s string
+	if err := xml.Unmarshal([]byte("<a>"+ann.Data+"</a>"), &s); err != nil {
+		s = ann.Data
+	}
+	return strings.TrimSpace(s)
+}
+
+func firstLabel(labels []XMLabel) string {
+	for _, label := range labels {
+		if label.Lang == defaultLang {
+			return label.Content
+		}
+	}
+	if len(labels) > 0 {
+		return labels[0].Content
+	}
+	return ""
+}
+
+func firstDescription(descriptions []XMLDescriptionType) string {
+	for _, description := range descriptions {
+		if description.Lang == defaultLang {
+			return description.Content
+		}
+	}
+	if len(descriptions) > 0 {
+		return descriptions[0].Content
+	}
+	return ""
+}
+
+// ToSpec 转换为 json 或 yaml 格式的模型定义
+func (x *XMLClassDefinitions) ToSpec() *ModelsSpec {
+	res := &ModelsSpec{LastModified: x.LastModified}
+	for idx := range x.Definitions {
+		res.Classes = append(res.Classes, *x.Definitions[idx].ToSpec())
+	}
+	for idx := range x.Mixins {
+		res.Mixins = append(res.Mixins, *x.Mixins[idx].ToSpec())
+	}
+	return res
+}
+
+// ToSpec 转换为 json 或 yaml 格式的 mixin 定义
+func (x *XMLMixinDefinition) ToSpec() *MixinSpec {
+	res := &MixinSpec{Name: x.Name}
+	for idx := range x.Properties {
+		res.Fields = append(res.Fields, *x.Properties[idx].ToSpec())
+	}
+	return res
+}
+
+// ToSpec 转换为 json 或 yaml 格式的类定义, 属性上的 key 会转换为 Keys 中的一项
+func (x *XMLClassDefinition) ToSpec() *ClassSpec {
+	res := &ClassSpec{
+		Name:         x.Name,
+		Super:        x.Base,
+		Label:        firstLabel(x.Labels),
+		IsAbstractly: x.Abstract,
+		Includes:     x.Includes,
+		Annotations:  fromXMLAnnotations(x.Annotations),
+	}
+
+	for idx := range x.Properties {
+		if x.Properties[idx].Key != nil {
+			res.Keys = append(res.Keys, []string{x.Properties[idx].Name})
+		}
+		res.Fields = append(res.Fields, *x.Properties[idx].ToSpec())
+	}
+	for _, key := range x.CombinedKeys {
+		res.Keys = append(res.Keys, key.Names)
+	}
+
+	for _, belongsTo := range x.BelongsTo {
+		res.BelongsTo = append(res.BelongsTo, BelongsToSpec{Name: belongsTo.Name, Target: belongsTo.Target})
+	}
+	for _, hasMany := range x.HasMany {
+		res.HasMany = append(res.HasMany, HasManySpec{
+			AttributeName: hasMany.AttributeName,
+			ForeignKey:    hasMany.ForeignKey,
+			Embedded:      hasMany.Embedded == "true",
+			Polymorphic:   hasMany.Polymorphic == "true",
+			Target:        hasMany.Target,
+		})
+	}
+	for _, hasOne := range x.HasOne {
+		res.HasOne = append(res.HasOne, HasOneSpec{
+			AttributeName: hasOne.AttributeName,
+			ForeignKey:    hasOne.ForeignKey,
+			Embedded:      hasOne.Embedded == "true",
+			Target:        hasOne.Target,
+		})
+	}
+	for _, habtm := range x.HasAndBelongsToMany {
+		res.HasAndBelongsToMany = append(res.HasAndBelongsToMany, HasAndBelongsToManySpec{
+			ForeignKey: habtm.ForeignKey,
+			Through:    habtm.Through,
+			Target:     habtm.Target,
+		})
+	}
+	return res
+}
+
+// ToSpec 转换为 json 或 yaml 格式的属性定义
+func (x *XMLPropertyDefinition) ToSpec() *FieldSpec {
+	res := &FieldSpec{
+		Name:        x.Name,
+		Type:        x.Type,
+		Label:       firstLabel(x.Labels),
+		Description: firstDescription(x.Descriptions),
+		IsArray:     x.Collection == "array",
+		IsOriginal:  x.Embedded != "true",
+		IsRequired:  x.Required != nil,
+		IsReadonly:  x.ReadOnly != nil,
+		IsUniquely:  x.Unique != nil,
+		Default:     x.DefaultValue,
+		Unit:        x.Unit,
+		Annotations: fromXMLAnnotations(x.Annotations),
+	}
+
+	restrictions := &RestrictionSpec{
+		Pattern:        x.Pattern,
+		MinValue:       x.MinValue,
+		MaxValue:       x.MaxValue,
+		Length:         x.Length,
+		MinLength:      x.MinLength,
+		MaxLength:      x.MaxLength,
+		FractionDigits: x.FractionDigits,
+		TotalDigits:    x.TotalDigits,
+	}
+	for _, enumeration := range x.Enumerations {
+		restrictions.Enumerations = append(restrictions.Enumerations, enumeration.Value)
+	}
+	if len(restrictions.Enumerations) != 0 || x.Pattern != "" ||
+		x.MinValue != "" || x.MaxValue != "" ||
+		x.Length != "" || x.MinLength != "" || x.MaxLength != "" ||
+		x.FractionDigits != "" || x.TotalDigits != "" {
+		res.Restrictions = restrictions
+	}
+	return res
+}
+
+// ConvertXMLToSpec 将 xml 格式的模型文件转换为 json 或 yaml 格式, 格式由目标文件的扩展名决定
+func ConvertXMLToSpec(xmlFile, specFile string) error {
+	bs, err := ioutil.ReadFile(xmlFile)
+	if nil != err {
+		return fmt.Errorf("read file '%s' failed, %s", xmlFile, err.Error())
+	}
+
+	var xmlDefinition XMLClassDefinitions
+	if err = xml.Unmarshal(bs, &xmlDefinition); nil != err {
+		return fmt.Errorf("unmarshal xml '%s' failed, %s", xmlFile, err.Error())
+	}
+
+	spec := xmlDefinition.ToSpec()
+	if strings.ToLower(filepath.Ext(specFile)) == ".json" {
+		bs, err = json.MarshalIndent(spec, "", "  ")
+	} else {
+		bs, err = yaml.Marshal(spec)
+	}
+	if err != nil {
+		return fmt.Errorf("marshal '%s' failed, %s", specFile, err.Error())
+	}
+	return ioutil.WriteFile(specFile, bs, 0644)
+}
+
+// ConvertSpecToXML 将 json 或 yaml 格式的模型文件转换为 xml 格式
+func ConvertSpecToXML(specFile, xmlFile string) error {
+	spec, err := ReadSpecFile(specFile)
+	if err != nil {
+		return err
+	}
+
+	bs, err := xml.MarshalIndent(spec.ToXML(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal '%s' failed, %s", xmlFile, err.Error())
+	}
+	return ioutil.WriteFile(xmlFile, append([]byte(xml.Header), bs...), 0644)
+}
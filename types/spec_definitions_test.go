@@ -0,0 +1,189 @@
+package types
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	a "github.com/three-plus-three/modules/assert"
+)
+
+func TestLoadSpecDir(t *testing.T) {
+	definitions, err := LoadTableDefinitions("test/spec")
+	if nil != err {
+		t.Errorf("read dir 'test/spec' failed, %s", err.Error())
+		return
+	}
+
+	a.Assert(t, definitions.Len(), a.Equals, 3, a.Commentf("check len of classDefinitions"))
+
+	person := definitions.Find("Person")
+	employee := definitions.Find("Employee")
+	company := definitions.Find("Company")
+	a.Assert(t, person, a.NotNil)
+	a.Assert(t, employee, a.NotNil)
+	a.Assert(t, company, a.NotNil)
+
+	a.Check(t, employee.Super, a.Equals, person, a.Commentf("check super of Class employee"))
+	a.Check(t, person.Super, a.IsNil, a.Commentf("check super of Class person"))
+
+	// id, ID3(mixin), Name, Age, Sex
+	a.Check(t, len(person.Fields), a.Equals, 5, a.Commentf("check len of Columns of person"))
+	// + Job, company_test_id
+	a.Check(t, len(employee.Fields), a.Equals, 7, a.Commentf("check len of Columns of employee"))
+	a.Check(t, len(company.Fields), a.Equals, 2, a.Commentf("check len of Columns of company"))
+
+	a.Check(t, person.Fields["ID3"], a.NotNil, a.Commentf("check mixin of person"))
+	a.Check(t, person.Fields["Name"].DefaultValue, a.Equals, "mfk")
+	a.Check(t, person.Fields["Name"].Restrictions, a.DeepEquals, []Validator{&StringLengthValidator{MinLength: 3, MaxLength: 13}})
+	a.Check(t, employee.Fields["Job"].IsRequired, a.Equals, true)
+	a.Check(t, len(person.Keys), a.Equals, 1)
+	a.Check(t, person.Keys[0][0].Name, a.Equals, "Name")
+
+	a.Assert(t, len(GetAssocations(employee)), a.Equals, 1)
+	belongsTo := GetAssocations(employee)[0].(*BelongsTo)
+	a.Check(t, belongsTo.Target(), a.Equals, company)
+	a.Check(t, belongsTo.Name, a.Equals, employee.Fields["company_test_id"])
+
+	a.Assert(t, len(GetAssocations(company)), a.Equals, 1)
+	hasMany := GetAssocations(company)[0].(*HasMany)
+	a.Check(t, hasMany.Target(), a.Equals, employee)
+	a.Check(t, hasMany.ForeignKey, a.Equals, "company_test_id")
+}
+
+func TestLoadSpecFailure(t *testing.T) {
+	_, err := LoadTableDefinitions("test/spec_failure/person.yaml")
+	if nil == err {
+		t.Error("excepted error is not nil")
+		return
+	}
+
+	nm := filepath.Join("test", "spec_failure", "person.yaml")
+	for _, excepted := range []string{
+		nm + ":6: load property 'Age' of class 'Person' failed",
+		nm + ":9: type 'ip' of property 'Address' in class 'Person' is unsupported",
+		nm + ":11: Base 'People' of class 'Employee' is not found.",
+		nm + ":11: key 'Job' of class 'Employee' is not found.",
+	} {
+		if !strings.Contains(err.Error(), excepted) {
+			t.Error("excepted error contains", excepted)
+			t.Error("actual is", err)
+		}
+	}
+}
+
+func TestLoadSpecSyntaxError(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	nm := filepath.Join(tmp, "bad.json")
+	if err := ioutil.WriteFile(nm, []byte("{\n  \"classes\": [\n    {\"name\": \"A\",}\n  ]\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadTableDefinitions(nm)
+	if nil == err {
+		t.Error("excepted error is not nil")
+		return
+	}
+	if !strings.HasPrefix(err.Error(), nm+":3:") {
+		t.Error("excepted error starts with", nm+":3:")
+		t.Error("actual is", err)
+	}
+}
+
+func TestConvertXMLToSpec(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, ext := range []string{".yaml", ".json"} {
+		specFile := filepath.Join(tmp, "test1"+ext)
+		if err := ConvertXMLToSpec("test/test1.xml", specFile); err != nil {
+			t.Error(err)
+			continue
+		}
+		xmlFile := filepath.Join(tmp, "test1"+ext+".xml")
+		if err := ConvertSpecToXML(specFile, xmlFile); err != nil {
+			t.Error(err)
+			continue
+		}
+
+		excepted, err := LoadTableDefinitions("test/test1.xml")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for _, nm := range []string{specFile, xmlFile} {
+			actual, err := LoadTableDefinitions(nm)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+
+			a.Check(t, actual.Len(), a.Equals, excepted.Len(), a.Commentf("check len of classDefinitions of %s", nm))
+			for name, cls := range excepted.All() {
+				actualCls := actual.Find(name)
+				if actualCls == nil {
+					t.Error(nm, ": class", name, "is not found")
+					continue
+				}
+				a.Check(t, len(actualCls.Fields), a.Equals, len(cls.Fields), a.Commentf("check len of Columns of %s in %s", name, nm))
+				a.Check(t, len(GetAssocations(actualCls)), a.Equals, len(GetAssocations(cls)), a.Commentf("check len of assocations of %s in %s", name, nm))
+				for fieldName, field := range cls.Fields {
+					actualField := actualCls.Fields[fieldName]
+					if actualField == nil {
+						t.Error(nm, ": property", fieldName, "of", name, "is not found")
+						continue
+					}
+					a.Check(t, actualField.Type, a.Equals, field.Type)
+					a.Check(t, actualField.IsRequired, a.Equals, field.IsRequired)
+					a.Check(t, actualField.DefaultValue, a.DeepEquals, field.DefaultValue)
+					a.Check(t, len(actualField.Restrictions), a.Equals, len(field.Restrictions))
+				}
+			}
+		}
+	}
+}
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	x := &XMLClassDefinition{
+		Name: "Person",
+		Annotations: []XMLAnnotation{
+			{Name: "validate", Data: "a &gt; 1"},
+			{Name: "validate", Data: "b &lt; 2"},
+			{Name: "json", Data: `[1,2]`},
+		},
+	}
+
+	spec := x.ToSpec()
+	a.Check(t, spec.Annotations["validate"], a.DeepEquals, []string{"a > 1", "b < 2"})
+	a.Check(t, spec.Annotations["json"], a.Equals, "[1,2]")
+
+	// 经过 json 编码后列表变为 []interface{}, 仍然要还原为多个注解
+	bs, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ClassSpec
+	if err := json.Unmarshal(bs, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cls := range []*ClassSpec{spec, &decoded} {
+		a.Check(t, cls.ToXML().Annotations, a.DeepEquals, []XMLAnnotation{
+			{Name: "json", Data: `[1,2]`},
+			{Name: "validate", Data: "a &gt; 1"},
+			{Name: "validate", Data: "b &lt; 2"},
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 )
 
@@ -232,7 +233,16 @@ func LoadFiles(files []string) (*TableDefinitions, error) {
 	return res, nil
 }
 
+// LoadTableDefinitions 加载模型文件，nm 可以是 xml 文件、json 或 yaml 文件，也可以是
+// 包含 json 或 yaml 文件的目录
 func LoadTableDefinitions(nm string) (*TableDefinitions, error) {
+	if info, err := os.Stat(nm); err == nil && info.IsDir() {
+		return LoadSpecDir(nm)
+	}
+	if IsSpecFile(nm) {
+		return LoadSpecFiles([]string{nm})
+	}
+
 	f, err := ioutil.ReadFile(nm)
 	if nil != err {
 		return nil, fmt.Errorf("read file '%s' failed, %s", nm, err.Error())
@@ -331,6 +341,8 @@ func loadDefinitions(xmlList []XMLClassDefinitions) (*TableDefinitions, []string
 				}
 			}
 
+			errList = append(errList, loadClassValidators(cls, xmlDefinition.Name, xmlDefinition.Annotations)...)
+
 			for _, combinedKey := range xmlDefinition.CombinedKeys {
 				if nil == combinedKey.Names || 0 == len(combinedKey.Names) {
 					log.Print("[WARN] '" + xmlDefinition.Name + "' has empty key.")
@@ -461,6 +473,11 @@ func LoadAfter(definitions map[string]*ClassDefinition, errList []string) (*Tabl
 		cls.CollectionName = last
 	}
 
+	// check fields of class validators
+	for _, cls := range definitions {
+		checkClassValidators(cls, &errList)
+	}
+
 	// check id is exists.
 	for _, cls := range definitions {
 		if id, ok := cls.Fields["id"]; !ok || nil == id {
@@ -438,7 +438,7 @@ func (self *stringType) CreateEnumerationValidator(values []string) (Validator,
 		return nil, errors.New("values is null or empty")
 	}
 
-	new_values := make([]string, len(values))
+	new_values := make([]string, 0, len(values))
 	for i, s := range values {
 		if "" == s {
 			return nil, fmt.Errorf("value[%d] is empty", i)
@@ -232,7 +232,7 @@ func TestString(t *testing.T) {
 
 	pv := &PatternValidator{}
 	checker = pv
-	pv.Pattern, _ = regexp.Compile("a.*")
+	pv.pattern, _ = regexp.Compile("a.*")
 	assertFalse("ddd")
 	assertTrue("aaa")
 }
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -10,6 +11,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/kardianos/osext"
 )
@@ -17,6 +21,10 @@ import (
 var (
 	Commands         = map[string]string{}
 	ExecutableFolder string
+
+	// OutputDrainTimeout 命令退出后等待输出读完的时间，脱离了进程组的孙进程继承了输出管道时，
+	// 管道会一直不关闭，超时后不再读取它们
+	OutputDrainTimeout = 2 * time.Second
 )
 
 func init() {
@@ -123,7 +131,61 @@ func LoadCommands(executableFolder string) {
 	}
 }
 
-// Job is an interface for submitted cron jobs.
+// RESTART_XXX 命令的重启策略
+const (
+	RESTART_NEVER      = "never"
+	RESTART_ON_FAILURE = "on-failure"
+	RESTART_ALWAYS     = "always"
+)
+
+// RestartPolicy 命令退出后的重启策略，用于 wshell 等长期运行的辅助进程
+type RestartPolicy struct {
+	Mode        string        // RESTART_NEVER (缺省值), RESTART_ON_FAILURE 或 RESTART_ALWAYS
+	MaxRestarts int           // 最大重启次数，0 表示不限制
+	Delay       time.Duration // 第一次重启前的等待时间，以后每次加倍，缺省为 1 秒
+	MaxDelay    time.Duration // 等待时间的最大值，缺省为 1 分钟
+}
+
+// OutputLine 命令输出的一行
+type OutputLine struct {
+	Stream string    `json:"stream"` // "stdout" 或 "stderr"
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+}
+
+// Result 命令执行的结果
+type Result struct {
+	Pid        int
+	ExitCode   int // 被信号终止时为 -1
+	StartAt    time.Time
+	EndAt      time.Time
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64 // 最大驻留内存 (字节)，不支持的系统上为 0
+	Restarts   int
+}
+
+// RunError 命令执行失败的错误
+type RunError struct {
+	Path     string
+	Op       string // 失败的原因: "start", "exit", "timeout" 或 "cancel"
+	ExitCode int
+	Err      error
+}
+
+func (e *RunError) Error() string {
+	switch e.Op {
+	case "start":
+		return "start '" + e.Path + "' failed, " + e.Err.Error()
+	case "timeout":
+		return "run '" + e.Path + "' timeout, process group is killed"
+	case "cancel":
+		return "run '" + e.Path + "' is canceled, process group is killed"
+	}
+	return "run '" + e.Path + "' failed, " + e.Err.Error()
+}
+
+// Command 一个外部命令
 type Command struct {
 	Execute   string
 	Arguments []string
@@ -131,6 +193,14 @@ type Command struct {
 
 	Logfile      string
 	Environments []string
+
+	// Timeout 超时后杀掉整个进程组，0 表示不限制
+	Timeout time.Duration
+
+	// OnOutput 逐行接收命令的标准输出和错误输出，它不会被并发调用
+	OnOutput func(OutputLine)
+
+	Restart RestartPolicy
 }
 
 const maxBytes = 5 * 1024 * 1024
@@ -180,9 +250,12 @@ func (job *Command) rotateLogFile() error {
 	return nil
 }
 
-func (job *Command) Run(ctx context.Context) error {
+func (job *Command) openLogfile() (io.WriteCloser, error) {
+	if job.Logfile == "" {
+		return nil, nil
+	}
 	if e := job.rotateLogFile(); e != nil {
-		return errors.New("rotate log file(" + job.Logfile + ") failed, " + e.Error())
+		return nil, errors.New("rotate log file(" + job.Logfile + ") failed, " + e.Error())
 	}
 	out, e := os.OpenFile(job.Logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if nil != e {
@@ -200,28 +273,101 @@ func (job *Command) Run(ctx context.Context) error {
 
 		out, e = os.OpenFile(job.Logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 		if nil != e {
-			return errors.New("open log file(" + job.Logfile + ") failed, " + e.Error())
+			return nil, errors.New("open log file(" + job.Logfile + ") failed, " + e.Error())
+		}
+	}
+	return out, nil
+}
+
+// Run 执行命令，按 Restart 中的策略重启它，命令没有成功执行时返回 *RunError
+func (job *Command) Run(ctx context.Context) error {
+	_, err := job.Supervise(ctx)
+	return err
+}
+
+// Supervise 执行命令，并按 Restart 中的策略重启它，返回最后一次执行的结果
+func (job *Command) Supervise(ctx context.Context) (*Result, error) {
+	delay := job.Restart.Delay
+	if delay <= 0 {
+		delay = 1 * time.Second
+	}
+	maxDelay := job.Restart.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 1 * time.Minute
+	}
+
+	restarts := 0
+	for {
+		result, err := job.RunOnce(ctx)
+		if result != nil {
+			result.Restarts = restarts
+		}
+		if ctx.Err() != nil {
+			return result, err
+		}
+
+		switch job.Restart.Mode {
+		case RESTART_ALWAYS:
+		case RESTART_ON_FAILURE:
+			if err == nil {
+				return result, nil
+			}
+		default:
+			return result, err
+		}
+		if job.Restart.MaxRestarts > 0 && restarts >= job.Restart.MaxRestarts {
+			return result, err
+		}
+
+		// 运行了较长时间后才退出的，等待时间重新计算
+		if result != nil && result.EndAt.Sub(result.StartAt) > maxDelay {
+			delay = job.Restart.Delay
+			if delay <= 0 {
+				delay = 1 * time.Second
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		restarts++
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
 		}
 	}
-	defer out.Close()
+}
 
-	io.WriteString(out, "=============== begin ===============\r\n")
-	defer io.WriteString(out, "===============  end  ===============\r\n")
+// RunOnce 执行一次命令，命令在自己的进程组中运行，超时或 ctx 取消时整个进程组会被杀掉,
+// 命令正常退出时它在后台启动的进程不会被杀掉
+func (job *Command) RunOnce(ctx context.Context) (*Result, error) {
+	out, e := job.openLogfile()
+	if e != nil {
+		return nil, e
+	}
+	if out != nil {
+		defer out.Close()
+
+		io.WriteString(out, "=============== begin ===============\r\n")
+		defer io.WriteString(out, "===============  end  ===============\r\n")
+	}
 
 	execPath := job.Execute
 	if s := Commands[job.Execute]; s != "" {
-		s = execPath
+		execPath = s
 	}
 
 	executePath, found := LookPath(ExecutableFolder, execPath)
 	if !found {
-		executePath = job.Execute
+		executePath = execPath
 	}
 
-	cmd := exec.CommandContext(ctx, executePath, job.Arguments...)
-	cmd.Stderr = out
-	cmd.Stdout = out
+	cmd := exec.Command(executePath, job.Arguments...)
 	cmd.Dir = job.Dir
+	setProcessGroup(cmd)
 
 	if len(job.Environments) > 0 {
 		osEnv := os.Environ()
@@ -232,24 +378,173 @@ func (job *Command) Run(ctx context.Context) error {
 		cmd.Env = environments
 	}
 
-	io.WriteString(out, cmd.Path)
-	for idx, s := range cmd.Args {
-		if 0 == idx {
-			continue
+	if out != nil {
+		io.WriteString(out, cmd.Path)
+		for idx, s := range cmd.Args {
+			if 0 == idx {
+				continue
+			}
+			io.WriteString(out, "\r\n \t\t")
+			io.WriteString(out, s)
 		}
-		io.WriteString(out, "\r\n \t\t")
-		io.WriteString(out, s)
+		io.WriteString(out, "\r\n===============  out  ===============\r\n")
 	}
-	io.WriteString(out, "\r\n===============  out  ===============\r\n")
-	if e = cmd.Start(); nil != e {
-		io.WriteString(out, "start failed, "+e.Error()+"\r\n")
-		return nil
+
+	var mu sync.Mutex
+	emit := func(line OutputLine) {
+		mu.Lock()
+		defer mu.Unlock()
+		if out != nil {
+			io.WriteString(out, line.Text+"\r\n")
+		}
+		if job.OnOutput != nil {
+			job.OnOutput(line)
+		}
 	}
 
-	if e = cmd.Wait(); nil != e {
-		io.WriteString(out, "run failed, "+e.Error()+"\r\n")
-	} else if nil != cmd.ProcessState {
-		io.WriteString(out, "run ok, exit with "+cmd.ProcessState.String()+".\r\n")
+	// 用 os.Pipe 而不是 cmd.StdoutPipe, 这样 Wait 不用等待输出读完
+	var readers sync.WaitGroup
+	var closers []io.Closer
+	var readFiles []*os.File
+	for _, stream := range []string{"stdout", "stderr"} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, &RunError{Path: executePath, Op: "start", ExitCode: -1, Err: err}
+		}
+		if stream == "stdout" {
+			cmd.Stdout = w
+		} else {
+			cmd.Stderr = w
+		}
+		closers = append(closers, w)
+		readFiles = append(readFiles, r)
+
+		readers.Add(1)
+		go func(stream string, r *os.File) {
+			defer readers.Done()
+			defer r.Close()
+			readLines(r, stream, emit)
+		}(stream, r)
+	}
+
+	result := &Result{StartAt: time.Now(), ExitCode: -1}
+	e = cmd.Start()
+	for _, c := range closers {
+		c.Close()
+	}
+	if nil != e {
+		waitReaders(&readers, readFiles)
+		if out != nil {
+			io.WriteString(out, "start failed, "+e.Error()+"\r\n")
+		}
+		return nil, &RunError{Path: executePath, Op: "start", ExitCode: -1, Err: e}
+	}
+	result.Pid = cmd.Process.Pid
+
+	// killedBy 只在下面的 goroutine 中写，等它退出(watched 关闭)后才读，不能用 mu 保护它,
+	// 否则 OnOutput 阻塞时进程组不会被杀掉
+	var killedBy string
+	// exited 在 Wait 返回后设置，不能在其它 goroutine 中读 cmd.ProcessState, Wait 会写它
+	var exited int32
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+
+		var timeout <-chan time.Time
+		if job.Timeout > 0 {
+			timer := time.NewTimer(job.Timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		reason := ""
+		select {
+		case <-done:
+			return
+		case <-timeout:
+			reason = "timeout"
+		case <-ctx.Done():
+			reason = "cancel"
+		}
+		killProcessGroup(cmd, atomic.LoadInt32(&exited) == 1)
+		killedBy = reason
+	}()
+
+	e = cmd.Wait()
+	atomic.StoreInt32(&exited, 1)
+	close(done)
+	<-watched
+	op := killedBy
+	if op != "" {
+		// 杀掉进程组时命令可能正在创建子进程，再杀一次残留的进程
+		killProcessGroup(cmd, true)
+	}
+	waitReaders(&readers, readFiles)
+
+	result.EndAt = time.Now()
+	if state := cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		result.UserTime = state.UserTime()
+		result.SystemTime = state.SystemTime()
+		result.MaxRSS = maxRSS(state)
+	}
+
+	if out != nil {
+		if nil != e {
+			io.WriteString(out, "run failed, "+e.Error()+"\r\n")
+		} else if nil != cmd.ProcessState {
+			io.WriteString(out, "run ok, exit with "+cmd.ProcessState.String()+".\r\n")
+		}
+	}
+	if op != "" {
+		return result, &RunError{Path: executePath, Op: op, ExitCode: result.ExitCode, Err: e}
+	}
+	if e != nil {
+		return result, &RunError{Path: executePath, Op: "exit", ExitCode: result.ExitCode, Err: e}
+	}
+	return result, nil
+}
+
+// waitReaders 等待输出读完，超过 OutputDrainTimeout 后关闭管道，使读取的 goroutine 退出
+func waitReaders(readers *sync.WaitGroup, files []*os.File) {
+	finished := make(chan struct{})
+	go func() {
+		readers.Wait()
+		close(finished)
+	}()
+
+	timer := time.NewTimer(OutputDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		return
+	case <-timer.C:
+	}
+
+	for _, f := range files {
+		f.Close()
+	}
+	// 有的系统上关闭管道不能中断正在进行的读操作，这时不再等待它们
+	timer.Reset(time.Second)
+	select {
+	case <-finished:
+	case <-timer.C:
+	}
+}
+
+// readLines 逐行读取输出，过长的行会被分成多行
+func readLines(r io.Reader, stream string, emit func(OutputLine)) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			emit(OutputLine{Stream: stream, Text: strings.TrimRight(string(line), "\r\n"), Time: time.Now()})
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
 	}
-	return nil
 }
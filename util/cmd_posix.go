@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd, exited bool) {
+	if cmd.Process == nil {
+		return
+	}
+	// 进程组 id 和命令的 pid 相同，超时或取消时命令可能已退出，但进程组中还有残留的进程，所以 exited 时也要杀掉
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return 0
+	}
+	// darwin 下的单位是字节，其它系统是 KB
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+	return int64(rusage.Maxrss) * 1024
+}
@@ -0,0 +1,223 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCommandOutput(t *testing.T) {
+	var lines []OutputLine
+	job := &Command{
+		Execute:   "sh",
+		Arguments: []string{"-c", "echo a; echo b 1>&2; printf c"},
+		OnOutput:  func(line OutputLine) { lines = append(lines, line) },
+	}
+	result, err := job.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || result.Pid == 0 || result.EndAt.Before(result.StartAt) {
+		t.Error("result is", *result)
+	}
+
+	var stdout, stderr []string
+	for _, line := range lines {
+		if line.Stream == "stdout" {
+			stdout = append(stdout, line.Text)
+		} else {
+			stderr = append(stderr, line.Text)
+		}
+	}
+	if strings.Join(stdout, ",") != "a,c" {
+		t.Error("stdout is", stdout)
+	}
+	if strings.Join(stderr, ",") != "b" {
+		t.Error("stderr is", stderr)
+	}
+}
+
+func TestCommandFailure(t *testing.T) {
+	job := &Command{Execute: "sh", Arguments: []string{"-c", "exit 3"}}
+	result, err := job.RunOnce(context.Background())
+	if err == nil {
+		t.Fatal("excepted error is not nil")
+	}
+	if e, ok := err.(*RunError); !ok || e.Op != "exit" || e.ExitCode != 3 {
+		t.Error("error is", err)
+	}
+	if result == nil || result.ExitCode != 3 {
+		t.Error("result is", result)
+	}
+
+	job = &Command{Execute: "not_exists_command_for_test"}
+	err = job.Run(context.Background())
+	if e, ok := err.(*RunError); !ok || e.Op != "start" {
+		t.Error("error is", err)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	var pid int
+	job := &Command{
+		Execute:   "sh",
+		Arguments: []string{"-c", "sleep 30 & echo $!; wait"},
+		Timeout:   200 * time.Millisecond,
+		OnOutput: func(line OutputLine) {
+			pid, _ = strconv.Atoi(line.Text)
+		},
+	}
+	startAt := time.Now()
+	_, err := job.RunOnce(context.Background())
+	if e, ok := err.(*RunError); !ok || e.Op != "timeout" {
+		t.Fatal("error is", err)
+	}
+	if time.Since(startAt) > 5*time.Second {
+		t.Error("timeout isn't work")
+	}
+
+	// 子进程也要被杀掉，它可能还没有被回收，是一个僵尸进程
+	if pid == 0 {
+		t.Fatal("pid of child is missing")
+	}
+	bs, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err == nil && !strings.Contains(string(bs), ") Z ") {
+		t.Error("child process is still running,", string(bs))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	job = &Command{Execute: "sh", Arguments: []string{"-c", "sleep 30"}}
+	err = job.Run(ctx)
+	if e, ok := err.(*RunError); !ok || e.Op != "cancel" {
+		t.Error("error is", err)
+	}
+}
+
+func TestCommandTimeoutWhileOutputBlocked(t *testing.T) {
+	old := OutputDrainTimeout
+	OutputDrainTimeout = 100 * time.Millisecond
+	defer func() { OutputDrainTimeout = old }()
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	job := &Command{
+		Execute:   "sh",
+		Arguments: []string{"-c", "echo a; echo b 1>&2; sleep 30"},
+		Timeout:   200 * time.Millisecond,
+		OnOutput:  func(line OutputLine) { <-unblock },
+	}
+	startAt := time.Now()
+	_, err := job.RunOnce(context.Background())
+	if e, ok := err.(*RunError); !ok || e.Op != "timeout" {
+		t.Error("error is", err)
+	}
+	if time.Since(startAt) > 5*time.Second {
+		t.Error("timeout isn't work while OnOutput is blocked")
+	}
+}
+
+func TestCommandKeepBackgroundProcess(t *testing.T) {
+	var pid int
+	job := &Command{
+		Execute:   "sh",
+		Arguments: []string{"-c", "sleep 30 >/dev/null 2>&1 & echo $!"},
+		OnOutput: func(line OutputLine) {
+			pid, _ = strconv.Atoi(line.Text)
+		},
+	}
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pid == 0 {
+		t.Fatal("pid of child is missing")
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	// 命令正常退出后，它在后台启动的进程仍在运行
+	if err := syscall.Kill(pid, 0); err != nil {
+		t.Error("background process is killed,", err)
+	}
+}
+
+func TestCommandRestart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	count := 0
+	job := &Command{
+		Execute:   "sh",
+		Arguments: []string{"-c", "echo run; exit 1"},
+		Logfile:   filepath.Join(tmp, "job.log"),
+		OnOutput:  func(line OutputLine) { count++ },
+		Restart: RestartPolicy{
+			Mode:        RESTART_ON_FAILURE,
+			MaxRestarts: 2,
+			Delay:       10 * time.Millisecond,
+		},
+	}
+	result, err := job.Supervise(context.Background())
+	if err == nil {
+		t.Error("excepted error is not nil")
+	}
+	if result == nil || result.Restarts != 2 {
+		t.Error("result is", result)
+	}
+	if count != 3 {
+		t.Error("excepted run 3 times, actual is", count)
+	}
+
+	bs, err := ioutil.ReadFile(job.Logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(bs), "=============== begin ==============="); n != 3 {
+		t.Error("excepted 3 begin in log file, actual is", n)
+	}
+	if !strings.Contains(string(bs), "run\r\n") {
+		t.Error("output isn't in the log file,", string(bs))
+	}
+
+	job.Arguments = []string{"-c", "exit 0"}
+	job.Restart.Mode = RESTART_ON_FAILURE
+	result, err = job.Supervise(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
+	if result.Restarts != 0 {
+		t.Error("restarts is", result.Restarts)
+	}
+}
+
+func TestCommandOutputInherited(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid isn't found")
+	}
+
+	old := OutputDrainTimeout
+	OutputDrainTimeout = 100 * time.Millisecond
+	defer func() { OutputDrainTimeout = old }()
+
+	// 孙进程脱离了进程组，不会被杀掉，但它继承了输出管道
+	job := &Command{Execute: "sh", Arguments: []string{"-c", "setsid sleep 3 & echo ok"}}
+	startAt := time.Now()
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(startAt) > 2*time.Second {
+		t.Error("wait for output of grandchild")
+	}
+}
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+func killProcessGroup(cmd *exec.Cmd, exited bool) {
+	// windows 下没有进程组的信号，用 taskkill 杀掉整个进程树，进程退出后就找不到它的子进程了
+	if cmd.Process == nil || exited {
+		return
+	}
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -151,6 +151,12 @@ func (p *LineParser) Scan(skipEmptyLine ...bool) bool {
 	return hasNext
 }
 
+// Undo 回退一行，下次 Scan 时仍然返回当前行
+func (p *LineParser) Undo() {
+	p.scanner.Undo()
+	p.lineNumber--
+}
+
 func (s *LineParser) LineNumber() int {
 	return s.lineNumber
 }
@@ -371,7 +377,6 @@ func (s *Parser) ExceptDate(nm string, layout string, layouts ...string) *Parser
 			if c := 3 - (end-start-1)%3; c > 0 {
 				str2 = str2[:end] + strings.Repeat("0", c) + str2[end:]
 			}
-			fmt.Println("==============", str2)
 		}
 	} else {
 		if strings.HasSuffix(str, ")") {
@@ -391,7 +396,6 @@ func (s *Parser) ExceptDate(nm string, layout string, layouts ...string) *Parser
 			if c := 3 - (end-start-1)%3; c > 0 {
 				str = str[:end] + strings.Repeat("0", c) + str[end:]
 			}
-			fmt.Println("==============", str)
 		}
 	}
 
@@ -405,7 +409,9 @@ func (s *Parser) ExceptDate(nm string, layout string, layouts ...string) *Parser
 		t, err := time.Parse(layout, str)
 		if err == nil {
 			s.value[nm] = t
-			s.Scanner.Undo()
+			if has2 {
+				s.Scanner.Undo()
+			}
 			return s
 		}
 
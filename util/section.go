@@ -46,6 +46,7 @@ func (p *SectionParser) Lines() Lines {
 type Lines struct {
 	parser  *LineParser
 	isFirst bool
+	isEnd   bool
 }
 
 func (p *Lines) Scan() bool {
@@ -53,17 +54,23 @@ func (p *Lines) Scan() bool {
 		p.isFirst = false
 		return true
 	}
+	if p.isEnd {
+		return false
+	}
 
 	if !p.parser.Scan() {
+		p.isEnd = true
 		return false
 	}
 	bs := p.parser.Bytes()
 	if len(bs) == 0 {
+		p.isEnd = true
 		return false
 	}
 
 	bs = bytes.TrimSpace(bs)
 	if len(bs) == 0 {
+		p.isEnd = true
 		return false
 	}
 	return true
@@ -0,0 +1,525 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template 解析命令输出的模板，它被编译成 LineParser, SectionParser 和 Parser 的调用,
+// 模板的格式如下:
+//
+//	# 注释
+//	line     Interface Status MTU
+//	record   interfaces {
+//	  line     ${name} ${status} ${mtu:int}
+//	  optional description ${description:rest}
+//	}
+//	section  routes {
+//	  line     route ${dest} via ${gateway}
+//	  line     age ${age:int:time} [since] ${since:date:2006-01-02|2006/01/02}
+//	}
+//
+// 规则有下列几种:
+//
+//	line PATTERN       下一个非空行必须匹配 PATTERN
+//	optional PATTERN   下一个非空行匹配 PATTERN 时读取它，否则跳过本规则
+//	record NAME { }    重复读取块中的规则，每次得到一条记录，直到块中的第一行不匹配为止
+//	section NAME { }   和 record 一样，但每条记录是以空行分隔的一段，段中的行必须全部匹配
+//
+// PATTERN 由空格分隔的词组成，普通的词必须和输入相同 (不区分大小写), [word] 表示可选的词,
+// ${name:type:arg} 读取一个值，name 为 _ 时丢弃它，type 可以是
+//
+//	string            缺省值，一个词
+//	int, float        数字，arg 可以是 time 或 bytes, 表示数字后面跟一个单位，如 10 ms 或 2 KB
+//	date              日期，arg 是用 | 分隔的格式
+//	rest              一行中余下的全部内容，它必须是最后一个
+type Template struct {
+	Name  string
+	rules []*templateRule
+}
+
+const (
+	ruleLine = iota
+	ruleOptional
+	ruleRecord
+	ruleSection
+)
+
+type templateRule struct {
+	kind     int
+	name     string
+	line     int
+	text     string
+	words    []func(*Parser) *Parser
+	hasRest  bool
+	children []*templateRule
+}
+
+// TemplateError 模板执行失败时的错误，它包含了模板和输入中的位置
+type TemplateError struct {
+	Template     string
+	TemplateLine int
+	Rule         string
+	LineNumber   int
+	Line         string
+	Err          error
+}
+
+func (e *TemplateError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("template '")
+	sb.WriteString(e.Template)
+	sb.WriteString("'")
+	if e.TemplateLine > 0 {
+		sb.WriteString(" at line ")
+		sb.WriteString(strconv.Itoa(e.TemplateLine))
+	}
+	if e.Rule != "" {
+		sb.WriteString(" '")
+		sb.WriteString(e.Rule)
+		sb.WriteString("'")
+	}
+	sb.WriteString(" is mismatched with line ")
+	sb.WriteString(strconv.Itoa(e.LineNumber))
+	if e.Line != "" {
+		sb.WriteString(" '")
+		sb.WriteString(e.Line)
+		sb.WriteString("'")
+	}
+	if e.Err != nil {
+		sb.WriteString(", ")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+// LoadTemplate 从文件中读取模板，模板的名称为不含扩展名的文件名
+func LoadTemplate(filename string) (*Template, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.New("read file '" + filename + "' failed, " + err.Error())
+	}
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	return ParseTemplate(name, string(bs))
+}
+
+// ParseTemplate 编译模板
+func ParseTemplate(name, text string) (*Template, error) {
+	errorf := func(lineNumber int, msg string) error {
+		return errors.New("template '" + name + "' line " + strconv.Itoa(lineNumber) + " is invalid, " + msg)
+	}
+
+	root := &templateRule{kind: ruleRecord, name: name}
+	stack := []*templateRule{root}
+	for idx, s := range strings.Split(text, "\n") {
+		lineNumber := idx + 1
+		s = strings.TrimSpace(s)
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		parent := stack[len(stack)-1]
+		if s == "}" {
+			if len(stack) == 1 {
+				return nil, errorf(lineNumber, "unexpected '}'")
+			}
+			if err := checkBlock(parent); err != nil {
+				return nil, errorf(parent.line, err.Error())
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		keyword, pattern := s, ""
+		if idx := strings.IndexAny(s, " \t"); idx > 0 {
+			keyword, pattern = s[:idx], strings.TrimSpace(s[idx+1:])
+		}
+
+		rule := &templateRule{line: lineNumber, text: s}
+		switch keyword {
+		case "line", "optional":
+			rule.kind = ruleLine
+			if keyword == "optional" {
+				rule.kind = ruleOptional
+			}
+			if pattern == "" {
+				return nil, errorf(lineNumber, "pattern is missing")
+			}
+			words, hasRest, err := compilePattern(pattern)
+			if err != nil {
+				return nil, errorf(lineNumber, err.Error())
+			}
+			rule.words, rule.hasRest = words, hasRest
+		case "record", "section":
+			rule.kind = ruleRecord
+			if keyword == "section" {
+				rule.kind = ruleSection
+			}
+			if !strings.HasSuffix(pattern, "{") {
+				return nil, errorf(lineNumber, "'{' is missing")
+			}
+			rule.name = strings.TrimSpace(strings.TrimSuffix(pattern, "{"))
+			if rule.name == "" || strings.ContainsAny(rule.name, " \t") {
+				return nil, errorf(lineNumber, "name '"+rule.name+"' is invalid")
+			}
+			stack = append(stack, rule)
+		default:
+			return nil, errorf(lineNumber, "'"+keyword+"' is unsupported, it must is 'line', 'optional', 'record' or 'section'")
+		}
+		parent.children = append(parent.children, rule)
+	}
+
+	if len(stack) > 1 {
+		return nil, errorf(stack[len(stack)-1].line, "'}' is missing")
+	}
+	return &Template{Name: name, rules: root.children}, nil
+}
+
+func checkBlock(block *templateRule) error {
+	if len(block.children) == 0 {
+		return errors.New("'" + block.name + "' is empty")
+	}
+	if block.children[0].kind != ruleLine {
+		return errors.New("first rule of '" + block.name + "' must is 'line'")
+	}
+	return nil
+}
+
+// splitPattern 按空格分隔，但 ${...} 中可以有空格
+func splitPattern(pattern string) ([]string, error) {
+	var words []string
+	for {
+		pattern = strings.TrimLeft(pattern, " \t")
+		if pattern == "" {
+			return words, nil
+		}
+
+		if strings.HasPrefix(pattern, "${") {
+			end := strings.IndexByte(pattern, '}')
+			if end < 0 {
+				return nil, errors.New("'" + pattern + "' isn't closed")
+			}
+			words = append(words, pattern[:end+1])
+			pattern = pattern[end+1:]
+			continue
+		}
+
+		end := strings.IndexAny(pattern, " \t")
+		if end < 0 {
+			end = len(pattern)
+		}
+		words = append(words, pattern[:end])
+		pattern = pattern[end:]
+	}
+}
+
+func compilePattern(pattern string) ([]func(*Parser) *Parser, bool, error) {
+	words, err := splitPattern(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var funcs []func(*Parser) *Parser
+	for idx, word := range words {
+		if !strings.HasPrefix(word, "${") {
+			literal := []byte(strings.ToLower(word))
+			if len(literal) > 2 && strings.HasPrefix(word, "[") && strings.HasSuffix(word, "]") {
+				literal = literal[1 : len(literal)-1]
+				// 不用 ExceptOptional, 因为它在行尾时会出错
+				funcs = append(funcs, func(p *Parser) *Parser {
+					if p.Scanner.Scan() && !bytes.Equal(literal, bytes.ToLower(p.Scanner.Bytes())) {
+						p.Scanner.Undo()
+					}
+					return p
+				})
+			} else {
+				funcs = append(funcs, func(p *Parser) *Parser {
+					return p.Except(literal)
+				})
+			}
+			continue
+		}
+
+		ss := strings.SplitN(word[2:len(word)-1], ":", 3)
+		name := strings.TrimSpace(ss[0])
+		if name == "" {
+			return nil, false, errors.New("name of '" + word + "' is missing")
+		}
+		typ, arg := "string", ""
+		if len(ss) > 1 {
+			typ = strings.TrimSpace(ss[1])
+		}
+		if len(ss) > 2 {
+			arg = strings.TrimSpace(ss[2])
+		}
+
+		var unit func(s *Parser, value interface{}) (interface{}, error)
+		switch typ {
+		case "int", "float":
+			switch arg {
+			case "":
+			case "time":
+				unit = TimeUnit
+			case "bytes":
+				unit = BytesUnit
+			default:
+				return nil, false, errors.New("unit '" + arg + "' of '" + word + "' is unsupported, it must is 'time' or 'bytes'")
+			}
+		case "date":
+			if arg == "" {
+				return nil, false, errors.New("layout of '" + word + "' is missing")
+			}
+		default:
+			if arg != "" {
+				return nil, false, errors.New("'" + word + "' is invalid, type '" + typ + "' hasn't any argument")
+			}
+		}
+
+		switch typ {
+		case "string":
+			funcs = append(funcs, func(p *Parser) *Parser {
+				return p.ExceptString(name)
+			})
+		case "int":
+			if unit != nil {
+				funcs = append(funcs, func(p *Parser) *Parser {
+					return p.ExceptIntWithUnit(name, unit)
+				})
+			} else {
+				funcs = append(funcs, func(p *Parser) *Parser {
+					return p.ExceptInt(name)
+				})
+			}
+		case "float":
+			if unit != nil {
+				funcs = append(funcs, func(p *Parser) *Parser {
+					return p.ExceptFloatWithUnit(name, unit)
+				})
+			} else {
+				funcs = append(funcs, func(p *Parser) *Parser {
+					return p.ExceptFloat(name)
+				})
+			}
+		case "date":
+			layouts := strings.Split(arg, "|")
+			funcs = append(funcs, func(p *Parser) *Parser {
+				return p.ExceptDate(name, layouts[0], layouts[1:]...)
+			})
+		case "rest":
+			if idx != len(words)-1 {
+				return nil, false, errors.New("'" + word + "' must is last")
+			}
+			funcs = append(funcs, func(p *Parser) *Parser {
+				return p.ExceptToEnd(name)
+			})
+			return funcs, true, nil
+		default:
+			return nil, false, errors.New("type '" + typ + "' of '" + word + "' is unsupported")
+		}
+	}
+	return funcs, false, nil
+}
+
+type lineSource interface {
+	Scan() bool
+}
+
+type nonEmptyLines struct {
+	parser *LineParser
+}
+
+func (l nonEmptyLines) Scan() bool {
+	return l.parser.Scan(true)
+}
+
+// Execute 用模板解析 bs, 返回的结果中 record 和 section 的值为 []map[string]interface{}
+func (t *Template) Execute(bs []byte) (map[string]interface{}, error) {
+	parser := NewLineParser(NewScanner(bs))
+	value := map[string]interface{}{}
+	if err := t.execRules(parser, nonEmptyLines{parser}, t.rules, value); err != nil {
+		return nil, err
+	}
+	if parser.Scan(true) {
+		return nil, t.newError(nil, parser, errors.New("unexpected line"))
+	}
+	if err := parser.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (t *Template) newError(rule *templateRule, parser *LineParser, err error) error {
+	e := &TemplateError{
+		Template:   t.Name,
+		LineNumber: parser.LineNumber(),
+		Line:       strings.TrimSpace(parser.Text()),
+		Err:        err,
+	}
+	if rule != nil {
+		e.TemplateLine, e.Rule = rule.line, rule.text
+	}
+	return e
+}
+
+func (t *Template) execRules(parser *LineParser, lines lineSource, rules []*templateRule, value map[string]interface{}) error {
+	for _, rule := range rules {
+		switch rule.kind {
+		case ruleLine, ruleOptional:
+			if !lines.Scan() {
+				if rule.kind == ruleOptional {
+					continue
+				}
+				return &TemplateError{Template: t.Name, TemplateLine: rule.line, Rule: rule.text,
+					LineNumber: parser.LineNumber(), Err: io.ErrUnexpectedEOF}
+			}
+			if err := rule.match(parser, value); err != nil {
+				if rule.kind == ruleOptional {
+					parser.Undo()
+					continue
+				}
+				return t.newError(rule, parser, err)
+			}
+		case ruleRecord:
+			records := []map[string]interface{}{}
+			for lines.Scan() {
+				record := map[string]interface{}{}
+				if err := rule.children[0].match(parser, record); err != nil {
+					parser.Undo()
+					break
+				}
+				if err := t.execRules(parser, lines, rule.children[1:], record); err != nil {
+					return err
+				}
+				records = append(records, record)
+			}
+			value[rule.name] = records
+		case ruleSection:
+			records := []map[string]interface{}{}
+			sections := NewSectionParser(parser)
+			for sections.Scan() {
+				record := map[string]interface{}{}
+				if err := rule.children[0].match(parser, record); err != nil {
+					parser.Undo()
+					break
+				}
+				sectionLines := sections.Lines()
+				sectionLines.Scan()
+				if err := t.execRules(parser, &sectionLines, rule.children[1:], record); err != nil {
+					return err
+				}
+				if sectionLines.Scan() {
+					return t.newError(rule, parser, errors.New("unexpected line in the section"))
+				}
+				records = append(records, record)
+			}
+			value[rule.name] = records
+		}
+	}
+	return nil
+}
+
+// match 用规则解析当前行，成功时才将值复制到 value 中
+func (r *templateRule) match(parser *LineParser, value map[string]interface{}) error {
+	values := map[string]interface{}{}
+	p := parser.NewParser(values)
+	for _, word := range r.words {
+		if err := word(p).Err(); err != nil {
+			return err
+		}
+	}
+	if !r.hasRest && p.Scanner.Scan() {
+		return &ErrExcept{LineNumber: p.LineNumber,
+			Offset:   p.Scanner.Offset,
+			Excepted: []byte("end of line"),
+			Actual:   p.Scanner.Bytes()}
+	}
+
+	delete(values, "_")
+	for k, v := range values {
+		value[k] = v
+	}
+	return nil
+}
+
+// RunTemplateTest 用模板解析 input, 并和 excepted 中的 json 比较
+func RunTemplateTest(t *Template, input, excepted []byte) error {
+	value, err := t.Execute(input)
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var actualValue, exceptedValue interface{}
+	if err := json.Unmarshal(bs, &actualValue); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(excepted, &exceptedValue); err != nil {
+		return errors.New("excepted json is invalid, " + err.Error())
+	}
+	if !reflect.DeepEqual(actualValue, exceptedValue) {
+		actual, _ := json.MarshalIndent(actualValue, "", "  ")
+		return errors.New("result of template '" + t.Name + "' is mismatched, excepted is\r\n" +
+			string(bytes.TrimSpace(excepted)) + "\r\nactual is\r\n" + string(actual))
+	}
+	return nil
+}
+
+// RunTemplateTests 测试目录中的所有模板，模板 NAME.tpl 的样例为 NAME.*.txt, 对应的结果为 NAME.*.json
+func RunTemplateTests(dir string) error {
+	templates, err := filepath.Glob(filepath.Join(dir, "*.tpl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(templates)
+
+	var errList []string
+	for _, filename := range templates {
+		t, err := LoadTemplate(filename)
+		if err != nil {
+			errList = append(errList, err.Error())
+			continue
+		}
+
+		samples, err := filepath.Glob(filepath.Join(dir, t.Name+".*.txt"))
+		if err != nil {
+			return err
+		}
+		if len(samples) == 0 {
+			errList = append(errList, "samples of template '"+t.Name+"' is not found.")
+			continue
+		}
+		sort.Strings(samples)
+		for _, sample := range samples {
+			input, err := ioutil.ReadFile(sample)
+			if err != nil {
+				errList = append(errList, "read file '"+sample+"' failed, "+err.Error())
+				continue
+			}
+			jsonFile := strings.TrimSuffix(sample, ".txt") + ".json"
+			excepted, err := ioutil.ReadFile(jsonFile)
+			if err != nil {
+				errList = append(errList, "read file '"+jsonFile+"' failed, "+err.Error())
+				continue
+			}
+			if err := RunTemplateTest(t, input, excepted); err != nil {
+				errList = append(errList, filepath.Base(sample)+": "+err.Error())
+			}
+		}
+	}
+
+	if len(errList) > 0 {
+		return errors.New(strings.Join(errList, "\r\n"))
+	}
+	return nil
+}
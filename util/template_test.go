@@ -0,0 +1,63 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	if err := RunTemplateTests("testdata/templates"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTemplateFailure(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		excepted string
+	}{
+		{"match a", "line 1 is invalid, 'match' is unsupported"},
+		{"line", "line 1 is invalid, pattern is missing"},
+		{"line a ${b", "'${b' isn't closed"},
+		{"line ${b:int:km}", "unit 'km' of '${b:int:km}' is unsupported"},
+		{"line ${b:bool}", "type 'bool' of '${b:bool}' is unsupported"},
+		{"line ${b:rest} c", "'${b:rest}' must is last"},
+		{"record a {\n  optional b\n}", "line 1 is invalid, first rule of 'a' must is 'line'"},
+		{"record a {\n  line b", "line 1 is invalid, '}' is missing"},
+		{"line a\n}", "line 2 is invalid, unexpected '}'"},
+	} {
+		_, err := ParseTemplate("test", test.text)
+		if err == nil {
+			t.Error(test.text, "excepted error is not nil")
+			continue
+		}
+		if !strings.Contains(err.Error(), test.excepted) {
+			t.Error(test.text, "excepted error contains", test.excepted)
+			t.Error("actual is", err)
+		}
+	}
+
+	tpl, err := ParseTemplate("test", "line name ${name}\nrecord items {\n  line item ${id:int}\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		input    string
+		excepted string
+	}{
+		{"name a b", "template 'test' at line 1 'line name ${name}' is mismatched with line 1 'name a b', want read 'end of line'"},
+		{"name a\nitem x", "template 'test' is mismatched with line 2 'item x', unexpected line"},
+		{"\nname a\nitem 1\nitem 2\nother", "template 'test' is mismatched with line 5 'other', unexpected line"},
+		{"", "template 'test' at line 1 'line name ${name}' is mismatched with line 0, unexpected EOF"},
+	} {
+		_, err := tpl.Execute([]byte(test.input))
+		if err == nil {
+			t.Error(test.input, "excepted error is not nil")
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.excepted) {
+			t.Error(test.input, "excepted error is", test.excepted)
+			t.Error("actual is", err)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+# show interfaces brief
+line Interface Status MTU Speed
+record interfaces {
+  line     ${name} ${status} ${mtu:int} ${speed:int:bytes}
+  optional description ${description:rest}
+}
+line total ${count:int} [interfaces]
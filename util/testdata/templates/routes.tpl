@@ -0,0 +1,6 @@
+# 每个路由是以空行分隔的一段
+section routes {
+  line     route ${dest} via ${gateway}
+  optional metric ${metric:int}
+  line     age ${age:int:time} since ${since:date:2006-01-02|2006/01/02}
+}
@@ -1,6 +1,7 @@
 package weaver
 
 import (
+	"context"
 	"io"
 	"sync"
 	"sync/atomic"
@@ -11,6 +12,8 @@ import (
 	"github.com/three-plus-three/modules/concurrency"
 	"github.com/three-plus-three/modules/environment"
 	"github.com/three-plus-three/modules/hub"
+	"github.com/three-plus-three/modules/logext"
+	"github.com/three-plus-three/modules/tracing"
 )
 
 // ValueType 用于泛型替换的类型
@@ -130,38 +133,55 @@ func (srv *apartClient) Read() (ValueType, error) {
 		}
 	}
 
-	value, err := srv.read()
+	value, err := srv.read(context.Background())
 	srv.save(value, err)
 	return value, err
 }
 
-func (srv *apartClient) read() (ValueType, error) {
+func (srv *apartClient) read(ctx context.Context) (ValueType, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "weaver.read",
+		tracing.WithTag("queue", srv.queueName))
+	defer span.Finish()
+
 	var value ValueType
 	err := srv.wsrv.Resty().New(srv.urlPath).
 		SetParam("app", srv.appSrv.Name).
 		Result(&value).
-		GET(nil)
+		GET(ctx)
+	if err != nil {
+		span.SetError(err)
+	}
 	return value, err
 }
 
-func (srv *apartClient) write() (bool, error) {
+func (srv *apartClient) write(ctx context.Context) (bool, error) {
+	span, ctx := tracing.StartSpanFromContext(ctx, "weaver.write",
+		tracing.WithTag("queue", srv.queueName))
+	defer span.Finish()
+
 	value, err := srv.cb()
 	if err != nil {
+		span.SetError(err)
 		return false, err
 	}
 	o := srv.cached.Load()
 	if o != nil {
 		if result, ok := o.(*apartResult); ok {
 			if isSame(result.value, value) {
+				span.SetTag("skipped", true)
 				return true, nil
 			}
 		}
 	}
 
-	return false, srv.wsrv.Resty().New(srv.urlPath).
+	err = srv.wsrv.Resty().New(srv.urlPath).
 		SetParam("app", srv.appSrv.Name).
 		SetBody(value).
-		POST(nil)
+		POST(ctx)
+	if err != nil {
+		span.SetError(err)
+	}
+	return false, err
 }
 
 func (srv *apartClient) WhenChanged(cb func()) {
@@ -212,7 +232,13 @@ func (srv *apartClient) runSub() {
 
 		errCount = 0
 		err = topic.Run(func(sub *hub.Subscription, msg hub.Message) {
-			value, err := srv.read()
+			span, ctx := hub.StartConsumeSpan(context.Background(), "weaver.changed", msg)
+			value, err := srv.read(ctx)
+			if err != nil {
+				span.SetError(err)
+				logext.For(ctx, srv.logger).Error("read value fail", log.Error(err))
+			}
+			span.Finish()
 			srv.save(value, err)
 		})
 		if err != nil {
@@ -238,22 +264,27 @@ func (srv *apartClient) run() {
 	writed := false
 
 	flush := func() {
-		if skipped, err := srv.write(); err != nil {
-			srv.logger.Error("write value fail", log.Error(err))
+		span, ctx := tracing.StartSpanFromContext(context.Background(), "weaver.flush",
+			tracing.WithTag("queue", srv.queueName))
+		defer span.Finish()
+		logger := logext.For(ctx, srv.logger)
+
+		if skipped, err := srv.write(ctx); err != nil {
+			logger.Error("write value fail", log.Error(err))
 			writed = false
 		} else {
 			writed = true
 			if skipped {
-				srv.logger.Warn("write value is skipped", log.Error(err))
+				logger.Warn("write value is skipped", log.Error(err))
 			} else {
-				srv.logger.Info("write value is ok", log.Error(err))
+				logger.Info("write value is ok", log.Error(err))
 			}
 		}
 
-		value, err := srv.read()
+		value, err := srv.read(ctx)
 		srv.save(value, err)
 		if err != nil {
-			srv.logger.Error("read value fail", log.Error(err))
+			logger.Error("read value fail", log.Error(err))
 			writed = false
 		}
 
@@ -1,6 +1,7 @@
 package weaver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"github.com/cheekybits/genny/generic"
 	"github.com/runner-mei/log"
 	"github.com/three-plus-three/modules/environment"
+	"github.com/three-plus-three/modules/tracing"
 )
 
 // WeaveType 用于泛型替换的类型
@@ -23,6 +25,12 @@ type Weaver interface {
 	Stats() interface{}
 }
 
+// ContextUpdater 是 Weaver 的可选接口，实现了它的 Weaver 更新时调用 UpdateWithContext，
+// ctx 中包含请求的 span，用于在变更事件中传递跟踪的上下文
+type ContextUpdater interface {
+	UpdateWithContext(ctx context.Context, group string, value WeaveType) error
+}
+
 // Server 菜单的服备
 type Server struct {
 	env        *environment.Environment
@@ -43,9 +51,13 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			srv.stats(w, r)
 			return
 		}
-		srv.read(w, r)
+		span, ctx := tracing.StartServerSpan(r, "weaver.generate")
+		defer span.Finish()
+		srv.read(w, r.WithContext(ctx))
 	case "PUT", "POST":
-		srv.write(w, r)
+		span, ctx := tracing.StartServerSpan(r, "weaver.update")
+		defer span.Finish()
+		srv.write(w, r.WithContext(ctx))
 	default:
 		http.NotFound(w, r)
 	}
@@ -131,8 +143,13 @@ func (srv *Server) write(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = srv.weaver.Update(group, data)
+	if updater, ok := srv.weaver.(ContextUpdater); ok {
+		err = updater.UpdateWithContext(r.Context(), group, data)
+	} else {
+		err = srv.weaver.Update(group, data)
+	}
 	if err != nil {
+		tracing.SpanFromContext(r.Context()).SetError(err)
 		srv.logger.Error("update fail", log.String("group", group), log.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
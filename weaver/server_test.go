@@ -1,8 +1,10 @@
 package weaver
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -11,6 +13,7 @@ import (
 	"github.com/runner-mei/log"
 	"github.com/three-plus-three/modules/environment"
 	"github.com/three-plus-three/modules/environment/env_tests"
+	"github.com/three-plus-three/modules/tracing"
 )
 
 // WeaveType 用于泛型替换的类型
@@ -35,6 +38,17 @@ func (w *testWeaver) Generate(ctx string) (WeaveType, error) {
 	return w.value, nil
 }
 
+// testContextWeaver 实现了 ContextUpdater
+type testContextWeaver struct {
+	testWeaver
+	ctx context.Context
+}
+
+func (w *testContextWeaver) UpdateWithContext(ctx context.Context, group string, value WeaveType) error {
+	w.ctx = ctx
+	return w.Update(group, value)
+}
+
 func TestServerSimple(t *testing.T) {
 	env := env_tests.Clone(nil)
 
@@ -68,3 +82,37 @@ func TestServerSimple(t *testing.T) {
 	}
 
 }
+
+func TestServerTracing(t *testing.T) {
+	tracer := tracing.NewMemoryTracer()
+	tracing.SetGlobalTracer(tracer)
+	defer tracing.SetGlobalTracer(nil)
+
+	w := &testContextWeaver{}
+	srv, err := NewServer(nil, w, log.Empty(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsrv := httptest.NewServer(srv)
+	defer hsrv.Close()
+
+	root, ctx := tracing.StartSpanFromContext(context.Background(), "root")
+	req, _ := http.NewRequest("POST", hsrv.URL+"?app=abc", strings.NewReader("12"))
+	resp, err := tracing.WrapClient(nil).Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	root.Finish()
+
+	if resp.StatusCode != http.StatusOK || w.group != "abc" {
+		t.Fatal(resp.Status, w.group)
+	}
+	updateSpan := tracer.FindSpan("weaver.update")
+	if updateSpan == nil || updateSpan.TraceID != tracer.FindSpan("root").TraceID {
+		t.Fatal("update span is", updateSpan)
+	}
+	if span, ok := tracing.SpanFromContext(w.ctx).(*tracing.MemorySpan); !ok || span != updateSpan {
+		t.Error("context of Update hasn't the update span")
+	}
+}
@@ -14,6 +14,7 @@ import (
 	gobatis "github.com/runner-mei/GoBatis"
 	"github.com/runner-mei/orm"
 	"github.com/three-plus-three/forms"
+	merrors "github.com/three-plus-three/modules/errors"
 	"github.com/three-plus-three/modules/functions"
 	"github.com/three-plus-three/modules/toolbox"
 	"github.com/three-plus-three/modules/types"
@@ -507,6 +508,10 @@ func ErrorToFlash(c *revel.Controller, err error, notFoundKey ...string) {
 			c.Flash.Error(revel.Message(c.Request.Locale, "update.record_not_found"))
 		}
 	} else {
+		if ce, ok := err.(merrors.ApplicationErrorConverter); ok {
+			err = ce.ToApplicationError()
+		}
+
 		if oerr, ok := err.(*orm.Error); ok && len(oerr.Validations) > 0 {
 			for _, validation := range oerr.Validations {
 				localeMessage := validation.Message
@@ -553,6 +558,22 @@ func ErrorToFlash(c *revel.Controller, err error, notFoundKey ...string) {
 			} else {
 				c.Flash.Error(err.Error())
 			}
+		} else if aerr, ok := err.(*merrors.ApplicationError); ok {
+			// 字段错误放到 Validation 中，错误码在目录中注册过时显示本地化的消息
+			for key, values := range aerr.Fields {
+				for _, value := range values {
+					c.Validation.Error(value).Key(key)
+				}
+			}
+			if len(aerr.Fields) > 0 {
+				c.Validation.Keep()
+			}
+
+			if localeMessage, found := merrors.LocalizedMessage(aerr.ErrorCode(), c.Request.Locale); found && localeMessage != "" {
+				c.Flash.Error(localeMessage)
+			} else {
+				c.Flash.Error(err.Error())
+			}
 		} else {
 			c.Flash.Error(err.Error())
 		}
@@ -40,6 +40,7 @@ func Init(env *environment.Environment, serviceID environment.ENV_PROXY_TYPE, pr
 		revel.FilterConfiguringFilter, // A hook for adding or removing per-Action filters.
 		revel.ParamsFilter,            // Parse parameters into Controller.Params.
 		SessionFilter,                 // Restore and write the session cookie.
+		LogFilter,                     // Prepare the context of the request logger.
 		revel.FlashFilter,             // Restore and write the flash cookie.
 		revel.ValidationFilter,        // Restore kept validation errors and save new ones from cookie.
 		revel.I18nFilter,              // Resolve the requested language
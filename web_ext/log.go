@@ -0,0 +1,64 @@
+package web_ext
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/revel/revel"
+	mylog "github.com/runner-mei/log"
+	"github.com/three-plus-three/modules/logext"
+)
+
+// LOG_CONTEXT_KEY 是 LogFilter 将请求的 context 保存在 revel.Controller.Args 中时用的键
+const LOG_CONTEXT_KEY = "logext.context"
+
+// LogFilter 为请求准备日志的 context，它从请求头中读取请求 ID，没有时生成一个，并将它写回到响应头中，
+// 它要放在 SessionFilter 的后面，以便读取当前用户
+func LogFilter(c *revel.Controller, fc []revel.Filter) {
+	id := c.Request.GetHttpHeader(logext.REQUEST_ID_HEADER)
+	if id == "" {
+		id = logext.GenerateRequestID()
+	}
+	c.Response.Out.Header().Set(logext.REQUEST_ID_HEADER, id)
+
+	ctx := logext.ContextWithRequestID(requestContext(c), id)
+	if lifecycleData != nil {
+		if lifecycleData.Env != nil {
+			ctx = logext.ContextWithService(ctx, lifecycleData.Env.Name)
+			if lifecycleData.Env.Logger != nil {
+				ctx = logext.ContextWithLogger(ctx, lifecycleData.Env.Logger)
+			}
+		}
+		if lifecycleData.CurrentUser != nil {
+			if u := lifecycleData.CurrentUser(c); u != nil {
+				ctx = logext.ContextWithUser(ctx, u)
+			}
+		}
+	}
+	c.Args[LOG_CONTEXT_KEY] = ctx
+
+	fc[0](c, fc[1:]) // Execute the next filter stage.
+}
+
+// requestContext 返回底层 HTTP 请求的 context，其中有 net/http 中间件放入的 span 等值
+func requestContext(c *revel.Controller) context.Context {
+	if c.Request != nil && c.Request.In != nil {
+		if r, ok := c.Request.In.GetRaw().(*http.Request); ok {
+			return r.Context()
+		}
+	}
+	return context.Background()
+}
+
+// ContextFromController 返回 LogFilter 为请求准备的 context，没有时返回请求的 context
+func ContextFromController(c *revel.Controller) context.Context {
+	if ctx, ok := c.Args[LOG_CONTEXT_KEY].(context.Context); ok {
+		return ctx
+	}
+	return requestContext(c)
+}
+
+// LoggerFromController 返回带有请求 ID、用户和服务名的 logger
+func LoggerFromController(c *revel.Controller) mylog.Logger {
+	return logext.For(ContextFromController(c), nil)
+}
@@ -42,12 +42,13 @@ func NewConfig(server, origin string) (config *Config, err error) {
 func NewClient(config *Config, rwc io.ReadWriteCloser) (ws *Conn, err error) {
 	br := bufio.NewReader(rwc)
 	bw := bufio.NewWriter(rwc)
-	err = hybiClientHandshake(config, br, bw)
+	compression, err := hybiClientHandshakeWithExtensions(config, br, bw)
 	if err != nil {
 		return
 	}
 	buf := bufio.NewReadWriter(br, bw)
 	ws = newHybiClientConn(config, buf, rwc)
+	ws.setCompression(compression)
 	return
 }
 
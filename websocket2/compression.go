@@ -0,0 +1,307 @@
+package websocket2
+
+// This file implements the permessage-deflate extension.
+// https://tools.ietf.org/html/rfc7692
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	extensionPermessageDeflate = "permessage-deflate"
+
+	// maxWindowSize is the size of the LZ77 sliding window used by
+	// compress/flate, it is 2^15 bytes.
+	maxWindowSize = 1 << 15
+)
+
+// deflateTail is appended to a compressed message before it is inflated.
+// The first four bytes are the tail removed by the sender (see Section 7.2.1),
+// the rest is an empty final block so that the reader returns io.EOF.
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// CompressionOptions configures the permessage-deflate extension.
+// A client offers the extension and a server accepts it only if the Config
+// has non-nil CompressionOptions.
+type CompressionOptions struct {
+	// Level is the compression level of compress/flate. If zero,
+	// flate.DefaultCompression is used.
+	Level int
+
+	// Threshold is the minimum size of a message to be compressed,
+	// shorter messages are sent uncompressed.
+	Threshold int
+
+	// ServerNoContextTakeover requests the server to reset its compression
+	// context after each message. It saves memory and costs compression ratio.
+	ServerNoContextTakeover bool
+
+	// ClientNoContextTakeover requests the client to reset its compression
+	// context after each message.
+	ClientNoContextTakeover bool
+}
+
+// deflateParams are the negotiated parameters of permessage-deflate.
+type deflateParams struct {
+	serverNoContextTakeover bool
+	clientNoContextTakeover bool
+}
+
+func (p *deflateParams) String() string {
+	s := extensionPermessageDeflate
+	if p.serverNoContextTakeover {
+		s += "; server_no_context_takeover"
+	}
+	if p.clientNoContextTakeover {
+		s += "; client_no_context_takeover"
+	}
+	return s
+}
+
+type extension struct {
+	name   string
+	params map[string]string
+}
+
+// parseExtensions parses the value of Sec-WebSocket-Extensions headers.
+func parseExtensions(values []string) []extension {
+	var extensions []extension
+	for _, value := range values {
+		for _, s := range strings.Split(value, ",") {
+			ss := strings.Split(s, ";")
+			name := strings.TrimSpace(ss[0])
+			if name == "" {
+				continue
+			}
+			ext := extension{name: strings.ToLower(name), params: map[string]string{}}
+			for _, param := range ss[1:] {
+				kv := strings.SplitN(param, "=", 2)
+				key := strings.ToLower(strings.TrimSpace(kv[0]))
+				if key == "" {
+					continue
+				}
+				if len(kv) == 2 {
+					ext.params[key] = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+				} else {
+					ext.params[key] = ""
+				}
+			}
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+func isValidWindowBits(s string) bool {
+	bits, err := strconv.Atoi(s)
+	return err == nil && bits >= 8 && bits <= 15
+}
+
+// offerDeflate returns the value of Sec-WebSocket-Extensions sent by a client.
+// client_max_window_bits is not offered because compress/flate always uses
+// a window of 2^15 bytes.
+func offerDeflate(opts *CompressionOptions) string {
+	p := deflateParams{
+		serverNoContextTakeover: opts.ServerNoContextTakeover,
+		clientNoContextTakeover: opts.ClientNoContextTakeover,
+	}
+	return p.String()
+}
+
+// acceptDeflate selects the first acceptable permessage-deflate offer of a
+// client, it returns nil if there is none.
+func acceptDeflate(opts *CompressionOptions, values []string) *deflateParams {
+next:
+	for _, ext := range parseExtensions(values) {
+		if ext.name != extensionPermessageDeflate {
+			continue
+		}
+		p := &deflateParams{
+			serverNoContextTakeover: opts.ServerNoContextTakeover,
+			clientNoContextTakeover: opts.ClientNoContextTakeover,
+		}
+		for key, value := range ext.params {
+			switch key {
+			case "server_no_context_takeover":
+				if value != "" {
+					continue next
+				}
+				p.serverNoContextTakeover = true
+			case "client_no_context_takeover":
+				if value != "" {
+					continue next
+				}
+				p.clientNoContextTakeover = true
+			case "server_max_window_bits":
+				// The compressor can not use a smaller window.
+				if value != "15" {
+					continue next
+				}
+			case "client_max_window_bits":
+				// Any window is fine to the decompressor.
+				if value != "" && !isValidWindowBits(value) {
+					continue next
+				}
+			default:
+				continue next
+			}
+		}
+		return p
+	}
+	return nil
+}
+
+// parseDeflateResponse validates the Sec-WebSocket-Extensions sent by a server.
+func parseDeflateResponse(opts *CompressionOptions, values []string) (*deflateParams, error) {
+	extensions := parseExtensions(values)
+	if len(extensions) == 0 {
+		return nil, nil
+	}
+	if opts == nil || len(extensions) != 1 || extensions[0].name != extensionPermessageDeflate {
+		return nil, ErrUnsupportedExtensions
+	}
+
+	p := &deflateParams{}
+	for key, value := range extensions[0].params {
+		switch key {
+		case "server_no_context_takeover":
+			p.serverNoContextTakeover = true
+		case "client_no_context_takeover":
+			p.clientNoContextTakeover = true
+		case "server_max_window_bits":
+			if !isValidWindowBits(value) {
+				return nil, ErrUnsupportedExtensions
+			}
+		default:
+			// client_max_window_bits is not offered.
+			return nil, ErrUnsupportedExtensions
+		}
+	}
+	return p, nil
+}
+
+// deflateState is the compression state of a connection.
+type deflateState struct {
+	params    deflateParams
+	isServer  bool
+	level     int
+	threshold int
+
+	fw   *flate.Writer
+	wbuf bytes.Buffer
+
+	fr   io.ReadCloser
+	dict []byte
+}
+
+func newDeflateState(params *deflateParams, opts *CompressionOptions, isServer bool) *deflateState {
+	s := &deflateState{params: *params, isServer: isServer, level: flate.DefaultCompression}
+	if opts != nil {
+		if opts.Level != 0 {
+			s.level = opts.Level
+		}
+		s.threshold = opts.Threshold
+	}
+	return s
+}
+
+func (s *deflateState) writeNoContextTakeover() bool {
+	if s.isServer {
+		return s.params.serverNoContextTakeover
+	}
+	return s.params.clientNoContextTakeover
+}
+
+func (s *deflateState) readNoContextTakeover() bool {
+	if s.isServer {
+		return s.params.clientNoContextTakeover
+	}
+	return s.params.serverNoContextTakeover
+}
+
+// compress compresses a message, the result is valid until next call.
+func (s *deflateState) compress(msg []byte) ([]byte, error) {
+	s.wbuf.Reset()
+	if s.fw == nil {
+		fw, err := flate.NewWriter(&s.wbuf, s.level)
+		if err != nil {
+			return nil, err
+		}
+		s.fw = fw
+	} else if s.writeNoContextTakeover() {
+		s.fw.Reset(&s.wbuf)
+	}
+	if _, err := s.fw.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := s.fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(s.wbuf.Bytes(), deflateTail[:4]), nil
+}
+
+// decompress inflates a message, it returns ErrFrameTooLarge if the
+// inflated message is larger than limit. A non-positive limit means no limit.
+func (s *deflateState) decompress(data []byte, limit int) ([]byte, error) {
+	in := io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail))
+	var dict []byte
+	if !s.readNoContextTakeover() {
+		dict = s.dict
+	}
+	if s.fr == nil {
+		s.fr = flate.NewReaderDict(in, dict)
+	} else if err := s.fr.(flate.Resetter).Reset(in, dict); err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = s.fr
+	if limit > 0 {
+		r = io.LimitReader(s.fr, int64(limit)+1)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, r); err != nil {
+		return nil, err
+	}
+	if limit > 0 && out.Len() > limit {
+		return nil, ErrFrameTooLarge
+	}
+
+	if !s.readNoContextTakeover() {
+		s.dict = append(s.dict, out.Bytes()...)
+		if len(s.dict) > maxWindowSize {
+			s.dict = append([]byte(nil), s.dict[len(s.dict)-maxWindowSize:]...)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// messageReader is a frameReader of an inflated message.
+type messageReader struct {
+	*bytes.Reader
+	payloadType byte
+	length      int
+}
+
+func (r *messageReader) PayloadType() byte        { return r.payloadType }
+func (r *messageReader) HeaderReader() io.Reader  { return nil }
+func (r *messageReader) TrailerReader() io.Reader { return nil }
+func (r *messageReader) Len() int                 { return r.length }
+
+// setCompression enables permessage-deflate with the negotiated parameters.
+func (ws *Conn) setCompression(params *deflateParams) {
+	if params == nil {
+		return
+	}
+	var opts *CompressionOptions
+	if ws.config != nil {
+		opts = ws.config.Compression
+	}
+	ws.compression = newDeflateState(params, opts, ws.IsServerConn())
+}
+
+// IsCompressed reports whether permessage-deflate is negotiated.
+func (ws *Conn) IsCompressed() bool { return ws.compression != nil }
@@ -0,0 +1,269 @@
+package websocket2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptDeflate(t *testing.T) {
+	tests := []struct {
+		opts   CompressionOptions
+		offer  []string
+		accept string
+	}{
+		{CompressionOptions{}, []string{"permessage-deflate"}, "permessage-deflate"},
+		{CompressionOptions{}, []string{"permessage-deflate; client_max_window_bits"}, "permessage-deflate"},
+		{CompressionOptions{}, []string{"x-webkit-deflate-frame", "permessage-deflate; server_no_context_takeover"},
+			"permessage-deflate; server_no_context_takeover"},
+		{CompressionOptions{ClientNoContextTakeover: true}, []string{"permessage-deflate; server_max_window_bits=10, permessage-deflate"},
+			"permessage-deflate; client_no_context_takeover"},
+		{CompressionOptions{}, []string{"permessage-deflate; server_max_window_bits=10"}, ""},
+		{CompressionOptions{}, []string{"permessage-deflate; unknown"}, ""},
+		{CompressionOptions{}, nil, ""},
+	}
+	for _, test := range tests {
+		p := acceptDeflate(&test.opts, test.offer)
+		accept := ""
+		if p != nil {
+			accept = p.String()
+		}
+		if accept != test.accept {
+			t.Errorf("offer %q: expected %q got %q", test.offer, test.accept, accept)
+		}
+	}
+
+	opts := &CompressionOptions{}
+	for _, value := range []string{"permessage-deflate; client_max_window_bits=10", "permessage-deflate; server_max_window_bits=16", "foo", "permessage-deflate, permessage-deflate"} {
+		if _, err := parseDeflateResponse(opts, []string{value}); err != ErrUnsupportedExtensions {
+			t.Errorf("response %q: expected error %v got %v", value, ErrUnsupportedExtensions, err)
+		}
+	}
+	if _, err := parseDeflateResponse(nil, []string{"permessage-deflate"}); err != ErrUnsupportedExtensions {
+		t.Errorf("expected error %v got %v", ErrUnsupportedExtensions, err)
+	}
+	p, err := parseDeflateResponse(opts, []string{"permessage-deflate; server_no_context_takeover; server_max_window_bits=12"})
+	if err != nil || p == nil || !p.serverNoContextTakeover || p.clientNoContextTakeover {
+		t.Errorf("unexpected params %v, %v", p, err)
+	}
+}
+
+func TestHybiWriteFragments(t *testing.T) {
+	b := bytes.NewBuffer([]byte{})
+	br := bufio.NewReader(bytes.NewBuffer([]byte{}))
+	bw := bufio.NewWriter(b)
+	config := newConfig(t, "/")
+	config.FragmentSize = 10
+	conn := newHybiConn(config, bufio.NewReadWriter(br, bw), nil, new(http.Request))
+
+	msg := []byte(strings.Repeat("a", 25))
+	if n, err := conn.Write(msg); err != nil || n != len(msg) {
+		t.Fatalf("write: %d, %v", n, err)
+	}
+	var expected []byte
+	expected = append(expected, 0x01, 10)
+	expected = append(expected, msg[:10]...)
+	expected = append(expected, 0x00, 10)
+	expected = append(expected, msg[10:20]...)
+	expected = append(expected, 0x80, 5)
+	expected = append(expected, msg[20:]...)
+	if !bytes.Equal(expected, b.Bytes()) {
+		t.Errorf("frames expected %v got %v", expected, b.Bytes())
+	}
+
+	// Receive reads all fragments of a message.
+	wire := append([]byte{}, b.Bytes()...)
+	br = bufio.NewReader(bytes.NewBuffer(wire))
+	conn = newHybiConn(newConfig(t, "/"), bufio.NewReadWriter(br, bufio.NewWriter(b)), nil, nil)
+	var actual string
+	if err := Message.Receive(conn, &actual); err != nil {
+		t.Fatal("receive:", err)
+	}
+	if actual != string(msg) {
+		t.Errorf("expected %q got %q", msg, actual)
+	}
+}
+
+func TestHybiReadRsvWithoutCompression(t *testing.T) {
+	wireData := []byte{0xc1, 0x05, 'h', 'e', 'l', 'l', 'o'}
+	br := bufio.NewReader(bytes.NewBuffer(wireData))
+	b := bytes.NewBuffer([]byte{})
+	conn := newHybiConn(newConfig(t, "/"), bufio.NewReadWriter(br, bufio.NewWriter(b)), nil, nil)
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("expected EOF got %v", err)
+	}
+	if !bytes.Equal(b.Bytes()[:1], []byte{0x88}) {
+		t.Errorf("expected close frame got %v", b.Bytes())
+	}
+}
+
+func startCompressionServer(t *testing.T, opts *CompressionOptions, maxMessageSize int) (*httptest.Server, chan error) {
+	errs := make(chan error, 10)
+	server := httptest.NewServer(Server{
+		Config: Config{Compression: opts, FragmentSize: 100, MaxMessageSize: maxMessageSize},
+		Handler: func(ws *Conn) {
+			defer ws.Close()
+			if !ws.IsCompressed() {
+				errs <- fmt.Errorf("server connection is not compressed")
+				return
+			}
+			for {
+				var msg []byte
+				if err := Message.Receive(ws, &msg); err != nil {
+					errs <- err
+					return
+				}
+				if err := Message.Send(ws, msg); err != nil {
+					errs <- err
+					return
+				}
+			}
+		},
+	})
+	return server, errs
+}
+
+func TestCompressionEcho(t *testing.T) {
+	for _, opts := range []CompressionOptions{
+		{},
+		{ServerNoContextTakeover: true, ClientNoContextTakeover: true},
+		{Threshold: 64},
+	} {
+		opts := opts
+		server, _ := startCompressionServer(t, &opts, 0)
+
+		config, _ := NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", "http://localhost")
+		config.Compression = &opts
+		config.FragmentSize = 64
+		ws, err := DialConfig(config)
+		if err != nil {
+			server.Close()
+			t.Fatal("dial:", err)
+		}
+		if !ws.IsCompressed() {
+			t.Error("client connection is not compressed")
+		}
+
+		for i, s := range []string{
+			"hello",
+			strings.Repeat("hello, world!", 100),
+			strings.Repeat("hello, world!", 100),
+			"",
+			strings.Repeat("0123456789", 10000),
+		} {
+			if err := Message.Send(ws, s); err != nil {
+				t.Fatal("send:", err)
+			}
+			var actual string
+			if err := Message.Receive(ws, &actual); err != nil {
+				t.Fatal("receive:", err)
+			}
+			if actual != s {
+				t.Errorf("%v #%d: expected %d bytes got %d bytes", opts, i, len(s), len(actual))
+			}
+		}
+		ws.Close()
+		server.Close()
+	}
+}
+
+func TestCompressionNotAccepted(t *testing.T) {
+	server := httptest.NewServer(Server{Handler: func(ws *Conn) {
+		defer ws.Close()
+		io.Copy(ws, ws)
+	}})
+	defer server.Close()
+
+	config, _ := NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", "http://localhost")
+	config.Compression = &CompressionOptions{}
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer ws.Close()
+	if ws.IsCompressed() {
+		t.Error("connection is compressed")
+	}
+	if _, err := ws.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, 16)
+	if n, err := ws.Read(msg); err != nil || string(msg[:n]) != "hello" {
+		t.Errorf("read %q, %v", msg[:n], err)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, msg := range []string{
+		strings.Repeat("a", 2048),                      // too large after decompression
+		strings.Repeat(fmt.Sprint(0, 1, 2, 3, 4), 500), // fragmented
+	} {
+		server, errs := startCompressionServer(t, &CompressionOptions{}, 1024)
+
+		config, _ := NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", "http://localhost")
+		config.Compression = &CompressionOptions{}
+		config.FragmentSize = 16
+		ws, err := DialConfig(config)
+		if err != nil {
+			server.Close()
+			t.Fatal("dial:", err)
+		}
+		if err := Message.Send(ws, "small"); err != nil {
+			t.Fatal("send:", err)
+		}
+		var actual string
+		if err := Message.Receive(ws, &actual); err != nil || actual != "small" {
+			t.Errorf("receive %q, %v", actual, err)
+		}
+
+		if err := Message.Send(ws, msg); err != nil {
+			t.Fatal("send:", err)
+		}
+		if err := <-errs; err != ErrFrameTooLarge {
+			t.Errorf("expected error %v got %v", ErrFrameTooLarge, err)
+		}
+		if err := Message.Receive(ws, &actual); err != io.EOF {
+			t.Errorf("expected EOF got %v", err)
+		}
+		ws.Close()
+		server.Close()
+	}
+}
+
+func TestReceiveInflateLimit(t *testing.T) {
+	server, errs := startCompressionServer(t, &CompressionOptions{}, 0)
+	defer server.Close()
+
+	config, _ := NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", "http://localhost")
+	config.Compression = &CompressionOptions{}
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	defer ws.Close()
+	ws.MaxPayloadBytes = 1024
+
+	// the compressed message is small, but it is too large after decompression
+	if err := Message.Send(ws, strings.Repeat("a", 256*1024)); err != nil {
+		t.Fatal("send:", err)
+	}
+	var actual string
+	if err := Message.Receive(ws, &actual); err != ErrFrameTooLarge {
+		t.Errorf("expected error %v got %v", ErrFrameTooLarge, err)
+	}
+	// the message isn't inflated completely, the connection is closed with status 1009
+	select {
+	case err := <-errs:
+		if err != io.EOF {
+			t.Errorf("expected EOF got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("connection isn't closed")
+	}
+}
@@ -22,9 +22,9 @@ func TestDialConfigTLSWithDialer(t *testing.T) {
 	log.Print("Test TLS WebSocket server listening on ", tlsServerAddr)
 	defer tlsServer.Close()
 	config, _ := NewConfig(fmt.Sprintf("wss://%s/echo", tlsServerAddr), "http://localhost")
-	config.Dialer = &net.Dialer{
+	config.Dialer = (&net.Dialer{
 		Deadline: time.Now().Add(-time.Minute),
-	}
+	}).Dial
 	config.TlsConfig = &tls.Config{
 		InsecureSkipVerify: true,
 	}
@@ -48,14 +48,15 @@ var (
 	ErrNotImplemented        = &ProtocolError{"not implemented"}
 
 	handshakeHeader = map[string]bool{
-		"Host":                   true,
-		"Upgrade":                true,
-		"Connection":             true,
-		"Sec-Websocket-Key":      true,
-		"Sec-Websocket-Origin":   true,
-		"Sec-Websocket-Version":  true,
-		"Sec-Websocket-Protocol": true,
-		"Sec-Websocket-Accept":   true,
+		"Host":                     true,
+		"Upgrade":                  true,
+		"Connection":               true,
+		"Sec-Websocket-Key":        true,
+		"Sec-Websocket-Origin":     true,
+		"Sec-Websocket-Version":    true,
+		"Sec-Websocket-Protocol":   true,
+		"Sec-Websocket-Accept":     true,
+		"Sec-Websocket-Extensions": true,
 	}
 )
 
@@ -262,6 +263,7 @@ func (buf hybiFrameWriterFactory) NewFrameWriter(payloadType byte) (frame frameW
 type hybiFrameHandler struct {
 	conn        *Conn
 	payloadType byte
+	messageSize int64
 }
 
 func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, error) {
@@ -278,14 +280,34 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 			return nil, io.EOF
 		}
 	}
+	handler.conn.notifyFrame(frame.PayloadType())
 	if header := frame.HeaderReader(); header != nil {
 		io.Copy(ioutil.Discard, header)
 	}
+	hybiFrame := frame.(*hybiFrameReader)
+	if hybiFrame.header.Rsv[1] || hybiFrame.header.Rsv[2] ||
+		(hybiFrame.header.Rsv[0] && (handler.conn.compression == nil ||
+			(hybiFrame.header.OpCode != TextFrame && hybiFrame.header.OpCode != BinaryFrame))) {
+		// RSV1 is only used by permessage-deflate on the first frame of a message.
+		handler.WriteClose(closeStatusProtocolError)
+		return nil, io.EOF
+	}
 	switch frame.PayloadType() {
 	case ContinuationFrame:
-		frame.(*hybiFrameReader).header.OpCode = handler.payloadType
+		hybiFrame.header.OpCode = handler.payloadType
+		handler.messageSize += hybiFrame.header.Length
+		if err := handler.checkMessageSize(); err != nil {
+			return nil, err
+		}
 	case TextFrame, BinaryFrame:
 		handler.payloadType = frame.PayloadType()
+		handler.messageSize = hybiFrame.header.Length
+		if err := handler.checkMessageSize(); err != nil {
+			return nil, err
+		}
+		if hybiFrame.header.Rsv[0] {
+			return handler.readCompressedMessage(hybiFrame)
+		}
 	case CloseFrame:
 		return nil, io.EOF
 	case PingFrame, PongFrame:
@@ -305,6 +327,36 @@ func (handler *hybiFrameHandler) HandleFrame(frame frameReader) (frameReader, er
 	return frame, nil
 }
 
+// checkMessageSize closes the connection with status 1009 if the message
+// being received is larger than Config.MaxMessageSize.
+func (handler *hybiFrameHandler) checkMessageSize() error {
+	if limit := handler.conn.maxMessageSize(); limit > 0 && handler.messageSize > int64(limit) {
+		handler.WriteClose(closeStatusTooBigData)
+		return ErrFrameTooLarge
+	}
+	return nil
+}
+
+// readCompressedMessage reads all fragments of a compressed message and
+// returns a reader of the inflated message.
+func (handler *hybiFrameHandler) readCompressedMessage(frame *hybiFrameReader) (frameReader, error) {
+	limit := handler.conn.messageLimit()
+	data, err := handler.conn.readFragments(frame, limit)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := handler.conn.compression.decompress(data, limit)
+	if err != nil {
+		if err == ErrFrameTooLarge {
+			handler.WriteClose(closeStatusTooBigData)
+		} else {
+			handler.WriteClose(closeStatusBadMessageData)
+		}
+		return nil, err
+	}
+	return &messageReader{Reader: bytes.NewReader(msg), payloadType: frame.header.OpCode, length: len(msg)}, nil
+}
+
 func (handler *hybiFrameHandler) WriteClose(status int) (err error) {
 	handler.conn.wio.Lock()
 	defer handler.conn.wio.Unlock()
@@ -331,6 +383,124 @@ func (handler *hybiFrameHandler) WritePong(msg []byte) (n int, err error) {
 	return n, err
 }
 
+func (ws *Conn) maxMessageSize() int {
+	if ws.config == nil {
+		return 0
+	}
+	return ws.config.MaxMessageSize
+}
+
+// messageLimit returns the size limit of the message being received, it is
+// Config.MaxMessageSize, or the limit of Codec's Receive method if it is zero,
+// so that a small compressed message cannot be inflated without limit.
+func (ws *Conn) messageLimit() int {
+	if limit := ws.maxMessageSize(); limit > 0 {
+		return limit
+	}
+	return ws.receiveLimit
+}
+
+// readFragments reads the payload of frame and of all its continuation frames,
+// control frames between them are handled by ws.frameHandler. It returns
+// ErrFrameTooLarge if the payload is larger than limit.
+// A non-positive limit means no limit.
+func (ws *Conn) readFragments(frame frameReader, limit int) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		var r io.Reader = frame
+		if limit > 0 {
+			r = io.LimitReader(frame, int64(limit-buf.Len())+1)
+		}
+		if _, err := buf.ReadFrom(r); err != nil {
+			return nil, err
+		}
+		if limit > 0 && buf.Len() > limit {
+			return nil, ErrFrameTooLarge
+		}
+		if hybiFrame, ok := frame.(*hybiFrameReader); !ok || hybiFrame.header.Fin {
+			return buf.Bytes(), nil
+		}
+
+	again:
+		next, err := ws.frameReaderFactory.NewFrameReader()
+		if err != nil {
+			return nil, err
+		}
+		if next.PayloadType() != ContinuationFrame && next.PayloadType() < CloseFrame {
+			ws.frameHandler.WriteClose(closeStatusProtocolError)
+			return nil, ErrBadFrame
+		}
+		frame, err = ws.frameHandler.HandleFrame(next)
+		if err != nil {
+			return nil, err
+		}
+		if frame == nil {
+			goto again
+		}
+	}
+}
+
+// writeMessage writes msg as a message, it is compressed if permessage-deflate
+// is negotiated and split into frames of Config.FragmentSize.
+// The caller must hold ws.wio.
+func (ws *Conn) writeMessage(payloadType byte, msg []byte) (int, error) {
+	factory, ok := ws.frameWriterFactory.(hybiFrameWriterFactory)
+	fragmentSize := 0
+	if ws.config != nil {
+		fragmentSize = ws.config.FragmentSize
+	}
+	if !ok || (ws.compression == nil && (fragmentSize <= 0 || len(msg) <= fragmentSize)) {
+		w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(msg)
+		w.Close()
+		return n, err
+	}
+
+	data := msg
+	compressed := false
+	if ws.compression != nil && len(msg) >= ws.compression.threshold &&
+		(payloadType == TextFrame || payloadType == BinaryFrame) {
+		var err error
+		data, err = ws.compression.compress(msg)
+		if err != nil {
+			return 0, err
+		}
+		compressed = true
+	}
+	if fragmentSize <= 0 {
+		fragmentSize = len(data)
+	}
+
+	opCode := payloadType
+	for {
+		n := len(data)
+		if n > fragmentSize {
+			n = fragmentSize
+		}
+		header := &hybiFrameHeader{Fin: n == len(data), OpCode: opCode}
+		header.Rsv[0] = compressed && opCode != ContinuationFrame
+		if factory.needMaskingKey {
+			var err error
+			header.MaskingKey, err = generateMaskingKey()
+			if err != nil {
+				return 0, err
+			}
+		}
+		w := &hybiFrameWriter{writer: factory.Writer, header: header}
+		if _, err := w.Write(data[:n]); err != nil {
+			return 0, err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			return len(msg), nil
+		}
+		opCode = ContinuationFrame
+	}
+}
+
 // newHybiConn creates a new WebSocket connection speaking hybi draft protocol.
 func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser, request *http.Request) *Conn {
 	if buf == nil {
@@ -345,6 +515,7 @@ func newHybiConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCloser,
 		PayloadType:        TextFrame,
 		defaultCloseStatus: closeStatusNormal}
 	ws.frameHandler = &hybiFrameHandler{conn: ws}
+	ws.startKeepalive()
 	return ws
 }
 
@@ -403,6 +574,14 @@ func getNonceAccept(nonce []byte) (expected []byte, err error) {
 
 // Client handshake described in draft-ietf-hybi-thewebsocket-protocol-17
 func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (err error) {
+	_, err = hybiClientHandshakeWithExtensions(config, br, bw)
+	return err
+}
+
+// hybiClientHandshakeWithExtensions performs the client handshake and returns
+// the negotiated parameters of permessage-deflate, which is nil if the server
+// does not accept it.
+func hybiClientHandshakeWithExtensions(config *Config, br *bufio.Reader, bw *bufio.Writer) (compression *deflateParams, err error) {
 	bw.WriteString("GET " + config.Location.RequestURI() + " HTTP/1.1\r\n")
 
 	// According to RFC 6874, an HTTP client, proxy, or other
@@ -419,44 +598,47 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 	bw.WriteString("Origin: " + strings.ToLower(config.Origin.String()) + "\r\n")
 
 	if config.Version != ProtocolVersionHybi13 {
-		return ErrBadProtocolVersion
+		return nil, ErrBadProtocolVersion
 	}
 
 	bw.WriteString("Sec-WebSocket-Version: " + fmt.Sprintf("%d", config.Version) + "\r\n")
 	if len(config.Protocol) > 0 {
 		bw.WriteString("Sec-WebSocket-Protocol: " + strings.Join(config.Protocol, ", ") + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	if config.Compression != nil {
+		bw.WriteString("Sec-WebSocket-Extensions: " + offerDeflate(config.Compression) + "\r\n")
+	}
 	err = config.Header.WriteSubset(bw, handshakeHeader)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	bw.WriteString("\r\n")
 	if err = bw.Flush(); err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := http.ReadResponse(br, &http.Request{Method: "GET"})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.StatusCode != 101 {
-		return ErrBadStatus
+		return nil, ErrBadStatus
 	}
 	if strings.ToLower(resp.Header.Get("Upgrade")) != "websocket" ||
 		strings.ToLower(resp.Header.Get("Connection")) != "upgrade" {
-		return ErrBadUpgrade
+		return nil, ErrBadUpgrade
 	}
 	expectedAccept, err := getNonceAccept(nonce)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp.Header.Get("Sec-WebSocket-Accept") != string(expectedAccept) {
-		return ErrChallengeResponse
+		return nil, ErrChallengeResponse
 	}
-	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
-		return ErrUnsupportedExtensions
+	compression, err = parseDeflateResponse(config.Compression, resp.Header["Sec-Websocket-Extensions"])
+	if err != nil {
+		return nil, err
 	}
 	offeredProtocol := resp.Header.Get("Sec-WebSocket-Protocol")
 	if offeredProtocol != "" {
@@ -468,12 +650,12 @@ func hybiClientHandshake(config *Config, br *bufio.Reader, bw *bufio.Writer) (er
 			}
 		}
 		if !protocolMatched {
-			return ErrBadWebSocketProtocol
+			return nil, ErrBadWebSocketProtocol
 		}
 		config.Protocol = []string{offeredProtocol}
 	}
 
-	return nil
+	return compression, nil
 }
 
 // newHybiClientConn creates a client WebSocket connection after handshake.
@@ -484,7 +666,8 @@ func newHybiClientConn(config *Config, buf *bufio.ReadWriter, rwc io.ReadWriteCl
 // A HybiServerHandshaker performs a server handshake using hybi draft protocol.
 type hybiServerHandshaker struct {
 	*Config
-	accept []byte
+	accept      []byte
+	compression *deflateParams
 }
 
 func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Request) (code int, err error) {
@@ -527,6 +710,9 @@ func (c *hybiServerHandshaker) ReadHandshake(buf *bufio.Reader, req *http.Reques
 			c.Protocol = append(c.Protocol, strings.TrimSpace(protocols[i]))
 		}
 	}
+	if c.Compression != nil {
+		c.compression = acceptDeflate(c.Compression, req.Header["Sec-Websocket-Extensions"])
+	}
 	c.accept, err = getNonceAccept([]byte(key))
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -562,7 +748,9 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 	if len(c.Protocol) > 0 {
 		buf.WriteString("Sec-WebSocket-Protocol: " + c.Protocol[0] + "\r\n")
 	}
-	// TODO(ukai): send Sec-WebSocket-Extensions.
+	if c.compression != nil {
+		buf.WriteString("Sec-WebSocket-Extensions: " + c.compression.String() + "\r\n")
+	}
 	if c.Header != nil {
 		err := c.Header.WriteSubset(buf, handshakeHeader)
 		if err != nil {
@@ -574,7 +762,9 @@ func (c *hybiServerHandshaker) AcceptHandshake(buf *bufio.Writer) (err error) {
 }
 
 func (c *hybiServerHandshaker) NewServerConn(buf *bufio.ReadWriter, rwc io.ReadWriteCloser, request *http.Request) *Conn {
-	return newHybiServerConn(c.Config, buf, rwc, request)
+	conn := newHybiServerConn(c.Config, buf, rwc, request)
+	conn.setCompression(c.compression)
+	return conn
 }
 
 // newHybiServerConn returns a new WebSocket connection speaking hybi draft protocol.
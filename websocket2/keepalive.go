@@ -0,0 +1,201 @@
+package websocket2
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeepaliveError is returned by Conn.Read and Codec's Receive method when the
+// connection is closed by the keepalive because the peer seems dead.
+type KeepaliveError struct {
+	// Reason is "pong timeout" or "idle timeout".
+	Reason string
+
+	// Status is the close status sent to the peer.
+	Status int
+
+	// Duration is the timeout which is exceeded.
+	Duration time.Duration
+}
+
+func (e *KeepaliveError) Error() string {
+	return "websocket: " + e.Reason + " after " + e.Duration.String() +
+		", connection is closed with status " + strconv.Itoa(e.Status)
+}
+
+// Timeout implements the net.Error interface.
+func (e *KeepaliveError) Timeout() bool { return true }
+
+// Temporary implements the net.Error interface.
+func (e *KeepaliveError) Temporary() bool { return false }
+
+// IsKeepaliveError reports whether err is a KeepaliveError.
+func IsKeepaliveError(err error) bool {
+	_, ok := err.(*KeepaliveError)
+	return ok
+}
+
+// keepalive sends pings and closes the connection if no pong or no frame is
+// received in time. Pongs and other frames are noticed only while someone is
+// reading the connection.
+type keepalive struct {
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	idleTimeout  time.Duration
+
+	lastRead int64 // unix nano
+	lastPong int64 // unix nano
+	pingSent int64 // unix nano, 0 if no ping is waiting for pong
+
+	err       atomic.Value
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (ka *keepalive) stop() {
+	ka.closeOnce.Do(func() {
+		close(ka.done)
+	})
+}
+
+func (ka *keepalive) tick() time.Duration {
+	tick := time.Duration(0)
+	for _, d := range []time.Duration{ka.pingInterval, ka.pongTimeout, ka.idleTimeout} {
+		if d > 0 && (tick == 0 || d < tick) {
+			tick = d
+		}
+	}
+	tick /= 2
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	return tick
+}
+
+// startKeepalive starts the keepalive if it is enabled in ws.config.
+func (ws *Conn) startKeepalive() {
+	if ws.config == nil {
+		return
+	}
+	ka := &keepalive{
+		pingInterval: ws.config.PingInterval,
+		pongTimeout:  ws.config.PongTimeout,
+		idleTimeout:  ws.config.IdleTimeout,
+		done:         make(chan struct{}),
+	}
+	if ka.pingInterval <= 0 && ka.idleTimeout <= 0 {
+		return
+	}
+	if ka.pingInterval > 0 && ka.pongTimeout <= 0 {
+		ka.pongTimeout = ka.pingInterval
+	}
+	now := time.Now().UnixNano()
+	ka.lastRead = now
+	ka.lastPong = now
+	ws.keepalive = ka
+	go ws.runKeepalive(ka)
+}
+
+func (ws *Conn) runKeepalive(ka *keepalive) {
+	ticker := time.NewTicker(ka.tick())
+	defer ticker.Stop()
+
+	lastPing := time.Now()
+	for {
+		select {
+		case <-ka.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if ka.idleTimeout > 0 &&
+			now.Sub(time.Unix(0, atomic.LoadInt64(&ka.lastRead))) > ka.idleTimeout {
+			ws.closeByKeepalive(ka, &KeepaliveError{Reason: "idle timeout", Status: closeStatusGoingAway, Duration: ka.idleTimeout})
+			return
+		}
+		if ka.pingInterval <= 0 {
+			continue
+		}
+
+		if sent := atomic.LoadInt64(&ka.pingSent); sent != 0 {
+			if atomic.LoadInt64(&ka.lastPong) >= sent {
+				atomic.CompareAndSwapInt64(&ka.pingSent, sent, 0)
+			} else if now.Sub(time.Unix(0, sent)) > ka.pongTimeout {
+				ws.closeByKeepalive(ka, &KeepaliveError{Reason: "pong timeout", Status: closeStatusPolicyViolation, Duration: ka.pongTimeout})
+				return
+			}
+		}
+
+		if now.Sub(lastPing) >= ka.pingInterval && atomic.LoadInt64(&ka.pingSent) == 0 {
+			lastPing = now
+			atomic.StoreInt64(&ka.pingSent, now.UnixNano())
+			if err := ws.writePing(nil, ka.pongTimeout); err != nil {
+				// The connection is broken, the reader gets the error.
+				return
+			}
+		}
+	}
+}
+
+func (ws *Conn) closeByKeepalive(ka *keepalive, err *KeepaliveError) {
+	ka.err.Store(err)
+	ka.stop()
+	if conn, ok := ws.rwc.(net.Conn); ok {
+		// A writer blocked by the dead peer holds ws.wio, the deadline
+		// releases it.
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+	}
+	ws.frameHandler.WriteClose(err.Status)
+	ws.rwc.Close()
+}
+
+// notifyFrame records that a frame is received.
+func (ws *Conn) notifyFrame(payloadType byte) {
+	if ka := ws.keepalive; ka != nil {
+		now := time.Now().UnixNano()
+		atomic.StoreInt64(&ka.lastRead, now)
+		if payloadType == PongFrame {
+			atomic.StoreInt64(&ka.lastPong, now)
+		}
+	}
+}
+
+// keepaliveErr replaces err with the KeepaliveError if the connection is
+// closed by the keepalive.
+func (ws *Conn) keepaliveErr(err error) error {
+	if err == nil || ws.keepalive == nil {
+		return err
+	}
+	if e, ok := ws.keepalive.err.Load().(*KeepaliveError); ok {
+		return e
+	}
+	return err
+}
+
+func (ws *Conn) writePing(msg []byte, timeout time.Duration) error {
+	ws.wio.Lock()
+	defer ws.wio.Unlock()
+	if conn, ok := ws.rwc.(net.Conn); ok && timeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	w, err := ws.frameWriterFactory.NewFrameWriter(PingFrame)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	w.Close()
+	return err
+}
+
+// WritePing sends a ping frame with msg, which must not be longer than 125 bytes.
+func (ws *Conn) WritePing(msg []byte) error {
+	if len(msg) > maxControlFramePayloadLength {
+		return ErrBadFrame
+	}
+	return ws.writePing(msg, 0)
+}
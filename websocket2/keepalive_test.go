@@ -0,0 +1,169 @@
+package websocket2
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dialKeepalive(t *testing.T, server *httptest.Server, pingInterval, pongTimeout, idleTimeout time.Duration) *Conn {
+	config, _ := NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/", "http://localhost")
+	config.PingInterval = pingInterval
+	config.PongTimeout = pongTimeout
+	config.IdleTimeout = idleTimeout
+	ws, err := DialConfig(config)
+	if err != nil {
+		t.Fatal("dial:", err)
+	}
+	return ws
+}
+
+// readCloseStatus skips frames until a close frame and returns its status.
+func readCloseStatus(ws *Conn) (int, error) {
+	for {
+		frame, err := ws.frameReaderFactory.NewFrameReader()
+		if err != nil {
+			return 0, err
+		}
+		if frame.PayloadType() != CloseFrame {
+			io.Copy(ioutil.Discard, frame)
+			continue
+		}
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(frame, b); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+}
+
+func TestKeepalivePongTimeout(t *testing.T) {
+	release := make(chan struct{})
+	status := make(chan int, 1)
+	server := httptest.NewServer(Server{Handler: func(ws *Conn) {
+		defer ws.Close()
+		// The connection is not read, so pings are not answered.
+		<-release
+		code, err := readCloseStatus(ws)
+		if err != nil {
+			t.Error(err)
+		}
+		status <- code
+	}})
+	defer server.Close()
+
+	ws := dialKeepalive(t, server, 20*time.Millisecond, 50*time.Millisecond, 0)
+	defer ws.Close()
+
+	var msg string
+	err := Message.Receive(ws, &msg)
+	close(release)
+	e, ok := err.(*KeepaliveError)
+	if !ok {
+		t.Fatalf("expected KeepaliveError got %T %v", err, err)
+	}
+	if e.Reason != "pong timeout" || e.Status != closeStatusPolicyViolation || !e.Timeout() {
+		t.Error(e)
+	}
+	if code := <-status; code != closeStatusPolicyViolation {
+		t.Errorf("expected close status %d got %d", closeStatusPolicyViolation, code)
+	}
+	if _, err := ws.Read(make([]byte, 16)); !IsKeepaliveError(err) {
+		t.Errorf("expected KeepaliveError got %v", err)
+	}
+}
+
+func TestKeepaliveIdleTimeout(t *testing.T) {
+	errs := make(chan error, 1)
+	server := httptest.NewServer(Server{
+		Config: Config{IdleTimeout: 100 * time.Millisecond},
+		Handler: func(ws *Conn) {
+			defer ws.Close()
+			var msg string
+			if err := Message.Receive(ws, &msg); err != nil {
+				errs <- err
+				return
+			}
+			if err := Message.Send(ws, msg); err != nil {
+				errs <- err
+				return
+			}
+			errs <- Message.Receive(ws, &msg)
+		}})
+	defer server.Close()
+
+	ws := dialKeepalive(t, server, 0, 0, 0)
+	defer ws.Close()
+
+	// A received message restarts the idle timer.
+	time.Sleep(60 * time.Millisecond)
+	if err := Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var msg string
+	if err := Message.Receive(ws, &msg); err != nil || msg != "hello" {
+		t.Fatal(msg, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	select {
+	case err := <-errs:
+		t.Fatal("connection is closed too early,", err)
+	default:
+	}
+
+	code, err := readCloseStatus(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != closeStatusGoingAway {
+		t.Errorf("expected close status %d got %d", closeStatusGoingAway, code)
+	}
+	err = <-errs
+	if e, ok := err.(*KeepaliveError); !ok || e.Reason != "idle timeout" || e.Status != closeStatusGoingAway {
+		t.Errorf("expected KeepaliveError got %T %v", err, err)
+	}
+}
+
+func TestKeepaliveAlive(t *testing.T) {
+	server := httptest.NewServer(Server{Handler: func(ws *Conn) {
+		defer ws.Close()
+		io.Copy(ws, ws)
+	}})
+	defer server.Close()
+
+	ws := dialKeepalive(t, server, 20*time.Millisecond, 50*time.Millisecond, 100*time.Millisecond)
+	defer ws.Close()
+
+	messages := make(chan string, 10)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			var msg string
+			if err := Message.Receive(ws, &msg); err != nil {
+				errs <- err
+				return
+			}
+			messages <- msg
+		}
+	}()
+
+	// The peer answers pings, so the connection is not idle.
+	time.Sleep(300 * time.Millisecond)
+	if err := Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-messages:
+		if msg != "hello" {
+			t.Error("expected hello got", msg)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -101,6 +101,39 @@ type Config struct {
 	// Dialer used when opening websocket connections.
 	Dialer func(network, address string) (net.Conn, error)
 
+	// Compression enables the permessage-deflate extension if it is not nil.
+	Compression *CompressionOptions
+
+	// FragmentSize is the maximum payload size of a frame written by
+	// Conn.Write and Codec.Send, larger messages are split into continuation
+	// frames. If zero, a message is written as a single frame.
+	FragmentSize int
+
+	// MaxMessageSize limits the size of a message received over Conn,
+	// including all of its fragments and after decompression. If it is
+	// exceeded, the connection is closed with status 1009 and
+	// ErrFrameTooLarge is returned. If zero, there is no limit in Conn.Read
+	// and Codec's Receive method uses Conn.MaxPayloadBytes.
+	MaxMessageSize int
+
+	// PingInterval is the interval of ping frames sent by Conn. If zero,
+	// no ping is sent.
+	PingInterval time.Duration
+
+	// PongTimeout is how long Conn waits for the pong of a ping. If it is
+	// exceeded, the connection is closed with status 1008. If zero,
+	// PingInterval is used.
+	PongTimeout time.Duration
+
+	// IdleTimeout closes the connection with status 1001 if no frame is
+	// received in it. If zero, there is no idle timeout.
+	//
+	// Pongs and other frames are received only while Conn is being read, so
+	// the keepalive requires a goroutine which reads Conn. After the
+	// connection is closed by the keepalive, Conn.Read and Codec's Receive
+	// method return a *KeepaliveError.
+	IdleTimeout time.Duration
+
 	handshakeData map[string]string
 }
 
@@ -179,9 +212,16 @@ type Conn struct {
 	PayloadType        byte
 	defaultCloseStatus int
 
+	compression *deflateState
+	keepalive   *keepalive
+
 	// MaxPayloadBytes limits the size of frame payload received over Conn
 	// by Codec's Receive method. If zero, DefaultMaxPayloadBytes is used.
 	MaxPayloadBytes int
+
+	// receiveLimit is the limit of the message being received by Codec's
+	// Receive method, it is guarded by rio.
+	receiveLimit int
 }
 
 // Read implements the io.Reader interface:
@@ -196,11 +236,11 @@ again:
 	if ws.frameReader == nil {
 		frame, err := ws.frameReaderFactory.NewFrameReader()
 		if err != nil {
-			return 0, err
+			return 0, ws.keepaliveErr(err)
 		}
 		ws.frameReader, err = ws.frameHandler.HandleFrame(frame)
 		if err != nil {
-			return 0, err
+			return 0, ws.keepaliveErr(err)
 		}
 		if ws.frameReader == nil {
 			goto again
@@ -214,7 +254,7 @@ again:
 		ws.frameReader = nil
 		goto again
 	}
-	return n, err
+	return n, ws.keepaliveErr(err)
 }
 
 // Write implements the io.Writer interface:
@@ -222,17 +262,14 @@ again:
 func (ws *Conn) Write(msg []byte) (n int, err error) {
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
-	w, err := ws.frameWriterFactory.NewFrameWriter(ws.PayloadType)
-	if err != nil {
-		return 0, err
-	}
-	n, err = w.Write(msg)
-	w.Close()
-	return n, err
+	return ws.writeMessage(ws.PayloadType, msg)
 }
 
 // Close implements the io.Closer interface.
 func (ws *Conn) Close() error {
+	if ws.keepalive != nil {
+		ws.keepalive.stop()
+	}
 	err := ws.frameHandler.WriteClose(ws.defaultCloseStatus)
 	err1 := ws.rwc.Close()
 	if err != nil {
@@ -312,21 +349,17 @@ func (cd Codec) Send(ws *Conn, v interface{}) (err error) {
 	}
 	ws.wio.Lock()
 	defer ws.wio.Unlock()
-	w, err := ws.frameWriterFactory.NewFrameWriter(payloadType)
-	if err != nil {
-		return err
-	}
-	_, err = w.Write(data)
-	w.Close()
+	_, err = ws.writeMessage(payloadType, data)
 	return err
 }
 
-// Receive receives single frame from ws, unmarshaled by cd.Unmarshal and stores
-// in v. The whole frame payload is read to an in-memory buffer; max size of
-// payload is defined by ws.MaxPayloadBytes. If frame payload size exceeds
-// limit, ErrFrameTooLarge is returned; in this case frame is not read off wire
-// completely. The next call to Receive would read and discard leftover data of
-// previous oversized frame before processing next frame.
+// Receive receives single message from ws, unmarshaled by cd.Unmarshal and stores
+// in v. The whole message payload, including all of its fragments, is read to
+// an in-memory buffer; max size of payload is defined by ws.MaxPayloadBytes.
+// If frame payload size exceeds limit, ErrFrameTooLarge is returned; in this
+// case frame is not read off wire completely. The next call to Receive would
+// read and discard leftover data of previous oversized frame before processing
+// next frame.
 func (cd Codec) Receive(ws *Conn, v interface{}) (err error) {
 	ws.rio.Lock()
 	defer ws.rio.Unlock()
@@ -337,22 +370,24 @@ func (cd Codec) Receive(ws *Conn, v interface{}) (err error) {
 		}
 		ws.frameReader = nil
 	}
+	maxPayloadBytes := ws.MaxPayloadBytes
+	if maxPayloadBytes == 0 {
+		maxPayloadBytes = DefaultMaxPayloadBytes
+	}
+	ws.receiveLimit = maxPayloadBytes
+	defer func() { ws.receiveLimit = 0 }()
 again:
 	frame, err := ws.frameReaderFactory.NewFrameReader()
 	if err != nil {
-		return err
+		return ws.keepaliveErr(err)
 	}
 	frame, err = ws.frameHandler.HandleFrame(frame)
 	if err != nil {
-		return err
+		return ws.keepaliveErr(err)
 	}
 	if frame == nil {
 		goto again
 	}
-	maxPayloadBytes := ws.MaxPayloadBytes
-	if maxPayloadBytes == 0 {
-		maxPayloadBytes = DefaultMaxPayloadBytes
-	}
 	if hf, ok := frame.(*hybiFrameReader); ok && hf.header.Length > int64(maxPayloadBytes) {
 		// payload size exceeds limit, no need to call Unmarshal
 		//
@@ -363,9 +398,9 @@ again:
 		return ErrFrameTooLarge
 	}
 	payloadType := frame.PayloadType()
-	data, err := ioutil.ReadAll(frame)
+	data, err := ws.readFragments(frame, maxPayloadBytes)
 	if err != nil {
-		return err
+		return ws.keepaliveErr(err)
 	}
 	return cd.Unmarshal(data, payloadType, v)
 }
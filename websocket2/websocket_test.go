@@ -361,9 +361,9 @@ func TestDialConfigBadVersion(t *testing.T) {
 func TestDialConfigWithDialer(t *testing.T) {
 	once.Do(startServer)
 	config := newConfig(t, "/echo")
-	config.Dialer = &net.Dialer{
+	config.Dialer = (&net.Dialer{
 		Deadline: time.Now().Add(-time.Minute),
-	}
+	}).Dial
 	_, err := DialConfig(config)
 	dialerr, ok := err.(*DialError)
 	if !ok {
@@ -0,0 +1,160 @@
+package zipfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeka/zip"
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// Options 打开 zip 文件的选项
+type Options struct {
+	// Password 是加密的条目的密码，为空时不能读取加密的条目
+	Password string
+}
+
+func setPassword(files []*zip.File, password string) {
+	if password == "" {
+		return
+	}
+	for _, f := range files {
+		if f.IsEncrypted() {
+			f.SetPassword(password)
+		}
+	}
+}
+
+// zipIndex 是中央目录的索引
+type zipIndex struct {
+	files map[string]*zip.File // 文件的路径，不以 '/' 开头
+	dirs  map[string][]zipFI   // 目录和它下面的条目，按名称排序，根目录为 ""
+}
+
+func newZipIndex(files []*zip.File) *zipIndex {
+	list := make(zipList, len(files))
+	copy(list, files) // sort a copy of rc.File
+	sort.Sort(list)
+
+	index := &zipIndex{
+		files: map[string]*zip.File{},
+		dirs:  map[string][]zipFI{"": nil},
+	}
+	seen := map[string]bool{}
+	for _, f := range list {
+		name := strings.TrimSuffix(f.Name, "/")
+		if name == "" {
+			continue
+		}
+
+		var file *zip.File
+		if !strings.HasSuffix(f.Name, "/") {
+			file = f
+			index.files[name] = f
+		}
+
+		// 将条目和它的上级目录都加到所在的目录中，
+		// 因为是排序过的，所以同名的文件和目录中只有文件会被加入
+		for !seen[name] {
+			seen[name] = true
+			if file == nil {
+				if _, ok := index.dirs[name]; !ok {
+					index.dirs[name] = nil
+				}
+			}
+
+			dir, base := path.Split(name)
+			dir = strings.TrimSuffix(dir, "/")
+			index.dirs[dir] = append(index.dirs[dir], zipFI{base, file})
+			if dir == "" {
+				break
+			}
+			name, file = dir, nil
+		}
+	}
+
+	for _, children := range index.dirs {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+	}
+	return index
+}
+
+type archiveKey struct {
+	filename string
+	size     int64
+	modTime  time.Time
+	password string
+}
+
+type archive struct {
+	rc    *zip.ReadCloser
+	index *zipIndex
+	refs  int
+}
+
+var archives = struct {
+	lock  sync.Mutex
+	cache map[archiveKey]*archive
+}{cache: map[archiveKey]*archive{}}
+
+// FileSystem 是可以关闭的 vfs.FileSystem
+type FileSystem interface {
+	vfs.FileSystem
+	io.Closer
+}
+
+// Open 打开一个 zip 文件，同一个 zip 文件在关闭前被多次打开时共享中央目录和它的索引，
+// 文件的大小或修改时间变化后会重新读取
+func Open(filename string, opts Options) (FileSystem, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	key := archiveKey{filename: filename, size: st.Size(), modTime: st.ModTime(), password: opts.Password}
+
+	archives.lock.Lock()
+	defer archives.lock.Unlock()
+
+	a := archives.cache[key]
+	if a == nil {
+		rc, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		setPassword(rc.File, opts.Password)
+		a = &archive{rc: rc, index: newZipIndex(rc.File)}
+		archives.cache[key] = a
+	}
+	a.refs++
+
+	return &zipFS{
+		ReadCloser: a.rc,
+		index:      a.index,
+		name:       filename,
+		release: func() error {
+			archives.lock.Lock()
+			defer archives.lock.Unlock()
+
+			a.refs--
+			if a.refs > 0 {
+				return nil
+			}
+			if archives.cache[key] == a {
+				delete(archives.cache, key)
+			}
+			return a.rc.Close()
+		},
+	}, nil
+}
@@ -0,0 +1,112 @@
+package zipfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// HTTP 将 vfs.FileSystem 转换成 http.FileSystem，以便用 http.FileServer 提供 zip 中的 web 资源
+func HTTP(fs vfs.FileSystem) http.FileSystem {
+	return httpFS{fs: fs}
+}
+
+type httpFS struct {
+	fs vfs.FileSystem
+}
+
+func (h httpFS) Open(name string) (http.File, error) {
+	return openFile(h.fs, path.Clean("/"+name))
+}
+
+func openFile(fs vfs.FileSystem, abspath string) (*file, error) {
+	fi, err := fs.Stat(abspath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return &file{fs: fs, name: abspath, fi: fi}, nil
+	}
+	r, err := fs.Open(abspath)
+	if err != nil {
+		return nil, err
+	}
+	return &file{fs: fs, name: abspath, fi: fi, r: r}, nil
+}
+
+// file 是 http.File 的实现，r 为 nil 时它是一个目录
+type file struct {
+	fs   vfs.FileSystem
+	name string
+	fi   os.FileInfo
+	r    vfs.ReadSeekCloser
+
+	children []os.FileInfo
+	loaded   bool
+	pos      int
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.r == nil {
+		return 0, fmt.Errorf("Read: %s is a directory", f.name)
+	}
+	return f.r.Read(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.r == nil {
+		if offset == 0 && whence == io.SeekStart {
+			f.pos = 0
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Seek: %s is a directory", f.name)
+	}
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	return f.r.Close()
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *file) readDir(count int) ([]os.FileInfo, error) {
+	if f.r != nil {
+		return nil, fmt.Errorf("Readdir: %s is not a directory", f.name)
+	}
+	if !f.loaded {
+		children, err := f.fs.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.children = children
+		f.loaded = true
+	}
+
+	rest := f.children[f.pos:]
+	if count <= 0 {
+		f.pos = len(f.children)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	f.pos += count
+	return rest[:count], nil
+}
+
+func (f *file) Readdir(count int) ([]os.FileInfo, error) {
+	return f.readDir(count)
+}
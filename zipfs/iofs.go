@@ -0,0 +1,108 @@
+//go:build go1.16
+// +build go1.16
+
+package zipfs
+
+import (
+	iofs "io/fs"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// FS 将 vfs.FileSystem 转换成 io/fs.FS，它同时实现了 fs.StatFS 和 fs.ReadDirFS
+func FS(fsys vfs.FileSystem) iofs.FS {
+	return ioFS{fs: fsys}
+}
+
+type ioFS struct {
+	fs vfs.FileSystem
+}
+
+func toAbsPath(op, name string) (string, error) {
+	if !iofs.ValidPath(name) {
+		return "", &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+func (f ioFS) Open(name string) (iofs.File, error) {
+	abspath, err := toAbsPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openFile(f.fs, abspath)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: toFSError(err)}
+	}
+	return file, nil
+}
+
+func (f ioFS) Stat(name string) (iofs.FileInfo, error) {
+	abspath, err := toAbsPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.fs.Stat(abspath)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: toFSError(err)}
+	}
+	return fi, nil
+}
+
+func (f ioFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	abspath, err := toAbsPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	children, err := f.fs.ReadDir(abspath)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: toFSError(err)}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+	return toDirEntries(children), nil
+}
+
+// toFSError 将错误转换成 fs 中定义的错误，以便 errors.Is 能识别它们
+func toFSError(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return iofs.ErrNotExist
+	case os.IsPermission(err):
+		return iofs.ErrPermission
+	default:
+		return err
+	}
+}
+
+// ReadDir 实现了 fs.ReadDirFile
+func (f *file) ReadDir(count int) ([]iofs.DirEntry, error) {
+	children, err := f.readDir(count)
+	if err != nil {
+		return nil, err
+	}
+	return toDirEntries(children), nil
+}
+
+func toDirEntries(children []os.FileInfo) []iofs.DirEntry {
+	entries := make([]iofs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, dirEntry{child})
+	}
+	return entries
+}
+
+type dirEntry struct {
+	fi os.FileInfo
+}
+
+func (e dirEntry) Name() string                 { return e.fi.Name() }
+func (e dirEntry) IsDir() bool                  { return e.fi.IsDir() }
+func (e dirEntry) Type() iofs.FileMode          { return e.fi.Mode().Type() }
+func (e dirEntry) Info() (iofs.FileInfo, error) { return e.fi, nil }
@@ -0,0 +1,40 @@
+//go:build go1.16
+// +build go1.16
+
+package zipfs
+
+import (
+	"errors"
+	iofs "io/fs"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIOFS(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "zipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	u := setupUnion(t, tmp)
+	defer u.Close()
+
+	fsys := FS(u)
+	if err := fstest.TestFS(fsys, "index.html", "secret.txt", "js/a.js", "js/b.js", "js/c.js", "css/x.css"); err != nil {
+		t.Error(err)
+	}
+
+	bs, err := iofs.ReadFile(fsys, "index.html")
+	if err != nil || string(bs) != "plugin" {
+		t.Error("index.html is", string(bs), err)
+	}
+	if _, err := fsys.Open("not_exists"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Error("error is", err)
+	}
+	if _, err := fsys.Open("/index.html"); !errors.Is(err, iofs.ErrInvalid) {
+		t.Error("error is", err)
+	}
+}
@@ -0,0 +1,212 @@
+package zipfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// ErrReadOnly 在没有可写的目录时写入文件
+var ErrReadOnly = errors.New("read-only file system")
+
+// Union 将多个文件系统合并成一个，前面的文件系统优先，如插件的 zip 文件覆盖基础的 zip 文件，
+// 同一个路径在多个文件系统中都是目录时，ReadDir 返回它们合并后的内容。
+// 有可写的目录时它是最上层，所有的写操作都在这个目录中进行，下层的文件系统不会被修改
+type Union struct {
+	overlay string
+	layers  []vfs.FileSystem
+}
+
+// NewUnion 创建一个只读的 Union，前面的文件系统优先，OS 中的目录可以用 vfs.OS 创建
+func NewUnion(layers ...vfs.FileSystem) *Union {
+	return &Union{layers: layers}
+}
+
+// NewOverlay 创建一个以目录 dir 为可写的最上层的 Union
+func NewOverlay(dir string, layers ...vfs.FileSystem) *Union {
+	return &Union{
+		overlay: dir,
+		layers:  append([]vfs.FileSystem{vfs.OS(dir)}, layers...),
+	}
+}
+
+func (u *Union) String() string {
+	names := make([]string, 0, len(u.layers))
+	for _, layer := range u.layers {
+		names = append(names, layer.String())
+	}
+	return "union(" + strings.Join(names, ", ") + ")"
+}
+
+func (u *Union) RootType(abspath string) vfs.RootType {
+	for _, layer := range u.layers {
+		if t := layer.RootType(abspath); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+func (u *Union) stat(abspath string, lstat bool) (vfs.FileSystem, os.FileInfo, error) {
+	for _, layer := range u.layers {
+		var fi os.FileInfo
+		var err error
+		if lstat {
+			fi, err = layer.Lstat(abspath)
+		} else {
+			fi, err = layer.Stat(abspath)
+		}
+		if err == nil {
+			return layer, fi, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, &os.PathError{Op: "stat", Path: abspath, Err: os.ErrNotExist}
+}
+
+func (u *Union) Open(abspath string) (vfs.ReadSeekCloser, error) {
+	layer, fi, err := u.stat(abspath, false)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("Open: %s is a directory", abspath)
+	}
+	return layer.Open(abspath)
+}
+
+func (u *Union) Lstat(abspath string) (os.FileInfo, error) {
+	_, fi, err := u.stat(abspath, true)
+	return fi, err
+}
+
+func (u *Union) Stat(abspath string) (os.FileInfo, error) {
+	_, fi, err := u.stat(abspath, false)
+	return fi, err
+}
+
+// ReadDir 合并所有文件系统中的这个目录，同名的条目以前面的文件系统为准
+func (u *Union) ReadDir(abspath string) ([]os.FileInfo, error) {
+	var list []os.FileInfo
+	var found bool
+	seen := map[string]bool{}
+	for _, layer := range u.layers {
+		fi, err := layer.Stat(abspath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !fi.IsDir() {
+			if !found {
+				return nil, fmt.Errorf("ReadDir: %s is not a directory", abspath)
+			}
+			// 被上层的目录遮住了
+			continue
+		}
+		found = true
+
+		children, err := layer.ReadDir(abspath)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if !seen[child.Name()] {
+				seen[child.Name()] = true
+				list = append(list, child)
+			}
+		}
+	}
+	if !found {
+		return nil, &os.PathError{Op: "readdir", Path: abspath, Err: os.ErrNotExist}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list, nil
+}
+
+// Close 关闭所有实现了 io.Closer 的文件系统
+func (u *Union) Close() error {
+	var err error
+	for _, layer := range u.layers {
+		if closer, ok := layer.(io.Closer); ok {
+			if e := closer.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (u *Union) overlayPath(op, abspath string) (string, error) {
+	if u.overlay == "" {
+		return "", &os.PathError{Op: op, Path: abspath, Err: ErrReadOnly}
+	}
+	abspath = path.Clean(abspath)
+	if !path.IsAbs(abspath) {
+		return "", fmt.Errorf("%s: not an absolute path: %s", op, abspath)
+	}
+	return filepath.Join(u.overlay, filepath.FromSlash(abspath)), nil
+}
+
+// Create 在可写的目录中创建或覆盖一个文件，它的上级目录不存在时会自动创建
+func (u *Union) Create(abspath string) (io.WriteCloser, error) {
+	name, err := u.overlayPath("create", abspath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
+
+// WriteFile 在可写的目录中写入一个文件，它的上级目录不存在时会自动创建
+func (u *Union) WriteFile(abspath string, data []byte, perm os.FileMode) error {
+	name, err := u.overlayPath("write", abspath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// MkdirAll 在可写的目录中创建目录
+func (u *Union) MkdirAll(abspath string, perm os.FileMode) error {
+	name, err := u.overlayPath("mkdir", abspath)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(name, perm)
+}
+
+// Remove 删除可写的目录中的文件或空目录，只存在于下层的文件系统中的文件不能删除，
+// 删除后下层的文件系统中的同名文件会重新可见
+func (u *Union) Remove(abspath string) error {
+	name, err := u.overlayPath("remove", abspath)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if err != nil && os.IsNotExist(err) {
+		if _, e := u.Stat(abspath); e == nil {
+			return &os.PathError{Op: "remove", Path: abspath, Err: ErrReadOnly}
+		}
+	}
+	return err
+}
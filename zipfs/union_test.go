@@ -0,0 +1,282 @@
+package zipfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yeka/zip"
+	"golang.org/x/tools/godoc/vfs"
+)
+
+func writeZip(t *testing.T, filename string, files map[string]string, encrypted map[string]string, password string) {
+	b := new(bytes.Buffer)
+	zw := zip.NewWriter(b)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, contents)
+	}
+	for name, contents := range encrypted {
+		w, err := zw.Encrypt(name, password, zip.AES256Encryption)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, contents)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readString(t *testing.T, fs vfs.Opener, abspath string) string {
+	bs, err := vfs.ReadFile(fs, abspath)
+	if err != nil {
+		t.Error(abspath, err)
+		return ""
+	}
+	return string(bs)
+}
+
+func readDirNames(t *testing.T, fs vfs.FileSystem, abspath string) []string {
+	list, err := fs.ReadDir(abspath)
+	if err != nil {
+		t.Error(abspath, err)
+		return nil
+	}
+	var names []string
+	for _, fi := range list {
+		names = append(names, fi.Name())
+	}
+	return names
+}
+
+func setupUnion(t *testing.T, tmp string) *Union {
+	writeZip(t, filepath.Join(tmp, "base.zip"), map[string]string{
+		"index.html": "base",
+		"js/a.js":    "a",
+		"css/x.css":  "x",
+	}, nil, "")
+	writeZip(t, filepath.Join(tmp, "plugin.zip"), map[string]string{
+		"index.html": "plugin",
+		"js/b.js":    "b",
+	}, map[string]string{"secret.txt": "secret"}, "123")
+
+	if err := os.MkdirAll(filepath.Join(tmp, "dir", "js"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, "dir", "js", "c.js"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin, err := Open(filepath.Join(tmp, "plugin.zip"), Options{Password: "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := Open(filepath.Join(tmp, "base.zip"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOverlay(filepath.Join(tmp, "overlay"), plugin, vfs.OS(filepath.Join(tmp, "dir")), base)
+}
+
+func TestUnion(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "zipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	u := setupUnion(t, tmp)
+	defer u.Close()
+
+	if s := readString(t, u, "/index.html"); s != "plugin" {
+		t.Error("index.html is", s)
+	}
+	if s := readString(t, u, "/css/x.css"); s != "x" {
+		t.Error("x.css is", s)
+	}
+	if s := readString(t, u, "/secret.txt"); s != "secret" {
+		t.Error("secret.txt is", s)
+	}
+	if names := readDirNames(t, u, "/js"); !reflect.DeepEqual(names, []string{"a.js", "b.js", "c.js"}) {
+		t.Error("js is", names)
+	}
+	if names := readDirNames(t, u, "/"); !reflect.DeepEqual(names, []string{"css", "index.html", "js", "secret.txt"}) {
+		t.Error("root is", names)
+	}
+	if _, err := u.Stat("/not_exists"); !os.IsNotExist(err) {
+		t.Error("error is", err)
+	}
+	if _, err := u.Open("/js"); err == nil {
+		t.Error("open a directory")
+	}
+
+	// 写入的文件在最上层
+	if err := u.WriteFile("/index.html", []byte("overlay"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s := readString(t, u, "/index.html"); s != "overlay" {
+		t.Error("index.html is", s)
+	}
+	if err := u.Remove("/index.html"); err != nil {
+		t.Error(err)
+	}
+	if s := readString(t, u, "/index.html"); s != "plugin" {
+		t.Error("index.html is", s)
+	}
+	if err := u.Remove("/index.html"); err == nil || !os.IsNotExist(err) && err.(*os.PathError).Err != ErrReadOnly {
+		t.Error("error is", err)
+	}
+
+	if err := NewUnion(u).WriteFile("/a.txt", []byte("abc"), 0644); err == nil || err.(*os.PathError).Err != ErrReadOnly {
+		t.Error("error is", err)
+	}
+}
+
+func TestOpenCached(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "zipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "a.zip")
+	writeZip(t, filename, map[string]string{"a/b/c": "c", "a/d": "d"}, map[string]string{"e": "e"}, "123")
+
+	fs1, err := Open(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs2, err := Open(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs1.(*zipFS).index != fs2.(*zipFS).index {
+		t.Error("central directory isn't cached")
+	}
+	if names := readDirNames(t, fs2, "/a"); !reflect.DeepEqual(names, []string{"b", "d"}) {
+		t.Error("a is", names)
+	}
+
+	// 没有密码时不能读加密的条目
+	if _, err := fs1.Open("/e"); err == nil {
+		t.Error("encrypted entry is opened without password")
+	}
+
+	fs1.Close()
+	fs1.Close()
+	if s := readString(t, fs2, "/a/b/c"); s != "c" {
+		t.Error("c is", s)
+	}
+	fs2.Close()
+
+	archives.lock.Lock()
+	count := len(archives.cache)
+	archives.lock.Unlock()
+	if count != 0 {
+		t.Error("cache isn't released -", count)
+	}
+}
+
+func TestZipSeek(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "zipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "a.zip")
+	writeZip(t, filename, map[string]string{"a": "0123456789"}, nil, "")
+	fs, err := Open(filename, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if n, err := f.Seek(0, io.SeekEnd); err != nil || n != 10 {
+		t.Error("seek end is", n, err)
+	}
+	buf := make([]byte, 3)
+	for _, test := range []struct {
+		offset   int64
+		whence   int
+		excepted string
+	}{
+		{5, io.SeekStart, "567"},
+		{-6, io.SeekCurrent, "234"},
+		{-2, io.SeekEnd, "89"},
+		{0, io.SeekStart, "012"},
+	} {
+		if _, err := f.Seek(test.offset, test.whence); err != nil {
+			t.Error(err)
+			continue
+		}
+		n, _ := io.ReadFull(f, buf)
+		if s := string(buf[:n]); s != test.excepted {
+			t.Error("excepted is", test.excepted, "actual is", s)
+		}
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seek to negative position")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "zipfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	u := setupUnion(t, tmp)
+	defer u.Close()
+
+	srv := httptest.NewServer(http.FileServer(HTTP(u)))
+	defer srv.Close()
+
+	get := func(u string, header map[string]string) (int, string) {
+		req, _ := http.NewRequest("GET", srv.URL+u, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(bs)
+	}
+
+	if code, body := get("/js/b.js", nil); code != http.StatusOK || body != "b" {
+		t.Error(code, body)
+	}
+	if code, body := get("/index.html", map[string]string{"Range": "bytes=2-4"}); code != http.StatusPartialContent || body != "ugi" {
+		t.Error(code, body)
+	}
+	if code, body := get("/js/", nil); code != http.StatusOK ||
+		!bytes.Contains([]byte(body), []byte("a.js")) || !bytes.Contains([]byte(body), []byte("c.js")) {
+		t.Error(code, body)
+	}
+	if code, _ := get("/not_exists", nil); code != http.StatusNotFound {
+		t.Error(code)
+	}
+}
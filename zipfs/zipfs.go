@@ -21,11 +21,11 @@ import (
 	"fmt"
 	"go/build"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/yeka/zip"
@@ -75,8 +75,11 @@ func (fi zipFI) Sys() interface{} {
 // zipFS is the zip-file based implementation of FileSystem
 type zipFS struct {
 	*zip.ReadCloser
-	list zipList
-	name string
+	index *zipIndex
+	name  string
+
+	closeOnce sync.Once
+	release   func() error // 不为 nil 时它是缓存中的 zip 文件，关闭时只减少引用计数
 }
 
 func (fs *zipFS) String() string {
@@ -109,8 +112,15 @@ func exists(path string) bool {
 }
 
 func (fs *zipFS) Close() error {
-	fs.list = nil
-	return fs.ReadCloser.Close()
+	var err error
+	fs.closeOnce.Do(func() {
+		if fs.release != nil {
+			err = fs.release()
+		} else {
+			err = fs.ReadCloser.Close()
+		}
+	})
+	return err
 }
 
 func zipPath(name string) (string, error) {
@@ -125,32 +135,30 @@ func isRoot(abspath string) bool {
 	return path.Clean(abspath) == "/"
 }
 
-func (fs *zipFS) stat(abspath string) (int, zipFI, error) {
+func (fs *zipFS) stat(abspath string) (zipFI, error) {
 	if isRoot(abspath) {
-		return 0, zipFI{
+		return zipFI{
 			name: "",
 			file: nil,
 		}, nil
 	}
 	zippath, err := zipPath(abspath)
 	if err != nil {
-		return 0, zipFI{}, err
-	}
-	i, exact := fs.list.lookup(zippath)
-	if i < 0 {
-		// zippath has leading '/' stripped - print it explicitly
-		return -1, zipFI{}, &os.PathError{Path: "/" + zippath, Err: os.ErrNotExist}
+		return zipFI{}, err
 	}
 	_, name := path.Split(zippath)
-	var file *zip.File
-	if exact {
-		file = fs.list[i] // exact match found - must be a file
+	if file, ok := fs.index.files[zippath]; ok {
+		return zipFI{name, file}, nil
 	}
-	return i, zipFI{name, file}, nil
+	if _, ok := fs.index.dirs[zippath]; ok {
+		return zipFI{name, nil}, nil
+	}
+	// zippath has leading '/' stripped - print it explicitly
+	return zipFI{}, &os.PathError{Op: "stat", Path: "/" + zippath, Err: os.ErrNotExist}
 }
 
 func (fs *zipFS) Open(abspath string) (vfs.ReadSeekCloser, error) {
-	_, fi, err := fs.stat(abspath)
+	fi, err := fs.stat(abspath)
 	if err != nil {
 		return nil, err
 	}
@@ -161,39 +169,71 @@ func (fs *zipFS) Open(abspath string) (vfs.ReadSeekCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &zipSeek{fi.file, r}, nil
+	return &zipSeek{file: fi.file, ReadCloser: r}, nil
 }
 
+// zipSeek 支持任意的 Seek，它只记下要移动到的位置，读的时候才移动过去，
+// 向前移动时跳过中间的数据，向后移动时重新打开条目
 type zipSeek struct {
 	file *zip.File
 	io.ReadCloser
+	pos    int64 // 已读到的位置
+	offset int64 // Seek 指定的位置
 }
 
-func (f *zipSeek) Seek(offset int64, whence int) (int64, error) {
-	if whence == 0 && offset == 0 {
-		r, err := f.file.Open()
+func (f *zipSeek) Read(p []byte) (int, error) {
+	if f.offset != f.pos {
+		if f.offset < f.pos {
+			r, err := f.file.Open()
+			if err != nil {
+				return 0, err
+			}
+			f.ReadCloser.Close()
+			f.ReadCloser = r
+			f.pos = 0
+		}
+		n, err := io.CopyN(ioutil.Discard, f.ReadCloser, f.offset-f.pos)
+		f.pos += n
 		if err != nil {
 			return 0, err
 		}
-		f.Close()
-		f.ReadCloser = r
-		return 0, nil
 	}
-	return 0, fmt.Errorf("unsupported Seek in %s", f.file.Name)
+
+	n, err := f.ReadCloser.Read(p)
+	f.pos += int64(n)
+	f.offset = f.pos
+	return n, err
+}
+
+func (f *zipSeek) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(f.file.UncompressedSize64)
+	default:
+		return 0, fmt.Errorf("Seek: invalid whence %d in %s", whence, f.file.Name)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Seek: negative position in %s", f.file.Name)
+	}
+	f.offset = offset
+	return offset, nil
 }
 
 func (fs *zipFS) Lstat(abspath string) (os.FileInfo, error) {
-	_, fi, err := fs.stat(abspath)
+	fi, err := fs.stat(abspath)
 	return fi, err
 }
 
 func (fs *zipFS) Stat(abspath string) (os.FileInfo, error) {
-	_, fi, err := fs.stat(abspath)
+	fi, err := fs.stat(abspath)
 	return fi, err
 }
 
 func (fs *zipFS) ReadDir(abspath string) ([]os.FileInfo, error) {
-	i, fi, err := fs.stat(abspath)
+	fi, err := fs.stat(abspath)
 	if err != nil {
 		return nil, err
 	}
@@ -201,53 +241,32 @@ func (fs *zipFS) ReadDir(abspath string) ([]os.FileInfo, error) {
 		return nil, fmt.Errorf("ReadDir: %s is not a directory", abspath)
 	}
 
-	var list []os.FileInfo
-
-	// make dirname the prefix that file names must start with to be considered
-	// in this directory. we must special case the root directory because, per
-	// the spec of this package, zip file entries MUST NOT start with /, so we
-	// should not append /, as we would in every other case.
 	var dirname string
-	if isRoot(abspath) {
-		dirname = ""
-	} else {
-		zippath, err := zipPath(abspath)
+	if !isRoot(abspath) {
+		dirname, err = zipPath(abspath)
 		if err != nil {
 			return nil, err
 		}
-		dirname = zippath + "/"
-	}
-	prevname := ""
-	for _, e := range fs.list[i:] {
-		if !strings.HasPrefix(e.Name, dirname) {
-			break // not in the same directory anymore
-		}
-		name := e.Name[len(dirname):] // local name
-		file := e
-		if i := strings.IndexRune(name, '/'); i >= 0 {
-			// We infer directories from files in subdirectories.
-			// If we have x/y, return a directory entry for x.
-			name = name[0:i] // keep local directory name only
-			file = nil
-		}
-		// If we have x/y and x/z, don't return two directory entries for x.
-		// TODO(gri): It should be possible to do this more efficiently
-		// by determining the (fs.list) range of local directory entries
-		// (via two binary searches).
-		if name != prevname {
-			list = append(list, zipFI{name, file})
-			prevname = name
-		}
 	}
 
+	children := fs.index.dirs[dirname]
+	list := make([]os.FileInfo, 0, len(children))
+	for _, child := range children {
+		list = append(list, child)
+	}
 	return list, nil
 }
 
+// New 创建一个 zip 文件的文件系统
 func New(rc *zip.ReadCloser, name string) vfs.FileSystem {
-	list := make(zipList, len(rc.File))
-	copy(list, rc.File) // sort a copy of rc.File
-	sort.Sort(list)
-	return &zipFS{rc, list, name}
+	return NewWithOptions(rc, name, Options{})
+}
+
+// NewWithOptions 创建一个 zip 文件的文件系统，它在创建时为中央目录建立索引，
+// 所以 Stat 和 ReadDir 不用再遍历所有的条目
+func NewWithOptions(rc *zip.ReadCloser, name string, opts Options) vfs.FileSystem {
+	setPassword(rc.File, opts.Password)
+	return &zipFS{ReadCloser: rc, index: newZipIndex(rc.File), name: name}
 }
 
 type zipList []*zip.File
@@ -256,36 +275,3 @@ type zipList []*zip.File
 func (z zipList) Len() int           { return len(z) }
 func (z zipList) Less(i, j int) bool { return z[i].Name < z[j].Name }
 func (z zipList) Swap(i, j int)      { z[i], z[j] = z[j], z[i] }
-
-// lookup returns the smallest index of an entry with an exact match
-// for name, or an inexact match starting with name/. If there is no
-// such entry, the result is -1, false.
-func (z zipList) lookup(name string) (index int, exact bool) {
-	// look for exact match first (name comes before name/ in z)
-	i := sort.Search(len(z), func(i int) bool {
-		return name <= z[i].Name
-	})
-	if i >= len(z) {
-		return -1, false
-	}
-	// 0 <= i < len(z)
-	if z[i].Name == name {
-		return i, true
-	}
-
-	// look for inexact match (must be in z[i:], if present)
-	z = z[i:]
-	name += "/"
-	j := sort.Search(len(z), func(i int) bool {
-		return name <= z[i].Name
-	})
-	if j >= len(z) {
-		return -1, false
-	}
-	// 0 <= j < len(z)
-	if strings.HasPrefix(z[j].Name, name) {
-		return i + j, false
-	}
-
-	return -1, false
-}